@@ -1,7 +1,9 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/base64"
 	"encoding/json"
@@ -27,6 +29,10 @@ import (
 	"github.com/openchat/openchat-backend/internal/rtc"
 )
 
+// eventTransmitStop asks the joiner to abort its current transmission while
+// staying connected. Typing "stop" on stdin does the same.
+const eventTransmitStop rtc.EventType = "rtc.transmit.stop"
+
 type options struct {
 	backendURL    string
 	serverID      string
@@ -38,6 +44,7 @@ type options struct {
 	userUID       string
 	deviceID      string
 	chunkBytes    int
+	compress      bool
 	interval      time.Duration
 	loop          bool
 	exitAfterSend bool
@@ -113,7 +120,7 @@ func main() {
 	shutdown := func(trigger string) {
 		shutdownOnce.Do(func() {
 			logger.Info("shutdown requested", "trigger", trigger)
-			_ = send(rtc.NewEnvelope("rtc.leave", opts.channelID, "leave_"+uuid.NewString()[:8], map[string]any{
+			_ = send(rtc.NewEnvelope(rtc.EventLeave, opts.channelID, "leave_"+uuid.NewString()[:8], map[string]any{
 				"reason": trigger,
 			}))
 			_ = conn.Close()
@@ -126,8 +133,9 @@ func main() {
 		shutdown("signal")
 	}()
 
-	if err := send(rtc.NewEnvelope("rtc.join", join.ChannelID, "join_"+uuid.NewString()[:8], map[string]any{
-		"ticket": join.Ticket,
+	if err := send(rtc.NewEnvelope(rtc.EventJoin, join.ChannelID, "join_"+uuid.NewString()[:8], map[string]any{
+		"ticket":    join.Ticket,
+		"device_id": join.DeviceID,
 	})); err != nil {
 		logger.Error("failed to send rtc.join", "error", err)
 		os.Exit(1)
@@ -150,28 +158,60 @@ func main() {
 	received := make(map[string]*receivedStream)
 	selfParticipantID := ""
 	sendStarted := false
+	var transmitMu sync.Mutex
+	var cancelTransmit context.CancelFunc
+	stopTransmit := func(trigger string) {
+		transmitMu.Lock()
+		cancel := cancelTransmit
+		cancelTransmit = nil
+		transmitMu.Unlock()
+		if cancel == nil {
+			logger.Info("no media transmission in progress", "trigger", trigger)
+			return
+		}
+		logger.Info("stopping media transmission", "trigger", trigger)
+		cancel()
+	}
 	startTransmit := func(trigger string) {
 		if sendStarted || opts.filePath == "" {
 			return
 		}
 		sendStarted = true
+		transmitCtx, cancel := context.WithCancel(ctx)
+		transmitMu.Lock()
+		cancelTransmit = cancel
+		transmitMu.Unlock()
 		logger.Info("starting media transmission", "trigger", trigger, "media_mode", opts.mediaMode, "loop", opts.loop)
 		go func() {
 			var transmitErr error
 			if opts.mediaMode == "pcm-frames" {
-				transmitErr = transmitPCMFrames(ctx, logger, send, opts, streamID)
+				transmitErr = transmitPCMFrames(transmitCtx, logger, send, opts, streamID)
 			} else {
-				transmitErr = transmitAudioState(ctx, logger, send, opts, streamID, streamBytes)
+				transmitErr = transmitAudioState(transmitCtx, logger, send, opts, streamID, streamBytes)
 			}
+			stoppedByControl := transmitCtx.Err() != nil && ctx.Err() == nil
+			transmitMu.Lock()
+			cancelTransmit = nil
+			transmitMu.Unlock()
+			cancel()
 			if transmitErr != nil {
 				logger.Error("transmit failed", "error", transmitErr)
 			}
-			if opts.exitAfterSend {
+			if opts.exitAfterSend && !stoppedByControl {
 				stop()
 			}
 		}()
 	}
 
+	go func() {
+		scanner := bufio.NewScanner(os.Stdin)
+		for scanner.Scan() {
+			if strings.EqualFold(strings.TrimSpace(scanner.Text()), "stop") {
+				stopTransmit("stdin")
+			}
+		}
+	}()
+
 	for {
 		var envelope rtc.Envelope
 		_ = conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -189,7 +229,7 @@ func main() {
 		}
 
 		switch envelope.Type {
-		case "rtc.joined":
+		case rtc.EventJoined:
 			var payload struct {
 				ParticipantID string `json:"participant_id"`
 				Participants  []struct {
@@ -211,7 +251,7 @@ func main() {
 			} else if opts.filePath != "" {
 				logger.Info("waiting for first listener before starting media transmission")
 			}
-		case "rtc.participant.joined":
+		case rtc.EventParticipantJoined:
 			var payload struct {
 				Participant struct {
 					ParticipantID string `json:"participant_id"`
@@ -226,7 +266,7 @@ func main() {
 			if payload.Participant.ParticipantID != "" && payload.Participant.ParticipantID != selfParticipantID {
 				startTransmit("rtc.participant.joined")
 			}
-		case "rtc.participant.left":
+		case rtc.EventParticipantLeft:
 			var payload struct {
 				Participant struct {
 					ParticipantID string `json:"participant_id"`
@@ -238,7 +278,7 @@ func main() {
 				continue
 			}
 			logger.Info("participant left", "participant_id", payload.Participant.ParticipantID, "user_uid", payload.Participant.UserUID)
-		case "rtc.media.state":
+		case rtc.EventMediaState:
 			if len(envelope.Payload) == 0 {
 				continue
 			}
@@ -252,9 +292,11 @@ func main() {
 				continue
 			}
 			handleIncomingMediaState(logger, received, payload, opts.writeDir)
-		case "rtc.error":
+		case eventTransmitStop:
+			stopTransmit(string(eventTransmitStop))
+		case rtc.EventError:
 			logger.Warn("rtc error", "payload", string(envelope.Payload))
-		case "rtc.pong":
+		case rtc.EventPong:
 			// keepalive response; no-op
 		default:
 			logger.Debug("ignoring event", "type", envelope.Type)
@@ -276,6 +318,7 @@ func parseFlags() (options, error) {
 	flag.StringVar(&opts.userUID, "user-uid", "", "user uid for join-ticket request")
 	flag.StringVar(&opts.deviceID, "device-id", "", "device id for join-ticket request")
 	flag.IntVar(&opts.chunkBytes, "chunk-bytes", 8192, "payload bytes per rtc.media.state chunk")
+	flag.BoolVar(&opts.compress, "compress-chunks", false, "gzip each chunk before base64 encoding (flagged as chunk_encoding gzip+base64)")
 	flag.IntVar(&intervalMs, "interval-ms", 20, "interval between transmitted chunks in milliseconds")
 	flag.BoolVar(&opts.loop, "loop", false, "loop file transmission forever")
 	flag.BoolVar(&opts.exitAfterSend, "exit-after-send", false, "exit when one full file send completes")
@@ -320,7 +363,7 @@ func parseFlags() (options, error) {
 	}
 	if opts.mediaMode == "pcm-frames" && opts.filePath != "" {
 		if _, err := exec.LookPath(opts.ffmpegBin); err != nil {
-			return opts, fmt.Errorf("ffmpeg binary not found (%s): %w", opts.ffmpegBin, err)
+			return opts, fmt.Errorf("ffmpeg binary not found (%s): %w; use --media-mode chunks to send without decoding", opts.ffmpegBin, err)
 		}
 	}
 
@@ -391,10 +434,9 @@ func transmitAudioState(
 		loopIndex++
 		logger.Info("starting transmit loop", "loop", loopIndex, "chunks", totalSeq)
 		for seq := 0; seq < totalSeq; seq++ {
-			select {
-			case <-ctx.Done():
+			if ctx.Err() != nil {
+				endStoppedTransmit(logger, send, opts, streamID, "audio_file_chunks", loopIndex, seq, totalSeq)
 				return nil
-			default:
 			}
 
 			start := seq * opts.chunkBytes
@@ -402,7 +444,7 @@ func transmitAudioState(
 			if end > len(data) {
 				end = len(data)
 			}
-			chunkB64 := base64.StdEncoding.EncodeToString(data[start:end])
+			chunkB64, chunkEncoding := encodeChunk(data[start:end], opts.compress)
 			payload := map[string]any{
 				"stream_id":       streamID,
 				"stream_kind":     "audio_file_chunks",
@@ -412,14 +454,15 @@ func transmitAudioState(
 				"seq":             seq,
 				"total_seq":       totalSeq,
 				"chunk_b64":       chunkB64,
+				"chunk_encoding":  chunkEncoding,
 				"eof":             seq == totalSeq-1,
 				"transmitted_at":  time.Now().UTC().Format(time.RFC3339Nano),
 				"transmitter_uid": opts.userUID,
 			}
-			if err := send(rtc.NewEnvelope("rtc.media.state", opts.channelID, "media_"+strconv.Itoa(loopIndex)+"_"+strconv.Itoa(seq), payload)); err != nil {
+			if err := send(rtc.NewEnvelope(rtc.EventMediaState, opts.channelID, "media_"+strconv.Itoa(loopIndex)+"_"+strconv.Itoa(seq), payload)); err != nil {
 				return err
 			}
-			time.Sleep(opts.interval)
+			sleepContext(ctx, opts.interval)
 		}
 		logger.Info("completed transmit loop", "loop", loopIndex)
 
@@ -459,10 +502,9 @@ func transmitPCMFrames(
 		logger.Info("starting pcm transmit loop", "loop", loopIndex, "frames", totalSeq, "frame_bytes", frameBytes)
 
 		for seq := 0; seq < totalSeq; seq++ {
-			select {
-			case <-ctx.Done():
+			if ctx.Err() != nil {
+				endStoppedTransmit(logger, send, opts, streamID, "audio_pcm_s16le_48k_mono", loopIndex, seq, totalSeq)
 				return nil
-			default:
 			}
 
 			start := seq * frameBytes
@@ -470,7 +512,7 @@ func transmitPCMFrames(
 			if end > len(pcmBytes) {
 				end = len(pcmBytes)
 			}
-			chunkB64 := base64.StdEncoding.EncodeToString(pcmBytes[start:end])
+			chunkB64, chunkEncoding := encodeChunk(pcmBytes[start:end], opts.compress)
 			payload := map[string]any{
 				"stream_id":         streamID,
 				"stream_kind":       "audio_pcm_s16le_48k_mono",
@@ -481,6 +523,7 @@ func transmitPCMFrames(
 				"seq":               seq,
 				"total_seq":         totalSeq,
 				"chunk_b64":         chunkB64,
+				"chunk_encoding":    chunkEncoding,
 				"sample_rate_hz":    48000,
 				"channels":          1,
 				"frame_duration_ms": int(opts.interval / time.Millisecond),
@@ -488,10 +531,10 @@ func transmitPCMFrames(
 				"transmitted_at":    time.Now().UTC().Format(time.RFC3339Nano),
 				"transmitter_uid":   opts.userUID,
 			}
-			if err := send(rtc.NewEnvelope("rtc.media.state", opts.channelID, "pcm_"+strconv.Itoa(loopIndex)+"_"+strconv.Itoa(seq), payload)); err != nil {
+			if err := send(rtc.NewEnvelope(rtc.EventMediaState, opts.channelID, "pcm_"+strconv.Itoa(loopIndex)+"_"+strconv.Itoa(seq), payload)); err != nil {
 				return err
 			}
-			time.Sleep(opts.interval)
+			sleepContext(ctx, opts.interval)
 		}
 
 		logger.Info("completed pcm transmit loop", "loop", loopIndex)
@@ -501,9 +544,79 @@ func transmitPCMFrames(
 	}
 }
 
+// endStoppedTransmit logs how far an aborted transmission got and marks the
+// stream inactive so the server unpublishes it.
+func endStoppedTransmit(
+	logger *slog.Logger,
+	send func(rtc.Envelope) error,
+	opts options,
+	streamID string,
+	streamKind string,
+	loopIndex int,
+	sent int,
+	totalSeq int,
+) {
+	logger.Info("transmit stopped before eof", "loop", loopIndex, "sent", sent, "total_seq", totalSeq)
+	_ = send(rtc.NewEnvelope(rtc.EventMediaState, opts.channelID, "stop_"+streamID, map[string]any{
+		"stream_id":       streamID,
+		"stream_kind":     streamKind,
+		"active":          false,
+		"transmitter_uid": opts.userUID,
+	}))
+}
+
+// encodeChunk base64-encodes data, gzipping it first when compress is set, and
+// returns the chunk_encoding flag peers need to reverse it.
+func encodeChunk(data []byte, compress bool) (string, string) {
+	if !compress {
+		return base64.StdEncoding.EncodeToString(data), rtc.ChunkEncodingBase64
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(data)
+	_ = zw.Close()
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), rtc.ChunkEncodingGzipBase64
+}
+
+func decodeChunk(chunkB64 string, encoding string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(chunkB64)
+	if err != nil {
+		return nil, err
+	}
+	switch encoding {
+	case "", rtc.ChunkEncodingBase64:
+		return raw, nil
+	case rtc.ChunkEncodingGzipBase64:
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unsupported chunk_encoding %q", encoding)
+	}
+}
+
+func sleepContext(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+var errFFmpegUnavailable = errors.New("ffmpeg unavailable; retry with --media-mode chunks to send the file without decoding")
+
 func decodeToPCM(ctx context.Context, ffmpegBin string, inputPath string) ([]byte, error) {
+	// parseFlags already looked ffmpeg up, but the binary may have gone away since.
+	resolved, err := exec.LookPath(ffmpegBin)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s not found: %v", errFFmpegUnavailable, ffmpegBin, err)
+	}
 	cmd := exec.CommandContext(ctx,
-		ffmpegBin,
+		resolved,
 		"-v", "error",
 		"-i", inputPath,
 		"-vn",
@@ -520,7 +633,7 @@ func decodeToPCM(ctx context.Context, ffmpegBin string, inputPath string) ([]byt
 		return nil, fmt.Errorf("ffmpeg stdout pipe failed: %w", err)
 	}
 	if err := cmd.Start(); err != nil {
-		return nil, fmt.Errorf("ffmpeg start failed: %w", err)
+		return nil, fmt.Errorf("%w: %s failed to start: %v", errFFmpegUnavailable, resolved, err)
 	}
 
 	output, readErr := io.ReadAll(stdout)
@@ -531,9 +644,9 @@ func decodeToPCM(ctx context.Context, ffmpegBin string, inputPath string) ([]byt
 	if waitErr != nil {
 		msg := strings.TrimSpace(stderr.String())
 		if msg == "" {
-			msg = waitErr.Error()
+			return nil, fmt.Errorf("ffmpeg decode of %s failed (%v) with no stderr output", inputPath, waitErr)
 		}
-		return nil, fmt.Errorf("ffmpeg decode failed: %s", msg)
+		return nil, fmt.Errorf("ffmpeg decode of %s failed (%v); ffmpeg stderr:\n%s", inputPath, waitErr, msg)
 	}
 	return output, nil
 }
@@ -572,7 +685,7 @@ func handleIncomingMediaState(
 	}
 
 	if chunkB64 != "" {
-		chunk, err := base64.StdEncoding.DecodeString(chunkB64)
+		chunk, err := decodeChunk(chunkB64, asString(payload["chunk_encoding"]))
 		if err != nil {
 			logger.Warn("failed to decode incoming chunk", "stream", streamKey, "seq", seq, "error", err)
 			return
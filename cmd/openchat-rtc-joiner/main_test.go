@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openchat/openchat-backend/internal/rtc"
+)
+
+func TestTransmitStopsBeforeEOFWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := options{
+		channelID:  "ch_voice",
+		filePath:   "clip.wav",
+		fileType:   "wav",
+		userUID:    "uid_joiner_test",
+		chunkBytes: 1,
+		interval:   time.Millisecond,
+	}
+
+	var payloads []map[string]any
+	send := func(envelope rtc.Envelope) error {
+		var payload map[string]any
+		if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+			t.Fatalf("decode media payload: %v", err)
+		}
+		payloads = append(payloads, payload)
+		if len(payloads) == 3 {
+			cancel()
+		}
+		return nil
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	if err := transmitAudioState(ctx, logger, send, opts, "stream_test", make([]byte, 10)); err != nil {
+		t.Fatalf("transmit: %v", err)
+	}
+
+	if len(payloads) != 4 {
+		t.Fatalf("expected 3 chunks and a stop marker, got %d payloads", len(payloads))
+	}
+	for _, payload := range payloads[:3] {
+		if eof, _ := payload["eof"].(bool); eof {
+			t.Fatalf("expected transmission to stop before eof, got %v", payload)
+		}
+	}
+	if active, ok := payloads[3]["active"].(bool); !ok || active {
+		t.Fatalf("expected final active=false marker, got %v", payloads[3])
+	}
+}
+
+func TestDecodeToPCMReportsMissingAndFailingFFmpeg(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "ffmpeg-missing")
+	_, err := decodeToPCM(context.Background(), missing, "clip.wav")
+	if !errors.Is(err, errFFmpegUnavailable) {
+		t.Fatalf("expected errFFmpegUnavailable for a missing binary, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "--media-mode chunks") {
+		t.Fatalf("expected chunks fallback hint, got %q", err.Error())
+	}
+
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ffmpeg script requires a POSIX shell")
+	}
+	failing := filepath.Join(t.TempDir(), "ffmpeg")
+	script := "#!/bin/sh\necho 'clip.wav: Invalid data found when processing input' >&2\nexit 1\n"
+	if err := os.WriteFile(failing, []byte(script), 0o755); err != nil {
+		t.Fatalf("write fake ffmpeg: %v", err)
+	}
+	_, err = decodeToPCM(context.Background(), failing, "clip.wav")
+	if err == nil || errors.Is(err, errFFmpegUnavailable) {
+		t.Fatalf("expected a decode failure, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "ffmpeg stderr:\nclip.wav: Invalid data found") {
+		t.Fatalf("expected ffmpeg stderr in error, got %q", err.Error())
+	}
+}
+
+func TestCompressedChunksRoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("openchat pcm frame "), 64)
+	compressed, encoding := encodeChunk(data, true)
+	plain, _ := encodeChunk(data, false)
+	if encoding != rtc.ChunkEncodingGzipBase64 || len(compressed) >= len(plain) {
+		t.Fatalf("expected a smaller gzip+base64 chunk, got %q with %d vs %d bytes", encoding, len(compressed), len(plain))
+	}
+	decoded, err := decodeChunk(compressed, encoding)
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Fatalf("compressed chunk did not round-trip: %v", err)
+	}
+	if _, err := decodeChunk(plain, "brotli"); err == nil {
+		t.Fatalf("expected an unknown chunk_encoding to fail")
+	}
+}
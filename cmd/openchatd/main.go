@@ -25,6 +25,14 @@ func main() {
 		WriteTimeout:      30 * time.Second,
 		IdleTimeout:       90 * time.Second,
 	}
+	if cfg.TLSEnabled() {
+		tlsConfig, err := cfg.TLSConfig()
+		if err != nil {
+			logger.Error("invalid tls configuration", "error", err)
+			os.Exit(1)
+		}
+		httpServer.TLSConfig = tlsConfig
+	}
 
 	go func() {
 		logger.Info(
@@ -35,8 +43,15 @@ func main() {
 			"commit_short", build.CommitShort,
 			"build_time", build.BuildTime,
 			"vcs_modified", build.VCSModified,
+			"tls", cfg.TLSEnabled(),
 		)
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.TLSEnabled() {
+			err = httpServer.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("http server failed", "error", err)
 			os.Exit(1)
 		}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/openchat/openchat-backend/internal/rtc"
+)
+
+func (s *Server) getStorageStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"attachments": s.chat.AttachmentStorageStats(),
+		"avatars":     s.profiles.AvatarStorageStats(),
+	})
+}
+
+func (s *Server) getMaintenance(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"enabled": s.maintenance.Load()})
+}
+
+func (s *Server) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Enabled == nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid maintenance payload")
+		return
+	}
+	s.maintenance.Store(*body.Enabled)
+	s.logger.Info("maintenance mode updated", "enabled", *body.Enabled, "user_uid", requesterFromContext(r.Context()).UserUID)
+	writeJSON(w, http.StatusOK, map[string]any{"enabled": *body.Enabled})
+}
+
+func (s *Server) migrateRTCChannel(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	var body struct {
+		ToChannelID string `json:"to_channel_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid migration payload")
+		return
+	}
+	toChannelID := strings.TrimSpace(body.ToChannelID)
+	if !s.chat.ChannelExists(toChannelID) {
+		writeErrorKind(w, errorKindNotFound, "channel_not_found", "unknown voice channel")
+		return
+	}
+	if !s.chat.IsVoiceChannel(toChannelID) {
+		writeErrorKind(w, errorKindInvalid, "invalid_channel_type", "rooms can only migrate to voice channels")
+		return
+	}
+
+	moved, err := s.signaling.MigrateChannel(channelID, toChannelID)
+	if err != nil {
+		switch {
+		case errors.Is(err, rtc.ErrMigrationInvalid):
+			writeErrorKind(w, errorKindInvalid, "rtc_migration_invalid", err.Error())
+		case errors.Is(err, rtc.ErrChannelDisabled):
+			writeErrorKind(w, errorKindForbidden, "rtc_channel_disabled", "rtc is disabled for this channel")
+		case errors.Is(err, rtc.ErrChannelFull):
+			writeErrorKind(w, errorKindConflict, "rtc_channel_full", "target channel cannot hold every migrated participant")
+		default:
+			writeErrorKind(w, errorKindInternal, "rtc_migration_failed", "unable to migrate rtc channel")
+		}
+		return
+	}
+	s.logger.Info("rtc channel migration requested", "from_channel_id", channelID, "channel_id", toChannelID, "user_uid", requesterFromContext(r.Context()).UserUID)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"from_channel_id": channelID,
+		"channel_id":      toChannelID,
+		"migrated":        moved,
+	})
+}
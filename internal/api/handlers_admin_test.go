@@ -0,0 +1,366 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openchat/openchat-backend/internal/chat"
+	"github.com/openchat/openchat-backend/internal/realtime"
+	"github.com/openchat/openchat-backend/internal/rtc"
+)
+
+func TestStorageStatsReportBlobTotals(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_storage"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_storage", nil, []testUpload{
+		{FileName: "a.png", ContentType: "image/png", Content: onePixelPNG},
+		{FileName: "b.png", ContentType: "image/png", Content: onePixelPNG},
+	}))
+	uploadTestAvatar(t, ts.URL, "uid_storage")
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/admin/storage", nil)
+	if err != nil {
+		t.Fatalf("build storage request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_storage")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("storage request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected storage status: %d", resp.StatusCode)
+	}
+
+	var stats struct {
+		Attachments chat.StorageStats `json:"attachments"`
+		Avatars     chat.StorageStats `json:"avatars"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode storage stats: %v", err)
+	}
+	if stats.Attachments.Count != 2 || stats.Attachments.Blobs != 1 || stats.Attachments.Bytes != int64(len(onePixelPNG)) {
+		t.Fatalf("expected 2 attachments sharing one %d byte blob, got %+v", len(onePixelPNG), stats.Attachments)
+	}
+	if stats.Avatars.Count != 1 || stats.Avatars.Bytes != int64(len(testPNGBytes(t))) {
+		t.Fatalf("expected 1 avatar totalling %d bytes, got %+v", len(testPNGBytes(t)), stats.Avatars)
+	}
+}
+
+func TestMaintenanceModeBlocksWritesButAllowsReads(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_operator"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	setMaintenance := func(enabled bool) {
+		body, _ := json.Marshal(map[string]any{"enabled": enabled})
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/admin/maintenance", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("build maintenance request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_operator")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("maintenance request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected maintenance toggle status: %d", resp.StatusCode)
+		}
+	}
+
+	setMaintenance(true)
+
+	blocked := postJSONMessage(t, ts.URL, "ch_general", "uid_maintenance", map[string]any{"body": "hello"})
+	defer blocked.Body.Close()
+	if blocked.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 during maintenance, got %d", blocked.StatusCode)
+	}
+	if blocked.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header during maintenance")
+	}
+	var apiErr APIError
+	if err := json.NewDecoder(blocked.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if apiErr.Code != "maintenance" || !apiErr.Retryable {
+		t.Fatalf("expected retryable maintenance error, got %+v", apiErr)
+	}
+
+	read, err := http.Get(ts.URL + "/v1/channels/ch_general/messages")
+	if err != nil {
+		t.Fatalf("list messages failed: %v", err)
+	}
+	read.Body.Close()
+	if read.StatusCode != http.StatusOK {
+		t.Fatalf("expected reads to succeed during maintenance, got %d", read.StatusCode)
+	}
+
+	health, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("healthz failed: %v", err)
+	}
+	var healthBody struct {
+		Status string `json:"status"`
+	}
+	_ = json.NewDecoder(health.Body).Decode(&healthBody)
+	health.Body.Close()
+	if healthBody.Status != "maintenance" {
+		t.Fatalf("expected healthz to report maintenance, got %q", healthBody.Status)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/realtime?user_uid=uid_maintenance"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial realtime: %v", err)
+	}
+	defer conn.Close()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Fatalf("expected try-again-later close during maintenance, got %v", err)
+	}
+
+	setMaintenance(false)
+	decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_maintenance", map[string]any{"body": "back"}))
+}
+
+func TestMigrateRTCChannelMovesParticipants(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_migrate_admin"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	first := joinVoiceChannel(t, ts.URL, "vc_general", "uid_migrate_first")
+	second := joinVoiceChannel(t, ts.URL, "vc_general", "uid_migrate_second")
+	if envelope := readSignalingEnvelope(t, first); envelope.Type != rtc.EventParticipantJoined {
+		t.Fatalf("expected rtc.participant.joined, got %s", envelope.Type)
+	}
+	resident := joinVoiceChannel(t, ts.URL, "vc_party", "uid_migrate_resident")
+
+	rosterIDs := func(channelID string) map[string]string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/rtc/channels/"+channelID+"/participants", nil)
+		if err != nil {
+			t.Fatalf("build roster request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_migrate_admin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("roster request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var roster struct {
+			Participants []rtc.RosterEntry `json:"participants"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&roster); err != nil {
+			t.Fatalf("decode roster: %v", err)
+		}
+		ids := make(map[string]string, len(roster.Participants))
+		for _, participant := range roster.Participants {
+			ids[participant.UserUID] = participant.ParticipantID
+		}
+		return ids
+	}
+	before := rosterIDs("vc_general")
+	residentID := rosterIDs("vc_party")["uid_migrate_resident"]
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/admin/rtc/channels/vc_general/migrate", strings.NewReader(`{"to_channel_id":"vc_party"}`))
+	if err != nil {
+		t.Fatalf("build migrate request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_migrate_admin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("migrate request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var migrated struct {
+		Migrated int `json:"migrated"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&migrated); err != nil {
+		t.Fatalf("decode migrate response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || migrated.Migrated != 2 {
+		t.Fatalf("expected 2 participants migrated, got status=%d migrated=%d", resp.StatusCode, migrated.Migrated)
+	}
+
+	for uid, conn := range map[string]*websocket.Conn{"uid_migrate_first": first, "uid_migrate_second": second} {
+		envelope := readSignalingEnvelope(t, conn)
+		if envelope.Type != rtc.EventChannelMigrated || envelope.ChannelID != "vc_party" {
+			t.Fatalf("expected rtc.channel.migrated to vc_party, got %s on %s", envelope.Type, envelope.ChannelID)
+		}
+		var payload struct {
+			FromChannelID string `json:"from_channel_id"`
+			Participant   struct {
+				ParticipantID string `json:"participant_id"`
+			} `json:"participant"`
+		}
+		if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+			t.Fatalf("decode migrated payload: %v", err)
+		}
+		if payload.FromChannelID != "vc_general" || payload.Participant.ParticipantID != before[uid] {
+			t.Fatalf("unexpected migrated payload for %s: %+v", uid, payload)
+		}
+		if joinedID := joinedParticipantID(readSignalingEnvelope(t, conn)); joinedID != residentID {
+			t.Fatalf("expected %s to learn about the resident %s, got %q", uid, residentID, joinedID)
+		}
+	}
+	announced := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		announced[joinedParticipantID(readSignalingEnvelope(t, resident))] = true
+	}
+	if !announced[before["uid_migrate_first"]] || !announced[before["uid_migrate_second"]] {
+		t.Fatalf("expected the resident to learn about both migrated participants, got %v", announced)
+	}
+
+	if remaining := rosterIDs("vc_general"); len(remaining) != 0 {
+		t.Fatalf("expected vc_general to be empty, got %v", remaining)
+	}
+	after := rosterIDs("vc_party")
+	if len(after) != 3 || after["uid_migrate_first"] != before["uid_migrate_first"] || after["uid_migrate_second"] != before["uid_migrate_second"] {
+		t.Fatalf("expected participant ids preserved in vc_party, before=%v after=%v", before, after)
+	}
+
+	if err := first.WriteJSON(rtc.NewEnvelope(rtc.EventMediaState, "vc_party", "media_1", map[string]any{"muted": true})); err != nil {
+		t.Fatalf("send media state: %v", err)
+	}
+	if envelope := readSignalingEnvelope(t, second); envelope.Type != rtc.EventMediaState || envelope.ChannelID != "vc_party" {
+		t.Fatalf("expected media state relayed in vc_party, got %s on %s", envelope.Type, envelope.ChannelID)
+	}
+}
+
+func joinedParticipantID(envelope rtc.Envelope) string {
+	if envelope.Type != rtc.EventParticipantJoined {
+		return ""
+	}
+	var payload struct {
+		Participant struct {
+			ParticipantID string `json:"participant_id"`
+		} `json:"participant"`
+	}
+	_ = json.Unmarshal(envelope.Payload, &payload)
+	return payload.Participant.ParticipantID
+}
+
+func TestSubsystemHealthReportsLiveCounts(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_health_admin"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	getHealth := func(path string, out any) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			t.Fatalf("build health request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_health_admin")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("health request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected %s status: %d", path, resp.StatusCode)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("decode %s: %v", path, err)
+		}
+	}
+
+	var idleRealtime realtime.Health
+	getHealth("/v1/realtime/health", &idleRealtime)
+	if idleRealtime.Connections != 0 || idleRealtime.Subscriptions != 0 {
+		t.Fatalf("expected an idle realtime hub, got %+v", idleRealtime)
+	}
+
+	first := dialRealtime(t, ts.URL, "uid_health_first")
+	defer first.Close()
+	second := dialRealtime(t, ts.URL, "uid_health_second")
+	defer second.Close()
+	subscribeRealtime(t, first, "ch_general")
+	subscribeRealtime(t, second, "ch_general")
+
+	var liveRealtime realtime.Health
+	getHealth("/v1/realtime/health", &liveRealtime)
+	if liveRealtime.Connections != 2 || liveRealtime.Users != 2 || liveRealtime.Channels != 1 || liveRealtime.Subscriptions != 2 {
+		t.Fatalf("expected 2 connections subscribed to 1 channel, got %+v", liveRealtime)
+	}
+
+	joinVoiceChannel(t, ts.URL, "vc_general", "uid_health_caller")
+	var liveRTC rtc.Health
+	getHealth("/v1/rtc/health", &liveRTC)
+	if liveRTC.Rooms != 1 || liveRTC.Participants != 1 {
+		t.Fatalf("expected 1 room with 1 participant, got %+v", liveRTC)
+	}
+}
+
+func TestAdminRoutesRejectNonModerators(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_admin_moderator"}
+	ts := httptest.NewServer(NewServer(cfg, slog.Default()).Router())
+	defer ts.Close()
+
+	routes := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/v1/admin/storage", ""},
+		{http.MethodGet, "/v1/rtc/health", ""},
+		{http.MethodGet, "/v1/realtime/health", ""},
+		{http.MethodPost, "/v1/servers", `{"display_name":"Rogue Harbor"}`},
+		{http.MethodPost, "/v1/servers/srv_harbor/channels", `{"name":"rogue","type":"text"}`},
+		{http.MethodPut, "/v1/servers/srv_harbor/default-channel", `{"channel_id":"ch_general"}`},
+		{http.MethodPut, "/v1/admin/maintenance", `{"enabled":true}`},
+		{http.MethodPost, "/v1/rtc/channels/vc_general/drain", ""},
+		{http.MethodPost, "/v1/admin/rtc/channels/vc_general/migrate", `{"to_channel_id":"vc_party"}`},
+	}
+	for _, route := range routes {
+		req, err := http.NewRequest(route.method, ts.URL+route.path, strings.NewReader(route.body))
+		if err != nil {
+			t.Fatalf("build %s %s: %v", route.method, route.path, err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_admin_member")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", route.method, route.path, err)
+		}
+		var apiErr APIError
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden || apiErr.Code != "forbidden" {
+			t.Fatalf("expected 403 forbidden for %s %s, got %d %q", route.method, route.path, resp.StatusCode, apiErr.Code)
+		}
+	}
+
+	maintenance, err := http.Get(ts.URL + "/healthz")
+	if err != nil {
+		t.Fatalf("healthz failed: %v", err)
+	}
+	var health struct {
+		Status string `json:"status"`
+	}
+	_ = json.NewDecoder(maintenance.Body).Decode(&health)
+	maintenance.Body.Close()
+	if health.Status == "maintenance" {
+		t.Fatalf("expected a rejected toggle to leave maintenance off")
+	}
+}
@@ -1,37 +1,58 @@
 package api
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/openchat/openchat-backend/internal/chat"
+	"github.com/openchat/openchat-backend/internal/profile"
 )
 
 const multipartBodySlackBytes = 16 * 1024
 
+const maxBulkDeleteMessages = 100
+
 var (
 	errInvalidMessagePayload   = errors.New("invalid message payload")
 	errInvalidMultipartPayload = errors.New("invalid multipart message payload")
 	errAttachmentReadFailed    = errors.New("unable to read attachment upload")
 	errAttachmentTooLarge      = errors.New("attachment exceeds max upload size")
 	errAttachmentCountExceeded = errors.New("too many attachments in one message")
+	errAttachmentEncoding      = errors.New("attachment data_b64 is not valid base64")
 )
 
+type createMessagePayload struct {
+	Body             string
+	Format           string
+	ReplyToMessageID string
+	ForwardFrom      *chat.ForwardSource
+	SendAt           string
+	Uploads          []chat.AttachmentUploadInput
+	Visibility       string
+	VisibleTo        []string
+}
+
 func (s *Server) listChannelGroups(w http.ResponseWriter, r *http.Request) {
 	serverID := strings.TrimSpace(chi.URLParam(r, "serverID"))
 	groups, err := s.chat.ListChannelGroups(serverID)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "server_not_found", err.Error(), false)
+		writeErrorKind(w, errorKindNotFound, "server_not_found", err.Error())
 		return
 	}
+	defaultChannelID, _ := s.chat.DefaultChannelID(serverID)
 	writeJSON(w, http.StatusOK, map[string]any{
-		"server_id": serverID,
-		"groups":    groups,
+		"server_id":          serverID,
+		"default_channel_id": defaultChannelID,
+		"groups":             groups,
 	})
 }
 
@@ -39,94 +60,557 @@ func (s *Server) listMembers(w http.ResponseWriter, r *http.Request) {
 	serverID := strings.TrimSpace(chi.URLParam(r, "serverID"))
 	members, err := s.chat.ListMembers(serverID)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "server_not_found", err.Error(), false)
+		writeErrorKind(w, errorKindNotFound, "server_not_found", err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"server_id": serverID,
-		"members":   members,
-	})
+	s.writeListPage(w, map[string]any{"server_id": serverID}, "members", members, "", len(members))
 }
 
 func (s *Server) listMessages(w http.ResponseWriter, r *http.Request) {
 	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
-	limit := 100
-	if rawLimit := strings.TrimSpace(r.URL.Query().Get("limit")); rawLimit != "" {
-		parsed, err := strconv.Atoi(rawLimit)
-		if err == nil && parsed > 0 {
-			limit = parsed
+	limit := s.pageLimit(r, 100)
+	var descending bool
+	switch order := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("order"))); order {
+	case "", "asc":
+	case "desc":
+		descending = true
+	default:
+		writeErrorKind(w, errorKindInvalid, "invalid_order", "order must be asc or desc")
+		return
+	}
+
+	page, err := s.chat.ListMessages(channelID, chat.MessageQuery{
+		Limit:      limit,
+		Before:     strings.TrimSpace(r.URL.Query().Get("before")),
+		Descending: descending,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrCursorInvalid):
+			writeErrorKind(w, errorKindInvalid, "invalid_cursor", "pagination cursor is invalid")
+		default:
+			writeErrorKind(w, errorKindInternal, "message_list_failed", "unable to list messages")
 		}
+		return
+	}
+
+	s.writeListPage(w, map[string]any{"channel_id": channelID}, "messages", page.Messages, page.NextCursor, page.Total)
+}
+
+func (s *Server) searchMessages(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeErrorKind(w, errorKindInvalid, "search_query_required", "q is required")
+		return
 	}
 
-	messages, err := s.chat.ListMessages(channelID, limit)
+	page, err := s.chat.SearchMessages(channelID, query, s.pageLimit(r, 25))
 	if err != nil {
-		writeError(w, http.StatusNotFound, "channel_not_found", err.Error(), false)
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrSearchQueryEmpty):
+			writeErrorKind(w, errorKindInvalid, "search_query_required", "q is required")
+		default:
+			writeErrorKind(w, errorKindInternal, "message_search_failed", "unable to search messages")
+		}
 		return
 	}
 
+	authorUIDs := make([]string, 0, len(page.Results))
+	for _, result := range page.Results {
+		authorUIDs = append(authorUIDs, result.Message.AuthorUID)
+	}
+	authors := make(map[string]profile.CanonicalProfile, len(authorUIDs))
+	requester := requesterFromContext(r.Context())
+	for _, author := range s.profiles.BatchGet(authorUIDs) {
+		authors[author.UserUID] = author.VisibleTo(requester.UserUID)
+	}
+	type searchResult struct {
+		chat.SearchResult
+		Author profile.CanonicalProfile `json:"author"`
+	}
+	results := make([]searchResult, 0, len(page.Results))
+	for _, result := range page.Results {
+		results = append(results, searchResult{SearchResult: result, Author: authors[result.Message.AuthorUID]})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id":    channelID,
+		"query":         query,
+		"results":       results,
+		"total_matches": page.TotalMatches,
+	})
+}
+
+// maxPollWait stays under the server's 30s write timeout.
+const maxPollWait = 25 * time.Second
+
+func (s *Server) pollMessages(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	var afterSeq int64
+	if rawAfter := strings.TrimSpace(r.URL.Query().Get("after_seq")); rawAfter != "" {
+		parsed, err := strconv.ParseInt(rawAfter, 10, 64)
+		if err != nil || parsed < 0 {
+			writeErrorKind(w, errorKindInvalid, "invalid_query", "after_seq must be a non-negative integer")
+			return
+		}
+		afterSeq = parsed
+	}
+
+	// A shorter client deadline from X-OpenChat-Request-Timeout still wins.
+	ctx, cancel := context.WithTimeout(r.Context(), maxPollWait)
+	defer cancel()
+
+	messages, err := s.chat.WaitForMessages(ctx, channelID, afterSeq)
+	if err != nil {
+		writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		return
+	}
+	// Oldest first, so a capped client resumes from the last seq it received.
+	if limit := s.pageLimit(r, s.cfg.PageLimit()); len(messages) > limit {
+		messages = messages[:limit]
+	}
 	writeJSON(w, http.StatusOK, map[string]any{
 		"channel_id": channelID,
 		"messages":   messages,
 	})
 }
 
+const (
+	maxRecentChannels       = 50
+	maxRecentPerChannel     = 20
+	defaultRecentPerChannel = 3
+)
+
+func (s *Server) listRecentMessages(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ChannelIDs []string `json:"channel_ids"`
+		PerChannel int      `json:"per_channel"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid recent messages payload")
+		return
+	}
+	if len(body.ChannelIDs) == 0 {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "at least one channel_id is required")
+		return
+	}
+	if len(body.ChannelIDs) > maxRecentChannels {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "too many channel_ids")
+		return
+	}
+	perChannel := body.PerChannel
+	if perChannel <= 0 {
+		perChannel = defaultRecentPerChannel
+	}
+	if perChannel > maxRecentPerChannel {
+		perChannel = maxRecentPerChannel
+	}
+
+	recent := make(map[string][]chat.Message, len(body.ChannelIDs))
+	unknown := make([]string, 0)
+	for _, rawID := range body.ChannelIDs {
+		channelID := strings.TrimSpace(rawID)
+		if _, seen := recent[channelID]; seen {
+			continue
+		}
+		page, err := s.chat.ListMessages(channelID, chat.MessageQuery{Limit: perChannel})
+		if err != nil {
+			unknown = append(unknown, channelID)
+			continue
+		}
+		recent[channelID] = page.Messages
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"per_channel":         perChannel,
+		"channels":            recent,
+		"unknown_channel_ids": unknown,
+	})
+}
+
 func (s *Server) createMessage(w http.ResponseWriter, r *http.Request) {
 	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
 	if channelID == "" {
-		writeError(w, http.StatusBadRequest, "invalid_channel", "channel id is required", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_channel", "channel id is required")
+		return
+	}
+	if s.cfg.DisableMessaging {
+		writeFeatureDisabled(w, "messaging")
 		return
 	}
 
-	body, replyToMessageID, uploads, payloadErr := parseCreateMessagePayload(w, r, s.chat)
+	payload, payloadErr := parseCreateMessagePayload(w, r, s.chat)
 	if payloadErr != nil {
 		switch {
 		case errors.Is(payloadErr, errAttachmentTooLarge):
-			writeError(w, http.StatusRequestEntityTooLarge, "attachment_too_large", "attachment exceeds max upload size", false)
+			writeErrorKind(w, errorKindTooLarge, "attachment_too_large", "attachment exceeds max upload size")
 		case errors.Is(payloadErr, errAttachmentCountExceeded):
-			writeError(w, http.StatusBadRequest, "attachment_count_exceeded", "too many attachments in one message", false)
+			writeErrorKind(w, errorKindInvalid, "attachment_count_exceeded", "too many attachments in one message")
+		case errors.Is(payloadErr, errAttachmentEncoding):
+			writeErrorKind(w, errorKindInvalid, "attachment_invalid_encoding", "attachment data_b64 must be standard base64")
 		case errors.Is(payloadErr, errAttachmentReadFailed):
-			writeError(w, http.StatusBadRequest, "invalid_payload", "unable to read attachment upload", false)
+			writeErrorKind(w, errorKindInvalid, "invalid_payload", "unable to read attachment upload")
 		case errors.Is(payloadErr, errInvalidMultipartPayload):
-			writeError(w, http.StatusBadRequest, "invalid_payload", "invalid multipart message payload", false)
+			writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid multipart message payload")
 		default:
-			writeError(w, http.StatusBadRequest, "invalid_payload", "invalid message payload", false)
+			writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid message payload")
+		}
+		return
+	}
+
+	if s.cfg.DisableAttachments && len(payload.Uploads) > 0 {
+		writeFeatureDisabled(w, "attachments")
+		return
+	}
+
+	requester := requesterFromContext(r.Context())
+	input := chat.CreateMessageInput{
+		ChannelID:        channelID,
+		AuthorUID:        requester.UserUID,
+		Body:             payload.Body,
+		Format:           chat.MessageFormat(payload.Format),
+		Uploads:          payload.Uploads,
+		ReplyToMessageID: payload.ReplyToMessageID,
+		ForwardFrom:      payload.ForwardFrom,
+		Visibility:       chat.MessageVisibility(payload.Visibility),
+		VisibleTo:        payload.VisibleTo,
+	}
+
+	if payload.SendAt != "" {
+		sendAt, err := time.Parse(time.RFC3339, payload.SendAt)
+		if err != nil {
+			writeErrorKind(w, errorKindInvalid, "send_at_invalid", "send_at must be an RFC3339 timestamp")
+			return
+		}
+		// A send time that has already passed is delivered immediately.
+		if sendAt.After(time.Now()) {
+			scheduled, err := s.chat.ScheduleMessage(input, sendAt)
+			if err != nil {
+				writeCreateMessageError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusAccepted, map[string]any{
+				"scheduled":         true,
+				"scheduled_message": scheduled,
+			})
+			return
+		}
+	}
+
+	message, err := s.chat.CreateMessage(input)
+	if err != nil {
+		writeCreateMessageError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"message": message,
+	})
+}
+
+func (s *Server) cancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	scheduledID := strings.TrimSpace(chi.URLParam(r, "scheduledID"))
+	requester := requesterFromContext(r.Context())
+	if err := s.chat.CancelScheduledMessage(channelID, scheduledID, requester.UserUID); err != nil {
+		if errors.Is(err, chat.ErrScheduledMessageNotFound) {
+			writeErrorKind(w, errorKindNotFound, "scheduled_message_not_found", err.Error())
+			return
 		}
+		writeErrorKind(w, errorKindInternal, "scheduled_message_cancel_failed", "unable to cancel scheduled message")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeCreateMessageError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, chat.ErrMessageEmpty):
+		writeErrorKind(w, errorKindInvalid, "message_empty", "message body or attachment is required")
+	case errors.Is(err, chat.ErrChannelReadOnly):
+		writeErrorKind(w, errorKindForbidden, "channel_read_only", "channel is read-only")
+	case errors.Is(err, chat.ErrMessageFormatInvalid):
+		writeErrorKind(w, errorKindInvalid, "message_format_invalid", "message format must be plain or markdown")
+	case errors.Is(err, chat.ErrReplyTargetNotFound):
+		writeErrorKind(w, errorKindInvalid, "reply_target_not_found", "reply target message not found")
+	case errors.Is(err, chat.ErrForwardSourceNotFound):
+		writeErrorKind(w, errorKindNotFound, "forward_source_not_found", "forwarded message not found")
+	case errors.Is(err, chat.ErrTooManyAttachments):
+		writeErrorKind(w, errorKindInvalid, "attachment_count_exceeded", "too many attachments in one message")
+	case errors.Is(err, chat.ErrAttachmentTooLarge):
+		writeErrorKind(w, errorKindTooLarge, "attachment_too_large", "attachment exceeds max upload size")
+	case errors.Is(err, chat.ErrAttachmentTypeMismatch):
+		writeErrorKind(w, errorKindInvalid, "attachment_type_mismatch", "attachment declared type does not match its content")
+	case errors.Is(err, chat.ErrAttachmentTypeUnsupported):
+		writeErrorKind(w, errorKindUnsupportedMedia, "attachment_type_unsupported", "attachment mime type is unsupported")
+	case errors.Is(err, chat.ErrAttachmentAltTooLong):
+		writeErrorKind(w, errorKindInvalid, "attachment_alt_too_long", "attachment alt text is too long")
+	case errors.Is(err, chat.ErrAttachmentEmpty):
+		writeErrorKind(w, errorKindInvalid, "attachment_empty", "attachment upload is empty")
+	case errors.Is(err, chat.ErrAttachmentImageInvalid):
+		writeErrorKind(w, errorKindInvalid, "attachment_invalid_image", "attachment image payload is invalid")
+	case errors.Is(err, chat.ErrAttachmentImageTooLarge):
+		writeErrorKind(w, errorKindTooLarge, "attachment_image_too_large", fmt.Sprintf("attachment images may have at most %d pixels", chat.MaxStrippedImagePixels))
+	case errors.Is(err, chat.ErrChannelNotFound):
+		writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+	case errors.Is(err, chat.ErrChannelTypeInvalid):
+		writeErrorKind(w, errorKindInvalid, "channel_type_invalid", "messages can only be sent to text channels")
+	case errors.Is(err, chat.ErrSendAtInvalid):
+		writeErrorKind(w, errorKindInvalid, "send_at_invalid", "send_at must be in the future")
+	case errors.Is(err, chat.ErrScheduleTooFar):
+		writeErrorKind(w, errorKindInvalid, "send_at_too_far", err.Error())
+	case errors.Is(err, chat.ErrTooManyScheduled):
+		writeErrorKind(w, errorKindConflict, "too_many_scheduled", err.Error())
+	case errors.Is(err, chat.ErrMessageVisibilityInvalid):
+		writeErrorKind(w, errorKindInvalid, "visibility_invalid", "visibility must be everyone or ephemeral")
+	case errors.Is(err, chat.ErrEphemeralAttachments):
+		writeErrorKind(w, errorKindInvalid, "ephemeral_attachments", "ephemeral messages cannot carry uploads")
+	case errors.Is(err, chat.ErrVisibleToInvalid):
+		writeErrorKind(w, errorKindInvalid, "visible_to_invalid", fmt.Sprintf("ephemeral messages need 1-%d visible_to uids that can read the channel", chat.MaxEphemeralRecipients))
+	default:
+		writeErrorKind(w, errorKindInternal, "message_create_failed", "unable to create message")
+	}
+}
+
+func (s *Server) purgeChannelMessages(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	if r.URL.Query().Get("confirm") != "true" {
+		writeErrorKind(w, errorKindInvalid, "confirmation_required", "purging a channel requires confirm=true")
 		return
 	}
 
 	requester := requesterFromContext(r.Context())
-	message, err := s.chat.CreateMessage(channelID, requester.UserUID, body, uploads, replyToMessageID)
+	purged, err := s.chat.PurgeChannel(channelID, requester.UserUID)
 	if err != nil {
 		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrModeratorRequired):
+			writeErrorKind(w, errorKindForbidden, "moderator_required", "moderator role is required")
+		default:
+			writeErrorKind(w, errorKindInternal, "channel_purge_failed", "unable to purge channel")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id":   channelID,
+		"purged_count": purged,
+	})
+}
+
+func (s *Server) bulkDeleteMessages(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	var body struct {
+		MessageIDs []string `json:"message_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid bulk delete payload")
+		return
+	}
+	if len(body.MessageIDs) == 0 {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "at least one message_id is required")
+		return
+	}
+	if len(body.MessageIDs) > maxBulkDeleteMessages {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", fmt.Sprintf("at most %d message_ids can be deleted at once", maxBulkDeleteMessages))
+		return
+	}
+
+	requester := requesterFromContext(r.Context())
+	results, err := s.chat.DeleteMessages(channelID, body.MessageIDs, requester.UserUID)
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrModeratorRequired):
+			writeErrorKind(w, errorKindForbidden, "moderator_required", "moderator role is required")
+		default:
+			writeErrorKind(w, errorKindInternal, "message_delete_failed", "unable to delete messages")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id": channelID,
+		"results":    results,
+	})
+}
+
+func (s *Server) setChannelTopic(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	var body struct {
+		Topic string `json:"topic"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid channel topic payload")
+		return
+	}
+
+	requester := requesterFromContext(r.Context())
+	channel, err := s.chat.SetChannelTopic(channelID, body.Topic, requester.UserUID)
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrModeratorRequired):
+			writeErrorKind(w, errorKindForbidden, "moderator_required", "moderator role is required")
+		case errors.Is(err, chat.ErrChannelTopicTooLong):
+			writeErrorKind(w, errorKindInvalid, "channel_topic_too_long", fmt.Sprintf("topic must be at most %d characters", chat.MaxChannelTopicRunes))
+		default:
+			writeErrorKind(w, errorKindInternal, "channel_topic_failed", "unable to update channel topic")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"channel": channel})
+}
+
+func (s *Server) editMessage(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	messageID := strings.TrimSpace(chi.URLParam(r, "messageID"))
+	var body struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid message payload")
+		return
+	}
+
+	requester := requesterFromContext(r.Context())
+	message, err := s.chat.EditMessage(chat.EditMessageInput{
+		ChannelID: channelID,
+		MessageID: messageID,
+		EditorUID: requester.UserUID,
+		Body:      body.Body,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrMessageNotFound):
+			writeErrorKind(w, errorKindNotFound, "message_not_found", err.Error())
+		case errors.Is(err, chat.ErrMessageEditForbidden):
+			writeErrorKind(w, errorKindForbidden, "message_edit_forbidden", "only the author can edit this message")
+		case errors.Is(err, chat.ErrEditWindowExpired):
+			writeErrorKind(w, errorKindForbidden, "message_edit_window_expired", "message edit window has expired")
 		case errors.Is(err, chat.ErrMessageEmpty):
-			writeError(w, http.StatusBadRequest, "message_empty", "message body or attachment is required", false)
-		case errors.Is(err, chat.ErrReplyTargetNotFound):
-			writeError(w, http.StatusBadRequest, "reply_target_not_found", "reply target message not found", false)
-		case errors.Is(err, chat.ErrTooManyAttachments):
-			writeError(w, http.StatusBadRequest, "attachment_count_exceeded", "too many attachments in one message", false)
-		case errors.Is(err, chat.ErrAttachmentTooLarge):
-			writeError(w, http.StatusRequestEntityTooLarge, "attachment_too_large", "attachment exceeds max upload size", false)
-		case errors.Is(err, chat.ErrAttachmentTypeUnsupported):
-			writeError(w, http.StatusUnsupportedMediaType, "attachment_type_unsupported", "attachment mime type is unsupported", false)
-		case errors.Is(err, chat.ErrAttachmentImageInvalid):
-			writeError(w, http.StatusBadRequest, "attachment_invalid_image", "attachment image payload is invalid", false)
+			writeErrorKind(w, errorKindInvalid, "message_empty", "message body or attachment is required")
 		default:
-			writeError(w, http.StatusBadRequest, "message_create_failed", err.Error(), false)
+			writeErrorKind(w, errorKindInternal, "message_edit_failed", "unable to edit message")
 		}
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, map[string]any{
+	writeJSON(w, http.StatusOK, map[string]any{
+		"message": message,
+	})
+}
+
+func (s *Server) deleteMessage(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	messageID := strings.TrimSpace(chi.URLParam(r, "messageID"))
+	requester := requesterFromContext(r.Context())
+	if err := s.chat.DeleteMessage(channelID, messageID, requester.UserUID); err != nil {
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrMessageNotFound):
+			writeErrorKind(w, errorKindNotFound, "message_not_found", err.Error())
+		case errors.Is(err, chat.ErrMessageDeleteForbidden):
+			writeErrorKind(w, errorKindForbidden, "message_delete_forbidden", "only the author can delete this message")
+		default:
+			writeErrorKind(w, errorKindInternal, "message_delete_failed", "unable to delete message")
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) pinMessage(w http.ResponseWriter, r *http.Request) {
+	s.setMessagePinned(w, r, s.chat.PinMessage)
+}
+
+func (s *Server) unpinMessage(w http.ResponseWriter, r *http.Request) {
+	s.setMessagePinned(w, r, s.chat.UnpinMessage)
+}
+
+func (s *Server) setMessagePinned(w http.ResponseWriter, r *http.Request, apply func(string, string, string) (chat.Message, error)) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	messageID := strings.TrimSpace(chi.URLParam(r, "messageID"))
+	requester := requesterFromContext(r.Context())
+	message, err := apply(channelID, messageID, requester.UserUID)
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrMessageNotFound):
+			writeErrorKind(w, errorKindNotFound, "message_not_found", err.Error())
+		case errors.Is(err, chat.ErrPinForbidden):
+			writeErrorKind(w, errorKindForbidden, "forbidden", err.Error())
+		case errors.Is(err, chat.ErrPinLimitReached):
+			writeErrorKind(w, errorKindConflict, "pin_limit_reached", err.Error())
+		default:
+			writeErrorKind(w, errorKindInternal, "message_pin_failed", "unable to update pin")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
 		"message": message,
 	})
 }
 
+func (s *Server) listPinnedMessages(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	pins, err := s.chat.ListPinnedMessages(channelID)
+	if err != nil {
+		writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id": channelID,
+		"pins":       pins,
+	})
+}
+
+func (s *Server) getMessageHistory(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	messageID := strings.TrimSpace(chi.URLParam(r, "messageID"))
+	requester := requesterFromContext(r.Context())
+	revisions, err := s.chat.MessageHistory(channelID, messageID, requester.UserUID)
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrMessageNotFound):
+			writeErrorKind(w, errorKindNotFound, "message_not_found", err.Error())
+		case errors.Is(err, chat.ErrMessageHistoryForbidden):
+			writeErrorKind(w, errorKindForbidden, "message_history_forbidden", "only the author or a moderator can view message history")
+		default:
+			writeErrorKind(w, errorKindInternal, "message_history_failed", "unable to load message history")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id": channelID,
+		"message_id": messageID,
+		"revisions":  revisions,
+	})
+}
+
 func (s *Server) getMessageAttachment(w http.ResponseWriter, r *http.Request) {
 	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
 	attachmentID := strings.TrimSpace(chi.URLParam(r, "attachmentID"))
 	attachment, content, err := s.chat.AttachmentContent(channelID, attachmentID)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "attachment_not_found", "attachment not found", false)
+		writeErrorKind(w, errorKindNotFound, "attachment_not_found", "attachment not found")
 		return
 	}
 
@@ -140,60 +624,141 @@ func parseCreateMessagePayload(
 	w http.ResponseWriter,
 	r *http.Request,
 	chatService *chat.Service,
-) (string, string, []chat.AttachmentUploadInput, error) {
+) (createMessagePayload, error) {
 	contentType := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Type")))
 	if strings.HasPrefix(contentType, "multipart/form-data") {
 		maxBytes, maxFiles, _ := chatService.AttachmentUploadRules()
 		maxBodyBytes := int64(maxBytes*maxFiles + multipartBodySlackBytes)
 		r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
 		if err := r.ParseMultipartForm(maxBodyBytes); err != nil {
-			return "", "", nil, errInvalidMultipartPayload
+			return createMessagePayload{}, errInvalidMultipartPayload
 		}
 		if r.MultipartForm == nil {
-			return "", "", nil, errInvalidMultipartPayload
+			return createMessagePayload{}, errInvalidMultipartPayload
 		}
 
 		files := r.MultipartForm.File["files"]
 		if len(files) > maxFiles {
-			return "", "", nil, errAttachmentCountExceeded
+			return createMessagePayload{}, errAttachmentCountExceeded
 		}
 
+		altTexts := r.MultipartForm.Value["files_alt"]
 		uploads := make([]chat.AttachmentUploadInput, 0, len(files))
-		for _, header := range files {
+		for index, header := range files {
 			file, openErr := header.Open()
 			if openErr != nil {
-				return "", "", nil, errAttachmentReadFailed
+				return createMessagePayload{}, errAttachmentReadFailed
 			}
 
 			content, readErr := io.ReadAll(io.LimitReader(file, int64(maxBytes+1)))
 			closeErr := file.Close()
 			if readErr != nil || closeErr != nil {
-				return "", "", nil, errAttachmentReadFailed
+				return createMessagePayload{}, errAttachmentReadFailed
 			}
 			if len(content) > maxBytes {
-				return "", "", nil, errAttachmentTooLarge
+				return createMessagePayload{}, errAttachmentTooLarge
 			}
 
-			uploads = append(uploads, chat.AttachmentUploadInput{
+			upload := chat.AttachmentUploadInput{
 				FileName:    header.Filename,
 				ContentType: strings.TrimSpace(header.Header.Get("Content-Type")),
 				Data:        content,
-			})
+			}
+			if index < len(altTexts) {
+				upload.AltText = altTexts[index]
+			}
+			uploads = append(uploads, upload)
 		}
 
-		return r.FormValue("body"), strings.TrimSpace(r.FormValue("reply_to_message_id")), uploads, nil
+		return createMessagePayload{
+			Body:             r.FormValue("body"),
+			Format:           strings.TrimSpace(r.FormValue("format")),
+			ReplyToMessageID: strings.TrimSpace(r.FormValue("reply_to_message_id")),
+			SendAt:           strings.TrimSpace(r.FormValue("send_at")),
+			Uploads:          uploads,
+			Visibility:       strings.TrimSpace(r.FormValue("visibility")),
+			VisibleTo:        r.MultipartForm.Value["visible_to"],
+		}, nil
 	}
 
+	// Base64 attachments inflate by 4/3, so the JSON body gets matching headroom.
+	maxBytes, maxFiles, _ := chatService.AttachmentUploadRules()
+	r.Body = http.MaxBytesReader(w, r.Body, int64(base64.StdEncoding.EncodedLen(maxBytes)*maxFiles+multipartBodySlackBytes))
+
 	var body struct {
-		Body             string `json:"body"`
-		ReplyToMessageID string `json:"reply_to_message_id"`
+		Body             string   `json:"body"`
+		Format           string   `json:"format"`
+		ReplyToMessageID string   `json:"reply_to_message_id"`
+		SendAt           string   `json:"send_at"`
+		Visibility       string   `json:"visibility"`
+		VisibleTo        []string `json:"visible_to"`
+		ForwardFrom      *struct {
+			ChannelID string `json:"channel_id"`
+			MessageID string `json:"message_id"`
+		} `json:"forward_from"`
+		Attachments []struct {
+			FileName    string `json:"file_name"`
+			ContentType string `json:"content_type"`
+			DataB64     string `json:"data_b64"`
+			AltText     string `json:"alt_text"`
+		} `json:"attachments"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		return "", "", nil, errInvalidMessagePayload
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			return createMessagePayload{}, errAttachmentTooLarge
+		}
+		return createMessagePayload{}, errInvalidMessagePayload
 	}
-	return body.Body, strings.TrimSpace(body.ReplyToMessageID), nil, nil
+	if len(body.Attachments) > maxFiles {
+		return createMessagePayload{}, errAttachmentCountExceeded
+	}
+
+	uploads := make([]chat.AttachmentUploadInput, 0, len(body.Attachments))
+	for _, attachment := range body.Attachments {
+		if len(attachment.DataB64) > base64.StdEncoding.EncodedLen(maxBytes) {
+			return createMessagePayload{}, errAttachmentTooLarge
+		}
+		content, err := base64.StdEncoding.DecodeString(attachment.DataB64)
+		if err != nil {
+			return createMessagePayload{}, errAttachmentEncoding
+		}
+		if len(content) > maxBytes {
+			return createMessagePayload{}, errAttachmentTooLarge
+		}
+		uploads = append(uploads, chat.AttachmentUploadInput{
+			FileName:    attachment.FileName,
+			ContentType: strings.TrimSpace(attachment.ContentType),
+			Data:        content,
+			AltText:     attachment.AltText,
+		})
+	}
+
+	payload := createMessagePayload{
+		Body:             body.Body,
+		Format:           strings.TrimSpace(body.Format),
+		ReplyToMessageID: strings.TrimSpace(body.ReplyToMessageID),
+		SendAt:           strings.TrimSpace(body.SendAt),
+		Uploads:          uploads,
+		Visibility:       strings.TrimSpace(body.Visibility),
+		VisibleTo:        body.VisibleTo,
+	}
+	if body.ForwardFrom != nil {
+		payload.ForwardFrom = &chat.ForwardSource{
+			ChannelID: body.ForwardFrom.ChannelID,
+			MessageID: body.ForwardFrom.MessageID,
+		}
+	}
+	return payload, nil
 }
 
 func (s *Server) realtimeWS(w http.ResponseWriter, r *http.Request) {
+	if s.refuseDuringMaintenance(w, r) {
+		return
+	}
 	s.realtime.ServeWS(w, r)
 }
+
+func (s *Server) getRealtimeHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.realtime.Health())
+}
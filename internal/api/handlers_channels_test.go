@@ -2,16 +2,24 @@ package api
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"github.com/openchat/openchat-backend/internal/app"
+	"github.com/openchat/openchat-backend/internal/chat"
 )
 
 var onePixelPNG = []byte{
@@ -242,3 +250,1375 @@ func TestCreateMessageRejectsUnknownReplyTarget(t *testing.T) {
 		t.Fatalf("expected reply_target_not_found code, got %s", apiErr.Code)
 	}
 }
+
+func TestListMessagesEmptyChannelReturnsEmptyList(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/channels/ch_release/messages")
+	if err != nil {
+		t.Fatalf("list messages request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status: %d body=%s", resp.StatusCode, string(payload))
+	}
+
+	var payload struct {
+		ChannelID string            `json:"channel_id"`
+		Messages  []json.RawMessage `json:"messages"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode list response: %v", err)
+	}
+	if payload.ChannelID != "ch_release" {
+		t.Fatalf("expected channel_id ch_release, got %q", payload.ChannelID)
+	}
+	if payload.Messages == nil {
+		t.Fatalf("expected messages to be an empty array, got null")
+	}
+	if len(payload.Messages) != 0 {
+		t.Fatalf("expected no messages, got %d", len(payload.Messages))
+	}
+}
+
+func TestListMessagesUnknownChannelReturnsNotFound(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/channels/ch_missing_404/messages")
+	if err != nil {
+		t.Fatalf("list messages request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status: %d body=%s", resp.StatusCode, string(payload))
+	}
+
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if apiErr.Code != "channel_not_found" {
+		t.Fatalf("expected channel_not_found code, got %s", apiErr.Code)
+	}
+}
+
+func TestCreateMessageMarkdownFormatRoundTrips(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	raw, err := json.Marshal(map[string]string{"body": "**shipped**", "format": "markdown"})
+	if err != nil {
+		t.Fatalf("marshal request body: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/channels/ch_general/messages", bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("build create request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_format_test")
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("send create request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected create status: %d body=%s", resp.StatusCode, string(payload))
+	}
+
+	var created struct {
+		Message struct {
+			ID     string `json:"id"`
+			Format string `json:"format"`
+		} `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode create response: %v", err)
+	}
+	if created.Message.Format != "markdown" {
+		t.Fatalf("expected markdown format on create, got %q", created.Message.Format)
+	}
+
+	listResp, err := http.Get(ts.URL + "/v1/channels/ch_general/messages")
+	if err != nil {
+		t.Fatalf("list messages request failed: %v", err)
+	}
+	defer listResp.Body.Close()
+
+	var listed struct {
+		Messages []struct {
+			ID     string `json:"id"`
+			Format string `json:"format"`
+		} `json:"messages"`
+	}
+	if err := json.NewDecoder(listResp.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode list response: %v", err)
+	}
+	var found bool
+	for _, message := range listed.Messages {
+		if message.ID == created.Message.ID {
+			found = true
+			if message.Format != "markdown" {
+				t.Fatalf("expected stored markdown format, got %q", message.Format)
+			}
+		} else if message.Format != "plain" {
+			t.Fatalf("expected default plain format for %s, got %q", message.ID, message.Format)
+		}
+	}
+	if !found {
+		t.Fatalf("expected created message in channel listing")
+	}
+
+	invalidRaw, _ := json.Marshal(map[string]string{"body": "<b>hi</b>", "format": "html"})
+	invalidReq, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/channels/ch_general/messages", bytes.NewReader(invalidRaw))
+	if err != nil {
+		t.Fatalf("build invalid format request: %v", err)
+	}
+	invalidReq.Header.Set("X-OpenChat-User-UID", "uid_format_test")
+	invalidReq.Header.Set("Content-Type", "application/json")
+	invalidResp, err := http.DefaultClient.Do(invalidReq)
+	if err != nil {
+		t.Fatalf("send invalid format request: %v", err)
+	}
+	defer invalidResp.Body.Close()
+	if invalidResp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unsupported format, got %d", invalidResp.StatusCode)
+	}
+}
+
+type testUpload struct {
+	FileName    string
+	ContentType string
+	Content     []byte
+	AltText     string
+}
+
+func postMultipartMessage(t *testing.T, baseURL string, channelID string, userUID string, fields map[string]string, uploads []testUpload) *http.Response {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	for key, value := range fields {
+		if err := writer.WriteField(key, value); err != nil {
+			t.Fatalf("write %s field: %v", key, err)
+		}
+	}
+	for _, upload := range uploads {
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", `form-data; name="files"; filename="`+upload.FileName+`"`)
+		contentType := upload.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			t.Fatalf("create multipart file: %v", err)
+		}
+		if _, err := part.Write(upload.Content); err != nil {
+			t.Fatalf("write multipart file: %v", err)
+		}
+		if err := writer.WriteField("files_alt", upload.AltText); err != nil {
+			t.Fatalf("write files_alt field: %v", err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/v1/channels/"+channelID+"/messages", &body)
+	if err != nil {
+		t.Fatalf("build create request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", userUID)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("send create request: %v", err)
+	}
+	return resp
+}
+
+func postJSONMessage(t *testing.T, baseURL string, channelID string, userUID string, payload map[string]any) *http.Response {
+	t.Helper()
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatalf("marshal request body: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/v1/channels/"+channelID+"/messages", bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("build create request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", userUID)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("send create request: %v", err)
+	}
+	return resp
+}
+
+type createdMessageResponse struct {
+	Message struct {
+		ID      string `json:"id"`
+		Seq     int64  `json:"seq"`
+		Body    string `json:"body"`
+		ReplyTo *struct {
+			MessageID   string `json:"message_id"`
+			PreviewText string `json:"preview_text"`
+		} `json:"reply_to"`
+		ForwardedFrom *struct {
+			ChannelID string `json:"channel_id"`
+			MessageID string `json:"message_id"`
+			AuthorUID string `json:"author_uid"`
+		} `json:"forwarded_from"`
+		Attachments []struct {
+			AttachmentID string `json:"attachment_id"`
+			Kind         string `json:"kind"`
+			FileName     string `json:"file_name"`
+			URL          string `json:"url"`
+			ContentType  string `json:"content_type"`
+			Width        int    `json:"width"`
+			Height       int    `json:"height"`
+			AltText      string `json:"alt_text"`
+		} `json:"attachments"`
+	} `json:"message"`
+}
+
+func decodeCreatedMessage(t *testing.T, resp *http.Response) createdMessageResponse {
+	t.Helper()
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected create status: %d body=%s", resp.StatusCode, string(payload))
+	}
+	var created createdMessageResponse
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode create response: %v", err)
+	}
+	return created
+}
+
+func TestReplyToAttachmentOnlyMessageNamesAttachment(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	target := decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_reply_test", map[string]string{"body": "  "}, []testUpload{
+		{FileName: "sunset.png", ContentType: "image/png", Content: onePixelPNG},
+	}))
+	if target.Message.Body != "" {
+		t.Fatalf("expected attachment-only message, got body %q", target.Message.Body)
+	}
+
+	reply := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_reply_test", map[string]any{
+		"body":                "nice shot",
+		"reply_to_message_id": target.Message.ID,
+	}))
+	if reply.Message.ReplyTo == nil {
+		t.Fatalf("expected reply_to payload")
+	}
+	if reply.Message.ReplyTo.PreviewText != "📎 sunset.png" {
+		t.Fatalf("expected attachment preview, got %q", reply.Message.ReplyTo.PreviewText)
+	}
+}
+
+func TestCreateMessageRejectsZeroByteAttachment(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	resp := postMultipartMessage(t, ts.URL, "ch_general", "uid_empty_upload", map[string]string{"body": "   "}, []testUpload{
+		{FileName: "empty.png", ContentType: "image/png", Content: nil},
+	})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status: %d body=%s", resp.StatusCode, string(payload))
+	}
+
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if apiErr.Code != "attachment_empty" {
+		t.Fatalf("expected attachment_empty code, got %s", apiErr.Code)
+	}
+}
+
+func TestCreateMessageValidatesSniffedAttachmentType(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	pngBytes := testPNGBytes(t)
+
+	mislabeled := postMultipartMessage(t, ts.URL, "ch_general", "uid_sniff", nil, []testUpload{
+		{FileName: "photo.jpg", ContentType: "image/jpeg", Content: pngBytes},
+	})
+	defer mislabeled.Body.Close()
+	if mislabeled.StatusCode != http.StatusBadRequest {
+		payload, _ := io.ReadAll(mislabeled.Body)
+		t.Fatalf("expected mislabeled upload to be rejected, got %d body=%s", mislabeled.StatusCode, string(payload))
+	}
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(mislabeled.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if apiErr.Code != "attachment_type_mismatch" {
+		t.Fatalf("expected attachment_type_mismatch code, got %s", apiErr.Code)
+	}
+
+	unlabeled := decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_sniff", nil, []testUpload{
+		{FileName: "photo.bin", Content: pngBytes},
+	}))
+	if len(unlabeled.Message.Attachments) != 1 {
+		t.Fatalf("expected 1 attachment, got %d", len(unlabeled.Message.Attachments))
+	}
+	if contentType := unlabeled.Message.Attachments[0].ContentType; contentType != "image/png" {
+		t.Fatalf("expected sniffed image/png content type, got %s", contentType)
+	}
+}
+
+func TestCreateMessageAcceptsNonImageAttachments(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	created := decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_files", nil, []testUpload{
+		{FileName: "minutes.pdf", ContentType: "application/pdf", Content: []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n1 0 obj\n<<>>\nendobj\n")},
+		{FileName: "jingle.mp3", ContentType: "audio/mpeg", Content: []byte("ID3\x04\x00\x00\x00\x00\x00\x00frames")},
+	}))
+	if len(created.Message.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(created.Message.Attachments))
+	}
+	for idx, want := range []string{"file", "audio"} {
+		attachment := created.Message.Attachments[idx]
+		if attachment.Kind != want || attachment.Width != 0 || attachment.Height != 0 {
+			t.Fatalf("expected %s attachment without dimensions, got %+v", want, attachment)
+		}
+	}
+
+	picture := decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_files", nil, []testUpload{
+		{FileName: "dot.png", ContentType: "image/png", Content: onePixelPNG},
+	}))
+	if kind := picture.Message.Attachments[0].Kind; kind != "image" {
+		t.Fatalf("expected image kind, got %q", kind)
+	}
+
+	broken := postMultipartMessage(t, ts.URL, "ch_general", "uid_files", nil, []testUpload{
+		{FileName: "broken.png", ContentType: "image/png", Content: []byte("definitely not a png")},
+	})
+	defer broken.Body.Close()
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	_ = json.NewDecoder(broken.Body).Decode(&apiErr)
+	if broken.StatusCode != http.StatusBadRequest || apiErr.Code != "attachment_invalid_image" {
+		t.Fatalf("expected declared image that fails to decode to be rejected, got %d %q", broken.StatusCode, apiErr.Code)
+	}
+}
+
+func TestCreateMessageInReadOnlyChannelRequiresAuthorRole(t *testing.T) {
+	cfg := testConfig()
+	cfg.AuthorUIDs = []string{"uid_release_author"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	rejected := postJSONMessage(t, ts.URL, "ch_release", "uid_regular_member", map[string]any{"body": "can I post here?"})
+	defer rejected.Body.Close()
+	if rejected.StatusCode != http.StatusForbidden {
+		payload, _ := io.ReadAll(rejected.Body)
+		t.Fatalf("expected 403 for regular member, got %d body=%s", rejected.StatusCode, string(payload))
+	}
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(rejected.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if apiErr.Code != "channel_read_only" {
+		t.Fatalf("expected channel_read_only code, got %s", apiErr.Code)
+	}
+
+	created := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_release", "uid_release_author", map[string]any{"body": "v1.2 is out"}))
+	if created.Message.Body != "v1.2 is out" {
+		t.Fatalf("expected author post to succeed, got %q", created.Message.Body)
+	}
+}
+
+func TestReplyPreviewTruncatesOnRuneBoundary(t *testing.T) {
+	cfg := testConfig()
+	cfg.ReplyPreviewMaxRunes = 10
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	long := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_preview_author", map[string]any{
+		"body": "こんにちは世界、長いメッセージです",
+	}))
+	reply := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_preview_reply", map[string]any{
+		"body":                "replying",
+		"reply_to_message_id": long.Message.ID,
+	}))
+	if reply.Message.ReplyTo == nil {
+		t.Fatalf("expected reply_to payload")
+	}
+	preview := reply.Message.ReplyTo.PreviewText
+	if !utf8.ValidString(preview) {
+		t.Fatalf("expected valid utf-8 preview, got %q", preview)
+	}
+	if preview != "こんにちは世界、長…" {
+		t.Fatalf("unexpected preview %q", preview)
+	}
+	if count := utf8.RuneCountInString(preview); count != 10 {
+		t.Fatalf("expected preview of 10 runes, got %d", count)
+	}
+
+	capsResp, err := http.Get(ts.URL + "/v1/client/capabilities")
+	if err != nil {
+		t.Fatalf("capabilities request failed: %v", err)
+	}
+	defer capsResp.Body.Close()
+	var caps struct {
+		Limits struct {
+			ReplyPreviewMaxRunes int `json:"reply_preview_max_runes"`
+		} `json:"limits"`
+	}
+	if err := json.NewDecoder(capsResp.Body).Decode(&caps); err != nil {
+		t.Fatalf("decode capabilities: %v", err)
+	}
+	if caps.Limits.ReplyPreviewMaxRunes != 10 {
+		t.Fatalf("expected advertised preview length 10, got %d", caps.Limits.ReplyPreviewMaxRunes)
+	}
+}
+
+func TestRecentMessagesAcrossChannels(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	raw, _ := json.Marshal(map[string]any{
+		"channel_ids": []string{"ch_general", "ch_design", "ch_missing"},
+		"per_channel": 1,
+	})
+	resp, err := http.Post(ts.URL+"/v1/channels:recent", "application/json", bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("recent messages request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status: %d body=%s", resp.StatusCode, string(payload))
+	}
+
+	var payload struct {
+		Channels map[string][]struct {
+			ID string `json:"id"`
+		} `json:"channels"`
+		UnknownChannelIDs []string `json:"unknown_channel_ids"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode recent messages: %v", err)
+	}
+	if len(payload.Channels) != 2 {
+		t.Fatalf("expected recents for 2 channels, got %d", len(payload.Channels))
+	}
+	if general := payload.Channels["ch_general"]; len(general) != 1 || general[0].ID != "msg_seed_02" {
+		t.Fatalf("expected latest ch_general message msg_seed_02, got %+v", general)
+	}
+	if design := payload.Channels["ch_design"]; len(design) != 1 || design[0].ID != "msg_seed_11" {
+		t.Fatalf("expected latest ch_design message msg_seed_11, got %+v", design)
+	}
+	if len(payload.UnknownChannelIDs) != 1 || payload.UnknownChannelIDs[0] != "ch_missing" {
+		t.Fatalf("expected ch_missing to be reported unknown, got %v", payload.UnknownChannelIDs)
+	}
+}
+
+func TestModeratorBulkDeleteReportsPerMessageResults(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_bulk_moderator"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	first := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_spammer", map[string]any{"body": "spam one"}))
+	second := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_spammer", map[string]any{"body": "spam two"}))
+	watcher := dialRealtime(t, ts.URL, "uid_bulk_watcher")
+	subscribeRealtime(t, watcher, "ch_general")
+
+	bulkDelete := func(userUID string, messageIDs []string) *http.Response {
+		raw, _ := json.Marshal(map[string]any{"message_ids": messageIDs})
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/channels/ch_general/messages:delete", bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("build bulk delete request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("bulk delete request failed: %v", err)
+		}
+		return resp
+	}
+
+	forbidden := bulkDelete("uid_regular_member", []string{first.Message.ID})
+	forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-moderator, got %d", forbidden.StatusCode)
+	}
+	tooMany := bulkDelete("uid_bulk_moderator", make([]string, maxBulkDeleteMessages+1))
+	tooMany.Body.Close()
+	if tooMany.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 past the batch cap, got %d", tooMany.StatusCode)
+	}
+
+	resp := bulkDelete("uid_bulk_moderator", []string{first.Message.ID, "msg_missing", second.Message.ID, first.Message.ID})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected bulk delete status: %d body=%s", resp.StatusCode, string(payload))
+	}
+	var out struct {
+		Results []struct {
+			MessageID string `json:"message_id"`
+			Status    string `json:"status"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode bulk delete response: %v", err)
+	}
+	want := []string{first.Message.ID + "=deleted", "msg_missing=not_found", second.Message.ID + "=deleted"}
+	got := make([]string, 0, len(out.Results))
+	for _, result := range out.Results {
+		got = append(got, result.MessageID+"="+result.Status)
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected results %v, got %v", want, got)
+	}
+
+	for _, messageID := range []string{first.Message.ID, second.Message.ID} {
+		envelope := expectRealtimeEnvelope(t, watcher, "chat.message.deleted")
+		if !strings.Contains(string(envelope.Payload), `"id":"`+messageID+`"`) {
+			t.Fatalf("expected deletion of %s, got %s", messageID, envelope.Payload)
+		}
+	}
+}
+
+func TestModeratorPurgeClearsChannelAndBroadcasts(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_purge_moderator"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	watcher := dialRealtime(t, ts.URL, "uid_purge_watcher")
+	subscribeRealtime(t, watcher, "ch_general")
+
+	purge := func(userUID string, query string) *http.Response {
+		req, err := http.NewRequest(http.MethodDelete, ts.URL+"/v1/channels/ch_general/messages"+query, nil)
+		if err != nil {
+			t.Fatalf("build purge request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("purge request failed: %v", err)
+		}
+		return resp
+	}
+
+	unconfirmed := purge("uid_purge_moderator", "")
+	unconfirmed.Body.Close()
+	if unconfirmed.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 without confirmation, got %d", unconfirmed.StatusCode)
+	}
+	forbidden := purge("uid_regular_member", "?confirm=true")
+	forbidden.Body.Close()
+	if forbidden.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-moderator, got %d", forbidden.StatusCode)
+	}
+
+	resp := purge("uid_purge_moderator", "?confirm=true")
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected purge status: %d body=%s", resp.StatusCode, string(payload))
+	}
+
+	envelope := expectRealtimeEnvelope(t, watcher, "chat.channel.purged")
+	var purged struct {
+		ChannelID string `json:"channel_id"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &purged); err != nil {
+		t.Fatalf("decode purge event: %v", err)
+	}
+	if purged.ChannelID != "ch_general" {
+		t.Fatalf("expected purge event for ch_general, got %s", purged.ChannelID)
+	}
+
+	list, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages")
+	if list.Total != 0 {
+		t.Fatalf("expected purged channel to be empty, got total %d", list.Total)
+	}
+}
+
+func TestModeratorSetsChannelTopic(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_topic_moderator"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	watcher := dialRealtime(t, ts.URL, "uid_topic_watcher")
+	subscribeRealtime(t, watcher, "ch_general")
+
+	setTopic := func(userUID string, topic string) int {
+		raw, _ := json.Marshal(map[string]any{"topic": topic})
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/channels/ch_general/topic", bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("build topic request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("topic request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := setTopic("uid_regular_member", "hijacked"); status != http.StatusForbidden {
+		t.Fatalf("expected 403 for non-moderator, got %d", status)
+	}
+	if status := setTopic("uid_topic_moderator", strings.Repeat("t", 257)); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an overlong topic, got %d", status)
+	}
+	if status := setTopic("uid_topic_moderator", "Release planning this week"); status != http.StatusOK {
+		t.Fatalf("expected moderator to set topic, got %d", status)
+	}
+
+	envelope := expectRealtimeEnvelope(t, watcher, "chat.channel.topic.updated")
+	var updated struct {
+		ChannelID string `json:"channel_id"`
+		Topic     string `json:"topic"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &updated); err != nil {
+		t.Fatalf("decode topic event: %v", err)
+	}
+	if updated.ChannelID != "ch_general" || updated.Topic != "Release planning this week" {
+		t.Fatalf("unexpected topic event: %+v", updated)
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/servers/srv_harbor/channels")
+	if err != nil {
+		t.Fatalf("channel groups request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var groups struct {
+		Groups []struct {
+			Channels []struct {
+				ID    string `json:"id"`
+				Topic string `json:"topic"`
+			} `json:"channels"`
+		} `json:"groups"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&groups); err != nil {
+		t.Fatalf("decode channel groups: %v", err)
+	}
+	topics := make(map[string]string)
+	for _, group := range groups.Groups {
+		for _, channel := range group.Channels {
+			topics[channel.ID] = channel.Topic
+		}
+	}
+	if topics["ch_general"] != "Release planning this week" || topics["ch_design"] != "" {
+		t.Fatalf("unexpected channel topics in listing: %v", topics)
+	}
+}
+
+func TestCreateMessageAttachmentAltTextRoundTrips(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	created := decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_alt_text", nil, []testUpload{
+		{FileName: "harbor.png", ContentType: "image/png", Content: onePixelPNG, AltText: "  Boats moored at dusk  "},
+		{FileName: "plain.png", ContentType: "image/png", Content: onePixelPNG},
+	}))
+	if len(created.Message.Attachments) != 2 {
+		t.Fatalf("expected 2 attachments, got %d", len(created.Message.Attachments))
+	}
+	if alt := created.Message.Attachments[0].AltText; alt != "Boats moored at dusk" {
+		t.Fatalf("expected trimmed alt text, got %q", alt)
+	}
+	if alt := created.Message.Attachments[1].AltText; alt != "" {
+		t.Fatalf("expected no alt text on second attachment, got %q", alt)
+	}
+
+	tooLong := postMultipartMessage(t, ts.URL, "ch_general", "uid_alt_text", nil, []testUpload{
+		{FileName: "harbor.png", ContentType: "image/png", Content: onePixelPNG, AltText: strings.Repeat("a", chat.MaxAttachmentAltTextRunes+1)},
+	})
+	defer tooLong.Body.Close()
+	if tooLong.StatusCode != http.StatusBadRequest {
+		payload, _ := io.ReadAll(tooLong.Body)
+		t.Fatalf("expected 400 for long alt text, got %d body=%s", tooLong.StatusCode, string(payload))
+	}
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(tooLong.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if apiErr.Code != "attachment_alt_too_long" {
+		t.Fatalf("expected attachment_alt_too_long code, got %s", apiErr.Code)
+	}
+}
+
+func TestForwardMessageBetweenChannels(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	source := decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_forward_author", map[string]string{"body": "ship it"}, []testUpload{
+		{FileName: "build.png", ContentType: "image/png", Content: onePixelPNG},
+	}))
+
+	forwarded := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_design", "uid_forwarder", map[string]any{
+		"forward_from": map[string]any{"channel_id": "ch_general", "message_id": source.Message.ID},
+	}))
+	if forwarded.Message.ForwardedFrom == nil {
+		t.Fatalf("expected forwarded_from reference")
+	}
+	reference := *forwarded.Message.ForwardedFrom
+	if reference.ChannelID != "ch_general" || reference.MessageID != source.Message.ID || reference.AuthorUID != "uid_forward_author" {
+		t.Fatalf("unexpected forwarded_from reference: %+v", reference)
+	}
+	if forwarded.Message.Body != "ship it" {
+		t.Fatalf("expected forwarded body to be copied, got %q", forwarded.Message.Body)
+	}
+	if len(forwarded.Message.Attachments) != 1 {
+		t.Fatalf("expected 1 forwarded attachment, got %d", len(forwarded.Message.Attachments))
+	}
+	forwardedAttachment := forwarded.Message.Attachments[0]
+	if forwardedAttachment.AttachmentID == source.Message.Attachments[0].AttachmentID ||
+		!strings.Contains(forwardedAttachment.URL, "/v1/channels/ch_design/attachments/"+forwardedAttachment.AttachmentID) {
+		t.Fatalf("expected forwarded attachment to get its own id in the target channel, got %+v", forwardedAttachment)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/v1/channels/ch_general/messages/"+source.Message.ID, nil)
+	if err != nil {
+		t.Fatalf("build delete request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_forward_author")
+	deleted, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("delete request failed: %v", err)
+	}
+	deleted.Body.Close()
+	if deleted.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 deleting the source, got %d", deleted.StatusCode)
+	}
+	assetResp, err := http.Get(ts.URL + "/v1/channels/ch_design/attachments/" + forwardedAttachment.AttachmentID)
+	if err != nil {
+		t.Fatalf("fetch forwarded attachment: %v", err)
+	}
+	content, _ := io.ReadAll(assetResp.Body)
+	assetResp.Body.Close()
+	if assetResp.StatusCode != http.StatusOK || !bytes.Equal(content, onePixelPNG) {
+		t.Fatalf("expected forwarded attachment to outlive its source, got %d", assetResp.StatusCode)
+	}
+
+	missing := postJSONMessage(t, ts.URL, "ch_design", "uid_forwarder", map[string]any{
+		"forward_from": map[string]any{"channel_id": "ch_general", "message_id": "msg_missing"},
+	})
+	defer missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		payload, _ := io.ReadAll(missing.Body)
+		t.Fatalf("expected 404 for unknown forward source, got %d body=%s", missing.StatusCode, string(payload))
+	}
+}
+
+func TestPollMessagesHonorsRequestTimeoutHeader(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	poll := func(afterSeq int64) (time.Duration, []json.RawMessage) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/channels/ch_general/messages:poll?after_seq="+strconv.FormatInt(afterSeq, 10), nil)
+		if err != nil {
+			t.Fatalf("build poll request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-Request-Timeout", "1")
+		started := time.Now()
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("poll request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("unexpected poll status: %d body=%s", resp.StatusCode, string(body))
+		}
+		var payload struct {
+			Messages []json.RawMessage `json:"messages"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode poll response: %v", err)
+		}
+		return time.Since(started), payload.Messages
+	}
+
+	created := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_poller", map[string]any{"body": "latest"}))
+
+	elapsed, messages := poll(created.Message.Seq)
+	if len(messages) != 0 {
+		t.Fatalf("expected empty poll result, got %d messages", len(messages))
+	}
+	if elapsed < 900*time.Millisecond || elapsed > 3*time.Second {
+		t.Fatalf("expected poll to return after about 1s, took %s", elapsed)
+	}
+
+	elapsed, messages = poll(created.Message.Seq - 1)
+	if len(messages) != 1 || elapsed > 500*time.Millisecond {
+		t.Fatalf("expected immediate single message, got %d after %s", len(messages), elapsed)
+	}
+}
+
+func TestCreateMessageWithFutureSendAtIsScheduled(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	resp := postJSONMessage(t, ts.URL, "ch_general", "uid_schedule_api", map[string]any{
+		"body":    "later",
+		"send_at": time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected 202 for scheduled message, got %d", resp.StatusCode)
+	}
+	var scheduled struct {
+		Scheduled        bool `json:"scheduled"`
+		ScheduledMessage struct {
+			ID string `json:"id"`
+		} `json:"scheduled_message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&scheduled); err != nil {
+		t.Fatalf("decode scheduled response: %v", err)
+	}
+	if !scheduled.Scheduled || scheduled.ScheduledMessage.ID == "" {
+		t.Fatalf("unexpected scheduled response %+v", scheduled)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/v1/channels/ch_general/scheduled-messages/"+scheduled.ScheduledMessage.ID, nil)
+	if err != nil {
+		t.Fatalf("build cancel request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_schedule_api")
+	cancelResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("cancel request failed: %v", err)
+	}
+	cancelResp.Body.Close()
+	if cancelResp.StatusCode != http.StatusNoContent {
+		t.Fatalf("expected 204 on cancel, got %d", cancelResp.StatusCode)
+	}
+}
+
+func TestScheduleMessageValidatesUpFrontAndCapsPending(t *testing.T) {
+	cfg := testConfig()
+	cfg.MessageMaxScheduled = 2
+	ts := httptest.NewServer(NewServer(cfg, slog.Default()).Router())
+	defer ts.Close()
+
+	sendAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	invalid := []struct {
+		name    string
+		payload map[string]any
+		code    string
+	}{
+		{"missing reply target", map[string]any{"body": "later", "send_at": sendAt, "reply_to_message_id": "msg_missing"}, "reply_target_not_found"},
+		{"unknown visibility", map[string]any{"body": "later", "send_at": sendAt, "visibility": "secret"}, "visibility_invalid"},
+	}
+	for _, tc := range invalid {
+		resp := postJSONMessage(t, ts.URL, "ch_general", "uid_schedule_cap", tc.payload)
+		var apiErr struct {
+			Code string `json:"code"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest || apiErr.Code != tc.code {
+			t.Fatalf("%s: expected 400 %s, got %d %q", tc.name, tc.code, resp.StatusCode, apiErr.Code)
+		}
+	}
+
+	for idx := 0; idx < 2; idx++ {
+		resp := postJSONMessage(t, ts.URL, "ch_general", "uid_schedule_cap", map[string]any{"body": "later", "send_at": sendAt})
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("expected 202 for scheduled message %d, got %d", idx, resp.StatusCode)
+		}
+	}
+	resp := postJSONMessage(t, ts.URL, "ch_general", "uid_schedule_cap", map[string]any{"body": "one too many", "send_at": sendAt})
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 past the pending cap, got %d", resp.StatusCode)
+	}
+	other := postJSONMessage(t, ts.URL, "ch_general", "uid_schedule_other", map[string]any{"body": "mine", "send_at": sendAt})
+	other.Body.Close()
+	if other.StatusCode != http.StatusAccepted {
+		t.Fatalf("expected the cap to be per user, got %d", other.StatusCode)
+	}
+}
+
+func TestDisabledAttachmentsFeatureRejectsUploads(t *testing.T) {
+	cfg := testConfig()
+	cfg.DisableAttachments = true
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	capsResp, err := http.Get(ts.URL + "/v1/client/capabilities")
+	if err != nil {
+		t.Fatalf("capabilities request failed: %v", err)
+	}
+	defer capsResp.Body.Close()
+	var caps struct {
+		Features struct {
+			Messaging   bool `json:"messaging"`
+			Attachments bool `json:"attachments"`
+		} `json:"features"`
+	}
+	if err := json.NewDecoder(capsResp.Body).Decode(&caps); err != nil {
+		t.Fatalf("decode capabilities: %v", err)
+	}
+	if caps.Features.Attachments || !caps.Features.Messaging {
+		t.Fatalf("expected attachments off and messaging on, got %+v", caps.Features)
+	}
+
+	resp := postMultipartMessage(t, ts.URL, "ch_general", "uid_no_uploads", map[string]string{"body": "with file"}, []testUpload{
+		{FileName: "pixel.png", ContentType: "image/png", Content: onePixelPNG},
+	})
+	defer resp.Body.Close()
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if resp.StatusCode != http.StatusForbidden || apiErr.Code != "feature_disabled" {
+		t.Fatalf("expected 403 feature_disabled, got %d %q", resp.StatusCode, apiErr.Code)
+	}
+
+	decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_no_uploads", map[string]any{"body": "text still works"}))
+}
+
+func TestCreateMessageWithBase64JSONAttachment(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	created := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_base64_test", map[string]any{
+		"body": "from an embedded client",
+		"attachments": []map[string]any{
+			{"file_name": "pixel.png", "content_type": "image/png", "data_b64": base64.StdEncoding.EncodeToString(onePixelPNG)},
+		},
+	}))
+	if len(created.Message.Attachments) != 1 {
+		t.Fatalf("expected one attachment, got %d", len(created.Message.Attachments))
+	}
+	attachment := created.Message.Attachments[0]
+	if attachment.FileName != "pixel.png" || attachment.ContentType != "image/png" {
+		t.Fatalf("unexpected attachment metadata: %+v", attachment)
+	}
+
+	assetResp, err := http.Get(ts.URL + "/v1/channels/ch_general/attachments/" + attachment.AttachmentID)
+	if err != nil {
+		t.Fatalf("fetch attachment: %v", err)
+	}
+	defer assetResp.Body.Close()
+	assetBody, err := io.ReadAll(assetResp.Body)
+	if err != nil {
+		t.Fatalf("read attachment body: %v", err)
+	}
+	if assetResp.StatusCode != http.StatusOK || !bytes.Equal(assetBody, onePixelPNG) {
+		t.Fatalf("expected stored png bytes, got status %d", assetResp.StatusCode)
+	}
+
+	resp := postJSONMessage(t, ts.URL, "ch_general", "uid_base64_test", map[string]any{
+		"attachments": []map[string]any{
+			{"file_name": "pixel.png", "content_type": "image/png", "data_b64": "not base64!"},
+		},
+	})
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed base64, got %d", resp.StatusCode)
+	}
+}
+
+func TestDeleteMessageLeavesBlankedTombstone(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	created := decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_deleter", map[string]string{"body": "oops"}, []testUpload{
+		{FileName: "oops.png", ContentType: "image/png", Content: onePixelPNG},
+	}))
+	deleteAs := func(userUID string) int {
+		req, err := http.NewRequest(http.MethodDelete, ts.URL+"/v1/channels/ch_general/messages/"+created.Message.ID, nil)
+		if err != nil {
+			t.Fatalf("build delete request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("delete request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := deleteAs("uid_someone_else"); status != http.StatusForbidden {
+		t.Fatalf("expected 403 for another user, got %d", status)
+	}
+	if status := deleteAs("uid_deleter"); status != http.StatusNoContent {
+		t.Fatalf("expected 204 for the author, got %d", status)
+	}
+
+	list, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages")
+	var found bool
+	for _, raw := range list.Items {
+		var item struct {
+			ID          string            `json:"id"`
+			Body        string            `json:"body"`
+			Deleted     bool              `json:"deleted"`
+			DeletedAt   string            `json:"deleted_at"`
+			Attachments []json.RawMessage `json:"attachments"`
+		}
+		if err := json.Unmarshal(raw, &item); err != nil {
+			t.Fatalf("decode list item: %v", err)
+		}
+		if item.ID != created.Message.ID {
+			continue
+		}
+		found = true
+		if !item.Deleted || item.DeletedAt == "" || item.Body != "" || len(item.Attachments) != 0 {
+			t.Fatalf("expected blanked tombstone, got %s", string(raw))
+		}
+	}
+	if !found {
+		t.Fatalf("expected deleted message to stay in the list")
+	}
+
+	assetResp, err := http.Get(ts.URL + "/v1/channels/ch_general/attachments/" + created.Message.Attachments[0].AttachmentID)
+	if err != nil {
+		t.Fatalf("fetch attachment: %v", err)
+	}
+	assetResp.Body.Close()
+	if assetResp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected deleted attachment to 404, got %d", assetResp.StatusCode)
+	}
+}
+
+func TestAttachmentOnlyServedForItsOwnChannel(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_attachment_mod"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	created := decodeCreatedMessage(t, postMultipartMessage(t, ts.URL, "ch_general", "uid_scope", nil, []testUpload{
+		{FileName: "scoped.png", ContentType: "image/png", Content: onePixelPNG},
+	}))
+	attachmentID := created.Message.Attachments[0].AttachmentID
+	fetchStatus := func(channelID string) int {
+		resp, err := http.Get(ts.URL + "/v1/channels/" + channelID + "/attachments/" + attachmentID)
+		if err != nil {
+			t.Fatalf("fetch attachment: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status := fetchStatus("ch_general"); status != http.StatusOK {
+		t.Fatalf("expected 200 from the owning channel, got %d", status)
+	}
+	if status := fetchStatus("ch_design"); status != http.StatusNotFound {
+		t.Fatalf("expected 404 from another channel, got %d", status)
+	}
+
+	req, err := http.NewRequest(http.MethodDelete, ts.URL+"/v1/channels/ch_general/messages?confirm=true", nil)
+	if err != nil {
+		t.Fatalf("build purge request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_attachment_mod")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("purge request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected purge status: %d", resp.StatusCode)
+	}
+	if status := fetchStatus("ch_general"); status != http.StatusNotFound {
+		t.Fatalf("expected purged attachment id to 404, got %d", status)
+	}
+}
+
+func TestSearchMessagesMatchesAllTermsNewestFirst(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	for _, body := range []string{"Zebrafish deploy went fine", "zebrafish tank cleaned", "deploy later today"} {
+		decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_searcher", map[string]any{"body": body}))
+	}
+
+	search := func(query string) (int, []byte) {
+		resp, err := http.Get(ts.URL + "/v1/channels/ch_general/messages/search?q=" + url.QueryEscape(query))
+		if err != nil {
+			t.Fatalf("search request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	status, raw := search("ZEBRAFISH")
+	if status != http.StatusOK {
+		t.Fatalf("unexpected search status: %d body=%s", status, string(raw))
+	}
+	var payload struct {
+		Results []struct {
+			Message struct {
+				Body string `json:"body"`
+			} `json:"message"`
+			MessagesAfter int `json:"messages_after"`
+			Author        struct {
+				UserUID string `json:"user_uid"`
+			} `json:"author"`
+		} `json:"results"`
+		TotalMatches int `json:"total_matches"`
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		t.Fatalf("decode search response: %v", err)
+	}
+	if payload.TotalMatches != 2 || len(payload.Results) != 2 {
+		t.Fatalf("expected 2 matches, got %s", string(raw))
+	}
+	if payload.Results[0].Message.Body != "zebrafish tank cleaned" || payload.Results[0].MessagesAfter != 1 {
+		t.Fatalf("expected newest match first with context counts, got %s", string(raw))
+	}
+	if payload.Results[0].Author.UserUID != "uid_searcher" {
+		t.Fatalf("expected author profile snapshot, got %s", string(raw))
+	}
+
+	if _, raw := search("deploy zebrafish"); !strings.Contains(string(raw), `"total_matches":1`) {
+		t.Fatalf("expected all terms to be required, got %s", string(raw))
+	}
+	if status, _ := search("   "); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an empty query, got %d", status)
+	}
+}
+
+func TestPinMessageRequiresPinRole(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_pin_mod"}
+	cfg.ChannelManagerUIDs = []string{"uid_pin_manager"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	pinAs := func(method string, userUID string) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+"/v1/channels/ch_general/pins/msg_seed_01", nil)
+		if err != nil {
+			t.Fatalf("build pin request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("pin request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var apiErr struct {
+			Code string `json:"code"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return resp.StatusCode, apiErr.Code
+	}
+
+	if status, code := pinAs(http.MethodPut, "uid_pin_member"); status != http.StatusForbidden || code != "forbidden" {
+		t.Fatalf("expected 403 forbidden for a member, got %d %q", status, code)
+	}
+	if status, _ := pinAs(http.MethodPut, "uid_pin_manager"); status != http.StatusOK {
+		t.Fatalf("expected channel manager to pin, got %d", status)
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/channels/ch_general/pins")
+	if err != nil {
+		t.Fatalf("list pins: %v", err)
+	}
+	var listed struct {
+		Pins []struct {
+			ID       string `json:"id"`
+			PinnedBy string `json:"pinned_by"`
+		} `json:"pins"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&listed); err != nil {
+		t.Fatalf("decode pins: %v", err)
+	}
+	resp.Body.Close()
+	if len(listed.Pins) != 1 || listed.Pins[0].ID != "msg_seed_01" || listed.Pins[0].PinnedBy != "uid_pin_manager" {
+		t.Fatalf("unexpected pins: %+v", listed.Pins)
+	}
+
+	if status, _ := pinAs(http.MethodDelete, "uid_pin_mod"); status != http.StatusOK {
+		t.Fatalf("expected moderator to unpin, got %d", status)
+	}
+
+	open := httptest.NewServer(NewServer(testConfig(), slog.Default()).Router())
+	defer open.Close()
+	req, err := http.NewRequest(http.MethodPut, open.URL+"/v1/channels/ch_general/pins/msg_seed_01", nil)
+	if err != nil {
+		t.Fatalf("build pin request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_pin_member")
+	openResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("pin request failed: %v", err)
+	}
+	openResp.Body.Close()
+	if openResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected anyone to pin without configured roles, got %d", openResp.StatusCode)
+	}
+}
+
+func TestPinLimitMatchesAdvertisedCapability(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxPinsPerChannel = 1
+	ts := httptest.NewServer(NewServer(cfg, slog.Default()).Router())
+	defer ts.Close()
+
+	capsResp, err := http.Get(ts.URL + "/v1/client/capabilities")
+	if err != nil {
+		t.Fatalf("capabilities request failed: %v", err)
+	}
+	var caps struct {
+		Limits struct {
+			MaxPinsPerChannel int `json:"max_pins_per_channel"`
+		} `json:"limits"`
+	}
+	if err := json.NewDecoder(capsResp.Body).Decode(&caps); err != nil {
+		t.Fatalf("decode capabilities: %v", err)
+	}
+	capsResp.Body.Close()
+	if caps.Limits.MaxPinsPerChannel != 1 {
+		t.Fatalf("expected advertised pin limit 1, got %d", caps.Limits.MaxPinsPerChannel)
+	}
+
+	pin := func(messageID string) (int, string) {
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/channels/ch_general/pins/"+messageID, nil)
+		if err != nil {
+			t.Fatalf("build pin request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_pin_member")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("pin request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var apiErr struct {
+			Code string `json:"code"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return resp.StatusCode, apiErr.Code
+	}
+	if status, _ := pin("msg_seed_01"); status != http.StatusOK {
+		t.Fatalf("expected first pin to succeed, got %d", status)
+	}
+	if status, code := pin("msg_seed_02"); status != http.StatusConflict || code != "pin_limit_reached" {
+		t.Fatalf("expected 409 pin_limit_reached past the advertised limit, got %d %q", status, code)
+	}
+}
+
+func TestEphemeralMessageOnlyReachesVisibleUsers(t *testing.T) {
+	ts := httptest.NewServer(NewServer(testConfig(), slog.Default()).Router())
+	defer ts.Close()
+
+	before, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages")
+
+	bystander := dialRealtime(t, ts.URL, "uid_ephemeral_bystander")
+	subscribeRealtime(t, bystander, "ch_general")
+	invoker := dialRealtime(t, ts.URL, "uid_ephemeral_invoker")
+	subscribeRealtime(t, invoker, "ch_general")
+	expectRealtimeEnvelope(t, bystander, "chat.presence.joined")
+
+	invalid := postJSONMessage(t, ts.URL, "ch_general", "uid_ephemeral_bot", map[string]any{
+		"body":       "only you can see this",
+		"visibility": "ephemeral",
+	})
+	invalid.Body.Close()
+	if invalid.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for ephemeral message without visible_to, got %d", invalid.StatusCode)
+	}
+	withUpload := postMultipartMessage(t, ts.URL, "ch_general", "uid_ephemeral_bot", map[string]string{
+		"body":       "only you can see this file",
+		"visibility": "ephemeral",
+		"visible_to": "uid_ephemeral_invoker",
+	}, []testUpload{{FileName: "secret.png", ContentType: "image/png", Content: onePixelPNG}})
+	var uploadErr APIError
+	_ = json.NewDecoder(withUpload.Body).Decode(&uploadErr)
+	withUpload.Body.Close()
+	if withUpload.StatusCode != http.StatusBadRequest || uploadErr.Code != "ephemeral_attachments" {
+		t.Fatalf("expected 400 ephemeral_attachments for an ephemeral upload, got %d %q", withUpload.StatusCode, uploadErr.Code)
+	}
+
+	ephemeral := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_ephemeral_bot", map[string]any{
+		"body":       "only you can see this",
+		"visibility": "ephemeral",
+		"visible_to": []string{"uid_ephemeral_invoker", "uid_ephemeral_invoker"},
+	}))
+	public := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_ephemeral_bot", map[string]any{
+		"body": "everyone can see this",
+	}))
+
+	messageID := func(raw json.RawMessage) string {
+		var payload struct {
+			Message struct {
+				ID string `json:"id"`
+			} `json:"message"`
+		}
+		_ = json.Unmarshal(raw, &payload)
+		return payload.Message.ID
+	}
+	if got := messageID(expectRealtimeEnvelope(t, invoker, "chat.message.created").Payload); got != ephemeral.Message.ID {
+		t.Fatalf("expected the invoker to receive the ephemeral message first, got %s", got)
+	}
+	if got := messageID(expectRealtimeEnvelope(t, invoker, "chat.message.created").Payload); got != public.Message.ID {
+		t.Fatalf("expected the invoker to receive the public message, got %s", got)
+	}
+	if got := messageID(expectRealtimeEnvelope(t, bystander, "chat.message.created").Payload); got != public.Message.ID {
+		t.Fatalf("expected the bystander to skip the ephemeral message, got %s", got)
+	}
+
+	after, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages")
+	if after.Total != before.Total+1 {
+		t.Fatalf("expected only the public message in history, got total %d (was %d)", after.Total, before.Total)
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func (s *Server) listEmojis(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.chat.EmojiCatalog())
+}
+
+func (s *Server) getCustomEmoji(w http.ResponseWriter, r *http.Request) {
+	emoji, content, err := s.chat.CustomEmojiContent(strings.TrimSpace(chi.URLParam(r, "emojiID")))
+	if err != nil {
+		writeErrorKind(w, errorKindNotFound, "emoji_not_found", "custom emoji not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", emoji.ContentType)
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(content)
+}
@@ -0,0 +1,34 @@
+package api
+
+import "net/http"
+
+const maxPresenceBatchSize = 100
+
+func (s *Server) presenceHeartbeat(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.DisablePresence {
+		writeFeatureDisabled(w, "presence")
+		return
+	}
+	requester := requesterFromContext(r.Context())
+	writeJSON(w, http.StatusOK, s.realtime.Heartbeat(requester.UserUID))
+}
+
+func (s *Server) batchPresence(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.DisablePresence {
+		writeFeatureDisabled(w, "presence")
+		return
+	}
+	userUIDs := r.URL.Query()["user_uid"]
+	if len(userUIDs) == 0 {
+		writeErrorKind(w, errorKindInvalid, "invalid_query", "at least one user_uid is required")
+		return
+	}
+	if len(userUIDs) > maxPresenceBatchSize {
+		writeErrorKind(w, errorKindInvalid, "invalid_query", "too many user_uid values")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"presence": s.realtime.Presence(userUIDs),
+	})
+}
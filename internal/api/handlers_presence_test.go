@@ -0,0 +1,83 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPresenceHeartbeatExpiresAfterTTL(t *testing.T) {
+	cfg := testConfig()
+	cfg.PresenceHeartbeatTTL = 150 * time.Millisecond
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	userUID := "uid_polling_client"
+	heartbeat := func() {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/presence/heartbeat", nil)
+		if err != nil {
+			t.Fatalf("build heartbeat request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("heartbeat request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("unexpected heartbeat status: %d body=%s", resp.StatusCode, string(body))
+		}
+	}
+	status := func() string {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/presence?user_uid="+userUID, nil)
+		if err != nil {
+			t.Fatalf("build presence request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_observer")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("presence request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var payload struct {
+			Presence []struct {
+				UserUID string `json:"user_uid"`
+				Status  string `json:"status"`
+			} `json:"presence"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode presence response: %v", err)
+		}
+		if len(payload.Presence) != 1 {
+			t.Fatalf("expected 1 presence entry, got %d", len(payload.Presence))
+		}
+		return payload.Presence[0].Status
+	}
+
+	if got := status(); got != "offline" {
+		t.Fatalf("expected offline before heartbeat, got %s", got)
+	}
+
+	heartbeat()
+	if got := status(); got != "online" {
+		t.Fatalf("expected online after heartbeat, got %s", got)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	heartbeat()
+	time.Sleep(100 * time.Millisecond)
+	if got := status(); got != "online" {
+		t.Fatalf("expected sliding ttl to keep user online, got %s", got)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if got := status(); got != "offline" {
+		t.Fatalf("expected offline after ttl lapsed, got %s", got)
+	}
+}
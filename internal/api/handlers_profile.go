@@ -3,6 +3,7 @@ package api
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"strconv"
@@ -16,7 +17,7 @@ const maxProfileBatchSize = 100
 
 func (s *Server) getMyProfile(w http.ResponseWriter, r *http.Request) {
 	requester := requesterFromContext(r.Context())
-	writeJSON(w, http.StatusOK, s.profiles.GetOrCreate(requester.UserUID))
+	writeProfile(w, r, s.profiles.GetOrCreate(requester.UserUID))
 }
 
 func (s *Server) updateMyProfile(w http.ResponseWriter, r *http.Request) {
@@ -27,15 +28,27 @@ func (s *Server) updateMyProfile(w http.ResponseWriter, r *http.Request) {
 		AvatarMode    string `json:"avatar_mode"`
 		AvatarPreset  string `json:"avatar_preset_id"`
 		AvatarAssetID string `json:"avatar_asset_id"`
+		Bio           string `json:"bio"`
+		Pronouns      string `json:"pronouns"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_payload", "invalid profile update payload", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid profile update payload")
 		return
 	}
 
-	expectedVersion, err := parseIfMatchVersion(r.Header.Get("If-Match"))
+	expectedVersion, matchAny, err := parseETagVersion(r.Header.Get("If-Match"))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_if_match", "If-Match must be an integer profile version", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_if_match", "If-Match must be an integer profile version or *")
+		return
+	}
+	_, noneMatchAny, err := parseETagVersion(r.Header.Get("If-None-Match"))
+	if err != nil || (r.Header.Get("If-None-Match") != "" && !noneMatchAny) {
+		writeErrorKind(w, errorKindInvalid, "invalid_if_none_match", "If-None-Match only supports * for profile updates")
+		return
+	}
+	exists := s.profiles.Exists(requester.UserUID)
+	if (matchAny && !exists) || (noneMatchAny && exists) {
+		writeErrorKind(w, errorKindStale, "precondition_failed", "profile precondition failed")
 		return
 	}
 
@@ -44,21 +57,70 @@ func (s *Server) updateMyProfile(w http.ResponseWriter, r *http.Request) {
 		AvatarMode:    profile.AvatarMode(strings.TrimSpace(body.AvatarMode)),
 		AvatarPreset:  body.AvatarPreset,
 		AvatarAssetID: body.AvatarAssetID,
+		Bio:           body.Bio,
+		Pronouns:      body.Pronouns,
 	}, expectedVersion)
 	if updateErr != nil {
 		switch {
 		case errors.Is(updateErr, profile.ErrDisplayNameInvalid):
-			writeError(w, http.StatusBadRequest, "display_name_invalid", "display name does not meet policy", false)
+			writeErrorKind(w, errorKindInvalid, "display_name_invalid", "display name does not meet policy")
+		case errors.Is(updateErr, profile.ErrDisplayNameReserved):
+			writeErrorKind(w, errorKindInvalid, "display_name_reserved", "display name contains a reserved word")
+		case errors.Is(updateErr, profile.ErrDisplayNameCooldown):
+			writeErrorKind(w, errorKindRateLimited, "display_name_cooldown", updateErr.Error())
+		case errors.Is(updateErr, profile.ErrBioTooLong):
+			writeErrorKind(w, errorKindInvalid, "bio_too_long", fmt.Sprintf("bio must be at most %d characters", profile.MaxBioRunes))
+		case errors.Is(updateErr, profile.ErrPronounsTooLong):
+			writeErrorKind(w, errorKindInvalid, "pronouns_too_long", fmt.Sprintf("pronouns must be at most %d characters", profile.MaxPronounsRunes))
 		case errors.Is(updateErr, profile.ErrAvatarModeUnsupported):
-			writeError(w, http.StatusBadRequest, "avatar_mode_unsupported", "avatar mode is not supported", false)
+			writeErrorKind(w, errorKindInvalid, "avatar_mode_unsupported", "avatar mode is not supported")
 		case errors.Is(updateErr, profile.ErrAvatarPresetInvalid):
-			writeError(w, http.StatusBadRequest, "avatar_mode_unsupported", "avatar preset is invalid", false)
+			writeErrorKind(w, errorKindInvalid, "avatar_mode_unsupported", "avatar preset is invalid")
 		case errors.Is(updateErr, profile.ErrAvatarAssetNotFound):
-			writeError(w, http.StatusBadRequest, "avatar_asset_not_found", "avatar asset not found", false)
+			writeErrorKind(w, errorKindInvalid, "avatar_asset_not_found", "avatar asset not found")
 		case errors.Is(updateErr, profile.ErrProfileConflict):
-			writeError(w, http.StatusConflict, "profile_conflict", "profile update conflict", true)
+			writeErrorKind(w, errorKindStale, "profile_conflict", "profile version does not match If-Match")
 		default:
-			writeError(w, http.StatusInternalServerError, "profile_update_failed", "unable to update profile", true)
+			writeErrorKind(w, errorKindInternal, "profile_update_failed", "unable to update profile")
+		}
+		return
+	}
+
+	w.Header().Set("ETag", profileETag(updated.ProfileVersion))
+	writeJSON(w, http.StatusOK, updated)
+}
+
+// setMyPresence treats an omitted field as "keep the current value".
+func (s *Server) setMyPresence(w http.ResponseWriter, r *http.Request) {
+	requester := requesterFromContext(r.Context())
+
+	var body struct {
+		Presence   *string `json:"presence"`
+		StatusText *string `json:"status_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid presence payload")
+		return
+	}
+
+	current := s.profiles.GetOrCreate(requester.UserUID)
+	presence, statusText := current.Presence, current.StatusText
+	if body.Presence != nil {
+		presence = profile.Presence(*body.Presence)
+	}
+	if body.StatusText != nil {
+		statusText = *body.StatusText
+	}
+
+	updated, err := s.profiles.SetPresence(requester.UserUID, presence, statusText)
+	if err != nil {
+		switch {
+		case errors.Is(err, profile.ErrPresenceInvalid):
+			writeErrorKind(w, errorKindInvalid, "presence_invalid", "presence must be online, idle, dnd, offline, or invisible")
+		case errors.Is(err, profile.ErrStatusTextTooLong):
+			writeErrorKind(w, errorKindInvalid, "status_text_too_long", fmt.Sprintf("status text must be at most %d characters", profile.MaxStatusTextRunes))
+		default:
+			writeErrorKind(w, errorKindInternal, "presence_update_failed", "unable to update presence")
 		}
 		return
 	}
@@ -68,26 +130,30 @@ func (s *Server) updateMyProfile(w http.ResponseWriter, r *http.Request) {
 
 func (s *Server) uploadProfileAvatar(w http.ResponseWriter, r *http.Request) {
 	maxBytes, _, _, _ := s.profiles.AvatarUploadRules()
+	if r.ContentLength > int64(maxBytes+1024) {
+		writeErrorKind(w, errorKindTooLarge, "avatar_too_large", "avatar exceeds max upload size")
+		return
+	}
 	r.Body = http.MaxBytesReader(w, r.Body, int64(maxBytes+1024))
 	if err := r.ParseMultipartForm(int64(maxBytes + 1024)); err != nil {
-		writeError(w, http.StatusRequestEntityTooLarge, "avatar_too_large", "avatar exceeds max upload size", false)
+		writeErrorKind(w, errorKindTooLarge, "avatar_too_large", "avatar exceeds max upload size")
 		return
 	}
 
 	file, header, err := r.FormFile("file")
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_payload", "missing multipart file field 'file'", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "missing multipart file field 'file'")
 		return
 	}
 	defer file.Close()
 
 	content, err := io.ReadAll(io.LimitReader(file, int64(maxBytes+1)))
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid_payload", "unable to read avatar upload", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "unable to read avatar upload")
 		return
 	}
 	if len(content) > maxBytes {
-		writeError(w, http.StatusRequestEntityTooLarge, "avatar_too_large", "avatar exceeds max upload size", false)
+		writeErrorKind(w, errorKindTooLarge, "avatar_too_large", "avatar exceeds max upload size")
 		return
 	}
 
@@ -95,17 +161,20 @@ func (s *Server) uploadProfileAvatar(w http.ResponseWriter, r *http.Request) {
 	if header != nil {
 		contentType = strings.TrimSpace(header.Header.Get("Content-Type"))
 	}
-	asset, uploadErr := s.profiles.UploadAvatar(contentType, content)
+	requester := requesterFromContext(r.Context())
+	asset, uploadErr := s.profiles.UploadAvatar(requester.UserUID, contentType, content)
 	if uploadErr != nil {
 		switch {
 		case errors.Is(uploadErr, profile.ErrAvatarTooLarge):
-			writeError(w, http.StatusRequestEntityTooLarge, "avatar_too_large", "avatar exceeds max upload size", false)
+			writeErrorKind(w, errorKindTooLarge, "avatar_too_large", "avatar exceeds max upload size")
 		case errors.Is(uploadErr, profile.ErrAvatarTypeUnsupported):
-			writeError(w, http.StatusUnsupportedMediaType, "avatar_type_unsupported", "avatar mime type is unsupported", false)
+			writeErrorKind(w, errorKindUnsupportedMedia, "avatar_type_unsupported", "avatar mime type is unsupported")
 		case errors.Is(uploadErr, profile.ErrAvatarDimensions):
-			writeError(w, http.StatusBadRequest, "avatar_dimensions_exceeded", "avatar dimensions exceed limits", false)
+			writeErrorKind(w, errorKindInvalid, "avatar_dimensions_exceeded", "avatar dimensions exceed limits")
+		case errors.Is(uploadErr, profile.ErrAvatarLimitReached):
+			writeErrorKind(w, errorKindConflict, "avatar_limit_reached", "avatar asset limit reached")
 		default:
-			writeError(w, http.StatusInternalServerError, "avatar_upload_failed", "unable to upload avatar", true)
+			writeErrorKind(w, errorKindInternal, "avatar_upload_failed", "unable to upload avatar")
 		}
 		return
 	}
@@ -113,11 +182,23 @@ func (s *Server) uploadProfileAvatar(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, asset)
 }
 
+func (s *Server) deleteProfileAvatar(w http.ResponseWriter, r *http.Request) {
+	requester := requesterFromContext(r.Context())
+	updated, err := s.profiles.ClearAvatar(requester.UserUID)
+	if err != nil {
+		writeErrorKind(w, errorKindInternal, "avatar_delete_failed", "unable to remove avatar")
+		return
+	}
+
+	w.Header().Set("ETag", profileETag(updated.ProfileVersion))
+	writeJSON(w, http.StatusOK, updated)
+}
+
 func (s *Server) getProfileAvatar(w http.ResponseWriter, r *http.Request) {
 	assetID := strings.TrimSpace(chi.URLParam(r, "assetID"))
 	asset, content, err := s.profiles.AvatarContent(assetID)
 	if err != nil {
-		writeError(w, http.StatusNotFound, "avatar_asset_not_found", "avatar asset not found", false)
+		writeErrorKind(w, errorKindNotFound, "avatar_asset_not_found", "avatar asset not found")
 		return
 	}
 
@@ -127,37 +208,89 @@ func (s *Server) getProfileAvatar(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(content)
 }
 
+func (s *Server) getPresetAvatar(w http.ResponseWriter, r *http.Request) {
+	presetID := strings.TrimSpace(chi.URLParam(r, "presetID"))
+	contentType, content, err := s.profiles.PresetAvatar(presetID)
+	if err != nil {
+		writeErrorKind(w, errorKindNotFound, "avatar_preset_not_found", "avatar preset not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(content)
+}
+
+func (s *Server) getProfile(w http.ResponseWriter, r *http.Request) {
+	userUID := strings.TrimSpace(chi.URLParam(r, "userUID"))
+	if userUID == "" {
+		writeErrorKind(w, errorKindInvalid, "invalid_user", "user uid is required")
+		return
+	}
+	requester := requesterFromContext(r.Context())
+	writeProfile(w, r, s.profiles.GetOrCreate(userUID).VisibleTo(requester.UserUID))
+}
+
+// writeProfile sets the profile ETag and answers If-None-Match with 304 when
+// the client already holds the current version.
+func writeProfile(w http.ResponseWriter, r *http.Request, current profile.CanonicalProfile) {
+	etag := profileETag(current.ProfileVersion)
+	w.Header().Set("ETag", etag)
+	if version, matchAny, err := parseETagVersion(r.Header.Get("If-None-Match")); err == nil {
+		if matchAny || (version != nil && *version == current.ProfileVersion) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, current)
+}
+
+func profileETag(version int) string {
+	return `W/"` + strconv.Itoa(version) + `"`
+}
+
 func (s *Server) batchProfiles(w http.ResponseWriter, r *http.Request) {
 	userUIDs := r.URL.Query()["user_uid"]
 	if len(userUIDs) == 0 {
-		writeError(w, http.StatusBadRequest, "invalid_query", "at least one user_uid is required", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_query", "at least one user_uid is required")
 		return
 	}
 	if len(userUIDs) > maxProfileBatchSize {
-		writeError(w, http.StatusBadRequest, "invalid_query", "too many user_uid values", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_query", "too many user_uid values")
 		return
 	}
 
+	requester := requesterFromContext(r.Context())
+	profiles := s.profiles.BatchGet(userUIDs)
+	for idx := range profiles {
+		profiles[idx] = profiles[idx].VisibleTo(requester.UserUID)
+	}
 	writeJSON(w, http.StatusOK, map[string]any{
-		"profiles": s.profiles.BatchGet(userUIDs),
+		"profiles": profiles,
 	})
 }
 
-func parseIfMatchVersion(raw string) (*int, error) {
+// parseETagVersion reads a conditional header holding a profile version. Weak
+// validators compare equal to strong ones, and "*" reports matchAny.
+func parseETagVersion(raw string) (*int, bool, error) {
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
-		return nil, nil
+		return nil, false, nil
+	}
+	if raw == "*" {
+		return nil, true, nil
 	}
 
 	raw = strings.TrimPrefix(raw, "W/")
 	raw = strings.Trim(raw, `"`)
 	raw = strings.TrimSpace(raw)
 	if raw == "" {
-		return nil, nil
+		return nil, false, nil
 	}
 	parsed, err := strconv.Atoi(raw)
 	if err != nil || parsed <= 0 {
-		return nil, errors.New("invalid if-match")
+		return nil, false, errors.New("invalid profile etag")
 	}
-	return &parsed, nil
+	return &parsed, false, nil
 }
@@ -3,6 +3,7 @@ package api
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"image"
 	"image/color"
 	"image/png"
@@ -11,11 +12,18 @@ import (
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/openchat/openchat-backend/internal/app"
+	"github.com/openchat/openchat-backend/internal/profile"
 )
 
 func TestProfileLifecycleEndpoints(t *testing.T) {
@@ -212,9 +220,9 @@ func TestProfileLifecycleEndpoints(t *testing.T) {
 		t.Fatalf("conflict update failed: %v", err)
 	}
 	defer conflictResp.Body.Close()
-	if conflictResp.StatusCode != http.StatusConflict {
+	if conflictResp.StatusCode != http.StatusPreconditionFailed {
 		body, _ := io.ReadAll(conflictResp.Body)
-		t.Fatalf("expected conflict status, got %d body=%s", conflictResp.StatusCode, string(body))
+		t.Fatalf("expected precondition failed status, got %d body=%s", conflictResp.StatusCode, string(body))
 	}
 }
 
@@ -233,3 +241,639 @@ func testPNGBytes(t *testing.T) []byte {
 	}
 	return buf.Bytes()
 }
+
+func TestPresetAvatarEndpointServesSVG(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/profile/avatar/preset/reef")
+	if err != nil {
+		t.Fatalf("preset avatar request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected preset avatar status: %d body=%s", resp.StatusCode, string(body))
+	}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "image/svg+xml" {
+		t.Fatalf("expected image/svg+xml content type, got %s", contentType)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read preset avatar body: %v", err)
+	}
+	var svg struct {
+		XMLName xml.Name
+		Width   string `xml:"width,attr"`
+	}
+	if err := xml.Unmarshal(body, &svg); err != nil {
+		t.Fatalf("preset avatar is not valid xml: %v", err)
+	}
+	if svg.XMLName.Local != "svg" || svg.Width == "" {
+		t.Fatalf("expected svg root element with width, got %q", svg.XMLName.Local)
+	}
+
+	again, err := http.Get(ts.URL + "/v1/profile/avatar/preset/reef")
+	if err != nil {
+		t.Fatalf("second preset avatar request failed: %v", err)
+	}
+	defer again.Body.Close()
+	againBody, _ := io.ReadAll(again.Body)
+	if !bytes.Equal(body, againBody) {
+		t.Fatalf("expected deterministic preset avatar output")
+	}
+
+	missing, err := http.Get(ts.URL + "/v1/profile/avatar/preset/not-a-preset")
+	if err != nil {
+		t.Fatalf("unknown preset request failed: %v", err)
+	}
+	defer missing.Body.Close()
+	if missing.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for unknown preset, got %d", missing.StatusCode)
+	}
+}
+
+func TestGeneratedProfileAvatarURLServesPresetImage(t *testing.T) {
+	presetDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(presetDir, "default.png"), testPNGBytes(t), 0o644); err != nil {
+		t.Fatalf("write default preset image: %v", err)
+	}
+	cfg := testConfig()
+	cfg.PresetAvatarDir = presetDir
+
+	for _, tc := range []struct {
+		name        string
+		cfg         app.Config
+		contentType string
+	}{
+		{name: "generated svg", cfg: testConfig(), contentType: "image/svg+xml"},
+		{name: "configured default", cfg: cfg, contentType: "image/png"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(tc.cfg, slog.Default())
+			ts := httptest.NewServer(server.Router())
+			defer ts.Close()
+
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/profile/me", nil)
+			if err != nil {
+				t.Fatalf("build profile request: %v", err)
+			}
+			req.Header.Set("X-OpenChat-User-UID", "uid_generated_avatar")
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatalf("profile request failed: %v", err)
+			}
+			defer resp.Body.Close()
+			var me profile.CanonicalProfile
+			if err := json.NewDecoder(resp.Body).Decode(&me); err != nil {
+				t.Fatalf("decode profile: %v", err)
+			}
+			if me.AvatarMode != profile.AvatarModeGenerated || me.AvatarURL == nil {
+				t.Fatalf("expected generated profile with avatar_url, got %+v", me)
+			}
+
+			avatarURL, err := url.Parse(*me.AvatarURL)
+			if err != nil {
+				t.Fatalf("parse avatar_url: %v", err)
+			}
+			avatar, err := http.Get(ts.URL + avatarURL.Path)
+			if err != nil {
+				t.Fatalf("avatar request failed: %v", err)
+			}
+			defer avatar.Body.Close()
+			body, _ := io.ReadAll(avatar.Body)
+			if avatar.StatusCode != http.StatusOK || avatar.Header.Get("Content-Type") != tc.contentType {
+				t.Fatalf("unexpected avatar response %d %q", avatar.StatusCode, avatar.Header.Get("Content-Type"))
+			}
+			switch tc.contentType {
+			case "image/png":
+				if _, _, err := image.Decode(bytes.NewReader(body)); err != nil {
+					t.Fatalf("configured preset avatar is not a valid image: %v", err)
+				}
+			default:
+				var svg struct{ XMLName xml.Name }
+				if err := xml.Unmarshal(body, &svg); err != nil || svg.XMLName.Local != "svg" {
+					t.Fatalf("generated preset avatar is not valid svg: %v", err)
+				}
+			}
+		})
+	}
+}
+
+func uploadTestAvatar(t *testing.T, baseURL string, userUID string) string {
+	t.Helper()
+	return uploadTestAvatarFile(t, baseURL, userUID, "avatar.png", testPNGBytes(t))
+}
+
+func uploadTestAvatarFile(t *testing.T, baseURL string, userUID string, fileName string, content []byte) string {
+	t.Helper()
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("file", fileName)
+	if err != nil {
+		t.Fatalf("create multipart file: %v", err)
+	}
+	if _, err := part.Write(content); err != nil {
+		t.Fatalf("write avatar payload: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("close multipart writer: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/v1/profile/avatar", &body)
+	if err != nil {
+		t.Fatalf("build upload request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", userUID)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("upload avatar failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected upload status: %d body=%s", resp.StatusCode, string(payload))
+	}
+	var uploaded struct {
+		AvatarAssetID string `json:"avatar_asset_id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&uploaded); err != nil {
+		t.Fatalf("decode upload response: %v", err)
+	}
+	return uploaded.AvatarAssetID
+}
+
+// oneByOneWebP is a lossless 1x1 WebP image.
+var oneByOneWebP = []byte{
+	0x52, 0x49, 0x46, 0x46, 0x1a, 0x00, 0x00, 0x00, 0x57, 0x45, 0x42, 0x50,
+	0x56, 0x50, 0x38, 0x4c, 0x0d, 0x00, 0x00, 0x00, 0x2f, 0x00, 0x00, 0x00,
+	0x10, 0x07, 0x10, 0x11, 0x11, 0x88, 0x88, 0xfe, 0x07, 0x00,
+}
+
+func TestAvatarUploadAcceptsWebP(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	assetID := uploadTestAvatarFile(t, ts.URL, "uid_webp", "avatar.webp", oneByOneWebP)
+	resp, err := http.Get(ts.URL + "/v1/profile/avatar/" + assetID)
+	if err != nil {
+		t.Fatalf("get avatar: %v", err)
+	}
+	defer resp.Body.Close()
+	content, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/webp" {
+		t.Fatalf("expected image/webp avatar, got %d %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	if !bytes.Equal(content, oneByOneWebP) {
+		t.Fatalf("expected served avatar to match the upload")
+	}
+	if _, _, _, mimeTypes := server.profiles.AvatarUploadRules(); !slices.Contains(mimeTypes, "image/webp") {
+		t.Fatalf("expected upload rules to advertise image/webp, got %v", mimeTypes)
+	}
+}
+
+func TestAvatarUploadsEvictOldestUnreferencedAsset(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxAvatarAssetsPerUser = 2
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	userUID := "uid_avatar_cap"
+	referenced := uploadTestAvatar(t, ts.URL, userUID)
+
+	updateBytes, _ := json.Marshal(map[string]any{
+		"display_name":    "Capped",
+		"avatar_mode":     "uploaded",
+		"avatar_asset_id": referenced,
+	})
+	updateReq, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/profile/me", bytes.NewReader(updateBytes))
+	if err != nil {
+		t.Fatalf("build update profile request: %v", err)
+	}
+	updateReq.Header.Set("X-OpenChat-User-UID", userUID)
+	updateReq.Header.Set("Content-Type", "application/json")
+	updateResp, err := http.DefaultClient.Do(updateReq)
+	if err != nil {
+		t.Fatalf("update profile failed: %v", err)
+	}
+	updateResp.Body.Close()
+	if updateResp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected update status: %d", updateResp.StatusCode)
+	}
+
+	oldestUnreferenced := uploadTestAvatar(t, ts.URL, userUID)
+	newest := uploadTestAvatar(t, ts.URL, userUID)
+
+	avatarStatus := func(assetID string) int {
+		resp, err := http.Get(ts.URL + "/v1/profile/avatar/" + assetID)
+		if err != nil {
+			t.Fatalf("get avatar failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := avatarStatus(referenced); status != http.StatusOK {
+		t.Fatalf("expected referenced avatar to survive, got %d", status)
+	}
+	if status := avatarStatus(oldestUnreferenced); status != http.StatusNotFound {
+		t.Fatalf("expected oldest unreferenced avatar to be evicted, got %d", status)
+	}
+	if status := avatarStatus(newest); status != http.StatusOK {
+		t.Fatalf("expected newest avatar to be stored, got %d", status)
+	}
+}
+
+func TestAvatarUploadRejectsOversizedContentLengthUpFront(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	maxBytes, _, _, _ := server.profiles.AvatarUploadRules()
+	bodyReader, bodyWriter := io.Pipe()
+	defer bodyWriter.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/profile/avatar", bodyReader)
+	if err != nil {
+		t.Fatalf("build upload request: %v", err)
+	}
+	req.ContentLength = int64(maxBytes) * 4
+	req.Header.Set("X-OpenChat-User-UID", "uid_oversized_avatar")
+	req.Header.Set("Content-Type", "multipart/form-data; boundary=unused")
+
+	// The body is never written, so only an early Content-Length check can answer.
+	client := &http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("upload avatar failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("expected 413, got %d body=%s", resp.StatusCode, string(payload))
+	}
+}
+
+func TestDisplayNameRejectsReservedWords(t *testing.T) {
+	cfg := testConfig()
+	cfg.ReservedDisplayNames = []string{"Admin"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	updateName := func(displayName string) (int, string) {
+		raw, _ := json.Marshal(map[string]any{
+			"display_name":     displayName,
+			"avatar_mode":      "generated",
+			"avatar_preset_id": "reef",
+		})
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/profile/me", bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("build update profile request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_reserved_name")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("update profile failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var apiErr struct {
+			Code string `json:"code"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return resp.StatusCode, apiErr.Code
+	}
+
+	status, code := updateName("the real sysADMIN")
+	if status != http.StatusBadRequest || code != "display_name_reserved" {
+		t.Fatalf("expected display_name_reserved, got %d %s", status, code)
+	}
+	if status, code := updateName("Harbor Keeper"); status != http.StatusOK {
+		t.Fatalf("expected innocuous name to pass, got %d %s", status, code)
+	}
+}
+
+func TestAvatarUploadNotifiesUploaderWhenReady(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	uploaderConn := dialRealtime(t, ts.URL, "uid_avatar_ready")
+	otherConn := dialRealtime(t, ts.URL, "uid_avatar_bystander")
+	// Round-trip a ping so both connections are registered before the upload.
+	for _, conn := range []*websocket.Conn{uploaderConn, otherConn} {
+		if err := conn.WriteJSON(map[string]any{"type": "chat.ping"}); err != nil {
+			t.Fatalf("send chat.ping: %v", err)
+		}
+		expectRealtimeEnvelope(t, conn, "chat.pong")
+	}
+
+	assetID := uploadTestAvatar(t, ts.URL, "uid_avatar_ready")
+
+	envelope := expectRealtimeEnvelope(t, uploaderConn, "profile.avatar.ready")
+	var ready struct {
+		AvatarAssetID string `json:"avatar_asset_id"`
+		Width         int    `json:"width"`
+		Height        int    `json:"height"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &ready); err != nil {
+		t.Fatalf("decode avatar ready payload: %v", err)
+	}
+	if ready.AvatarAssetID != assetID {
+		t.Fatalf("expected asset id %s, got %s", assetID, ready.AvatarAssetID)
+	}
+	if ready.Width != 8 || ready.Height != 8 {
+		t.Fatalf("expected 8x8 dimensions, got %dx%d", ready.Width, ready.Height)
+	}
+
+	_ = otherConn.SetReadDeadline(time.Now().Add(150 * time.Millisecond))
+	var unexpected map[string]any
+	if err := otherConn.ReadJSON(&unexpected); err == nil {
+		t.Fatalf("expected no avatar event for other users, got %v", unexpected)
+	}
+}
+
+func TestGetProfileByUID(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	getProfile := func(userUID string) profile.CanonicalProfile {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/profiles/"+userUID, nil)
+		if err != nil {
+			t.Fatalf("build profile request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_profile_viewer")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("profile request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			body, _ := io.ReadAll(resp.Body)
+			t.Fatalf("unexpected profile status: %d body=%s", resp.StatusCode, string(body))
+		}
+		var canonical profile.CanonicalProfile
+		if err := json.NewDecoder(resp.Body).Decode(&canonical); err != nil {
+			t.Fatalf("decode profile: %v", err)
+		}
+		return canonical
+	}
+
+	updateReq, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/profile/me", bytes.NewReader([]byte(`{"display_name":"Harbor Pilot","avatar_mode":"generated","avatar_preset_id":"reef"}`)))
+	if err != nil {
+		t.Fatalf("build update request: %v", err)
+	}
+	updateReq.Header.Set("X-OpenChat-User-UID", "uid_profile_known")
+	updateReq.Header.Set("Content-Type", "application/json")
+	updateResp, err := http.DefaultClient.Do(updateReq)
+	if err != nil {
+		t.Fatalf("update profile failed: %v", err)
+	}
+	updateResp.Body.Close()
+	if updateResp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected update status: %d", updateResp.StatusCode)
+	}
+
+	known := getProfile("uid_profile_known")
+	if known.UserUID != "uid_profile_known" || known.DisplayName != "Harbor Pilot" {
+		t.Fatalf("expected updated profile, got %+v", known)
+	}
+
+	fresh := getProfile("uid_profile_fresh")
+	if fresh.UserUID != "uid_profile_fresh" || fresh.DisplayName == "" {
+		t.Fatalf("expected default profile for unknown uid, got %+v", fresh)
+	}
+}
+
+func TestProfileUpdateConditionalHeaders(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	const userUID = "uid_conditional"
+	body, _ := json.Marshal(map[string]any{"display_name": "Conditional", "avatar_mode": "generated", "avatar_preset_id": "reef"})
+	update := func(header string, value string) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/profile/me", bytes.NewReader(body))
+		if err != nil {
+			t.Fatalf("build update request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(header, value)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("update request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	if resp := update("If-Match", "*"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for If-Match * before the profile exists, got %d", resp.StatusCode)
+	}
+
+	getReq, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/profile/me", nil)
+	if err != nil {
+		t.Fatalf("build get request: %v", err)
+	}
+	getReq.Header.Set("X-OpenChat-User-UID", userUID)
+	getResp, err := http.DefaultClient.Do(getReq)
+	if err != nil {
+		t.Fatalf("get profile failed: %v", err)
+	}
+	getResp.Body.Close()
+	etag := getResp.Header.Get("ETag")
+	if etag != `W/"1"` {
+		t.Fatalf("expected weak etag for version 1, got %q", etag)
+	}
+
+	getReq.Header.Set("If-None-Match", etag)
+	notModified, err := http.DefaultClient.Do(getReq)
+	if err != nil {
+		t.Fatalf("conditional get failed: %v", err)
+	}
+	notModified.Body.Close()
+	if notModified.StatusCode != http.StatusNotModified {
+		t.Fatalf("expected 304 for matching If-None-Match, got %d", notModified.StatusCode)
+	}
+
+	if resp := update("If-None-Match", "*"); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for If-None-Match * on an existing profile, got %d", resp.StatusCode)
+	}
+	if resp := update("If-Match", "*"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected If-Match * to succeed once the profile exists, got %d", resp.StatusCode)
+	}
+	resp := update("If-Match", `W/"2"`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected weak matching version to succeed, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("ETag"); got != `W/"3"` {
+		t.Fatalf("expected updated etag W/\"3\", got %q", got)
+	}
+	if resp := update("If-Match", `"2"`); resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for a stale version, got %d", resp.StatusCode)
+	}
+}
+
+func TestPresencePatchBroadcastsAndHidesInvisibleUsers(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	watcher := dialRealtime(t, ts.URL, "uid_presence_watcher")
+	if err := watcher.WriteJSON(map[string]any{
+		"type":    "profile.subscribe",
+		"payload": map[string]any{"user_uids": []string{"uid_presence_target"}},
+	}); err != nil {
+		t.Fatalf("send profile.subscribe: %v", err)
+	}
+	expectRealtimeEnvelope(t, watcher, "profile.subscribed")
+
+	patchPresence := func(payload map[string]any) (int, profile.CanonicalProfile) {
+		raw, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodPatch, ts.URL+"/v1/profile/me/presence", bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("build presence request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_presence_target")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("presence request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var out profile.CanonicalProfile
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return resp.StatusCode, out
+	}
+	getProfileAs := func(viewerUID string) profile.CanonicalProfile {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/profiles/uid_presence_target", nil)
+		if err != nil {
+			t.Fatalf("build profile request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", viewerUID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("profile request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var out profile.CanonicalProfile
+		if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+			t.Fatalf("decode profile: %v", err)
+		}
+		return out
+	}
+
+	if status, _ := patchPresence(map[string]any{"presence": "away"}); status != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown presence, got %d", status)
+	}
+	status, updated := patchPresence(map[string]any{"presence": "dnd", "status_text": "In a meeting"})
+	if status != http.StatusOK || updated.Presence != profile.PresenceDND || updated.StatusText != "In a meeting" {
+		t.Fatalf("unexpected presence update %d %+v", status, updated)
+	}
+	envelope := expectRealtimeEnvelope(t, watcher, "presence_updated")
+	var event struct {
+		UserUID    string `json:"user_uid"`
+		Presence   string `json:"presence"`
+		StatusText string `json:"status_text"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &event); err != nil {
+		t.Fatalf("decode presence event: %v", err)
+	}
+	if event.UserUID != "uid_presence_target" || event.Presence != "dnd" || event.StatusText != "In a meeting" {
+		t.Fatalf("unexpected presence event %+v", event)
+	}
+
+	// Omitting status_text keeps the current one.
+	if status, updated := patchPresence(map[string]any{"presence": "invisible"}); status != http.StatusOK || updated.StatusText != "In a meeting" {
+		t.Fatalf("expected status text to survive a presence-only patch, got %d %+v", status, updated)
+	}
+	envelope = expectRealtimeEnvelope(t, watcher, "presence_updated")
+	if err := json.Unmarshal(envelope.Payload, &event); err != nil {
+		t.Fatalf("decode presence event: %v", err)
+	}
+	if event.Presence != "offline" || event.StatusText != "" {
+		t.Fatalf("expected invisible user to appear offline to watchers, got %+v", event)
+	}
+	if seen := getProfileAs("uid_presence_watcher"); seen.Presence != profile.PresenceOffline || seen.StatusText != "" {
+		t.Fatalf("expected invisible user to appear offline to others, got %+v", seen)
+	}
+	if own := getProfileAs("uid_presence_target"); own.Presence != profile.PresenceInvisible {
+		t.Fatalf("expected user to see their own invisible presence, got %+v", own)
+	}
+}
+
+func TestDeleteAvatarRevertsToGeneratedPreset(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	userUID := "uid_avatar_delete"
+	assetID := uploadTestAvatar(t, ts.URL, userUID)
+	updateBytes, _ := json.Marshal(map[string]any{
+		"display_name":    "Removing",
+		"avatar_mode":     "uploaded",
+		"avatar_asset_id": assetID,
+	})
+	updateReq, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/profile/me", bytes.NewReader(updateBytes))
+	if err != nil {
+		t.Fatalf("build update profile request: %v", err)
+	}
+	updateReq.Header.Set("X-OpenChat-User-UID", userUID)
+	updateReq.Header.Set("Content-Type", "application/json")
+	updateResp, err := http.DefaultClient.Do(updateReq)
+	if err != nil {
+		t.Fatalf("update profile failed: %v", err)
+	}
+	var uploaded profile.CanonicalProfile
+	_ = json.NewDecoder(updateResp.Body).Decode(&uploaded)
+	updateResp.Body.Close()
+	if uploaded.AvatarMode != profile.AvatarModeUploaded {
+		t.Fatalf("expected uploaded avatar mode, got %+v", uploaded)
+	}
+
+	conn := dialRealtime(t, ts.URL, userUID)
+	deleteReq, err := http.NewRequest(http.MethodDelete, ts.URL+"/v1/profile/avatar", nil)
+	if err != nil {
+		t.Fatalf("build delete avatar request: %v", err)
+	}
+	deleteReq.Header.Set("X-OpenChat-User-UID", userUID)
+	deleteResp, err := http.DefaultClient.Do(deleteReq)
+	if err != nil {
+		t.Fatalf("delete avatar failed: %v", err)
+	}
+	defer deleteResp.Body.Close()
+	if deleteResp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected delete avatar status: %d", deleteResp.StatusCode)
+	}
+	var cleared profile.CanonicalProfile
+	if err := json.NewDecoder(deleteResp.Body).Decode(&cleared); err != nil {
+		t.Fatalf("decode cleared profile: %v", err)
+	}
+	if cleared.AvatarMode != profile.AvatarModeGenerated || cleared.AvatarPresetID == nil || cleared.AvatarAssetID != nil {
+		t.Fatalf("expected generated avatar without asset, got %+v", cleared)
+	}
+	if cleared.AvatarURL == nil || !strings.HasSuffix(*cleared.AvatarURL, "/v1/profile/avatar/preset/"+*cleared.AvatarPresetID) {
+		t.Fatalf("expected preset avatar url, got %v", cleared.AvatarURL)
+	}
+	if cleared.ProfileVersion != uploaded.ProfileVersion+1 {
+		t.Fatalf("expected profile version %d, got %d", uploaded.ProfileVersion+1, cleared.ProfileVersion)
+	}
+	expectRealtimeEnvelope(t, conn, "profile_updated")
+
+	resp, err := http.Get(ts.URL + "/v1/profile/avatar/" + assetID)
+	if err != nil {
+		t.Fatalf("get avatar failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected orphaned avatar to be removed, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/openchat/openchat-backend/internal/chat"
+)
+
+const maxReactionBatchMessages = 100
+
+func (s *Server) addReaction(w http.ResponseWriter, r *http.Request) {
+	s.setReaction(w, r, s.chat.AddReaction)
+}
+
+func (s *Server) removeReaction(w http.ResponseWriter, r *http.Request) {
+	s.setReaction(w, r, s.chat.RemoveReaction)
+}
+
+func (s *Server) setReaction(w http.ResponseWriter, r *http.Request, apply func(chat.ReactionInput) ([]chat.ReactionSummary, error)) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	messageID := strings.TrimSpace(chi.URLParam(r, "messageID"))
+	emoji := chi.URLParam(r, "emoji")
+	if unescaped, err := url.PathUnescape(emoji); err == nil {
+		emoji = unescaped
+	}
+
+	requester := requesterFromContext(r.Context())
+	reactions, err := apply(chat.ReactionInput{
+		ChannelID: channelID,
+		MessageID: messageID,
+		UserUID:   requester.UserUID,
+		Emoji:     emoji,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrMessageNotFound):
+			writeErrorKind(w, errorKindNotFound, "message_not_found", err.Error())
+		case errors.Is(err, chat.ErrReactionInvalid):
+			writeErrorKind(w, errorKindInvalid, "reaction_invalid", "reaction emoji is invalid")
+		case errors.Is(err, chat.ErrReactionNotAllowed):
+			writeErrorKind(w, errorKindInvalid, "reaction_not_allowed", "reaction emoji is not allowed on this server")
+		default:
+			writeErrorKind(w, errorKindInternal, "reaction_update_failed", "unable to update reaction")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id": channelID,
+		"message_id": messageID,
+		"reactions":  reactions,
+	})
+}
+
+func (s *Server) batchReactions(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	var body struct {
+		MessageIDs []string `json:"message_ids"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid reactions payload")
+		return
+	}
+	if len(body.MessageIDs) == 0 {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "at least one message_id is required")
+		return
+	}
+	if len(body.MessageIDs) > maxReactionBatchMessages {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "too many message_ids")
+		return
+	}
+
+	requester := requesterFromContext(r.Context())
+	reactions, unknown, err := s.chat.ReactionSummaries(channelID, requester.UserUID, body.MessageIDs)
+	if err != nil {
+		if errors.Is(err, chat.ErrChannelNotFound) {
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+			return
+		}
+		writeErrorKind(w, errorKindInternal, "reactions_lookup_failed", "unable to load reactions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id":          channelID,
+		"reactions":           reactions,
+		"unknown_message_ids": unknown,
+	})
+}
@@ -0,0 +1,172 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func sendReaction(t *testing.T, baseURL string, method string, channelID string, messageID string, userUID string, emoji string) {
+	t.Helper()
+	req, err := http.NewRequest(method, baseURL+"/v1/channels/"+channelID+"/messages/"+messageID+"/reactions/"+url.PathEscape(emoji), nil)
+	if err != nil {
+		t.Fatalf("build reaction request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", userUID)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("send reaction request: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		payload, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected reaction status: %d body=%s", resp.StatusCode, string(payload))
+	}
+}
+
+func TestBatchReactionSummaries(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	first := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_react_author", map[string]any{"body": "first"}))
+	second := decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_react_author", map[string]any{"body": "second"}))
+
+	sendReaction(t, ts.URL, http.MethodPut, "ch_general", first.Message.ID, "uid_react_alice", "👍")
+	sendReaction(t, ts.URL, http.MethodPut, "ch_general", first.Message.ID, "uid_react_bob", "👍")
+	sendReaction(t, ts.URL, http.MethodPut, "ch_general", second.Message.ID, "uid_react_bob", "🎉")
+	sendReaction(t, ts.URL, http.MethodPut, "ch_general", second.Message.ID, "uid_react_alice", "🎉")
+	sendReaction(t, ts.URL, http.MethodDelete, "ch_general", second.Message.ID, "uid_react_alice", "🎉")
+
+	raw, _ := json.Marshal(map[string]any{"message_ids": []string{first.Message.ID, second.Message.ID, "msg_missing"}})
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/channels/ch_general/reactions:batch", bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("build batch request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_react_alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("batch request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+	var batch struct {
+		Reactions map[string][]struct {
+			Emoji   string `json:"emoji"`
+			Count   int    `json:"count"`
+			Reacted bool   `json:"reacted"`
+		} `json:"reactions"`
+		UnknownMessageIDs []string `json:"unknown_message_ids"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&batch); err != nil {
+		t.Fatalf("decode batch response: %v", err)
+	}
+
+	firstSummary := batch.Reactions[first.Message.ID]
+	if len(firstSummary) != 1 || firstSummary[0].Emoji != "👍" || firstSummary[0].Count != 2 || !firstSummary[0].Reacted {
+		t.Fatalf("unexpected first message reactions %+v", firstSummary)
+	}
+	secondSummary := batch.Reactions[second.Message.ID]
+	if len(secondSummary) != 1 || secondSummary[0].Emoji != "🎉" || secondSummary[0].Count != 1 || secondSummary[0].Reacted {
+		t.Fatalf("unexpected second message reactions %+v", secondSummary)
+	}
+	if len(batch.UnknownMessageIDs) != 1 || batch.UnknownMessageIDs[0] != "msg_missing" {
+		t.Fatalf("expected msg_missing to be unknown, got %v", batch.UnknownMessageIDs)
+	}
+}
+
+func TestBatchReactionsRejectsOversizedBatch(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	ids := make([]string, maxReactionBatchMessages+1)
+	for idx := range ids {
+		ids[idx] = "msg_" + string(rune('a'+idx%26))
+	}
+	raw, _ := json.Marshal(map[string]any{"message_ids": ids})
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/channels/ch_general/reactions:batch", bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("build batch request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_react_alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("batch request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for oversized batch, got %d", resp.StatusCode)
+	}
+}
+
+func TestReactionEmojiAllowlistAndCustomEmoji(t *testing.T) {
+	emojiDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(emojiDir, "partyparrot.png"), onePixelPNG, 0o600); err != nil {
+		t.Fatalf("write custom emoji: %v", err)
+	}
+	cfg := testConfig()
+	cfg.ReactionEmojis = []string{"👍", "🎉"}
+	cfg.CustomEmojiDir = emojiDir
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	sendReaction(t, ts.URL, http.MethodPut, "ch_general", "msg_seed_01", "uid_react_alice", "👍")
+	sendReaction(t, ts.URL, http.MethodPut, "ch_general", "msg_seed_01", "uid_react_alice", ":partyparrot:")
+
+	req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/channels/ch_general/messages/msg_seed_01/reactions/"+url.PathEscape("🚀"), nil)
+	if err != nil {
+		t.Fatalf("build reaction request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_react_alice")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("send reaction request: %v", err)
+	}
+	var errPayload struct {
+		Code string `json:"code"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&errPayload)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest || errPayload.Code != "reaction_not_allowed" {
+		t.Fatalf("expected 400 reaction_not_allowed, got %d %q", resp.StatusCode, errPayload.Code)
+	}
+
+	catalogResp, err := http.Get(ts.URL + "/v1/emojis")
+	if err != nil {
+		t.Fatalf("get emoji catalog: %v", err)
+	}
+	defer catalogResp.Body.Close()
+	var catalog struct {
+		ReactionEmojis []string `json:"reaction_emojis"`
+		Custom         []struct {
+			ID        string `json:"id"`
+			Shortcode string `json:"shortcode"`
+		} `json:"custom"`
+	}
+	if err := json.NewDecoder(catalogResp.Body).Decode(&catalog); err != nil {
+		t.Fatalf("decode emoji catalog: %v", err)
+	}
+	if len(catalog.ReactionEmojis) != 2 || len(catalog.Custom) != 1 || catalog.Custom[0].Shortcode != ":partyparrot:" {
+		t.Fatalf("unexpected emoji catalog: %+v", catalog)
+	}
+
+	imageResp, err := http.Get(ts.URL + "/v1/emojis/partyparrot")
+	if err != nil {
+		t.Fatalf("get custom emoji: %v", err)
+	}
+	defer imageResp.Body.Close()
+	if imageResp.StatusCode != http.StatusOK || imageResp.Header.Get("Content-Type") != "image/png" {
+		t.Fatalf("unexpected custom emoji response: %d %q", imageResp.StatusCode, imageResp.Header.Get("Content-Type"))
+	}
+}
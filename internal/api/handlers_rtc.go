@@ -2,44 +2,60 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/openchat/openchat-backend/internal/chat"
 	"github.com/openchat/openchat-backend/internal/rtc"
 )
 
 type joinTicketRequest struct {
 	ServerID string `json:"server_id"`
+	Nonce    string `json:"nonce"`
 }
 
 func (s *Server) issueJoinTicket(w http.ResponseWriter, r *http.Request) {
 	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
 	if channelID == "" {
-		writeError(w, http.StatusBadRequest, "invalid_channel", "channel id is required", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_channel", "channel id is required")
 		return
 	}
 	if !s.chat.ChannelExists(channelID) {
-		writeError(w, http.StatusNotFound, "channel_not_found", "unknown voice channel", false)
+		writeErrorKind(w, errorKindNotFound, "channel_not_found", "unknown voice channel")
 		return
 	}
 	if !s.chat.IsVoiceChannel(channelID) {
-		writeError(w, http.StatusBadRequest, "invalid_channel_type", "join ticket can only be created for voice channels", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_channel_type", "join ticket can only be created for voice channels")
+		return
+	}
+	if !s.signaling.ChannelEnabled(channelID) {
+		writeErrorKind(w, errorKindForbidden, "rtc_channel_disabled", "rtc is disabled for this channel")
+		return
+	}
+	if s.cfg.DisableRTCVoice {
+		writeFeatureDisabled(w, "voice")
 		return
 	}
 
 	requester := requesterFromContext(r.Context())
 	var body joinTicketRequest
 	if r.Body != nil {
-		_ = json.NewDecoder(r.Body).Decode(&body)
+		// An absent body falls back to the default server; a malformed one is rejected.
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid join ticket payload")
+			return
+		}
 	}
 	serverID := strings.TrimSpace(body.ServerID)
 	if serverID == "" {
 		serverID = s.capabilities.Build().ServerID
 	}
 	if !s.chat.ServerExists(serverID) {
-		writeError(w, http.StatusNotFound, "server_not_found", "unknown server", false)
+		writeErrorKind(w, errorKindNotFound, "server_not_found", "unknown server")
 		return
 	}
 
@@ -50,19 +66,60 @@ func (s *Server) issueJoinTicket(w http.ResponseWriter, r *http.Request) {
 		DeviceID:  requester.DeviceID,
 		Permissions: rtc.Permissions{
 			Speak:       true,
-			Video:       true,
-			Screenshare: true,
+			Video:       !s.cfg.DisableRTCVideo,
+			Screenshare: !s.cfg.DisableRTCScreenshare,
+			Moderator:   s.chat.HasRole(serverID, requester.UserUID, chat.RoleModerator),
 		},
+		Nonce: body.Nonce,
 	})
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "rtc_ticket_issue_failed", err.Error(), false)
+		writeErrorKind(w, errorKindInternal, "rtc_ticket_issue_failed", "unable to issue join ticket")
+		return
+	}
+
+	s.writeJoinTicket(w, ticket, claims)
+}
+
+func (s *Server) refreshJoinTicket(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	var body struct {
+		Ticket string `json:"ticket"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || strings.TrimSpace(body.Ticket) == "" {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "ticket is required")
+		return
+	}
+
+	ticket, claims, err := s.tokens.Refresh(strings.TrimSpace(body.Ticket))
+	if err != nil {
+		switch {
+		case errors.Is(err, rtc.ErrTicketRefreshExpired):
+			writeErrorKind(w, errorKindUnauthorized, "ticket_refresh_expired", err.Error())
+		case errors.Is(err, rtc.ErrInvalidTicket):
+			writeErrorKind(w, errorKindUnauthorized, "invalid_ticket", err.Error())
+		default:
+			writeErrorKind(w, errorKindInternal, "rtc_ticket_issue_failed", "unable to refresh join ticket")
+		}
 		return
 	}
+	if claims.ChannelID != channelID || claims.UserUID != requesterFromContext(r.Context()).UserUID {
+		writeErrorKind(w, errorKindForbidden, "ticket_mismatch", "ticket was issued for a different channel or user")
+		return
+	}
+	s.writeJoinTicket(w, ticket, claims)
+}
 
+func (s *Server) writeJoinTicket(w http.ResponseWriter, ticket string, claims rtc.TicketClaims) {
 	capabilities := s.capabilities.Build()
+	turnCredential, hasTurnCredential := s.turn.Issue(claims.UserUID)
 	iceServers := []any{}
 	if capabilities.RTC != nil {
 		for _, ice := range capabilities.RTC.IceServers {
+			if ice.CredentialType == "ephemeral" && hasTurnCredential {
+				ice.Username = turnCredential.Username
+				ice.Credential = turnCredential.Credential
+				ice.ExpiresAt = turnCredential.ExpiresAt.Format(time.RFC3339)
+			}
 			server := map[string]any{"urls": ice.URLs}
 			if ice.Username != "" {
 				server["username"] = ice.Username
@@ -93,6 +150,64 @@ func (s *Server) issueJoinTicket(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func (s *Server) getRTCStats(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"rooms": s.signaling.RoomStats(),
+	})
+}
+
+func (s *Server) getRTCHealth(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, s.signaling.Health())
+}
+
+func (s *Server) getMyRTCParticipation(w http.ResponseWriter, r *http.Request) {
+	requester := requesterFromContext(r.Context())
+	participations := make([]map[string]any, 0)
+	for _, participant := range s.signaling.Participation(requester.UserUID) {
+		participations = append(participations, map[string]any{
+			"channel_id":     participant.ChannelID,
+			"participant_id": participant.ParticipantID,
+			"device_id":      participant.DeviceID,
+			"this_device":    participant.DeviceID == requester.DeviceID,
+			"permissions":    participant.Permissions,
+			"joined_at":      participant.JoinedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"user_uid":       requester.UserUID,
+		"participations": participations,
+	})
+}
+
+func (s *Server) getRTCRoster(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	if !s.chat.IsVoiceChannel(channelID) {
+		writeErrorKind(w, errorKindNotFound, "channel_not_found", "unknown voice channel")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id":   channelID,
+		"participants": s.signaling.Roster(channelID),
+	})
+}
+
+func (s *Server) drainRTCChannel(w http.ResponseWriter, r *http.Request) {
+	channelID := strings.TrimSpace(chi.URLParam(r, "channelID"))
+	if !s.chat.IsVoiceChannel(channelID) {
+		writeErrorKind(w, errorKindNotFound, "channel_not_found", "unknown voice channel")
+		return
+	}
+	drained := s.signaling.DrainChannel(channelID)
+	s.logger.Info("rtc channel drained", "channel_id", channelID, "participants", drained, "user_uid", requesterFromContext(r.Context()).UserUID)
+	writeJSON(w, http.StatusOK, map[string]any{
+		"channel_id": channelID,
+		"drained":    drained,
+	})
+}
+
 func (s *Server) signalingWS(w http.ResponseWriter, r *http.Request) {
+	if s.refuseDuringMaintenance(w, r) {
+		return
+	}
 	s.signaling.ServeWS(w, r)
 }
@@ -0,0 +1,797 @@
+package api
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openchat/openchat-backend/internal/rtc"
+)
+
+type joinTicketResponse struct {
+	Ticket      string                `json:"ticket"`
+	ChannelID   string                `json:"channel_id"`
+	DeviceID    string                `json:"device_id"`
+	Permissions rtc.Permissions       `json:"permissions"`
+	ICEServers  []joinTicketICEServer `json:"ice_servers"`
+}
+
+type joinTicketICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username"`
+	Credential string   `json:"credential"`
+	ExpiresAt  string   `json:"expires_at"`
+}
+
+func requestJoinTicket(t *testing.T, baseURL string, channelID string, userUID string, deviceID string) joinTicketResponse {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, baseURL+"/v1/rtc/channels/"+channelID+"/join-ticket", bytes.NewReader([]byte(`{"server_id":"srv_harbor"}`)))
+	if err != nil {
+		t.Fatalf("build join ticket request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", userUID)
+	req.Header.Set("X-OpenChat-Device-ID", deviceID)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("join ticket request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected join ticket status: %d body=%s", resp.StatusCode, string(body))
+	}
+	var ticket joinTicketResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ticket); err != nil {
+		t.Fatalf("decode join ticket: %v", err)
+	}
+	return ticket
+}
+
+func joinVoiceChannel(t *testing.T, baseURL string, channelID string, userUID string) *websocket.Conn {
+	t.Helper()
+	ticket := requestJoinTicket(t, baseURL, channelID, userUID, "dev_"+userUID)
+
+	wsURL := "ws" + strings.TrimPrefix(baseURL, "http") + "/v1/rtc/signaling"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial signaling: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	if err := conn.WriteJSON(rtc.NewEnvelope("rtc.join", channelID, "join_1", map[string]any{"ticket": ticket.Ticket})); err != nil {
+		t.Fatalf("send rtc.join: %v", err)
+	}
+	envelope := readSignalingEnvelope(t, conn)
+	if envelope.Type != "rtc.joined" {
+		t.Fatalf("expected rtc.joined, got %s payload=%s", envelope.Type, string(envelope.Payload))
+	}
+	return conn
+}
+
+func readSignalingEnvelope(t *testing.T, conn *websocket.Conn) rtc.Envelope {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var envelope rtc.Envelope
+	if err := conn.ReadJSON(&envelope); err != nil {
+		t.Fatalf("read signaling envelope: %v", err)
+	}
+	return envelope
+}
+
+func TestChannelGroupsReportActiveCall(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	activeCalls := func() map[string]bool {
+		resp, err := http.Get(ts.URL + "/v1/servers/srv_harbor/channels")
+		if err != nil {
+			t.Fatalf("channel groups request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var payload struct {
+			Groups []struct {
+				Channels []struct {
+					ID         string `json:"id"`
+					ActiveCall bool   `json:"active_call"`
+				} `json:"channels"`
+			} `json:"groups"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+			t.Fatalf("decode channel groups: %v", err)
+		}
+		out := make(map[string]bool)
+		for _, group := range payload.Groups {
+			for _, channel := range group.Channels {
+				out[channel.ID] = channel.ActiveCall
+			}
+		}
+		return out
+	}
+
+	if activeCalls()["vc_general"] {
+		t.Fatalf("expected vc_general to start without an active call")
+	}
+
+	joinVoiceChannel(t, ts.URL, "vc_general", "uid_active_call")
+
+	calls := activeCalls()
+	if !calls["vc_general"] {
+		t.Fatalf("expected vc_general active_call=true after join")
+	}
+	if calls["vc_party"] {
+		t.Fatalf("expected vc_party to remain inactive")
+	}
+}
+
+func TestSignalingPermissionsQueryMatchesTicket(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	ticket := requestJoinTicket(t, ts.URL, "vc_general", "uid_perm_query", "dev_perm_query")
+	conn := joinVoiceChannel(t, ts.URL, "vc_general", "uid_perm_query")
+
+	if err := conn.WriteJSON(rtc.NewEnvelope("rtc.permissions.query", "vc_general", "perm_1", nil)); err != nil {
+		t.Fatalf("send permissions query: %v", err)
+	}
+	envelope := readSignalingEnvelope(t, conn)
+	if envelope.Type != "rtc.permissions" {
+		t.Fatalf("expected rtc.permissions, got %s payload=%s", envelope.Type, string(envelope.Payload))
+	}
+	if envelope.RequestID != "perm_1" {
+		t.Fatalf("expected request id echo, got %q", envelope.RequestID)
+	}
+	var payload struct {
+		Permissions rtc.Permissions `json:"permissions"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		t.Fatalf("decode permissions payload: %v", err)
+	}
+	if payload.Permissions != ticket.Permissions {
+		t.Fatalf("expected permissions %+v, got %+v", ticket.Permissions, payload.Permissions)
+	}
+}
+
+func TestRosterTalliesICECandidateTypes(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	sender := joinVoiceChannel(t, ts.URL, "vc_general", "uid_ice_sender")
+	peer := joinVoiceChannel(t, ts.URL, "vc_general", "uid_ice_peer")
+	if envelope := readSignalingEnvelope(t, sender); envelope.Type != "rtc.participant.joined" {
+		t.Fatalf("expected rtc.participant.joined, got %s", envelope.Type)
+	}
+
+	candidates := []any{
+		"candidate:1 1 udp 2122260223 192.168.1.10 54321 typ host generation 0",
+		"candidate:2 1 udp 1686052607 203.0.113.5 54321 typ srflx raddr 192.168.1.10 rport 54321",
+		map[string]any{"candidate": "candidate:3 1 udp 41885439 198.51.100.7 3478 typ relay raddr 203.0.113.5 rport 54321", "sdp_mid": "0"},
+		"candidate:4 1 udp 2122260223 192.168.1.11 54322 typ host generation 0",
+	}
+	for idx, candidate := range candidates {
+		if err := sender.WriteJSON(rtc.NewEnvelope("rtc.ice.candidate", "vc_general", "ice_"+strconv.Itoa(idx), map[string]any{"candidate": candidate})); err != nil {
+			t.Fatalf("send candidate: %v", err)
+		}
+		if envelope := readSignalingEnvelope(t, peer); envelope.Type != "rtc.ice.candidate" {
+			t.Fatalf("expected relayed rtc.ice.candidate, got %s", envelope.Type)
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/rtc/channels/vc_general/participants", nil)
+	if err != nil {
+		t.Fatalf("build roster request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_ice_observer")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("roster request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var roster struct {
+		Participants []struct {
+			UserUID           string         `json:"user_uid"`
+			ICECandidateTypes map[string]int `json:"ice_candidate_types"`
+		} `json:"participants"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&roster); err != nil {
+		t.Fatalf("decode roster: %v", err)
+	}
+	if len(roster.Participants) != 2 {
+		t.Fatalf("expected 2 participants in roster, got %d", len(roster.Participants))
+	}
+	for _, participant := range roster.Participants {
+		switch participant.UserUID {
+		case "uid_ice_sender":
+			counts := participant.ICECandidateTypes
+			if counts["host"] != 2 || counts["srflx"] != 1 || counts["relay"] != 1 {
+				t.Fatalf("unexpected candidate tallies %v", counts)
+			}
+		case "uid_ice_peer":
+			if len(participant.ICECandidateTypes) != 0 {
+				t.Fatalf("expected no tallies for peer, got %v", participant.ICECandidateTypes)
+			}
+		}
+	}
+}
+
+func TestRosterReportsActiveStreamKinds(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	publisher := joinVoiceChannel(t, ts.URL, "vc_general", "uid_kinds_publisher")
+	peer := joinVoiceChannel(t, ts.URL, "vc_general", "uid_kinds_peer")
+	if envelope := readSignalingEnvelope(t, publisher); envelope.Type != "rtc.participant.joined" {
+		t.Fatalf("expected rtc.participant.joined, got %s", envelope.Type)
+	}
+
+	publish := func(streamID string, streamKind string, eof bool) []string {
+		t.Helper()
+		payload := map[string]any{"stream_id": streamID, "stream_kind": streamKind, "eof": eof}
+		if err := publisher.WriteJSON(rtc.NewEnvelope(rtc.EventMediaState, "vc_general", "media_"+streamID, payload)); err != nil {
+			t.Fatalf("send media state: %v", err)
+		}
+		envelope := readSignalingEnvelope(t, peer)
+		if envelope.Type != rtc.EventParticipantUpdated {
+			t.Fatalf("expected rtc.participant.updated, got %s payload=%s", envelope.Type, string(envelope.Payload))
+		}
+		var updated struct {
+			Participant struct {
+				ActiveStreamKinds []string `json:"active_stream_kinds"`
+			} `json:"participant"`
+		}
+		if err := json.Unmarshal(envelope.Payload, &updated); err != nil {
+			t.Fatalf("decode participant update: %v", err)
+		}
+		if envelope := readSignalingEnvelope(t, peer); envelope.Type != rtc.EventMediaState {
+			t.Fatalf("expected rtc.media.state, got %s", envelope.Type)
+		}
+		return updated.Participant.ActiveStreamKinds
+	}
+	roster := func() []string {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/rtc/channels/vc_general/participants", nil)
+		if err != nil {
+			t.Fatalf("build roster request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_kinds_observer")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("roster request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Participants []struct {
+				UserUID           string   `json:"user_uid"`
+				ActiveStreamKinds []string `json:"active_stream_kinds"`
+			} `json:"participants"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode roster: %v", err)
+		}
+		for _, participant := range body.Participants {
+			if participant.UserUID == "uid_kinds_peer" && len(participant.ActiveStreamKinds) != 0 {
+				t.Fatalf("expected no active kinds for peer, got %v", participant.ActiveStreamKinds)
+			}
+			if participant.UserUID == "uid_kinds_publisher" {
+				return participant.ActiveStreamKinds
+			}
+		}
+		t.Fatalf("publisher missing from roster")
+		return nil
+	}
+
+	if kinds := publish("mic", "audio", false); !slices.Equal(kinds, []string{"audio"}) {
+		t.Fatalf("expected audio in participant update, got %v", kinds)
+	}
+	if kinds := publish("screen", "video_screen", false); !slices.Equal(kinds, []string{"audio", "video_screen"}) {
+		t.Fatalf("expected audio and screen in participant update, got %v", kinds)
+	}
+	if kinds := roster(); !slices.Equal(kinds, []string{"audio", "video_screen"}) {
+		t.Fatalf("expected roster to list audio and screen, got %v", kinds)
+	}
+
+	if kinds := publish("mic", "audio", true); !slices.Equal(kinds, []string{"video_screen"}) {
+		t.Fatalf("expected audio cleared after eof, got %v", kinds)
+	}
+	if kinds := roster(); !slices.Equal(kinds, []string{"video_screen"}) {
+		t.Fatalf("expected roster to list only screen after eof, got %v", kinds)
+	}
+}
+
+func TestDrainRTCChannelDisconnectsOnlyThatRoom(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_drain_admin"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	first := joinVoiceChannel(t, ts.URL, "vc_general", "uid_drain_first")
+	second := joinVoiceChannel(t, ts.URL, "vc_general", "uid_drain_second")
+	bystander := joinVoiceChannel(t, ts.URL, "vc_party", "uid_drain_bystander")
+	if envelope := readSignalingEnvelope(t, first); envelope.Type != rtc.EventParticipantJoined {
+		t.Fatalf("expected rtc.participant.joined, got %s", envelope.Type)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/rtc/channels/vc_general/drain", nil)
+	if err != nil {
+		t.Fatalf("build drain request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_drain_admin")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("drain request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var drained struct {
+		Drained int `json:"drained"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&drained); err != nil {
+		t.Fatalf("decode drain response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || drained.Drained != 2 {
+		t.Fatalf("expected 2 drained participants, got status=%d drained=%d", resp.StatusCode, drained.Drained)
+	}
+
+	var rejoinTicket string
+	for _, conn := range []*websocket.Conn{first, second} {
+		envelope := readSignalingEnvelope(t, conn)
+		for envelope.Type == rtc.EventParticipantLeft {
+			envelope = readSignalingEnvelope(t, conn)
+		}
+		if envelope.Type != rtc.EventError {
+			t.Fatalf("expected rtc.error, got %s", envelope.Type)
+		}
+		var payload struct {
+			Code             string `json:"code"`
+			Retryable        bool   `json:"retryable"`
+			ReconnectAfterMs int    `json:"reconnect_after_ms"`
+			Ticket           string `json:"ticket"`
+		}
+		if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+			t.Fatalf("decode drain payload: %v", err)
+		}
+		if payload.Code != "rtc_server_draining" || !payload.Retryable || payload.ReconnectAfterMs <= 0 || payload.Ticket == "" {
+			t.Fatalf("unexpected drain payload %+v", payload)
+		}
+		rejoinTicket = payload.Ticket
+
+		_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := conn.ReadMessage()
+		if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+			t.Fatalf("expected try-again-later close, got %v", err)
+		}
+	}
+
+	if err := bystander.WriteJSON(rtc.NewEnvelope(rtc.EventPing, "vc_party", "ping_1", nil)); err != nil {
+		t.Fatalf("send ping: %v", err)
+	}
+	if envelope := readSignalingEnvelope(t, bystander); envelope.Type != rtc.EventPong {
+		t.Fatalf("expected bystander to stay connected, got %s", envelope.Type)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/rtc/signaling"
+	rejoined, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial signaling: %v", err)
+	}
+	defer rejoined.Close()
+	if err := rejoined.WriteJSON(rtc.NewEnvelope(rtc.EventJoin, "vc_general", "join_2", map[string]any{"ticket": rejoinTicket})); err != nil {
+		t.Fatalf("send rtc.join: %v", err)
+	}
+	if envelope := readSignalingEnvelope(t, rejoined); envelope.Type != rtc.EventJoined {
+		t.Fatalf("expected rejoin with drain ticket, got %s payload=%s", envelope.Type, string(envelope.Payload))
+	}
+}
+
+func TestJoinRejectedForDisabledRTCChannel(t *testing.T) {
+	cfg := testConfig()
+	cfg.RTCEnabledChannels = []string{"vc_general"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/rtc/channels/vc_party/join-ticket", bytes.NewReader([]byte(`{"server_id":"srv_harbor"}`)))
+	if err != nil {
+		t.Fatalf("build join ticket request: %v", err)
+	}
+	req.Header.Set("X-OpenChat-User-UID", "uid_disabled")
+	req.Header.Set("X-OpenChat-Device-ID", "dev_disabled")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("join ticket request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for disabled channel ticket, got %d", resp.StatusCode)
+	}
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if apiErr.Code != "rtc_channel_disabled" {
+		t.Fatalf("expected rtc_channel_disabled code, got %s", apiErr.Code)
+	}
+
+	ticket, _, err := server.tokens.Issue(rtc.IssueTicketInput{
+		ServerID:  "srv_harbor",
+		ChannelID: "vc_party",
+		UserUID:   "uid_disabled",
+		DeviceID:  "dev_disabled",
+	})
+	if err != nil {
+		t.Fatalf("issue ticket: %v", err)
+	}
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/rtc/signaling"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial signaling: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(rtc.NewEnvelope("rtc.join", "vc_party", "join_1", map[string]any{"ticket": ticket})); err != nil {
+		t.Fatalf("send rtc.join: %v", err)
+	}
+	envelope := readSignalingEnvelope(t, conn)
+	if envelope.Type != "rtc.error" {
+		t.Fatalf("expected rtc.error, got %s", envelope.Type)
+	}
+	var payload struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		t.Fatalf("decode rtc.error payload: %v", err)
+	}
+	if payload.Code != "rtc_channel_disabled" {
+		t.Fatalf("expected rtc_channel_disabled, got %s", payload.Code)
+	}
+}
+
+func TestJoinTicketBindingRejectsMismatchedDeviceOrNonce(t *testing.T) {
+	cfg := testConfig()
+	cfg.RTCBindTicketDevice = true
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	issue := func(nonce string) string {
+		ticket, _, err := server.tokens.Issue(rtc.IssueTicketInput{
+			ServerID:  "srv_harbor",
+			ChannelID: "vc_general",
+			UserUID:   "uid_bound",
+			DeviceID:  "dev_bound",
+			Nonce:     nonce,
+		})
+		if err != nil {
+			t.Fatalf("issue ticket: %v", err)
+		}
+		return ticket
+	}
+	join := func(deviceID string, payload map[string]any) rtc.Envelope {
+		wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/rtc/signaling"
+		conn, _, err := websocket.DefaultDialer.Dial(wsURL, http.Header{"X-OpenChat-Device-ID": {deviceID}})
+		if err != nil {
+			t.Fatalf("dial signaling: %v", err)
+		}
+		defer conn.Close()
+		if err := conn.WriteJSON(rtc.NewEnvelope("rtc.join", "vc_general", "join_1", payload)); err != nil {
+			t.Fatalf("send rtc.join: %v", err)
+		}
+		return readSignalingEnvelope(t, conn)
+	}
+	expectBindingFailure := func(envelope rtc.Envelope) {
+		t.Helper()
+		var payload struct {
+			Code string `json:"code"`
+		}
+		_ = json.Unmarshal(envelope.Payload, &payload)
+		if envelope.Type != "rtc.error" || payload.Code != "rtc_ticket_binding_failed" {
+			t.Fatalf("expected rtc_ticket_binding_failed, got %s payload=%s", envelope.Type, string(envelope.Payload))
+		}
+	}
+
+	expectBindingFailure(join("dev_other", map[string]any{"ticket": issue("")}))
+	// Naming the ticket's device in the payload does not override the upgrade claim.
+	expectBindingFailure(join("dev_other", map[string]any{"ticket": issue(""), "device_id": "dev_bound"}))
+	expectBindingFailure(join("dev_bound", map[string]any{"ticket": issue("nonce_a"), "nonce": "nonce_b"}))
+
+	joined := join("dev_bound", map[string]any{"ticket": issue("nonce_a"), "nonce": "nonce_a"})
+	if joined.Type != "rtc.joined" {
+		t.Fatalf("expected rtc.joined for matching binding, got %s payload=%s", joined.Type, string(joined.Payload))
+	}
+}
+
+func TestJoinTicketValidatesBodyShape(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	post := func(body io.Reader) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/rtc/channels/vc_general/join-ticket", body)
+		if err != nil {
+			t.Fatalf("build join ticket request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_ticket_body")
+		req.Header.Set("X-OpenChat-Device-ID", "dev_ticket_body")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("join ticket request failed: %v", err)
+		}
+		return resp
+	}
+
+	malformed := post(strings.NewReader(`["srv_harbor"]`))
+	defer malformed.Body.Close()
+	if malformed.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for malformed body, got %d", malformed.StatusCode)
+	}
+	var apiErr struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(malformed.Body).Decode(&apiErr); err != nil {
+		t.Fatalf("decode error response: %v", err)
+	}
+	if apiErr.Code != "invalid_payload" {
+		t.Fatalf("expected invalid_payload code, got %s", apiErr.Code)
+	}
+
+	absent := post(nil)
+	defer absent.Body.Close()
+	if absent.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(absent.Body)
+		t.Fatalf("expected absent body to default, got %d body=%s", absent.StatusCode, string(body))
+	}
+	var ticket struct {
+		ServerID string `json:"server_id"`
+	}
+	if err := json.NewDecoder(absent.Body).Decode(&ticket); err != nil {
+		t.Fatalf("decode join ticket: %v", err)
+	}
+	if ticket.ServerID != "srv_harbor" {
+		t.Fatalf("expected default server srv_harbor, got %q", ticket.ServerID)
+	}
+}
+
+func TestModeratorKickDisconnectsTarget(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_kick_moderator"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	moderator := joinVoiceChannel(t, ts.URL, "vc_general", "uid_kick_moderator")
+	target := joinVoiceChannel(t, ts.URL, "vc_general", "uid_kick_target")
+	joined := readSignalingEnvelope(t, moderator)
+	var joinedPayload struct {
+		Participant struct {
+			ParticipantID string `json:"participant_id"`
+		} `json:"participant"`
+	}
+	if err := json.Unmarshal(joined.Payload, &joinedPayload); err != nil || joined.Type != rtc.EventParticipantJoined {
+		t.Fatalf("expected rtc.participant.joined, got %s: %v", joined.Type, err)
+	}
+	targetID := joinedPayload.Participant.ParticipantID
+
+	expectErrorCode := func(conn *websocket.Conn, code string) {
+		t.Helper()
+		envelope := readSignalingEnvelope(t, conn)
+		var payload struct {
+			Code string `json:"code"`
+		}
+		_ = json.Unmarshal(envelope.Payload, &payload)
+		if envelope.Type != rtc.EventError || payload.Code != code {
+			t.Fatalf("expected rtc.error %s, got %s payload=%s", code, envelope.Type, string(envelope.Payload))
+		}
+	}
+	kick := func(conn *websocket.Conn, targetParticipantID string) {
+		t.Helper()
+		if err := conn.WriteJSON(rtc.NewEnvelope(rtc.EventModerationKick, "vc_general", "kick", map[string]any{"target_participant_id": targetParticipantID})); err != nil {
+			t.Fatalf("send rtc.moderation.kick: %v", err)
+		}
+	}
+
+	kick(target, targetID)
+	expectErrorCode(target, "rtc_forbidden")
+	kick(moderator, "p_missing")
+	expectErrorCode(moderator, "rtc_target_not_found")
+
+	kick(moderator, targetID)
+	if envelope := readSignalingEnvelope(t, target); envelope.Type != rtc.EventKicked {
+		t.Fatalf("expected rtc.kicked, got %s payload=%s", envelope.Type, string(envelope.Payload))
+	}
+	_ = target.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := target.ReadMessage(); !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Fatalf("expected policy violation close, got %v", err)
+	}
+	left := readSignalingEnvelope(t, moderator)
+	if left.Type != rtc.EventParticipantLeft || !strings.Contains(string(left.Payload), targetID) {
+		t.Fatalf("expected rtc.participant.left for the kicked participant, got %s payload=%s", left.Type, string(left.Payload))
+	}
+}
+
+func TestJoinTicketIssuesEphemeralTURNCredentials(t *testing.T) {
+	turnURL := "turns:turn.openchat.test:5349"
+	for _, tc := range []struct {
+		name   string
+		secret string
+	}{
+		{name: "with secret", secret: "turn-shared-secret"},
+		{name: "without secret"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.TURNURLs = []string{turnURL}
+			cfg.TURNSecret = tc.secret
+			cfg.TURNCredentialTTL = 10 * time.Minute
+			ts := httptest.NewServer(NewServer(cfg, slog.Default()).Router())
+			defer ts.Close()
+
+			ticket := requestJoinTicket(t, ts.URL, "vc_general", "uid_turn_user", "dev_turn")
+			idx := slices.IndexFunc(ticket.ICEServers, func(server joinTicketICEServer) bool {
+				return slices.Contains(server.URLs, turnURL)
+			})
+			if idx < 0 {
+				t.Fatalf("expected TURN server in ice_servers, got %+v", ticket.ICEServers)
+			}
+			turn := ticket.ICEServers[idx]
+			if tc.secret == "" {
+				if turn.Username != "" || turn.Credential != "" || turn.ExpiresAt != "" {
+					t.Fatalf("expected no TURN credentials without a secret, got %+v", turn)
+				}
+				return
+			}
+
+			expiry, user, ok := strings.Cut(turn.Username, ":")
+			if !ok || user != "uid_turn_user" {
+				t.Fatalf("expected <expiry>:<uid> username, got %q", turn.Username)
+			}
+			expiresAt, err := time.Parse(time.RFC3339, turn.ExpiresAt)
+			if err != nil || strconv.FormatInt(expiresAt.Unix(), 10) != expiry {
+				t.Fatalf("expected expires_at %q to match username expiry %q", turn.ExpiresAt, expiry)
+			}
+			if remaining := time.Until(expiresAt); remaining <= 0 || remaining > cfg.TURNCredentialTTL {
+				t.Fatalf("expected expiry within the TTL, got %s", remaining)
+			}
+			mac := hmac.New(sha1.New, []byte(tc.secret))
+			mac.Write([]byte(turn.Username))
+			if want := base64.StdEncoding.EncodeToString(mac.Sum(nil)); turn.Credential != want {
+				t.Fatalf("expected HMAC-SHA1 credential %q, got %q", want, turn.Credential)
+			}
+		})
+	}
+}
+
+func TestRefreshJoinTicketKeepsClaimsAndOriginalTicket(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	refresh := func(userUID string, ticket string) (int, string, joinTicketResponse) {
+		t.Helper()
+		payload, _ := json.Marshal(map[string]string{"ticket": ticket})
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/rtc/channels/vc_general/join-ticket/refresh", bytes.NewReader(payload))
+		if err != nil {
+			t.Fatalf("build refresh request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("refresh request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			var apiErr struct {
+				Code string `json:"code"`
+			}
+			_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+			return resp.StatusCode, apiErr.Code, joinTicketResponse{}
+		}
+		var refreshed joinTicketResponse
+		if err := json.NewDecoder(resp.Body).Decode(&refreshed); err != nil {
+			t.Fatalf("decode refreshed ticket: %v", err)
+		}
+		return resp.StatusCode, "", refreshed
+	}
+
+	original := requestJoinTicket(t, ts.URL, "vc_general", "uid_refresh", "dev_refresh")
+	status, _, refreshed := refresh("uid_refresh", original.Ticket)
+	if status != http.StatusOK {
+		t.Fatalf("expected refresh to succeed, got %d", status)
+	}
+	if refreshed.Ticket == original.Ticket || refreshed.DeviceID != original.DeviceID || refreshed.Permissions != original.Permissions {
+		t.Fatalf("expected a new ticket with the original claims, got %+v", refreshed)
+	}
+
+	wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/rtc/signaling"
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial signaling: %v", err)
+	}
+	defer conn.Close()
+	if err := conn.WriteJSON(rtc.NewEnvelope("rtc.join", "vc_general", "join_1", map[string]any{"ticket": original.Ticket})); err != nil {
+		t.Fatalf("send rtc.join: %v", err)
+	}
+	if envelope := readSignalingEnvelope(t, conn); envelope.Type != rtc.EventJoined {
+		t.Fatalf("expected the original ticket to still join, got %s payload=%s", envelope.Type, string(envelope.Payload))
+	}
+
+	if status, code, _ := refresh("uid_someone_else", refreshed.Ticket); status != http.StatusForbidden || code != "ticket_mismatch" {
+		t.Fatalf("expected 403 ticket_mismatch for another user, got %d %q", status, code)
+	}
+	if status, code, _ := refresh("uid_refresh", "not-a-ticket"); status != http.StatusUnauthorized || code != "invalid_ticket" {
+		t.Fatalf("expected 401 invalid_ticket, got %d %q", status, code)
+	}
+}
+
+func TestMyRTCParticipationReportsJoinedChannels(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	type participation struct {
+		ChannelID     string `json:"channel_id"`
+		ParticipantID string `json:"participant_id"`
+		DeviceID      string `json:"device_id"`
+		ThisDevice    bool   `json:"this_device"`
+	}
+	fetch := func(deviceID string) []participation {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/rtc/me/participation", nil)
+		if err != nil {
+			t.Fatalf("build participation request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_participation")
+		req.Header.Set("X-OpenChat-Device-ID", deviceID)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("participation request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		var body struct {
+			Participations []participation `json:"participations"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("decode participation: %v", err)
+		}
+		return body.Participations
+	}
+
+	if got := fetch("dev_uid_participation"); len(got) != 0 {
+		t.Fatalf("expected no participation before joining, got %+v", got)
+	}
+
+	conn := joinVoiceChannel(t, ts.URL, "vc_general", "uid_participation")
+	got := fetch("dev_uid_participation")
+	if len(got) != 1 || got[0].ChannelID != "vc_general" || got[0].ParticipantID == "" || !got[0].ThisDevice {
+		t.Fatalf("expected vc_general on this device, got %+v", got)
+	}
+	if other := fetch("dev_other"); len(other) != 1 || other[0].ThisDevice {
+		t.Fatalf("expected the join to be reported for another device as not this_device, got %+v", other)
+	}
+
+	_ = conn.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for len(fetch("dev_uid_participation")) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected participation to clear after leaving")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -1,11 +1,14 @@
 package api
 
 import (
+	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/openchat/openchat-backend/internal/chat"
 )
 
 func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
@@ -18,13 +21,17 @@ func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
 func (s *Server) leaveServerMembership(w http.ResponseWriter, r *http.Request) {
 	serverID := strings.TrimSpace(chi.URLParam(r, "serverID"))
 	if serverID == "" {
-		writeError(w, http.StatusBadRequest, "invalid_server", "server id is required", false)
+		writeErrorKind(w, errorKindInvalid, "invalid_server", "server id is required")
 		return
 	}
 
 	requester := requesterFromContext(r.Context())
 	if err := s.chat.LeaveServer(serverID, requester.UserUID); err != nil {
-		writeError(w, http.StatusNotFound, "server_not_found", err.Error(), false)
+		if errors.Is(err, chat.ErrStoreFailed) {
+			writeErrorKind(w, errorKindInternal, "server_leave_failed", "unable to leave server")
+			return
+		}
+		writeErrorKind(w, errorKindNotFound, "server_not_found", err.Error())
 		return
 	}
 
@@ -35,3 +42,107 @@ func (s *Server) leaveServerMembership(w http.ResponseWriter, r *http.Request) {
 		"left_at":   time.Now().UTC().Format(time.RFC3339),
 	})
 }
+
+func (s *Server) createServer(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ServerID    string `json:"server_id"`
+		DisplayName string `json:"display_name"`
+		IconText    string `json:"icon_text"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid server payload")
+		return
+	}
+
+	server, err := s.chat.CreateServer(chat.CreateServerInput{
+		ServerID:    body.ServerID,
+		DisplayName: body.DisplayName,
+		IconText:    body.IconText,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrServerNameInvalid):
+			writeErrorKind(w, errorKindInvalid, "server_name_invalid", "server display name is invalid")
+		case errors.Is(err, chat.ErrServerExists):
+			writeErrorKind(w, errorKindConflict, "server_exists", "server already exists")
+		default:
+			writeErrorKind(w, errorKindInternal, "server_create_failed", "unable to create server")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"server": server,
+	})
+}
+
+func (s *Server) createChannel(w http.ResponseWriter, r *http.Request) {
+	serverID := strings.TrimSpace(chi.URLParam(r, "serverID"))
+	var body struct {
+		GroupID  string `json:"group_id"`
+		Name     string `json:"name"`
+		Type     string `json:"type"`
+		ReadOnly bool   `json:"read_only"`
+		Order    *int   `json:"order"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid channel payload")
+		return
+	}
+
+	channel, err := s.chat.CreateChannel(serverID, chat.CreateChannelInput{
+		GroupID:  body.GroupID,
+		Name:     body.Name,
+		Type:     chat.ChannelType(body.Type),
+		ReadOnly: body.ReadOnly,
+		Order:    body.Order,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, chat.ErrServerNotFound):
+			writeErrorKind(w, errorKindNotFound, "server_not_found", err.Error())
+		case errors.Is(err, chat.ErrChannelNameInvalid):
+			writeErrorKind(w, errorKindInvalid, "channel_name_invalid", "channel name is invalid")
+		case errors.Is(err, chat.ErrChannelTypeInvalid):
+			writeErrorKind(w, errorKindInvalid, "channel_type_invalid", "channel type must be text or voice")
+		default:
+			writeErrorKind(w, errorKindInternal, "channel_create_failed", "unable to create channel")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"server_id": serverID,
+		"channel":   channel,
+	})
+}
+
+func (s *Server) setDefaultChannel(w http.ResponseWriter, r *http.Request) {
+	serverID := strings.TrimSpace(chi.URLParam(r, "serverID"))
+	var body struct {
+		ChannelID string `json:"channel_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeErrorKind(w, errorKindInvalid, "invalid_payload", "invalid default channel payload")
+		return
+	}
+
+	if err := s.chat.SetDefaultChannel(serverID, body.ChannelID); err != nil {
+		switch {
+		case errors.Is(err, chat.ErrServerNotFound):
+			writeErrorKind(w, errorKindNotFound, "server_not_found", err.Error())
+		case errors.Is(err, chat.ErrChannelNotFound):
+			writeErrorKind(w, errorKindNotFound, "channel_not_found", err.Error())
+		case errors.Is(err, chat.ErrChannelTypeInvalid):
+			writeErrorKind(w, errorKindInvalid, "channel_type_invalid", "default channel must be a text channel")
+		default:
+			writeErrorKind(w, errorKindInternal, "default_channel_update_failed", "unable to update default channel")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"server_id":          serverID,
+		"default_channel_id": strings.TrimSpace(body.ChannelID),
+	})
+}
@@ -0,0 +1,15 @@
+package api
+
+import (
+	"net/http"
+	"time"
+)
+
+func (s *Server) getServerTime(w http.ResponseWriter, _ *http.Request) {
+	now := time.Now().UTC()
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]any{
+		"server_time": now.Format(time.RFC3339Nano),
+		"unix_ms":     now.UnixMilli(),
+	})
+}
@@ -3,8 +3,23 @@ package api
 import (
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
+// pageLimit reads the limit query parameter, clamped to the configured maximum,
+// so a page may hold fewer items than the client asked for.
+func (s *Server) pageLimit(r *http.Request, fallback int) int {
+	limit := fallback
+	if rawLimit := strings.TrimSpace(r.URL.Query().Get("limit")); rawLimit != "" {
+		parsed, err := strconv.Atoi(rawLimit)
+		if err == nil && parsed > 0 {
+			limit = parsed
+		}
+	}
+	return min(limit, s.cfg.PageLimit())
+}
+
 func writeJSON(w http.ResponseWriter, status int, payload any) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
@@ -18,3 +33,80 @@ func writeError(w http.ResponseWriter, status int, code string, message string,
 		Retryable: retryable,
 	})
 }
+
+// errorKind classifies a failure so status and retryability stay consistent across handlers.
+type errorKind int
+
+const (
+	errorKindInvalid errorKind = iota
+	errorKindUnauthorized
+	errorKindForbidden
+	errorKindNotFound
+	errorKindConflict
+	errorKindStale
+	errorKindTooLarge
+	errorKindUnsupportedMedia
+	errorKindRateLimited
+	errorKindInternal
+	errorKindUnavailable
+)
+
+func (k errorKind) status() int {
+	switch k {
+	case errorKindUnauthorized:
+		return http.StatusUnauthorized
+	case errorKindForbidden:
+		return http.StatusForbidden
+	case errorKindNotFound:
+		return http.StatusNotFound
+	case errorKindConflict:
+		return http.StatusConflict
+	case errorKindStale:
+		return http.StatusPreconditionFailed
+	case errorKindTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case errorKindUnsupportedMedia:
+		return http.StatusUnsupportedMediaType
+	case errorKindRateLimited:
+		return http.StatusTooManyRequests
+	case errorKindInternal:
+		return http.StatusInternalServerError
+	case errorKindUnavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+// retryable reports whether repeating the request can succeed: internal failures are
+// transient, stale writes succeed once the client refetches, and rate limits lapse.
+func (k errorKind) retryable() bool {
+	return k == errorKindInternal || k == errorKindUnavailable || k == errorKindStale || k == errorKindRateLimited
+}
+
+func writeFeatureDisabled(w http.ResponseWriter, feature string) {
+	writeErrorKind(w, errorKindForbidden, "feature_disabled", feature+" is disabled on this server")
+}
+
+func writeErrorKind(w http.ResponseWriter, kind errorKind, code string, message string) {
+	writeError(w, kind.status(), code, message, kind.retryable())
+}
+
+// writeListPage keeps the legacy collection key next to items until clients migrate.
+func (s *Server) writeListPage(w http.ResponseWriter, fields map[string]any, legacyKey string, items any, nextCursor string, total int) {
+	payload := make(map[string]any, len(fields)+4)
+	for key, value := range fields {
+		payload[key] = value
+	}
+	if !s.cfg.OmitLegacyListKeys {
+		payload[legacyKey] = items
+	}
+	payload["items"] = items
+	if nextCursor != "" {
+		payload["next_cursor"] = nextCursor
+	} else {
+		payload["next_cursor"] = nil
+	}
+	payload["total"] = total
+	writeJSON(w, http.StatusOK, payload)
+}
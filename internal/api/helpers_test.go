@@ -0,0 +1,35 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestErrorKindRetryableClassification(t *testing.T) {
+	cases := []struct {
+		kind      errorKind
+		code      string
+		status    int
+		retryable bool
+	}{
+		{kind: errorKindInternal, code: "message_create_failed", status: http.StatusInternalServerError, retryable: true},
+		{kind: errorKindInvalid, code: "message_empty", status: http.StatusBadRequest, retryable: false},
+		{kind: errorKindRateLimited, code: "display_name_cooldown", status: http.StatusTooManyRequests, retryable: true},
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		writeErrorKind(rec, tc.kind, tc.code, "test")
+		if rec.Code != tc.status {
+			t.Fatalf("%s: expected status %d, got %d", tc.code, tc.status, rec.Code)
+		}
+		var apiErr APIError
+		if err := json.NewDecoder(rec.Body).Decode(&apiErr); err != nil {
+			t.Fatalf("%s: decode error response: %v", tc.code, err)
+		}
+		if apiErr.Code != tc.code || apiErr.Retryable != tc.retryable {
+			t.Fatalf("%s: expected retryable=%v, got %+v", tc.code, tc.retryable, apiErr)
+		}
+	}
+}
@@ -19,7 +19,7 @@ func withRequesterContext(next http.Handler, strict bool) http.Handler {
 		}
 
 		if uid == "" && strict {
-			writeError(w, http.StatusUnauthorized, "unauthorized", "missing user identity headers", false)
+			writeErrorKind(w, errorKindUnauthorized, "unauthorized", "missing user identity headers")
 			return
 		}
 		if uid == "" {
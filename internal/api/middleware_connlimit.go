@@ -0,0 +1,143 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+// connLimiter caps concurrent websocket connections per client IP. A max of zero
+// disables the limit. Forwarding headers are only believed when the socket peer
+// is a trusted proxy (IPs or CIDRs), and the proxies themselves are never
+// counted.
+type connLimiter struct {
+	max     int
+	trusted []netip.Prefix
+
+	mu     sync.Mutex
+	active map[string]int
+}
+
+func newConnLimiter(max int, trustedProxies []string) *connLimiter {
+	limiter := &connLimiter{
+		max:    max,
+		active: make(map[string]int),
+	}
+	for _, raw := range trustedProxies {
+		raw = strings.TrimSpace(raw)
+		if prefix, err := netip.ParsePrefix(raw); err == nil {
+			limiter.trusted = append(limiter.trusted, prefix.Masked())
+			continue
+		}
+		if addr, err := netip.ParseAddr(raw); err == nil {
+			limiter.trusted = append(limiter.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+		}
+	}
+	return limiter
+}
+
+// limit holds a slot for the lifetime of the wrapped handler, which for websocket
+// endpoints is the lifetime of the connection.
+func (l *connLimiter) limit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := l.clientIP(r)
+		if !l.acquire(ip) {
+			writeErrorKind(w, errorKindRateLimited, "too_many_connections", "too many concurrent connections from this address")
+			return
+		}
+		defer l.release(ip)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (l *connLimiter) acquire(ip string) bool {
+	if l.max <= 0 || l.isTrusted(ip) {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[ip] >= l.max {
+		return false
+	}
+	l.active[ip]++
+	return true
+}
+
+func (l *connLimiter) release(ip string) {
+	if l.max <= 0 || l.isTrusted(ip) {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.active[ip] <= 1 {
+		delete(l.active, ip)
+		return
+	}
+	l.active[ip]--
+}
+
+func (l *connLimiter) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range l.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP is the socket peer, or, when the peer is a trusted proxy, the
+// nearest untrusted address in X-Forwarded-For (then X-Real-IP).
+func (l *connLimiter) clientIP(r *http.Request) string {
+	peer := peerIP(r)
+	if !l.isTrusted(peer) {
+		return peer
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for idx := len(hops) - 1; idx >= 0; idx-- {
+			hop := strings.TrimSpace(hops[idx])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			if !l.isTrusted(hop) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		if _, err := netip.ParseAddr(realIP); err == nil {
+			return realIP
+		}
+	}
+	return peer
+}
+
+type peerAddrContextKey struct{}
+
+// withPeerAddr records the socket peer before middleware.RealIP replaces
+// RemoteAddr with a client-supplied forwarding header.
+func withPeerAddr(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), peerAddrContextKey{}, r.RemoteAddr)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func peerIP(r *http.Request) string {
+	addr, ok := r.Context().Value(peerAddrContextKey{}).(string)
+	if !ok {
+		addr = r.RemoteAddr
+	}
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -1,16 +1,45 @@
 package api
 
-import "net/http"
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
 
-func withCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match, X-OpenChat-User-UID, X-OpenChat-Device-ID")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+var (
+	defaultCORSAllowedHeaders = []string{"Content-Type", "Authorization", "If-Match", "If-None-Match", "Idempotency-Key", "X-OpenChat-User-UID", "X-OpenChat-Device-ID", "X-OpenChat-Request-Timeout"}
+	defaultCORSAllowedMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}
+)
+
+func withCORS(allowedMethods []string, allowedHeaders []string, maxAge time.Duration) func(http.Handler) http.Handler {
+	if len(allowedMethods) == 0 {
+		allowedMethods = defaultCORSAllowedMethods
+	}
+	if len(allowedHeaders) == 0 {
+		allowedHeaders = defaultCORSAllowedHeaders
+	}
+	methods := strings.Join(allowedMethods, ", ")
+	headers := strings.Join(allowedHeaders, ", ")
+	maxAgeSeconds := ""
+	if maxAge > 0 {
+		maxAgeSeconds = strconv.Itoa(int(maxAge / time.Second))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+			w.Header().Set("Access-Control-Allow-Headers", headers)
+			w.Header().Set("Access-Control-Allow-Methods", methods)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag")
+			if r.Method == http.MethodOptions {
+				if maxAgeSeconds != "" {
+					w.Header().Set("Access-Control-Max-Age", maxAgeSeconds)
+				}
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
 }
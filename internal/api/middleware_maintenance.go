@@ -0,0 +1,60 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const maintenanceTogglePath = "/v1/admin/maintenance"
+
+// withMaintenance blocks writes (and reads when configured) while maintenance mode is on.
+func (s *Server) withMaintenance(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.maintenance.Load() || r.URL.Path == maintenanceTogglePath || websocket.IsWebSocketUpgrade(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if !s.cfg.MaintenanceBlockReads {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		s.writeMaintenance(w)
+	})
+}
+
+func (s *Server) writeMaintenance(w http.ResponseWriter) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(s.maintenanceRetryAfter()/time.Second)))
+	writeErrorKind(w, errorKindUnavailable, "maintenance", "server is under maintenance")
+}
+
+func (s *Server) maintenanceRetryAfter() time.Duration {
+	if s.cfg.MaintenanceRetryAfter <= 0 {
+		return 120 * time.Second
+	}
+	return s.cfg.MaintenanceRetryAfter
+}
+
+// refuseDuringMaintenance closes new websocket connections with a try-again-later reason.
+func (s *Server) refuseDuringMaintenance(w http.ResponseWriter, r *http.Request) bool {
+	if !s.maintenance.Load() {
+		return false
+	}
+	upgrader := websocket.Upgrader{CheckOrigin: func(_ *http.Request) bool { return true }}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return true
+	}
+	_ = conn.WriteControl(
+		websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "maintenance"),
+		time.Now().Add(time.Second),
+	)
+	_ = conn.Close()
+	return true
+}
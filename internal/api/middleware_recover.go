@@ -0,0 +1,42 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/gorilla/websocket"
+)
+
+// withRecover turns a handler panic into the standard JSON error envelope. The
+// panic value and stack are logged with the request id and never sent to the client.
+func withRecover(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				recovered := recover()
+				if recovered == nil {
+					return
+				}
+				if err, ok := recovered.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(recovered)
+				}
+				logger.Error("handler panicked",
+					"request_id", middleware.GetReqID(r.Context()),
+					"method", r.Method,
+					"path", r.URL.Path,
+					"panic", recovered,
+					"stack", string(debug.Stack()),
+				)
+				// An upgraded connection has been hijacked; there is no response to write.
+				if websocket.IsWebSocketUpgrade(r) {
+					return
+				}
+				writeErrorKind(w, errorKindInternal, "internal_error", "internal server error")
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
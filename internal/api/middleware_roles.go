@@ -0,0 +1,35 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/openchat/openchat-backend/internal/chat"
+)
+
+// requireRole rejects requesters holding none of roles with 403. Roles are
+// checked on the route's {serverID}, else on the server owning its
+// {channelID}; server-wide routes check without one.
+func (s *Server) requireRole(roles ...chat.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			serverID := strings.TrimSpace(chi.URLParam(r, "serverID"))
+			if channelID := strings.TrimSpace(chi.URLParam(r, "channelID")); serverID == "" && channelID != "" {
+				serverID = s.chat.ChannelServerID(channelID)
+			}
+			userUID := requesterFromContext(r.Context()).UserUID
+			for _, role := range roles {
+				if s.chat.HasRole(serverID, userUID, role) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			names := make([]string, len(roles))
+			for idx, role := range roles {
+				names[idx] = string(role)
+			}
+			writeErrorKind(w, errorKindForbidden, "forbidden", "requires the "+strings.Join(names, " or ")+" role")
+		})
+	}
+}
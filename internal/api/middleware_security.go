@@ -0,0 +1,49 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultHSTSMaxAge = 365 * 24 * time.Hour
+
+// withSecurityHeaders sets the production response headers. HSTS is only sent
+// over TLS, and X-Forwarded-Proto is only believed from a trusted proxy.
+func withSecurityHeaders(maxAge time.Duration, includeSubdomains bool, proxies *connLimiter) func(http.Handler) http.Handler {
+	hsts := hstsHeaderValue(maxAge, includeSubdomains)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Content-Type-Options", "nosniff")
+			w.Header().Set("Referrer-Policy", "no-referrer")
+			if requestIsTLS(r, proxies) {
+				w.Header().Set("Strict-Transport-Security", hsts)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hstsHeaderValue builds the Strict-Transport-Security value; a max age of
+// zero falls back to one year.
+func hstsHeaderValue(maxAge time.Duration, includeSubdomains bool) string {
+	if maxAge <= 0 {
+		maxAge = defaultHSTSMaxAge
+	}
+	value := "max-age=" + strconv.FormatInt(int64(maxAge/time.Second), 10)
+	if includeSubdomains {
+		value += "; includeSubDomains"
+	}
+	return value
+}
+
+func requestIsTLS(r *http.Request, proxies *connLimiter) bool {
+	if r.TLS != nil {
+		return true
+	}
+	if !proxies.isTrusted(peerIP(r)) {
+		return false
+	}
+	return strings.EqualFold(strings.TrimSpace(r.Header.Get("X-Forwarded-Proto")), "https")
+}
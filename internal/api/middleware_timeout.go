@@ -0,0 +1,38 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const requestTimeoutHeader = "X-OpenChat-Request-Timeout"
+
+// withRequestTimeout bounds a request by the client's timeout header, clamped to maxTimeout.
+func withRequestTimeout(maxTimeout time.Duration) func(http.Handler) http.Handler {
+	if maxTimeout <= 0 {
+		maxTimeout = 60 * time.Second
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := strings.TrimSpace(r.Header.Get(requestTimeoutHeader))
+			if raw == "" || websocket.IsWebSocketUpgrade(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			seconds, err := strconv.Atoi(raw)
+			if err != nil || seconds <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			timeout := min(time.Duration(seconds)*time.Second, maxTimeout)
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
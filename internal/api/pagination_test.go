@@ -0,0 +1,175 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+)
+
+type listEnvelope struct {
+	Items      []json.RawMessage `json:"items"`
+	NextCursor *string           `json:"next_cursor"`
+	Total      int               `json:"total"`
+}
+
+func getListEnvelope(t *testing.T, url string) (listEnvelope, map[string]json.RawMessage) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("list request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read list body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected list status: %d body=%s", resp.StatusCode, string(body))
+	}
+
+	var envelope listEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		t.Fatalf("decode list envelope: %v", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(body, &raw); err != nil {
+		t.Fatalf("decode list fields: %v", err)
+	}
+	return envelope, raw
+}
+
+func TestListMessagesPaginationEnvelope(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	first, raw := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages?limit=1")
+	if _, ok := raw["messages"]; !ok {
+		t.Fatalf("expected legacy messages key during transition")
+	}
+	if len(first.Items) != 1 || first.Total != 2 {
+		t.Fatalf("expected 1 item of 2 total, got %d of %d", len(first.Items), first.Total)
+	}
+	if first.NextCursor == nil || *first.NextCursor != "msg_seed_02" {
+		t.Fatalf("expected next_cursor msg_seed_02, got %v", first.NextCursor)
+	}
+
+	second, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages?limit=1&before="+*first.NextCursor)
+	if len(second.Items) != 1 {
+		t.Fatalf("expected 1 item on second page, got %d", len(second.Items))
+	}
+	var oldest struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(second.Items[0], &oldest); err != nil {
+		t.Fatalf("decode second page item: %v", err)
+	}
+	if oldest.ID != "msg_seed_01" {
+		t.Fatalf("expected msg_seed_01 on second page, got %s", oldest.ID)
+	}
+	if second.NextCursor != nil {
+		t.Fatalf("expected null next_cursor on last page, got %q", *second.NextCursor)
+	}
+}
+
+func TestListMembersPaginationEnvelope(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	envelope, raw := getListEnvelope(t, ts.URL+"/v1/servers/srv_harbor/members")
+	if _, ok := raw["members"]; !ok {
+		t.Fatalf("expected legacy members key during transition")
+	}
+	if _, ok := raw["next_cursor"]; !ok {
+		t.Fatalf("expected next_cursor key in envelope")
+	}
+	if len(envelope.Items) != 4 || envelope.Total != 4 {
+		t.Fatalf("expected 4 members, got %d items total=%d", len(envelope.Items), envelope.Total)
+	}
+}
+
+func TestListEnvelopeOmitsLegacyKeysWhenConfigured(t *testing.T) {
+	cfg := testConfig()
+	cfg.OmitLegacyListKeys = true
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	envelope, raw := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages")
+	if _, ok := raw["messages"]; ok {
+		t.Fatalf("expected legacy messages key to be omitted")
+	}
+	if len(envelope.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(envelope.Items))
+	}
+}
+
+func TestListMessagesClampsLimitToConfiguredMax(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxPageLimit = 1
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	envelope, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages?limit=1000000")
+	if len(envelope.Items) != 1 || envelope.Total != 2 {
+		t.Fatalf("expected limit clamped to 1 item of 2 total, got %d of %d", len(envelope.Items), envelope.Total)
+	}
+	if envelope.NextCursor == nil {
+		t.Fatalf("expected next_cursor when the page was clamped")
+	}
+}
+
+func TestListMessagesDescendingOrderReversesPage(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	for _, body := range []string{"third", "fourth"} {
+		decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_order", map[string]any{"body": body}))
+	}
+	messageIDs := func(envelope listEnvelope) []string {
+		ids := make([]string, 0, len(envelope.Items))
+		for _, item := range envelope.Items {
+			var message struct {
+				ID string `json:"id"`
+			}
+			if err := json.Unmarshal(item, &message); err != nil {
+				t.Fatalf("decode message item: %v", err)
+			}
+			ids = append(ids, message.ID)
+		}
+		return ids
+	}
+
+	asc, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages?limit=3")
+	desc, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages?limit=3&order=desc")
+	ascIDs, descIDs := messageIDs(asc), messageIDs(desc)
+	reversed := slices.Clone(descIDs)
+	slices.Reverse(reversed)
+	if len(ascIDs) != 3 || !slices.Equal(ascIDs, reversed) {
+		t.Fatalf("expected desc page to reverse asc page, asc=%v desc=%v", ascIDs, descIDs)
+	}
+	if asc.NextCursor == nil || desc.NextCursor == nil || *asc.NextCursor != *desc.NextCursor || *asc.NextCursor != ascIDs[0] {
+		t.Fatalf("expected both orders to share the oldest-message cursor, asc=%v desc=%v", asc.NextCursor, desc.NextCursor)
+	}
+
+	older, _ := getListEnvelope(t, ts.URL+"/v1/channels/ch_general/messages?limit=3&order=desc&before="+*desc.NextCursor)
+	if ids := messageIDs(older); len(ids) != 1 || ids[0] != "msg_seed_01" {
+		t.Fatalf("expected the desc cursor to continue with older messages, got %v", ids)
+	}
+
+	resp, err := http.Get(ts.URL + "/v1/channels/ch_general/messages?order=sideways")
+	if err != nil {
+		t.Fatalf("list request failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for unknown order, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,409 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/openchat/openchat-backend/internal/realtime"
+)
+
+func dialRealtime(t *testing.T, baseURL string, userUID string) *websocket.Conn {
+	t.Helper()
+	wsURL := "ws" + strings.TrimPrefix(baseURL, "http") + "/v1/realtime?user_uid=" + userUID
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		t.Fatalf("dial realtime: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+func subscribeRealtime(t *testing.T, conn *websocket.Conn, channelID string) {
+	t.Helper()
+	if err := conn.WriteJSON(map[string]any{
+		"type":       "chat.subscribe",
+		"request_id": "sub_" + channelID,
+		"payload":    map[string]any{"channel_id": channelID},
+	}); err != nil {
+		t.Fatalf("send chat.subscribe: %v", err)
+	}
+	expectRealtimeEnvelope(t, conn, "chat.subscribed")
+	expectRealtimeEnvelope(t, conn, "chat.presence.snapshot")
+}
+
+func readRealtimeEnvelope(t *testing.T, conn *websocket.Conn) realtime.Envelope {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var envelope realtime.Envelope
+	if err := conn.ReadJSON(&envelope); err != nil {
+		t.Fatalf("read realtime envelope: %v", err)
+	}
+	return envelope
+}
+
+func expectRealtimeEnvelope(t *testing.T, conn *websocket.Conn, eventType realtime.EventType) realtime.Envelope {
+	t.Helper()
+	envelope := readRealtimeEnvelope(t, conn)
+	if envelope.Type != eventType {
+		t.Fatalf("expected %s, got %s payload=%s", eventType, envelope.Type, string(envelope.Payload))
+	}
+	return envelope
+}
+
+func TestPresenceGraceSuppressesReconnectFlicker(t *testing.T) {
+	cfg := testConfig()
+	cfg.PresenceLeaveGrace = time.Second
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	watcher := dialRealtime(t, ts.URL, "uid_presence_watcher")
+	subscribeRealtime(t, watcher, "ch_general")
+
+	flaky := dialRealtime(t, ts.URL, "uid_presence_flaky")
+	subscribeRealtime(t, flaky, "ch_general")
+	expectRealtimeEnvelope(t, watcher, "chat.presence.joined")
+
+	_ = flaky.Close()
+	// Let the hub observe the disconnect before the client comes back.
+	time.Sleep(100 * time.Millisecond)
+	reconnected := dialRealtime(t, ts.URL, "uid_presence_flaky")
+	subscribeRealtime(t, reconnected, "ch_general")
+
+	if err := watcher.WriteJSON(map[string]any{"type": "chat.ping", "request_id": "ping_1"}); err != nil {
+		t.Fatalf("send chat.ping: %v", err)
+	}
+	expectRealtimeEnvelope(t, watcher, "chat.pong")
+
+	time.Sleep(cfg.PresenceLeaveGrace + 200*time.Millisecond)
+	if err := watcher.WriteJSON(map[string]any{"type": "chat.ping", "request_id": "ping_2"}); err != nil {
+		t.Fatalf("send chat.ping: %v", err)
+	}
+	expectRealtimeEnvelope(t, watcher, "chat.pong")
+}
+
+func TestWebsocketConnectionsLimitedPerIP(t *testing.T) {
+	dialer := func(t *testing.T, trustedProxies []string) func(headers http.Header) (*http.Response, error) {
+		cfg := testConfig()
+		cfg.WSMaxConnsPerIP = 2
+		cfg.WSTrustedProxies = trustedProxies
+		ts := httptest.NewServer(NewServer(cfg, slog.Default()).Router())
+		t.Cleanup(ts.Close)
+		return func(headers http.Header) (*http.Response, error) {
+			wsURL := "ws" + strings.TrimPrefix(ts.URL, "http") + "/v1/realtime?user_uid=uid_conn_limit"
+			conn, resp, err := websocket.DefaultDialer.Dial(wsURL, headers)
+			if conn != nil {
+				t.Cleanup(func() { _ = conn.Close() })
+			}
+			return resp, err
+		}
+	}
+	expectRejected := func(t *testing.T, resp *http.Response, err error) {
+		t.Helper()
+		if err == nil {
+			t.Fatalf("expected connection past the limit to be rejected")
+		}
+		if resp == nil || resp.StatusCode != http.StatusTooManyRequests {
+			t.Fatalf("expected 429 past the limit, got %v", resp)
+		}
+	}
+
+	t.Run("spoofed headers from an untrusted peer", func(t *testing.T) {
+		dial := dialer(t, []string{"198.51.100.0/24"})
+		for _, ip := range []string{"203.0.113.1", "198.51.100.10"} {
+			if _, err := dial(http.Header{"X-Real-IP": {ip}}); err != nil {
+				t.Fatalf("dial as %s within limit: %v", ip, err)
+			}
+		}
+		resp, err := dial(http.Header{"X-Real-IP": {"203.0.113.3"}, "X-Forwarded-For": {"198.51.100.11"}})
+		expectRejected(t, resp, err)
+	})
+
+	t.Run("forwarded addresses from a trusted proxy", func(t *testing.T) {
+		dial := dialer(t, []string{"127.0.0.1"})
+		for i := 0; i < 2; i++ {
+			if _, err := dial(http.Header{"X-Real-IP": {"203.0.113.7"}}); err != nil {
+				t.Fatalf("dial %d within limit: %v", i, err)
+			}
+		}
+		resp, err := dial(http.Header{"X-Forwarded-For": {"203.0.113.7, 127.0.0.1"}})
+		expectRejected(t, resp, err)
+
+		if _, err := dial(http.Header{"X-Real-IP": {"203.0.113.8"}}); err != nil {
+			t.Fatalf("expected another address to connect: %v", err)
+		}
+		for i := 0; i < 3; i++ {
+			if _, err := dial(nil); err != nil {
+				t.Fatalf("expected the trusted proxy itself to be exempt: %v", err)
+			}
+		}
+	})
+}
+
+func TestChannelWelcomeDeliveredOnFirstSubscribeOnly(t *testing.T) {
+	cfg := testConfig()
+	cfg.ChannelWelcomeMessages = map[string]string{"ch_general": "Welcome to #general!"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	first := dialRealtime(t, ts.URL, "uid_welcome")
+	subscribeRealtime(t, first, "ch_general")
+	welcome := expectRealtimeEnvelope(t, first, realtime.EventChannelWelcome)
+	if !strings.Contains(string(welcome.Payload), "Welcome to #general!") {
+		t.Fatalf("unexpected welcome payload: %s", string(welcome.Payload))
+	}
+
+	second := dialRealtime(t, ts.URL, "uid_welcome")
+	subscribeRealtime(t, second, "ch_general")
+	if err := second.WriteJSON(map[string]any{"type": "chat.ping", "request_id": "ping_1"}); err != nil {
+		t.Fatalf("send chat.ping: %v", err)
+	}
+	expectRealtimeEnvelope(t, second, realtime.EventPong)
+}
+
+func TestProfileUpdatesOnlyDeliveredToWatchers(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	updateProfile := func(userUID string, displayName string) {
+		raw, _ := json.Marshal(map[string]any{
+			"display_name":     displayName,
+			"avatar_mode":      "generated",
+			"avatar_preset_id": "reef",
+		})
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/profile/me", bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("build update profile request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", userUID)
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("update profile failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected update profile status: %d", resp.StatusCode)
+		}
+	}
+
+	watcher := dialRealtime(t, ts.URL, "uid_watcher")
+	if err := watcher.WriteJSON(map[string]any{
+		"type":       "profile.subscribe",
+		"request_id": "watch_1",
+		"payload":    map[string]any{"user_uids": []string{"uid_watched"}},
+	}); err != nil {
+		t.Fatalf("send profile.subscribe: %v", err)
+	}
+	expectRealtimeEnvelope(t, watcher, realtime.EventProfileSubscribed)
+
+	updateProfile("uid_ignored", "Ignored Person")
+	updateProfile("uid_watched", "Watched Person")
+	update := expectRealtimeEnvelope(t, watcher, realtime.EventProfileUpdated)
+	if !strings.Contains(string(update.Payload), `"user_uid":"uid_watched"`) {
+		t.Fatalf("unexpected profile update payload: %s", string(update.Payload))
+	}
+}
+
+func TestRealtimeClosesConnectionOnOversizedFrame(t *testing.T) {
+	cfg := testConfig()
+	cfg.RealtimeMaxFrameBytes = 1024
+	ts := httptest.NewServer(NewServer(cfg, slog.Default()).Router())
+	defer ts.Close()
+
+	conn := dialRealtime(t, ts.URL, "uid_oversized")
+	defer conn.Close()
+	subscribeRealtime(t, conn, "ch_general")
+
+	if err := conn.WriteJSON(map[string]any{
+		"type":    "chat.typing.update",
+		"payload": map[string]any{"channel_id": strings.Repeat("x", 4096), "is_typing": true},
+	}); err != nil {
+		t.Fatalf("send oversized frame: %v", err)
+	}
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if !websocket.IsCloseError(err, websocket.CloseMessageTooBig) {
+			t.Fatalf("expected close 1009 message too big, got %v", err)
+		}
+		return
+	}
+}
+
+func TestChatPresenceCarriesStatusAndCoalescesDevices(t *testing.T) {
+	ts := httptest.NewServer(NewServer(testConfig(), slog.Default()).Router())
+	defer ts.Close()
+
+	type statusPayload struct {
+		ChannelID  string `json:"channel_id"`
+		UserUID    string `json:"user_uid"`
+		Presence   string `json:"presence"`
+		StatusText string `json:"status_text"`
+		Member     struct {
+			UserUID    string `json:"user_uid"`
+			Presence   string `json:"presence"`
+			StatusText string `json:"status_text"`
+		} `json:"member"`
+	}
+	expectStatus := func(conn *websocket.Conn, eventType realtime.EventType) statusPayload {
+		t.Helper()
+		var payload statusPayload
+		_ = json.Unmarshal(expectRealtimeEnvelope(t, conn, eventType).Payload, &payload)
+		return payload
+	}
+	patchPresence := func(presence string, statusText string) {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]any{"presence": presence, "status_text": statusText})
+		req, err := http.NewRequest(http.MethodPatch, ts.URL+"/v1/profile/me/presence", bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("build presence request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_status_owner")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("presence request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected presence status: %d", resp.StatusCode)
+		}
+	}
+	reportActivity := func(conn *websocket.Conn, presence string) {
+		t.Helper()
+		if err := conn.WriteJSON(map[string]any{"type": "chat.presence.update", "payload": map[string]any{"presence": presence}}); err != nil {
+			t.Fatalf("send chat.presence.update: %v", err)
+		}
+	}
+
+	patchPresence("dnd", "heads down")
+	watcher := dialRealtime(t, ts.URL, "uid_status_watcher")
+	defer watcher.Close()
+	subscribeRealtime(t, watcher, "ch_general")
+
+	desktop := dialRealtime(t, ts.URL, "uid_status_owner")
+	defer desktop.Close()
+	subscribeRealtime(t, desktop, "ch_general")
+	joined := expectStatus(watcher, "chat.presence.joined")
+	if joined.Member.UserUID != "uid_status_owner" || joined.Member.Presence != "dnd" || joined.Member.StatusText != "heads down" {
+		t.Fatalf("expected the join to carry dnd and the status text, got %+v", joined.Member)
+	}
+
+	patchPresence("online", "")
+	if updated := expectStatus(watcher, "chat.presence.updated"); updated.UserUID != "uid_status_owner" || updated.Presence != "online" || updated.ChannelID != "ch_general" {
+		t.Fatalf("expected chat.presence.updated online, got %+v", updated)
+	}
+	expectStatus(desktop, "chat.presence.updated")
+	expectStatus(desktop, "presence_updated")
+
+	phone := dialRealtime(t, ts.URL, "uid_status_owner")
+	defer phone.Close()
+	subscribeRealtime(t, phone, "ch_general")
+	expectStatus(watcher, "chat.presence.joined")
+	expectStatus(desktop, "chat.presence.joined")
+
+	reportActivity(desktop, "idle")
+	reportActivity(phone, "idle")
+	if updated := expectStatus(watcher, "chat.presence.updated"); updated.Presence != "idle" {
+		t.Fatalf("expected idle only once every device is idle, got %+v", updated)
+	}
+	reportActivity(phone, "online")
+	if updated := expectStatus(watcher, "chat.presence.updated"); updated.Presence != "online" {
+		t.Fatalf("expected one active device to make the user online, got %+v", updated)
+	}
+}
+
+func TestInvisibleUsersAreLeftOutOfRoomPresence(t *testing.T) {
+	ts := httptest.NewServer(NewServer(testConfig(), slog.Default()).Router())
+	defer ts.Close()
+
+	patchPresence := func(presence string) {
+		t.Helper()
+		raw, _ := json.Marshal(map[string]any{"presence": presence})
+		req, err := http.NewRequest(http.MethodPatch, ts.URL+"/v1/profile/me/presence", bytes.NewReader(raw))
+		if err != nil {
+			t.Fatalf("build presence request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_hidden")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("presence request failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected presence status: %d", resp.StatusCode)
+		}
+	}
+	snapshotUIDs := func(envelope realtime.Envelope) []string {
+		var payload struct {
+			Members []struct {
+				UserUID string `json:"user_uid"`
+			} `json:"members"`
+		}
+		_ = json.Unmarshal(envelope.Payload, &payload)
+		uids := make([]string, 0, len(payload.Members))
+		for _, member := range payload.Members {
+			uids = append(uids, member.UserUID)
+		}
+		sort.Strings(uids)
+		return uids
+	}
+	subscribe := func(conn *websocket.Conn) realtime.Envelope {
+		t.Helper()
+		if err := conn.WriteJSON(map[string]any{"type": "chat.subscribe", "payload": map[string]any{"channel_id": "ch_general"}}); err != nil {
+			t.Fatalf("send chat.subscribe: %v", err)
+		}
+		expectRealtimeEnvelope(t, conn, "chat.subscribed")
+		return expectRealtimeEnvelope(t, conn, "chat.presence.snapshot")
+	}
+
+	patchPresence("invisible")
+	watcher := dialRealtime(t, ts.URL, "uid_hidden_watcher")
+	subscribe(watcher)
+	hidden := dialRealtime(t, ts.URL, "uid_hidden")
+	if uids := snapshotUIDs(subscribe(hidden)); strings.Join(uids, ",") != "uid_hidden,uid_hidden_watcher" {
+		t.Fatalf("expected the invisible user to see themselves, got %v", uids)
+	}
+
+	// The watcher's next event is the message: no join leaked first.
+	decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_hidden_poster", map[string]any{"body": "anyone here?"}))
+	expectRealtimeEnvelope(t, watcher, "chat.message.created")
+	expectRealtimeEnvelope(t, hidden, "chat.message.created")
+
+	late := dialRealtime(t, ts.URL, "uid_hidden_late")
+	if uids := snapshotUIDs(subscribe(late)); strings.Join(uids, ",") != "uid_hidden_late,uid_hidden_watcher" {
+		t.Fatalf("expected the invisible user to be absent from the snapshot, got %v", uids)
+	}
+	expectRealtimeEnvelope(t, watcher, "chat.presence.joined")
+	expectRealtimeEnvelope(t, hidden, "chat.presence.joined")
+
+	patchPresence("online")
+	joined := expectRealtimeEnvelope(t, watcher, "chat.presence.joined")
+	if !strings.Contains(string(joined.Payload), `"uid_hidden"`) {
+		t.Fatalf("expected the user to join once visible, got %s", joined.Payload)
+	}
+	patchPresence("invisible")
+	left := expectRealtimeEnvelope(t, watcher, "chat.presence.left")
+	if !strings.Contains(string(left.Payload), `"uid_hidden"`) {
+		t.Fatalf("expected the user to leave on going invisible, got %s", left.Payload)
+	}
+
+	hidden.Close()
+	decodeCreatedMessage(t, postJSONMessage(t, ts.URL, "ch_general", "uid_hidden_poster", map[string]any{"body": "still here?"}))
+	expectRealtimeEnvelope(t, watcher, "chat.message.created")
+}
@@ -3,6 +3,7 @@ package api
 import (
 	"log/slog"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
@@ -19,54 +20,148 @@ type Server struct {
 	logger       *slog.Logger
 	capabilities *capabilities.Service
 	tokens       *rtc.TokenService
+	turn         *rtc.TurnCredentialService
 	signaling    *rtc.SignalingService
 	chat         *chat.Service
 	realtime     *realtime.Hub
 	profiles     *profile.Service
+	maintenance  atomic.Bool
+	wsConns      *connLimiter
 }
 
 func NewServer(cfg app.Config, logger *slog.Logger) *Server {
 	capSvc := capabilities.NewService(cfg)
 	tokens := rtc.NewTokenService(cfg.TicketSecret, cfg.TicketTTL)
-	signaling := rtc.NewSignalingService(logger, tokens)
-	chatService := chat.NewService(cfg.PublicBaseURL)
-	realtimeHub := realtime.NewHub(logger)
+	signaling := rtc.NewSignalingService(logger, tokens, rtc.SignalingOptions{
+		EnabledChannels:   cfg.RTCEnabledChannels,
+		BindTicketDevice:  cfg.RTCBindTicketDevice,
+		MaxRooms:          cfg.RTCMaxRooms,
+		MaxParticipants:   cfg.CallParticipantLimit(),
+		RoomSweepInterval: cfg.RTCRoomSweepInterval,
+		EnabledEvents:     cfg.RTCEnabledEvents,
+		SendBufferSize:    cfg.WSSendBuffer,
+		SlowConsumerDrops: cfg.WSSlowConsumerDrops,
+	})
+	var chatStore chat.Store
+	if cfg.DataDir != "" {
+		fileStore, err := chat.NewFileStore(cfg.DataDir)
+		if err != nil {
+			logger.Error("chat data dir unavailable; state will not persist", "dir", cfg.DataDir, "error", err)
+		} else {
+			chatStore = fileStore
+		}
+	}
+	chatService := chat.NewService(cfg.PublicBaseURL, chat.Options{
+		DefaultMessageFormat: chat.MessageFormat(cfg.MessageDefaultFormat),
+		Empty:                cfg.StartEmpty,
+		EditWindow:           cfg.MessageEditWindow,
+		ReplyPreviewMaxRunes: cfg.ReplyPreviewRunes(),
+		MaxPinsPerChannel:    cfg.PinLimit(),
+		MaxScheduleAhead:     cfg.MessageMaxScheduleAhead,
+		MaxScheduledPerUser:  cfg.MessageMaxScheduled,
+		ReactionEmojis:       cfg.ReactionEmojis,
+		StripImageMetadata:   cfg.StripImageMetadata,
+		Store:                chatStore,
+	})
+	if err := chatService.StoreError(); err != nil {
+		logger.Error("chat data could not be loaded; running from seed data without persistence", "dir", cfg.DataDir, "error", err)
+	}
+	if orphaned := chatService.OrphanedChannels(); len(orphaned) > 0 {
+		logger.Warn("dropped stored messages for channels that no longer exist", "dir", cfg.DataDir, "channels", orphaned)
+	}
+	if cfg.CustomEmojiDir != "" {
+		loaded, err := chatService.LoadCustomEmojiDir(cfg.CustomEmojiDir)
+		if err != nil {
+			logger.Warn("some custom emoji were not loaded", "dir", cfg.CustomEmojiDir, "error", err)
+		}
+		logger.Info("custom emoji loaded", "dir", cfg.CustomEmojiDir, "count", loaded)
+	}
+	// With no roles configured there is no provider, which leaves pinning open for
+	// local development; every role check still fails as it would with empty lists.
+	if len(cfg.ModeratorUIDs)+len(cfg.AuthorUIDs)+len(cfg.BotUIDs)+len(cfg.ChannelManagerUIDs) > 0 {
+		chatService.SetPermissionProvider(chat.NewStaticPermissionProvider(map[chat.Role][]string{
+			chat.RoleModerator:      cfg.ModeratorUIDs,
+			chat.RoleAuthor:         cfg.AuthorUIDs,
+			chat.RoleBot:            cfg.BotUIDs,
+			chat.RoleChannelManager: cfg.ChannelManagerUIDs,
+		}))
+	}
+	realtimeHub := realtime.NewHub(logger, realtime.Options{
+		PresenceTTL:         cfg.PresenceHeartbeatTTL,
+		PresenceGrace:       cfg.PresenceLeaveGrace,
+		DisablePresence:     cfg.DisablePresence,
+		WelcomeMessages:     cfg.ChannelWelcomeMessages,
+		WelcomeTTL:          cfg.ChannelWelcomeTTL,
+		ProfileUpdatesToAll: cfg.ProfileUpdatesToAll,
+		ReplayBufferSize:    cfg.RealtimeReplayBuffer,
+		SendBufferSize:      cfg.WSSendBuffer,
+		SlowConsumerDrops:   cfg.WSSlowConsumerDrops,
+		MaxFrameBytes:       int64(cfg.RealtimeMaxFrameBytes),
+	})
 	chatService.SetBroadcaster(realtimeHub)
+	chatService.SetCallOccupancy(signaling)
 
 	capabilitiesSnapshot := capSvc.Build()
-	profileService := profile.NewService(cfg.PublicBaseURL, capabilitiesSnapshot.ServerID)
+	profileService := profile.NewService(cfg.PublicBaseURL, capabilitiesSnapshot.ServerID, profile.Options{
+		MaxAvatarAssetsPerUser: cfg.MaxAvatarAssetsPerUser,
+		ReservedNameWords:      cfg.ReservedDisplayNames,
+		DisplayNameCooldown:    cfg.DisplayNameCooldown,
+	})
 	profileService.SetBroadcaster(realtimeHub)
+	realtimeHub.SetPresenceSource(profileService)
+	if cfg.PresetAvatarDir != "" {
+		loaded, err := profileService.LoadPresetAvatarDir(cfg.PresetAvatarDir)
+		if err != nil {
+			logger.Warn("some preset avatar images were not loaded", "dir", cfg.PresetAvatarDir, "error", err)
+		}
+		logger.Info("preset avatar images loaded", "dir", cfg.PresetAvatarDir, "count", loaded)
+	}
 
-	return &Server{
+	server := &Server{
 		cfg:          cfg,
 		logger:       logger,
 		capabilities: capSvc,
 		tokens:       tokens,
+		turn:         rtc.NewTurnCredentialService(cfg.TURNSecret, cfg.TURNCredentialTTL),
 		signaling:    signaling,
 		chat:         chatService,
 		realtime:     realtimeHub,
 		profiles:     profileService,
+		wsConns:      newConnLimiter(cfg.WSMaxConnsPerIP, cfg.WSTrustedProxies),
 	}
+	server.maintenance.Store(cfg.MaintenanceMode)
+	return server
 }
 
 func (s *Server) Router() http.Handler {
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
+	router.Use(withPeerAddr)
 	router.Use(middleware.RealIP)
-	router.Use(middleware.Recoverer)
-	router.Use(withCORS)
+	router.Use(withRecover(s.logger))
+	router.Use(withCORS(s.cfg.CORSAllowedMethods, s.cfg.CORSAllowedHeaders, s.cfg.CORSMaxAge))
+	if s.cfg.IsProduction() && !s.cfg.DisableSecurityHeaders {
+		router.Use(withSecurityHeaders(s.cfg.HSTSMaxAge, s.cfg.HSTSIncludeSubdomains, s.wsConns))
+	}
 	if !s.cfg.IsProduction() {
 		router.Use(middleware.Logger)
 	}
 
 	router.Get("/healthz", func(w http.ResponseWriter, _ *http.Request) {
-		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		status := "ok"
+		if s.maintenance.Load() {
+			status = "maintenance"
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": status})
 	})
 
 	router.Route("/v1", func(v1 chi.Router) {
+		v1.Use(s.withMaintenance)
+		v1.Use(withRequestTimeout(s.cfg.MaxRequestTimeout))
 		v1.Get("/client/capabilities", s.getCapabilities)
-		v1.Get("/rtc/signaling", s.signalingWS)
-		v1.Get("/realtime", s.realtimeWS)
+		v1.Get("/time", s.getServerTime)
+		v1.With(s.wsConns.limit).Get("/rtc/signaling", s.signalingWS)
+		v1.With(s.wsConns.limit).Get("/realtime", s.realtimeWS)
 		v1.With(func(next http.Handler) http.Handler {
 			return withRequesterContext(next, false)
 		}).Get("/servers", s.listServers)
@@ -74,20 +169,58 @@ func (s *Server) Router() http.Handler {
 		v1.Get("/servers/{serverID}/channels", s.listChannelGroups)
 		v1.Get("/servers/{serverID}/members", s.listMembers)
 		v1.Get("/channels/{channelID}/messages", s.listMessages)
+		v1.Get("/channels/{channelID}/messages:poll", s.pollMessages)
+		v1.Get("/channels/{channelID}/messages/search", s.searchMessages)
+		v1.Get("/channels/{channelID}/pins", s.listPinnedMessages)
+		v1.Post("/channels:recent", s.listRecentMessages)
 		v1.Get("/channels/{channelID}/attachments/{attachmentID}", s.getMessageAttachment)
 		v1.Get("/profile/avatar/{assetID}", s.getProfileAvatar)
+		v1.Get("/emojis", s.listEmojis)
+		v1.Get("/emojis/{emojiID}", s.getCustomEmoji)
+		v1.Get("/profile/avatar/preset/{presetID}", s.getPresetAvatar)
 
 		v1.Group(func(authed chi.Router) {
 			authed.Use(func(next http.Handler) http.Handler {
 				return withRequesterContext(next, s.cfg.IsProduction())
 			})
 			authed.Post("/rtc/channels/{channelID}/join-ticket", s.issueJoinTicket)
+			authed.Post("/rtc/channels/{channelID}/join-ticket/refresh", s.refreshJoinTicket)
+			authed.Get("/rtc/stats", s.getRTCStats)
+			authed.With(s.requireRole(chat.RoleModerator)).Get("/rtc/health", s.getRTCHealth)
+			authed.Get("/rtc/me/participation", s.getMyRTCParticipation)
+			authed.With(s.requireRole(chat.RoleModerator)).Get("/realtime/health", s.getRealtimeHealth)
+			authed.Get("/rtc/channels/{channelID}/participants", s.getRTCRoster)
+			authed.With(s.requireRole(chat.RoleModerator)).Post("/rtc/channels/{channelID}/drain", s.drainRTCChannel)
 			authed.Post("/channels/{channelID}/messages", s.createMessage)
+			authed.Patch("/channels/{channelID}/messages/{messageID}", s.editMessage)
+			authed.Delete("/channels/{channelID}/messages/{messageID}", s.deleteMessage)
+			authed.Put("/channels/{channelID}/pins/{messageID}", s.pinMessage)
+			authed.Delete("/channels/{channelID}/pins/{messageID}", s.unpinMessage)
+			authed.Get("/channels/{channelID}/messages/{messageID}/history", s.getMessageHistory)
+			authed.Delete("/channels/{channelID}/scheduled-messages/{scheduledID}", s.cancelScheduledMessage)
+			authed.Delete("/channels/{channelID}/messages", s.purgeChannelMessages)
+			authed.Post("/channels/{channelID}/messages:delete", s.bulkDeleteMessages)
+			authed.Put("/channels/{channelID}/topic", s.setChannelTopic)
+			authed.Put("/channels/{channelID}/messages/{messageID}/reactions/{emoji}", s.addReaction)
+			authed.Delete("/channels/{channelID}/messages/{messageID}/reactions/{emoji}", s.removeReaction)
+			authed.Post("/channels/{channelID}/reactions:batch", s.batchReactions)
+			authed.With(s.requireRole(chat.RoleModerator, chat.RoleChannelManager)).Post("/servers", s.createServer)
+			authed.With(s.requireRole(chat.RoleModerator, chat.RoleChannelManager)).Post("/servers/{serverID}/channels", s.createChannel)
+			authed.With(s.requireRole(chat.RoleModerator, chat.RoleChannelManager)).Put("/servers/{serverID}/default-channel", s.setDefaultChannel)
 			authed.Delete("/servers/{serverID}/membership", s.leaveServerMembership)
 			authed.Get("/profile/me", s.getMyProfile)
 			authed.Put("/profile/me", s.updateMyProfile)
+			authed.Patch("/profile/me/presence", s.setMyPresence)
 			authed.Post("/profile/avatar", s.uploadProfileAvatar)
+			authed.Delete("/profile/avatar", s.deleteProfileAvatar)
 			authed.Get("/profiles:batch", s.batchProfiles)
+			authed.Get("/profiles/{userUID}", s.getProfile)
+			authed.Post("/presence/heartbeat", s.presenceHeartbeat)
+			authed.Get("/presence", s.batchPresence)
+			authed.With(s.requireRole(chat.RoleModerator)).Get("/admin/storage", s.getStorageStats)
+			authed.Get("/admin/maintenance", s.getMaintenance)
+			authed.With(s.requireRole(chat.RoleModerator)).Put("/admin/maintenance", s.setMaintenance)
+			authed.With(s.requireRole(chat.RoleModerator)).Post("/admin/rtc/channels/{channelID}/migrate", s.migrateRTCChannel)
 		})
 	})
 
@@ -6,12 +6,25 @@ import (
 	"log/slog"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"github.com/openchat/openchat-backend/internal/app"
 )
 
+func testConfig() app.Config {
+	return app.Config{
+		HTTPAddr:      ":0",
+		PublicBaseURL: "http://localhost:8080",
+		SignalingPath: "/v1/rtc/signaling",
+		TicketTTL:     60 * time.Second,
+		TicketSecret:  "test-secret",
+		Environment:   "test",
+	}
+}
+
 func TestCapabilitiesEndpoint(t *testing.T) {
 	cfg := app.Config{
 		HTTPAddr:      ":0",
@@ -58,6 +71,40 @@ func TestCapabilitiesEndpoint(t *testing.T) {
 	}
 }
 
+func TestCapabilitiesIncludeConfiguredBanner(t *testing.T) {
+	cfg := testConfig()
+	cfg.BannerID = "tos_2026_03"
+	cfg.BannerText = "Terms of service updated"
+	cfg.BannerSeverity = "Warning"
+	cfg.BannerDismissible = true
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/client/capabilities")
+	if err != nil {
+		t.Fatalf("capabilities request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var payload struct {
+		Banner *struct {
+			ID          string `json:"id"`
+			Text        string `json:"text"`
+			Severity    string `json:"severity"`
+			Dismissible bool   `json:"dismissible"`
+		} `json:"banner"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Banner == nil {
+		t.Fatalf("expected banner in capabilities response")
+	}
+	if payload.Banner.ID != "tos_2026_03" || payload.Banner.Text != "Terms of service updated" || payload.Banner.Severity != "warning" || !payload.Banner.Dismissible {
+		t.Fatalf("unexpected banner %+v", *payload.Banner)
+	}
+}
+
 func TestServerDirectoryEndpoint(t *testing.T) {
 	cfg := app.Config{
 		HTTPAddr:      ":0",
@@ -207,3 +254,351 @@ func TestLeaveServerMembershipRemovesServerFromRequesterDirectory(t *testing.T)
 		t.Fatalf("expected 2 servers for second requester, got %d", len(otherPayload.Servers))
 	}
 }
+
+func TestServerDirectoryEmptyStartMode(t *testing.T) {
+	cfg := testConfig()
+	cfg.ChannelManagerUIDs = []string{"uid_empty_mode"}
+	cfg.StartEmpty = true
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/servers")
+	if err != nil {
+		t.Fatalf("servers request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status: %d body=%s", resp.StatusCode, string(body))
+	}
+
+	var payload struct {
+		Servers []json.RawMessage `json:"servers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.Servers == nil || len(payload.Servers) != 0 {
+		t.Fatalf("expected empty servers array, got %d entries", len(payload.Servers))
+	}
+
+	createReq, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/servers", strings.NewReader(`{"display_name":"Fresh Harbor"}`))
+	if err != nil {
+		t.Fatalf("build create server request: %v", err)
+	}
+	createReq.Header.Set("X-OpenChat-User-UID", "uid_empty_mode")
+	createReq.Header.Set("Content-Type", "application/json")
+	createResp, err := http.DefaultClient.Do(createReq)
+	if err != nil {
+		t.Fatalf("create server request failed: %v", err)
+	}
+	defer createResp.Body.Close()
+	if createResp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(createResp.Body)
+		t.Fatalf("unexpected create server status: %d body=%s", createResp.StatusCode, string(body))
+	}
+	var created struct {
+		Server struct {
+			ServerID string `json:"server_id"`
+			IconText string `json:"icon_text"`
+		} `json:"server"`
+	}
+	if err := json.NewDecoder(createResp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode create server response: %v", err)
+	}
+	if created.Server.ServerID == "" || created.Server.IconText != "FH" {
+		t.Fatalf("unexpected created server: %+v", created.Server)
+	}
+
+	channelReq, err := http.NewRequest(http.MethodPost, ts.URL+"/v1/servers/"+created.Server.ServerID+"/channels", strings.NewReader(`{"name":"lobby","type":"text"}`))
+	if err != nil {
+		t.Fatalf("build create channel request: %v", err)
+	}
+	channelReq.Header.Set("X-OpenChat-User-UID", "uid_empty_mode")
+	channelReq.Header.Set("Content-Type", "application/json")
+	channelResp, err := http.DefaultClient.Do(channelReq)
+	if err != nil {
+		t.Fatalf("create channel request failed: %v", err)
+	}
+	defer channelResp.Body.Close()
+	if channelResp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(channelResp.Body)
+		t.Fatalf("unexpected create channel status: %d body=%s", channelResp.StatusCode, string(body))
+	}
+	var createdChannel struct {
+		Channel struct {
+			ID string `json:"id"`
+		} `json:"channel"`
+	}
+	if err := json.NewDecoder(channelResp.Body).Decode(&createdChannel); err != nil {
+		t.Fatalf("decode create channel response: %v", err)
+	}
+
+	messagesResp, err := http.Get(ts.URL + "/v1/channels/" + createdChannel.Channel.ID + "/messages")
+	if err != nil {
+		t.Fatalf("list messages request failed: %v", err)
+	}
+	defer messagesResp.Body.Close()
+	if messagesResp.StatusCode != http.StatusOK {
+		t.Fatalf("expected created channel to be listable, got %d", messagesResp.StatusCode)
+	}
+}
+
+func TestSecurityHeadersOnlyInProduction(t *testing.T) {
+	fetchHealth := func(cfg app.Config) http.Header {
+		server := NewServer(cfg, slog.Default())
+		ts := httptest.NewServer(server.Router())
+		defer ts.Close()
+
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/healthz", nil)
+		if err != nil {
+			t.Fatalf("build health request: %v", err)
+		}
+		req.Header.Set("X-Forwarded-Proto", "https")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("health request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		return resp.Header
+	}
+
+	production := testConfig()
+	production.Environment = "production"
+	headers := fetchHealth(production)
+	if headers.Get("Strict-Transport-Security") != "" {
+		t.Fatalf("expected X-Forwarded-Proto from an untrusted peer to be ignored, got %q", headers.Get("Strict-Transport-Security"))
+	}
+
+	production.WSTrustedProxies = []string{"127.0.0.1"}
+	if got := fetchHealth(production).Get("Strict-Transport-Security"); got != "max-age=31536000" {
+		t.Fatalf("expected default HSTS header behind a trusted proxy, got %q", got)
+	}
+	production.HSTSMaxAge = time.Hour
+	production.HSTSIncludeSubdomains = true
+	headers = fetchHealth(production)
+	if got := headers.Get("Strict-Transport-Security"); got != "max-age=3600; includeSubDomains" {
+		t.Fatalf("expected configured HSTS header, got %q", got)
+	}
+	if headers.Get("X-Content-Type-Options") != "nosniff" {
+		t.Fatalf("expected X-Content-Type-Options nosniff, got %q", headers.Get("X-Content-Type-Options"))
+	}
+	if headers.Get("Referrer-Policy") == "" {
+		t.Fatalf("expected Referrer-Policy header in production")
+	}
+
+	development := testConfig()
+	development.Environment = "development"
+	headers = fetchHealth(development)
+	for _, name := range []string{"Strict-Transport-Security", "X-Content-Type-Options", "Referrer-Policy"} {
+		if headers.Get(name) != "" {
+			t.Fatalf("expected no %s header in development, got %q", name, headers.Get(name))
+		}
+	}
+
+	disabled := production
+	disabled.DisableSecurityHeaders = true
+	if fetchHealth(disabled).Get("Strict-Transport-Security") != "" {
+		t.Fatalf("expected security headers to be disabled by config")
+	}
+}
+
+func TestServerDirectoryIncludesDefaultChannel(t *testing.T) {
+	cfg := testConfig()
+	cfg.ModeratorUIDs = []string{"uid_default_channel"}
+	server := NewServer(cfg, slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/v1/servers")
+	if err != nil {
+		t.Fatalf("servers request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	var directory struct {
+		Servers []struct {
+			ServerID         string `json:"server_id"`
+			DefaultChannelID string `json:"default_channel_id"`
+		} `json:"servers"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&directory); err != nil {
+		t.Fatalf("decode servers response: %v", err)
+	}
+	defaultChannelID := ""
+	for _, entry := range directory.Servers {
+		if entry.ServerID == "srv_harbor" {
+			defaultChannelID = entry.DefaultChannelID
+		}
+	}
+	if defaultChannelID == "" {
+		t.Fatalf("expected srv_harbor to have a default_channel_id")
+	}
+
+	groupsResp, err := http.Get(ts.URL + "/v1/servers/srv_harbor/channels")
+	if err != nil {
+		t.Fatalf("channel groups request failed: %v", err)
+	}
+	defer groupsResp.Body.Close()
+	var groupsPayload struct {
+		DefaultChannelID string `json:"default_channel_id"`
+		Groups           []struct {
+			Channels []struct {
+				ID   string `json:"id"`
+				Type string `json:"type"`
+			} `json:"channels"`
+		} `json:"groups"`
+	}
+	if err := json.NewDecoder(groupsResp.Body).Decode(&groupsPayload); err != nil {
+		t.Fatalf("decode channel groups: %v", err)
+	}
+	if groupsPayload.DefaultChannelID != defaultChannelID {
+		t.Fatalf("expected channel groups default %s, got %s", defaultChannelID, groupsPayload.DefaultChannelID)
+	}
+	channelTypes := make(map[string]string)
+	for _, group := range groupsPayload.Groups {
+		for _, channel := range group.Channels {
+			channelTypes[channel.ID] = channel.Type
+		}
+	}
+	if channelTypes[defaultChannelID] != "text" {
+		t.Fatalf("expected default channel %s to be a text channel, got %q", defaultChannelID, channelTypes[defaultChannelID])
+	}
+
+	setDefault := func(channelID string) int {
+		req, err := http.NewRequest(http.MethodPut, ts.URL+"/v1/servers/srv_harbor/default-channel", strings.NewReader(`{"channel_id":"`+channelID+`"}`))
+		if err != nil {
+			t.Fatalf("build default channel request: %v", err)
+		}
+		req.Header.Set("X-OpenChat-User-UID", "uid_default_channel")
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("default channel request failed: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := setDefault("vc_general"); status != http.StatusBadRequest {
+		t.Fatalf("expected voice default channel to be rejected, got %d", status)
+	}
+	if status := setDefault("ch_missing"); status != http.StatusNotFound {
+		t.Fatalf("expected unknown default channel to be rejected, got %d", status)
+	}
+}
+
+func TestServerTimeEndpoint(t *testing.T) {
+	server := NewServer(testConfig(), slog.Default())
+	ts := httptest.NewServer(server.Router())
+	defer ts.Close()
+
+	before := time.Now()
+	resp, err := http.Get(ts.URL + "/v1/time")
+	if err != nil {
+		t.Fatalf("time request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("unexpected status: %d body=%s", resp.StatusCode, string(body))
+	}
+
+	var payload struct {
+		ServerTime string `json:"server_time"`
+		UnixMS     int64  `json:"unix_ms"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		t.Fatalf("decode time response: %v", err)
+	}
+	serverTime, err := time.Parse(time.RFC3339Nano, payload.ServerTime)
+	if err != nil {
+		t.Fatalf("server_time is not RFC3339: %v", err)
+	}
+	if skew := serverTime.Sub(before); skew < -time.Second || skew > 5*time.Second {
+		t.Fatalf("expected recent server_time, got skew %s", skew)
+	}
+	if payload.UnixMS != serverTime.UnixMilli() {
+		t.Fatalf("expected unix_ms %d to match server_time, got %d", serverTime.UnixMilli(), payload.UnixMS)
+	}
+}
+
+func TestCORSPreflightUsesConfiguredPolicy(t *testing.T) {
+	preflight := func(cfg app.Config) http.Header {
+		server := NewServer(cfg, slog.Default())
+		ts := httptest.NewServer(server.Router())
+		defer ts.Close()
+
+		req, err := http.NewRequest(http.MethodOptions, ts.URL+"/v1/profile/me", nil)
+		if err != nil {
+			t.Fatalf("build preflight request: %v", err)
+		}
+		req.Header.Set("Origin", "https://app.example")
+		req.Header.Set("Access-Control-Request-Method", "PUT")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("preflight request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("expected 204 preflight, got %d", resp.StatusCode)
+		}
+		return resp.Header
+	}
+
+	defaults := preflight(testConfig())
+	allowedHeaders := defaults.Get("Access-Control-Allow-Headers")
+	for _, header := range []string{"X-OpenChat-User-UID", "X-OpenChat-Device-ID", "If-Match", "Idempotency-Key"} {
+		if !strings.Contains(allowedHeaders, header) {
+			t.Fatalf("expected default allowed headers to include %s, got %q", header, allowedHeaders)
+		}
+	}
+	if maxAge := defaults.Get("Access-Control-Max-Age"); maxAge != "" {
+		t.Fatalf("expected no max-age without configuration, got %q", maxAge)
+	}
+
+	cfg := testConfig()
+	cfg.CORSAllowedMethods = []string{"GET", "PUT"}
+	cfg.CORSAllowedHeaders = []string{"Content-Type", "X-OpenChat-User-UID"}
+	cfg.CORSMaxAge = 10 * time.Minute
+	configured := preflight(cfg)
+	if methods := configured.Get("Access-Control-Allow-Methods"); methods != "GET, PUT" {
+		t.Fatalf("expected configured methods, got %q", methods)
+	}
+	if headers := configured.Get("Access-Control-Allow-Headers"); headers != "Content-Type, X-OpenChat-User-UID" {
+		t.Fatalf("expected configured headers, got %q", headers)
+	}
+	if maxAge := configured.Get("Access-Control-Max-Age"); maxAge != "600" {
+		t.Fatalf("expected max-age 600, got %q", maxAge)
+	}
+}
+
+func TestRecoverReturnsJSONErrorEnvelope(t *testing.T) {
+	var logs strings.Builder
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	handler := middleware.RequestID(withRecover(logger)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("secret internal detail")
+	})))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/v1/boom", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+	if contentType := rec.Header().Get("Content-Type"); contentType != "application/json" {
+		t.Fatalf("expected JSON content type, got %q", contentType)
+	}
+	var apiErr APIError
+	if err := json.Unmarshal(rec.Body.Bytes(), &apiErr); err != nil {
+		t.Fatalf("decode error envelope: %v body=%s", err, rec.Body.String())
+	}
+	if apiErr.Code != "internal_error" || !apiErr.Retryable {
+		t.Fatalf("unexpected error envelope %+v", apiErr)
+	}
+	if strings.Contains(rec.Body.String(), "secret internal detail") || strings.Contains(rec.Body.String(), "goroutine") {
+		t.Fatalf("panic details leaked to client: %s", rec.Body.String())
+	}
+	if !strings.Contains(logs.String(), "secret internal detail") || !strings.Contains(logs.String(), "request_id=") {
+		t.Fatalf("expected panic and request id in logs, got %s", logs.String())
+	}
+}
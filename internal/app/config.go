@@ -1,6 +1,7 @@
 package app
 
 import (
+	"encoding/json"
 	"net/url"
 	"os"
 	"strconv"
@@ -15,12 +16,119 @@ type Config struct {
 	TicketTTL     time.Duration
 	TicketSecret  string
 	Environment   string
+
+	MessageDefaultFormat    string
+	MessageEditWindow       time.Duration
+	ReplyPreviewMaxRunes    int
+	MaxPinsPerChannel       int
+	MessageMaxScheduleAhead time.Duration
+	MessageMaxScheduled     int
+	StartEmpty              bool
+	DataDir                 string
+	OmitLegacyListKeys      bool
+	MaxPageLimit            int
+	ReactionEmojis          []string
+	CustomEmojiDir          string
+	StripImageMetadata      bool
+
+	DisableSecurityHeaders bool
+	HSTSMaxAge             time.Duration
+	HSTSIncludeSubdomains  bool
+	PresenceHeartbeatTTL   time.Duration
+	PresenceLeaveGrace     time.Duration
+	MaxAvatarAssetsPerUser int
+	ReservedDisplayNames   []string
+	DisplayNameCooldown    time.Duration
+	ChannelWelcomeMessages map[string]string
+	ChannelWelcomeTTL      time.Duration
+	ProfileUpdatesToAll    bool
+	RealtimeReplayBuffer   int
+	WSSendBuffer           int
+	WSSlowConsumerDrops    int
+	RealtimeMaxFrameBytes  int
+	PresetAvatarDir        string
+
+	CORSAllowedMethods []string
+	CORSAllowedHeaders []string
+	CORSMaxAge         time.Duration
+
+	TLSCertFile     string
+	TLSKeyFile      string
+	TLSMinVersion   string
+	TLSCipherSuites []string
+
+	RTCEnabledChannels   []string
+	RTCBindTicketDevice  bool
+	RTCMaxRooms          int
+	RTCMaxParticipants   int
+	RTCRoomSweepInterval time.Duration
+	RTCEnabledEvents     []string
+	TURNURLs             []string
+	TURNSecret           string
+	TURNCredentialTTL    time.Duration
+
+	MaintenanceMode       bool
+	MaintenanceBlockReads bool
+	MaintenanceRetryAfter time.Duration
+
+	MaxRequestTimeout time.Duration
+
+	WSMaxConnsPerIP  int
+	WSTrustedProxies []string
+
+	DisableMessaging      bool
+	DisablePresence       bool
+	DisableAttachments    bool
+	DisableNotifications  bool
+	DisableRTCVoice       bool
+	DisableRTCVideo       bool
+	DisableRTCScreenshare bool
+	DisableRTCSimulcast   bool
+
+	BannerID          string
+	BannerText        string
+	BannerSeverity    string
+	BannerDismissible bool
+
+	ModeratorUIDs []string
+	AuthorUIDs    []string
+	BotUIDs       []string
+
+	ChannelManagerUIDs []string
 }
 
 func (c Config) IsProduction() bool {
 	return strings.EqualFold(c.Environment, "production")
 }
 
+func (c Config) ReplyPreviewRunes() int {
+	if c.ReplyPreviewMaxRunes <= 0 {
+		return 220
+	}
+	return c.ReplyPreviewMaxRunes
+}
+
+func (c Config) PinLimit() int {
+	if c.MaxPinsPerChannel <= 0 {
+		return 50
+	}
+	return c.MaxPinsPerChannel
+}
+
+func (c Config) CallParticipantLimit() int {
+	if c.RTCMaxParticipants <= 0 {
+		return 200
+	}
+	return c.RTCMaxParticipants
+}
+
+func (c Config) PageLimit() int {
+	if c.MaxPageLimit <= 0 {
+		return 200
+	}
+	return c.MaxPageLimit
+}
+
 func (c Config) SignalingURL() string {
 	base, err := url.Parse(c.PublicBaseURL)
 	if err != nil {
@@ -45,6 +153,85 @@ func LoadConfigFromEnv() Config {
 		TicketTTL:     time.Duration(envOrDefaultInt("OPENCHAT_JOIN_TICKET_TTL_SECONDS", 60)) * time.Second,
 		TicketSecret:  envOrDefault("OPENCHAT_JOIN_TICKET_SECRET", "dev-insecure-secret-change-me"),
 		Environment:   envOrDefault("OPENCHAT_ENV", "development"),
+
+		MessageDefaultFormat:    envOrDefault("OPENCHAT_MESSAGE_DEFAULT_FORMAT", "plain"),
+		MessageEditWindow:       time.Duration(envOrDefaultInt("OPENCHAT_MESSAGE_EDIT_WINDOW_SECONDS", 900)) * time.Second,
+		ReplyPreviewMaxRunes:    envOrDefaultInt("OPENCHAT_REPLY_PREVIEW_MAX_RUNES", 220),
+		MaxPinsPerChannel:       envOrDefaultInt("OPENCHAT_MAX_PINS_PER_CHANNEL", 50),
+		MessageMaxScheduleAhead: time.Duration(envOrDefaultInt("OPENCHAT_MESSAGE_MAX_SCHEDULE_AHEAD_HOURS", 720)) * time.Hour,
+		MessageMaxScheduled:     envOrDefaultInt("OPENCHAT_MESSAGE_MAX_SCHEDULED_PER_USER", 20),
+		StartEmpty:              envOrDefaultBool("OPENCHAT_START_EMPTY", false),
+		DataDir:                 envOrDefault("OPENCHAT_DATA_DIR", ""),
+		OmitLegacyListKeys:      envOrDefaultBool("OPENCHAT_API_OMIT_LEGACY_LIST_KEYS", false),
+		MaxPageLimit:            envOrDefaultInt("OPENCHAT_API_MAX_PAGE_LIMIT", 200),
+		ReactionEmojis:          envList("OPENCHAT_REACTION_EMOJIS"),
+		CustomEmojiDir:          envOrDefault("OPENCHAT_CUSTOM_EMOJI_DIR", ""),
+		StripImageMetadata:      envOrDefaultBool("OPENCHAT_ATTACHMENT_STRIP_METADATA", false),
+
+		DisableSecurityHeaders: envOrDefaultBool("OPENCHAT_DISABLE_SECURITY_HEADERS", false),
+		HSTSMaxAge:             time.Duration(envOrDefaultInt("OPENCHAT_HSTS_MAX_AGE_SECONDS", 31536000)) * time.Second,
+		HSTSIncludeSubdomains:  envOrDefaultBool("OPENCHAT_HSTS_INCLUDE_SUBDOMAINS", true),
+		PresenceHeartbeatTTL:   time.Duration(envOrDefaultInt("OPENCHAT_PRESENCE_HEARTBEAT_TTL_SECONDS", 45)) * time.Second,
+		PresenceLeaveGrace:     time.Duration(envOrDefaultInt("OPENCHAT_PRESENCE_LEAVE_GRACE_SECONDS", 5)) * time.Second,
+		MaxAvatarAssetsPerUser: envOrDefaultInt("OPENCHAT_PROFILE_MAX_AVATAR_ASSETS", 10),
+		ReservedDisplayNames:   envList("OPENCHAT_PROFILE_RESERVED_NAMES"),
+		DisplayNameCooldown:    time.Duration(envOrDefaultInt("OPENCHAT_PROFILE_DISPLAY_NAME_COOLDOWN_SECONDS", 3600)) * time.Second,
+		ChannelWelcomeMessages: envStringMap("OPENCHAT_CHANNEL_WELCOME_MESSAGES"),
+		ChannelWelcomeTTL:      time.Duration(envOrDefaultInt("OPENCHAT_CHANNEL_WELCOME_TTL_HOURS", 720)) * time.Hour,
+		ProfileUpdatesToAll:    envOrDefaultBool("OPENCHAT_PROFILE_UPDATES_TO_ALL", false),
+		RealtimeReplayBuffer:   envOrDefaultInt("OPENCHAT_REALTIME_REPLAY_BUFFER", 100),
+		WSSendBuffer:           envOrDefaultInt("OPENCHAT_WS_SEND_BUFFER", 64),
+		WSSlowConsumerDrops:    envOrDefaultInt("OPENCHAT_WS_SLOW_CONSUMER_DROPS", 32),
+		RealtimeMaxFrameBytes:  envOrDefaultInt("OPENCHAT_REALTIME_MAX_FRAME_BYTES", 65536),
+		PresetAvatarDir:        envOrDefault("OPENCHAT_PROFILE_PRESET_AVATAR_DIR", ""),
+
+		CORSAllowedMethods: envList("OPENCHAT_CORS_ALLOWED_METHODS"),
+		CORSAllowedHeaders: envList("OPENCHAT_CORS_ALLOWED_HEADERS"),
+		CORSMaxAge:         time.Duration(envOrDefaultInt("OPENCHAT_CORS_MAX_AGE_SECONDS", 600)) * time.Second,
+
+		TLSCertFile:     envOrDefault("OPENCHAT_TLS_CERT_FILE", ""),
+		TLSKeyFile:      envOrDefault("OPENCHAT_TLS_KEY_FILE", ""),
+		TLSMinVersion:   envOrDefault("OPENCHAT_TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites: envList("OPENCHAT_TLS_CIPHER_SUITES"),
+
+		RTCEnabledChannels:   envList("OPENCHAT_RTC_ENABLED_CHANNELS"),
+		RTCBindTicketDevice:  envOrDefaultBool("OPENCHAT_RTC_BIND_TICKET_DEVICE", false),
+		RTCMaxRooms:          envOrDefaultInt("OPENCHAT_RTC_MAX_ROOMS", 0),
+		RTCMaxParticipants:   envOrDefaultInt("OPENCHAT_RTC_MAX_CALL_PARTICIPANTS", 200),
+		RTCRoomSweepInterval: time.Duration(envOrDefaultInt("OPENCHAT_RTC_ROOM_SWEEP_SECONDS", 30)) * time.Second,
+		RTCEnabledEvents:     envList("OPENCHAT_RTC_ENABLED_EVENTS"),
+		TURNURLs:             envList("OPENCHAT_TURN_URLS"),
+		TURNSecret:           envOrDefault("OPENCHAT_TURN_SECRET", ""),
+		TURNCredentialTTL:    time.Duration(envOrDefaultInt("OPENCHAT_TURN_CREDENTIAL_TTL_SECONDS", 3600)) * time.Second,
+
+		MaintenanceMode:       envOrDefaultBool("OPENCHAT_MAINTENANCE_MODE", false),
+		MaintenanceBlockReads: envOrDefaultBool("OPENCHAT_MAINTENANCE_BLOCK_READS", false),
+		MaintenanceRetryAfter: time.Duration(envOrDefaultInt("OPENCHAT_MAINTENANCE_RETRY_AFTER_SECONDS", 120)) * time.Second,
+
+		MaxRequestTimeout: time.Duration(envOrDefaultInt("OPENCHAT_MAX_REQUEST_TIMEOUT_SECONDS", 60)) * time.Second,
+
+		WSMaxConnsPerIP:  envOrDefaultInt("OPENCHAT_WS_MAX_CONNS_PER_IP", 64),
+		WSTrustedProxies: envList("OPENCHAT_WS_TRUSTED_PROXIES"),
+
+		DisableMessaging:      envOrDefaultBool("OPENCHAT_DISABLE_MESSAGING", false),
+		DisablePresence:       envOrDefaultBool("OPENCHAT_DISABLE_PRESENCE", false),
+		DisableAttachments:    envOrDefaultBool("OPENCHAT_DISABLE_ATTACHMENTS", false),
+		DisableNotifications:  envOrDefaultBool("OPENCHAT_DISABLE_NOTIFICATIONS", false),
+		DisableRTCVoice:       envOrDefaultBool("OPENCHAT_DISABLE_RTC_VOICE", false),
+		DisableRTCVideo:       envOrDefaultBool("OPENCHAT_DISABLE_RTC_VIDEO", false),
+		DisableRTCScreenshare: envOrDefaultBool("OPENCHAT_DISABLE_RTC_SCREENSHARE", false),
+		DisableRTCSimulcast:   envOrDefaultBool("OPENCHAT_DISABLE_RTC_SIMULCAST", false),
+
+		BannerID:          envOrDefault("OPENCHAT_BANNER_ID", ""),
+		BannerText:        envOrDefault("OPENCHAT_BANNER_TEXT", ""),
+		BannerSeverity:    envOrDefault("OPENCHAT_BANNER_SEVERITY", "info"),
+		BannerDismissible: envOrDefaultBool("OPENCHAT_BANNER_DISMISSIBLE", true),
+
+		ModeratorUIDs: envList("OPENCHAT_MODERATOR_UIDS"),
+		AuthorUIDs:    envList("OPENCHAT_AUTHOR_UIDS"),
+		BotUIDs:       envList("OPENCHAT_BOT_UIDS"),
+
+		ChannelManagerUIDs: envList("OPENCHAT_CHANNEL_MANAGER_UIDS"),
 	}
 }
 
@@ -56,6 +243,46 @@ func envOrDefault(key string, fallback string) string {
 	return value
 }
 
+func envList(key string) []string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil
+	}
+	out := make([]string, 0)
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// envStringMap reads a JSON object of strings, e.g. {"ch_general":"Welcome!"}.
+// Unset or malformed values yield nil.
+func envStringMap(key string) map[string]string {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return nil
+	}
+	var out map[string]string
+	if err := json.Unmarshal([]byte(value), &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+func envOrDefaultBool(key string, fallback bool) bool {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return fallback
+	}
+	return parsed
+}
+
 func envOrDefaultInt(key string, fallback int) int {
 	value := strings.TrimSpace(os.Getenv(key))
 	if value == "" {
@@ -0,0 +1,43 @@
+package app
+
+import (
+	"crypto/tls"
+	"testing"
+)
+
+func TestTLSConfigDefaultsToTLS12Minimum(t *testing.T) {
+	tlsConfig, err := Config{}.TLSConfig()
+	if err != nil {
+		t.Fatalf("build tls config: %v", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS12 {
+		t.Fatalf("expected TLS 1.2 minimum, got %x", tlsConfig.MinVersion)
+	}
+	if tlsConfig.CipherSuites != nil {
+		t.Fatalf("expected default cipher suites when none configured")
+	}
+}
+
+func TestTLSConfigAppliesVersionAndCipherPolicy(t *testing.T) {
+	cfg := Config{
+		TLSMinVersion:   "1.3",
+		TLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+	}
+	tlsConfig, err := cfg.TLSConfig()
+	if err != nil {
+		t.Fatalf("build tls config: %v", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Fatalf("expected TLS 1.3 minimum, got %x", tlsConfig.MinVersion)
+	}
+	if len(tlsConfig.CipherSuites) != 1 || tlsConfig.CipherSuites[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Fatalf("unexpected cipher suites %v", tlsConfig.CipherSuites)
+	}
+
+	if _, err := (Config{TLSMinVersion: "1.0"}).TLSConfig(); err == nil {
+		t.Fatalf("expected legacy tls version to be rejected")
+	}
+	if _, err := (Config{TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}).TLSConfig(); err == nil {
+		t.Fatalf("expected insecure cipher suite to be rejected")
+	}
+}
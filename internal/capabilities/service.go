@@ -1,7 +1,9 @@
 package capabilities
 
 import (
-	"time"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
 
 	"github.com/openchat/openchat-backend/internal/app"
 )
@@ -30,6 +32,14 @@ type CapabilitiesResponse struct {
 	RTC                    *RTCCapabilitiesResponse      `json:"rtc,omitempty"`
 	Moderation             *ModerationCapabilities       `json:"moderation,omitempty"`
 	Profile                *ProfileCapabilitiesResponse  `json:"profile,omitempty"`
+	Banner                 *BannerResponse               `json:"banner,omitempty"`
+}
+
+type BannerResponse struct {
+	ID          string `json:"id"`
+	Text        string `json:"text"`
+	Severity    string `json:"severity"`
+	Dismissible bool   `json:"dismissible"`
 }
 
 type TransportCapabilitiesResponse struct {
@@ -46,10 +56,12 @@ type CoreFeatureFlagsResponse struct {
 }
 
 type CapabilityLimitsResponse struct {
-	MaxMessageBytes     int `json:"max_message_bytes"`
-	MaxUploadBytes      int `json:"max_upload_bytes"`
-	RateLimitPerMinute  int `json:"rate_limit_per_minute"`
-	MaxCallParticipants int `json:"max_call_participants"`
+	MaxMessageBytes      int `json:"max_message_bytes"`
+	MaxUploadBytes       int `json:"max_upload_bytes"`
+	RateLimitPerMinute   int `json:"rate_limit_per_minute"`
+	MaxCallParticipants  int `json:"max_call_participants"`
+	ReplyPreviewMaxRunes int `json:"reply_preview_max_runes"`
+	MaxPinsPerChannel    int `json:"max_pins_per_channel"`
 }
 
 type SecurityCapabilitiesResponse struct {
@@ -136,8 +148,49 @@ type ProfileAvatarUploadRulesResponse struct {
 	MaxHeight int      `json:"max_height"`
 }
 
+var bannerSeverities = map[string]struct{}{"info": {}, "warning": {}, "critical": {}}
+
+// banner returns the configured announcement, or nil when no text is set. Without an
+// explicit id the id is derived from the content so edits still read as new banners.
+func (s *Service) banner() *BannerResponse {
+	text := strings.TrimSpace(s.cfg.BannerText)
+	if text == "" {
+		return nil
+	}
+	severity := strings.ToLower(strings.TrimSpace(s.cfg.BannerSeverity))
+	if _, ok := bannerSeverities[severity]; !ok {
+		severity = "info"
+	}
+	id := strings.TrimSpace(s.cfg.BannerID)
+	if id == "" {
+		sum := sha256.Sum256([]byte(severity + "\n" + text))
+		id = "banner_" + hex.EncodeToString(sum[:6])
+	}
+	return &BannerResponse{
+		ID:          id,
+		Text:        text,
+		Severity:    severity,
+		Dismissible: s.cfg.BannerDismissible,
+	}
+}
+
+// iceServers lists STUN and any configured TURN servers. TURN credentials are
+// per user and only handed out with join tickets.
+func (s *Service) iceServers() []RTCIceServerResponse {
+	servers := []RTCIceServerResponse{
+		{URLs: []string{"stun:stun.l.google.com:19302"}},
+	}
+	if len(s.cfg.TURNURLs) > 0 {
+		turn := RTCIceServerResponse{URLs: append([]string(nil), s.cfg.TURNURLs...)}
+		if s.cfg.TURNSecret != "" {
+			turn.CredentialType = "ephemeral"
+		}
+		servers = append(servers, turn)
+	}
+	return servers
+}
+
 func (s *Service) Build() CapabilitiesResponse {
-	turnExpiry := time.Now().Add(30 * time.Minute).UTC().Format(time.RFC3339)
 	build := app.CurrentBuildInfo()
 	return CapabilitiesResponse{
 		ServerName:             "OpenChat Harbor",
@@ -154,16 +207,18 @@ func (s *Service) Build() CapabilitiesResponse {
 			Polling:   false,
 		},
 		Features: CoreFeatureFlagsResponse{
-			Messaging:     true,
-			Presence:      true,
-			Attachments:   true,
-			Notifications: true,
+			Messaging:     !s.cfg.DisableMessaging,
+			Presence:      !s.cfg.DisablePresence,
+			Attachments:   !s.cfg.DisableAttachments,
+			Notifications: !s.cfg.DisableNotifications,
 		},
 		Limits: CapabilityLimitsResponse{
-			MaxMessageBytes:     65536,
-			MaxUploadBytes:      52428800,
-			RateLimitPerMinute:  180,
-			MaxCallParticipants: 200,
+			MaxMessageBytes:      65536,
+			MaxUploadBytes:       52428800,
+			RateLimitPerMinute:   180,
+			MaxCallParticipants:  s.cfg.CallParticipantLimit(),
+			ReplyPreviewMaxRunes: s.cfg.ReplyPreviewRunes(),
+			MaxPinsPerChannel:    s.cfg.PinLimit(),
 		},
 		Security: SecurityCapabilitiesResponse{
 			HTTPSRequired:      s.cfg.IsProduction(),
@@ -175,23 +230,12 @@ func (s *Service) Build() CapabilitiesResponse {
 			SignalingTransport: "websocket",
 			Topologies:         []string{"p2p"},
 			Features: RTCFeatureFlagsResponse{
-				Voice:       true,
-				Video:       true,
-				Screenshare: true,
-				Simulcast:   true,
-			},
-			IceServers: []RTCIceServerResponse{
-				{
-					URLs: []string{"stun:stun.l.google.com:19302"},
-				},
-				{
-					URLs:           []string{"turns:turn.example.invalid:5349"},
-					Username:       "dev-user",
-					Credential:     "dev-secret",
-					CredentialType: "ephemeral",
-					ExpiresAt:      turnExpiry,
-				},
+				Voice:       !s.cfg.DisableRTCVoice,
+				Video:       !s.cfg.DisableRTCVideo,
+				Screenshare: !s.cfg.DisableRTCScreenshare,
+				Simulcast:   !s.cfg.DisableRTCSimulcast,
 			},
+			IceServers: s.iceServers(),
 			ConnectionPolicy: RTCConnectionPolicyResponse{
 				JoinTimeoutMs:      12000,
 				AnswerTimeoutMs:    10000,
@@ -226,12 +270,13 @@ func (s *Service) Build() CapabilitiesResponse {
 			},
 			AvatarUpload: &ProfileAvatarUploadRulesResponse{
 				MaxBytes:  2 * 1024 * 1024,
-				MimeTypes: []string{"image/png", "image/jpeg"},
+				MimeTypes: []string{"image/png", "image/jpeg", "image/webp"},
 				MaxWidth:  1024,
 				MaxHeight: 1024,
 			},
 			RealtimeEvent:            "profile_updated",
 			MessageAuthorProfileMode: "snapshot",
 		},
+		Banner: s.banner(),
 	}
 }
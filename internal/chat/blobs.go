@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// contentBlob is attachment content shared by every attachment whose bytes hash
+// the same; refs counts those attachments so the bytes can be freed safely.
+type contentBlob struct {
+	content []byte
+	refs    int
+}
+
+// retainBlobLocked stores content once per digest and returns the digest and the
+// shared bytes the attachment should reference.
+func (s *Service) retainBlobLocked(content []byte) (string, []byte) {
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+	blob, ok := s.blobsByDigest[digest]
+	if !ok {
+		blob = &contentBlob{content: content}
+		s.blobsByDigest[digest] = blob
+	}
+	blob.refs++
+	return digest, blob.content
+}
+
+func (s *Service) releaseBlobLocked(digest string) {
+	blob, ok := s.blobsByDigest[digest]
+	if !ok {
+		return
+	}
+	blob.refs--
+	if blob.refs <= 0 {
+		delete(s.blobsByDigest, digest)
+	}
+}
+
+// newAttachmentIDLocked mints an id that is neither live nor retired, so an id
+// can never resolve to another channel's (or a later upload's) content.
+func (s *Service) newAttachmentIDLocked() string {
+	for {
+		attachmentID := "att_" + strings.ReplaceAll(uuid.NewString()[:8], "-", "")
+		if _, live := s.attachmentsByID[attachmentID]; live {
+			continue
+		}
+		if _, retired := s.retiredAttachments[attachmentID]; retired {
+			continue
+		}
+		return attachmentID
+	}
+}
+
+// retireAttachmentLocked drops an attachment and its blob reference and keeps
+// the id reserved so stale URLs keep returning not found.
+func (s *Service) retireAttachmentLocked(attachmentID string) {
+	blob, ok := s.attachmentsByID[attachmentID]
+	if !ok {
+		return
+	}
+	s.releaseBlobLocked(blob.digest)
+	delete(s.attachmentsByID, attachmentID)
+	s.retiredAttachments[attachmentID] = struct{}{}
+}
@@ -0,0 +1,57 @@
+package chat_test
+
+import (
+	"testing"
+
+	"github.com/openchat/openchat-backend/internal/chat"
+	"github.com/openchat/openchat-backend/internal/chat/chattest"
+)
+
+func TestCreateMessageBroadcastsStoredMessage(t *testing.T) {
+	svc := chat.NewService("http://localhost:8080", chat.Options{})
+	broadcaster := &chattest.RecordingBroadcaster{}
+	svc.SetBroadcaster(broadcaster)
+
+	created, err := svc.CreateMessage(chat.CreateMessageInput{
+		ChannelID: "ch_general",
+		AuthorUID: "uid_broadcast",
+		Body:      "hello harbor",
+	})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	messages := broadcaster.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("expected 1 broadcast, got %d", len(messages))
+	}
+	sent := messages[0]
+	if sent.ID != created.ID || sent.ChannelID != "ch_general" || sent.AuthorUID != "uid_broadcast" || sent.Body != "hello harbor" {
+		t.Fatalf("unexpected broadcast message %+v", sent)
+	}
+	if sent.Seq != created.Seq {
+		t.Fatalf("expected broadcast seq %d, got %d", created.Seq, sent.Seq)
+	}
+}
+
+func TestEditMessageBroadcastsUpdate(t *testing.T) {
+	svc := chat.NewService("http://localhost:8080", chat.Options{})
+	broadcaster := &chattest.RecordingBroadcaster{}
+	svc.SetBroadcaster(broadcaster)
+
+	created, err := svc.CreateMessage(chat.CreateMessageInput{ChannelID: "ch_general", AuthorUID: "uid_broadcast", Body: "helo"})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	if _, err := svc.EditMessage(chat.EditMessageInput{ChannelID: "ch_general", MessageID: created.ID, EditorUID: "uid_broadcast", Body: "hello"}); err != nil {
+		t.Fatalf("edit message: %v", err)
+	}
+
+	updates := broadcaster.Updates()
+	if len(updates) != 1 {
+		t.Fatalf("expected 1 update broadcast, got %d", len(updates))
+	}
+	if updates[0].ID != created.ID || updates[0].Body != "hello" || updates[0].EditedAt == "" || updates[0].CreatedAt != created.CreatedAt {
+		t.Fatalf("unexpected update broadcast %+v", updates[0])
+	}
+}
@@ -0,0 +1,92 @@
+// Package chattest provides helpers for tests that exercise chat.Service
+// without a realtime hub.
+package chattest
+
+import (
+	"sync"
+
+	"github.com/openchat/openchat-backend/internal/chat"
+)
+
+type ChannelPurge struct {
+	ChannelID string
+	PurgedBy  string
+}
+
+type TopicUpdate struct {
+	ChannelID string
+	Topic     string
+	UpdatedBy string
+}
+
+// RecordingBroadcaster captures everything chat.Service would have broadcast.
+type RecordingBroadcaster struct {
+	mu       sync.Mutex
+	messages []chat.Message
+	updates  []chat.Message
+	deletes  []chat.Message
+	purges   []ChannelPurge
+	topics   []TopicUpdate
+}
+
+var _ chat.MessageBroadcaster = (*RecordingBroadcaster)(nil)
+
+func (b *RecordingBroadcaster) BroadcastMessage(message chat.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, message)
+}
+
+func (b *RecordingBroadcaster) BroadcastMessageUpdated(message chat.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updates = append(b.updates, message)
+}
+
+func (b *RecordingBroadcaster) BroadcastMessageDeleted(message chat.Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deletes = append(b.deletes, message)
+}
+
+func (b *RecordingBroadcaster) BroadcastChannelPurged(channelID string, purgedBy string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.purges = append(b.purges, ChannelPurge{ChannelID: channelID, PurgedBy: purgedBy})
+}
+
+func (b *RecordingBroadcaster) BroadcastChannelTopicUpdated(channelID string, topic string, updatedBy string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.topics = append(b.topics, TopicUpdate{ChannelID: channelID, Topic: topic, UpdatedBy: updatedBy})
+}
+
+func (b *RecordingBroadcaster) Messages() []chat.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]chat.Message(nil), b.messages...)
+}
+
+func (b *RecordingBroadcaster) Updates() []chat.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]chat.Message(nil), b.updates...)
+}
+
+func (b *RecordingBroadcaster) Deletes() []chat.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]chat.Message(nil), b.deletes...)
+}
+
+func (b *RecordingBroadcaster) Purges() []ChannelPurge {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]ChannelPurge(nil), b.purges...)
+}
+
+func (b *RecordingBroadcaster) TopicUpdates() []TopicUpdate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]TopicUpdate(nil), b.topics...)
+}
@@ -0,0 +1,156 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrMessageDeleteForbidden = errors.New("only the author can delete this message")
+
+// DeleteMessage soft-deletes a message: it keeps its slot and seq, but its body,
+// attachments, reactions, and edit history are dropped. Deleting an already
+// deleted message is a no-op.
+func (s *Service) DeleteMessage(channelID string, messageID string, authorUID string) error {
+	authorUID = strings.TrimSpace(authorUID)
+
+	s.mu.Lock()
+	if _, ok := s.channelTypeByID[channelID]; !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	messages := s.messagesByChannel[channelID]
+	idx := -1
+	for i := range messages {
+		if messages[i].ID == messageID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		s.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+	message := messages[idx]
+	if message.AuthorUID != authorUID {
+		s.mu.Unlock()
+		return ErrMessageDeleteForbidden
+	}
+	if message.Deleted {
+		s.mu.Unlock()
+		return nil
+	}
+
+	snap := s.snapshotChannelLocked(channelID)
+	tombstone := s.tombstoneLocked(channelID, idx)
+	if err := s.commitChannelLocked(snap); err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	broadcaster := s.broadcaster
+	s.mu.Unlock()
+
+	if broadcaster != nil {
+		broadcaster.BroadcastMessageDeleted(tombstone)
+	}
+	return nil
+}
+
+type BulkDeleteStatus string
+
+const (
+	BulkDeleteDeleted  BulkDeleteStatus = "deleted"
+	BulkDeleteNotFound BulkDeleteStatus = "not_found"
+)
+
+type BulkDeleteResult struct {
+	MessageID string           `json:"message_id"`
+	Status    BulkDeleteStatus `json:"status"`
+}
+
+// DeleteMessages tombstones each listed message on behalf of a moderator and
+// reports a result per distinct id, in request order. Already deleted messages
+// count as deleted.
+func (s *Service) DeleteMessages(channelID string, messageIDs []string, requesterUID string) ([]BulkDeleteResult, error) {
+	s.mu.Lock()
+	if _, ok := s.channelTypeByID[channelID]; !ok {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	if !s.hasRoleLocked(s.channelServerByID[channelID], requesterUID, RoleModerator) {
+		s.mu.Unlock()
+		return nil, ErrModeratorRequired
+	}
+
+	snap := s.snapshotChannelLocked(channelID)
+	indexByID := make(map[string]int, len(s.messagesByChannel[channelID]))
+	for i, message := range s.messagesByChannel[channelID] {
+		indexByID[message.ID] = i
+	}
+	results := make([]BulkDeleteResult, 0, len(messageIDs))
+	tombstones := make([]Message, 0, len(messageIDs))
+	seen := make(map[string]struct{}, len(messageIDs))
+	for _, messageID := range messageIDs {
+		messageID = strings.TrimSpace(messageID)
+		if _, dup := seen[messageID]; dup {
+			continue
+		}
+		seen[messageID] = struct{}{}
+		idx, ok := indexByID[messageID]
+		if !ok {
+			results = append(results, BulkDeleteResult{MessageID: messageID, Status: BulkDeleteNotFound})
+			continue
+		}
+		if !s.messagesByChannel[channelID][idx].Deleted {
+			tombstones = append(tombstones, s.tombstoneLocked(channelID, idx))
+		}
+		results = append(results, BulkDeleteResult{MessageID: messageID, Status: BulkDeleteDeleted})
+	}
+	if len(tombstones) > 0 {
+		if err := s.commitChannelLocked(snap); err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+	}
+	broadcaster := s.broadcaster
+	s.mu.Unlock()
+
+	if broadcaster != nil {
+		for _, tombstone := range tombstones {
+			broadcaster.BroadcastMessageDeleted(tombstone)
+		}
+	}
+	return results, nil
+}
+
+// tombstoneLocked blanks the message at idx and returns a copy of the result.
+func (s *Service) tombstoneLocked(channelID string, idx int) Message {
+	messages := s.messagesByChannel[channelID]
+	message := messages[idx]
+	messageID := message.ID
+	// Forwards of this message keep their own references to the shared blobs.
+	for _, attachment := range message.Attachments {
+		if blob, ok := s.attachmentsByID[attachment.AttachmentID]; ok && blob.messageID == message.ID {
+			s.retireAttachmentLocked(attachment.AttachmentID)
+		}
+	}
+	key := messageKey{channelID: channelID, messageID: messageID}
+	delete(s.reactionsByMessage, key)
+	delete(s.revisionsByMessage, key)
+
+	message.Deleted = true
+	message.DeletedAt = s.now().UTC().Format(time.RFC3339)
+	message.Body = ""
+	message.Attachments = nil
+	message.PinnedAt = ""
+	message.PinnedBy = ""
+	messages[idx] = message
+	for i := range messages {
+		if reply := messages[i].ReplyTo; reply != nil && reply.MessageID == messageID {
+			reply.PreviewText = ""
+			reply.IsUnavailable = true
+		}
+	}
+	return cloneMessage(message)
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const MaxCustomEmojiBytes = 256 * 1024
+
+var (
+	ErrReactionNotAllowed = errors.New("reaction emoji is not allowed")
+	ErrCustomEmojiInvalid = errors.New("custom emoji is invalid")
+	ErrCustomEmojiMissing = errors.New("custom emoji not found")
+)
+
+var customEmojiIDPattern = regexp.MustCompile(`^[a-z0-9_]{2,32}$`)
+
+var customEmojiTypes = map[string]struct{}{
+	"image/png":  {},
+	"image/gif":  {},
+	"image/jpeg": {},
+}
+
+// CustomEmoji is an image reacted with as ":id:".
+type CustomEmoji struct {
+	ID          string `json:"id"`
+	Shortcode   string `json:"shortcode"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+}
+
+type customEmojiAsset struct {
+	emoji   CustomEmoji
+	content []byte
+}
+
+// EmojiCatalog is what clients need to render a reaction picker. An empty
+// ReactionEmojis list means any unicode emoji is accepted.
+type EmojiCatalog struct {
+	ReactionEmojis []string      `json:"reaction_emojis"`
+	Custom         []CustomEmoji `json:"custom"`
+}
+
+// RegisterCustomEmoji adds or replaces a custom emoji image.
+func (s *Service) RegisterCustomEmoji(id string, content []byte) (CustomEmoji, error) {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if !customEmojiIDPattern.MatchString(id) || len(content) == 0 || len(content) > MaxCustomEmojiBytes {
+		return CustomEmoji{}, ErrCustomEmojiInvalid
+	}
+	contentType := http.DetectContentType(content)
+	if _, ok := customEmojiTypes[contentType]; !ok {
+		return CustomEmoji{}, fmt.Errorf("%w: unsupported type %s", ErrCustomEmojiInvalid, contentType)
+	}
+
+	emoji := CustomEmoji{
+		ID:          id,
+		Shortcode:   ":" + id + ":",
+		URL:         s.publicBaseURL + "/v1/emojis/" + id,
+		ContentType: contentType,
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.customEmojis[id] = customEmojiAsset{emoji: emoji, content: append([]byte(nil), content...)}
+	return emoji, nil
+}
+
+// LoadCustomEmojiDir registers every image in dir, named by its file stem.
+// Files that fail validation are skipped and reported in the returned error.
+func (s *Service) LoadCustomEmojiDir(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	loaded := 0
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		id := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if _, err := s.RegisterCustomEmoji(id, content); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+			continue
+		}
+		loaded++
+	}
+	return loaded, errors.Join(errs...)
+}
+
+func (s *Service) EmojiCatalog() EmojiCatalog {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	catalog := EmojiCatalog{
+		ReactionEmojis: append([]string{}, s.reactionEmojis...),
+		Custom:         make([]CustomEmoji, 0, len(s.customEmojis)),
+	}
+	for _, asset := range s.customEmojis {
+		catalog.Custom = append(catalog.Custom, asset.emoji)
+	}
+	sort.Slice(catalog.Custom, func(i, j int) bool { return catalog.Custom[i].ID < catalog.Custom[j].ID })
+	return catalog
+}
+
+func (s *Service) CustomEmojiContent(id string) (CustomEmoji, []byte, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	asset, ok := s.customEmojis[strings.ToLower(strings.TrimSpace(id))]
+	if !ok {
+		return CustomEmoji{}, nil, ErrCustomEmojiMissing
+	}
+	return asset.emoji, append([]byte(nil), asset.content...), nil
+}
+
+// reactionAllowedLocked accepts ":id:" only for registered custom emoji and any
+// other emoji only when it is on the allowlist (or no allowlist is configured).
+func (s *Service) reactionAllowedLocked(emoji string) bool {
+	if len(emoji) > 2 && strings.HasPrefix(emoji, ":") && strings.HasSuffix(emoji, ":") {
+		_, ok := s.customEmojis[emoji[1:len(emoji)-1]]
+		return ok
+	}
+	if len(s.reactionEmojiSet) == 0 {
+		return true
+	}
+	_, ok := s.reactionEmojiSet[emoji]
+	return ok
+}
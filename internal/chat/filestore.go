@@ -0,0 +1,172 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	serversFileName     = "servers.json"
+	messagesFileName    = "messages.json"
+	reactionsFileName   = "reactions.json"
+	attachmentsDirName  = "attachments"
+	leftServersFileName = "left_servers.json"
+)
+
+// FileStore keeps each record type in its own JSON file under a directory, and
+// each attachment in its own file under attachments/. Writes go to a temp file
+// that is renamed into place, so a crash mid-write leaves the previous file
+// intact.
+type FileStore struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, attachmentsDirName), 0o700); err != nil {
+		return nil, fmt.Errorf("create chat data dir: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) LoadServers() ([]StoredServer, error) {
+	var servers []StoredServer
+	err := f.read(serversFileName, &servers)
+	return servers, err
+}
+
+func (f *FileStore) SaveServers(servers []StoredServer) error {
+	return f.write(serversFileName, servers)
+}
+
+func (f *FileStore) LoadMessages() (map[string][]Message, error) {
+	var messagesByChannel map[string][]Message
+	err := f.read(messagesFileName, &messagesByChannel)
+	return messagesByChannel, err
+}
+
+func (f *FileStore) SaveMessages(messagesByChannel map[string][]Message) error {
+	return f.write(messagesFileName, messagesByChannel)
+}
+
+func (f *FileStore) LoadReactions() ([]StoredReaction, error) {
+	var reactions []StoredReaction
+	err := f.read(reactionsFileName, &reactions)
+	return reactions, err
+}
+
+func (f *FileStore) SaveReactions(reactions []StoredReaction) error {
+	return f.write(reactionsFileName, reactions)
+}
+
+func (f *FileStore) LoadAttachments() ([]StoredAttachment, error) {
+	entries, err := os.ReadDir(filepath.Join(f.dir, attachmentsDirName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	attachments := make([]StoredAttachment, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		var attachment StoredAttachment
+		if err := f.read(filepath.Join(attachmentsDirName, entry.Name()), &attachment); err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
+func (f *FileStore) SaveAttachment(attachment StoredAttachment) error {
+	name, err := attachmentFileName(attachment.Metadata.AttachmentID)
+	if err != nil {
+		return err
+	}
+	return f.write(name, attachment)
+}
+
+func (f *FileStore) RetireAttachment(attachmentID string) error {
+	name, err := attachmentFileName(attachmentID)
+	if err != nil {
+		return err
+	}
+	return f.write(name, StoredAttachment{
+		Metadata: MessageAttachment{AttachmentID: attachmentID},
+		Retired:  true,
+	})
+}
+
+func attachmentFileName(attachmentID string) (string, error) {
+	if attachmentID == "" || filepath.Base(attachmentID) != attachmentID || attachmentID == "." || attachmentID == ".." {
+		return "", fmt.Errorf("invalid attachment id %q", attachmentID)
+	}
+	return filepath.Join(attachmentsDirName, attachmentID+".json"), nil
+}
+
+func (f *FileStore) LoadLeftServers() (map[string]map[string]time.Time, error) {
+	var leftServersByUser map[string]map[string]time.Time
+	err := f.read(leftServersFileName, &leftServersByUser)
+	return leftServersByUser, err
+}
+
+func (f *FileStore) SaveLeftServers(leftServersByUser map[string]map[string]time.Time) error {
+	return f.write(leftServersFileName, leftServersByUser)
+}
+
+func (f *FileStore) read(name string, target any) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	raw, err := os.ReadFile(filepath.Join(f.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("decode %s: %w", name, err)
+	}
+	return nil
+}
+
+func (f *FileStore) write(name string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encode %s: %w", name, err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tmp, err := os.CreateTemp(filepath.Join(f.dir, filepath.Dir(name)), filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(raw); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, filepath.Join(f.dir, name)); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxMessageRevisions bounds the prior bodies retained per message; the oldest
+// revision is dropped first.
+const MaxMessageRevisions = 20
+
+var ErrMessageHistoryForbidden = errors.New("only the author or a moderator can view message history")
+
+// MessageRevision is a body a message held before an edit replaced it.
+type MessageRevision struct {
+	Body       string `json:"body"`
+	WrittenAt  string `json:"written_at"`
+	ReplacedAt string `json:"replaced_at"`
+	ReplacedBy string `json:"replaced_by"`
+}
+
+// MessageHistory lists prior revisions oldest first.
+func (s *Service) MessageHistory(channelID string, messageID string, requesterUID string) ([]MessageRevision, error) {
+	requesterUID = strings.TrimSpace(requesterUID)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.channelTypeByID[channelID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	message, ok := s.findMessageByIDLocked(channelID, messageID)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+	if message.AuthorUID != requesterUID && !s.hasRoleLocked(s.channelServerByID[channelID], requesterUID, RoleModerator) {
+		return nil, ErrMessageHistoryForbidden
+	}
+
+	revisions := s.revisionsByMessage[messageKey{channelID: channelID, messageID: messageID}]
+	out := make([]MessageRevision, len(revisions))
+	copy(out, revisions)
+	return out, nil
+}
+
+func (s *Service) recordRevisionLocked(message Message, replacedAt string, replacedBy string) {
+	writtenAt := message.EditedAt
+	if writtenAt == "" {
+		writtenAt = message.CreatedAt
+	}
+	key := messageKey{channelID: message.ChannelID, messageID: message.ID}
+	revisions := append(s.revisionsByMessage[key], MessageRevision{
+		Body:       message.Body,
+		WrittenAt:  writtenAt,
+		ReplacedAt: replacedAt,
+		ReplacedBy: replacedBy,
+	})
+	if len(revisions) > MaxMessageRevisions {
+		revisions = revisions[len(revisions)-MaxMessageRevisions:]
+	}
+	s.revisionsByMessage[key] = revisions
+}
@@ -0,0 +1,58 @@
+package chat
+
+import "strings"
+
+type Role string
+
+const (
+	RoleModerator      Role = "moderator"
+	RoleAuthor         Role = "author"
+	RoleBot            Role = "bot"
+	RoleChannelManager Role = "channel_manager"
+)
+
+type PermissionProvider interface {
+	HasRole(serverID string, userUID string, role Role) bool
+}
+
+type StaticPermissionProvider struct {
+	uidsByRole map[Role]map[string]struct{}
+}
+
+func NewStaticPermissionProvider(uidsByRole map[Role][]string) *StaticPermissionProvider {
+	provider := &StaticPermissionProvider{uidsByRole: make(map[Role]map[string]struct{}, len(uidsByRole))}
+	for role, uids := range uidsByRole {
+		members := make(map[string]struct{}, len(uids))
+		for _, uid := range uids {
+			if uid = strings.TrimSpace(uid); uid != "" {
+				members[uid] = struct{}{}
+			}
+		}
+		provider.uidsByRole[role] = members
+	}
+	return provider
+}
+
+func (p *StaticPermissionProvider) HasRole(_ string, userUID string, role Role) bool {
+	_, ok := p.uidsByRole[role][strings.TrimSpace(userUID)]
+	return ok
+}
+
+func (s *Service) SetPermissionProvider(p PermissionProvider) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.permissions = p
+}
+
+func (s *Service) HasRole(serverID string, userUID string, role Role) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.hasRoleLocked(serverID, userUID, role)
+}
+
+func (s *Service) hasRoleLocked(serverID string, userUID string, role Role) bool {
+	if s.permissions == nil {
+		return false
+	}
+	return s.permissions.HasRole(serverID, userUID, role)
+}
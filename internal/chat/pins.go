@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultMaxPinsPerChannel is used when Options.MaxPinsPerChannel is unset.
+const DefaultMaxPinsPerChannel = 50
+
+var (
+	ErrPinForbidden    = errors.New("pinning requires the moderator or channel manager role")
+	ErrPinLimitReached = errors.New("channel pin limit reached")
+)
+
+// PinMessage pins a message for everyone in the channel. Without a permission
+// provider anyone may pin; otherwise moderators and channel managers may.
+func (s *Service) PinMessage(channelID string, messageID string, userUID string) (Message, error) {
+	return s.setPinned(channelID, messageID, userUID, true)
+}
+
+func (s *Service) UnpinMessage(channelID string, messageID string, userUID string) (Message, error) {
+	return s.setPinned(channelID, messageID, userUID, false)
+}
+
+func (s *Service) setPinned(channelID string, messageID string, userUID string, pinned bool) (Message, error) {
+	userUID = strings.TrimSpace(userUID)
+
+	s.mu.Lock()
+	if _, ok := s.channelTypeByID[channelID]; !ok {
+		s.mu.Unlock()
+		return Message{}, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	if !s.canPinLocked(s.channelServerByID[channelID], userUID) {
+		s.mu.Unlock()
+		return Message{}, ErrPinForbidden
+	}
+	messages := s.messagesByChannel[channelID]
+	idx := -1
+	pinnedCount := 0
+	for i := range messages {
+		if messages[i].ID == messageID && !messages[i].Deleted {
+			idx = i
+		}
+		if messages[i].PinnedAt != "" {
+			pinnedCount++
+		}
+	}
+	if idx < 0 {
+		s.mu.Unlock()
+		return Message{}, fmt.Errorf("%w: %s", ErrMessageNotFound, messageID)
+	}
+
+	message := messages[idx]
+	if (message.PinnedAt != "") == pinned {
+		s.mu.Unlock()
+		return cloneMessage(message), nil
+	}
+	if pinned {
+		if pinnedCount >= s.maxPinsPerChannel {
+			s.mu.Unlock()
+			return Message{}, ErrPinLimitReached
+		}
+		message.PinnedAt = s.now().UTC().Format(time.RFC3339)
+		message.PinnedBy = userUID
+	} else {
+		message.PinnedAt = ""
+		message.PinnedBy = ""
+	}
+	snap := s.snapshotChannelLocked(channelID)
+	messages[idx] = message
+	if err := s.commitChannelLocked(snap); err != nil {
+		s.mu.Unlock()
+		return Message{}, err
+	}
+	broadcaster := s.broadcaster
+	s.mu.Unlock()
+
+	if broadcaster != nil {
+		broadcaster.BroadcastMessageUpdated(cloneMessage(message))
+	}
+	return cloneMessage(message), nil
+}
+
+// ListPinnedMessages returns the channel's pinned messages oldest first.
+func (s *Service) ListPinnedMessages(channelID string) ([]Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.channelTypeByID[channelID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	out := make([]Message, 0)
+	for _, message := range s.messagesByChannel[channelID] {
+		if message.PinnedAt != "" {
+			out = append(out, cloneMessage(message))
+		}
+	}
+	return out, nil
+}
+
+func (s *Service) canPinLocked(serverID string, userUID string) bool {
+	if s.permissions == nil {
+		return true
+	}
+	return s.hasRoleLocked(serverID, userUID, RoleModerator) || s.hasRoleLocked(serverID, userUID, RoleChannelManager)
+}
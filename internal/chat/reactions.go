@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const MaxReactionEmojiRunes = 32
+
+var ErrReactionInvalid = errors.New("reaction emoji is invalid")
+
+type ReactionInput struct {
+	ChannelID string
+	MessageID string
+	UserUID   string
+	Emoji     string
+}
+
+type ReactionSummary struct {
+	Emoji   string `json:"emoji"`
+	Count   int    `json:"count"`
+	Reacted bool   `json:"reacted"`
+}
+
+type messageKey struct {
+	channelID string
+	messageID string
+}
+
+func (s *Service) AddReaction(input ReactionInput) ([]ReactionSummary, error) {
+	return s.setReaction(input, true)
+}
+
+func (s *Service) RemoveReaction(input ReactionInput) ([]ReactionSummary, error) {
+	return s.setReaction(input, false)
+}
+
+func (s *Service) setReaction(input ReactionInput, reacted bool) ([]ReactionSummary, error) {
+	emoji := strings.TrimSpace(input.Emoji)
+	userUID := strings.TrimSpace(input.UserUID)
+	if emoji == "" || len([]rune(emoji)) > MaxReactionEmojiRunes || userUID == "" {
+		return nil, ErrReactionInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.channelTypeByID[input.ChannelID]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, input.ChannelID)
+	}
+	if _, ok := s.findMessageByIDLocked(input.ChannelID, input.MessageID); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMessageNotFound, input.MessageID)
+	}
+	// Removing stays possible after an emoji drops off the allowlist.
+	if reacted && !s.reactionAllowedLocked(emoji) {
+		return nil, ErrReactionNotAllowed
+	}
+
+	snap := s.snapshotChannelLocked(input.ChannelID)
+	key := messageKey{channelID: input.ChannelID, messageID: input.MessageID}
+	byEmoji := s.reactionsByMessage[key]
+	if reacted {
+		if byEmoji == nil {
+			byEmoji = make(map[string]map[string]struct{})
+			s.reactionsByMessage[key] = byEmoji
+		}
+		if byEmoji[emoji] == nil {
+			byEmoji[emoji] = make(map[string]struct{})
+		}
+		byEmoji[emoji][userUID] = struct{}{}
+	} else if byEmoji != nil {
+		delete(byEmoji[emoji], userUID)
+		if len(byEmoji[emoji]) == 0 {
+			delete(byEmoji, emoji)
+		}
+		if len(byEmoji) == 0 {
+			delete(s.reactionsByMessage, key)
+		}
+	}
+	if err := s.persistReactionsLocked(); err != nil {
+		s.restoreChannelLocked(snap)
+		return nil, err
+	}
+	return s.reactionSummaryLocked(key, userUID), nil
+}
+
+// ReactionSummaries returns reaction counts for each known message id, plus the
+// ids that do not exist in the channel.
+func (s *Service) ReactionSummaries(channelID string, requesterUID string, messageIDs []string) (map[string][]ReactionSummary, []string, error) {
+	requesterUID = strings.TrimSpace(requesterUID)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.channelTypeByID[channelID]; !ok {
+		return nil, nil, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	summaries := make(map[string][]ReactionSummary, len(messageIDs))
+	unknown := make([]string, 0)
+	for _, rawID := range messageIDs {
+		messageID := strings.TrimSpace(rawID)
+		if _, seen := summaries[messageID]; seen {
+			continue
+		}
+		if _, ok := s.findMessageByIDLocked(channelID, messageID); !ok {
+			unknown = append(unknown, messageID)
+			continue
+		}
+		summaries[messageID] = s.reactionSummaryLocked(messageKey{channelID: channelID, messageID: messageID}, requesterUID)
+	}
+	return summaries, unknown, nil
+}
+
+func (s *Service) reactionSummaryLocked(key messageKey, requesterUID string) []ReactionSummary {
+	out := make([]ReactionSummary, 0, len(s.reactionsByMessage[key]))
+	for emoji, users := range s.reactionsByMessage[key] {
+		_, reacted := users[requesterUID]
+		out = append(out, ReactionSummary{Emoji: emoji, Count: len(users), Reacted: reacted})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Emoji < out[j].Emoji
+	})
+	return out
+}
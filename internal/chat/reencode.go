@@ -0,0 +1,182 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+const strippedJPEGQuality = 92
+
+// MaxStrippedImagePixels bounds the images that are fully decoded for metadata
+// stripping, so a small, highly compressed upload cannot allocate gigabytes.
+const MaxStrippedImagePixels = 50_000_000
+
+var ErrAttachmentImageTooLarge = errors.New("attachment image dimensions are too large")
+
+// stripImageMetadata re-encodes an image from its decoded pixels, dropping EXIF
+// (including GPS), XMP, comments, and text chunks while keeping its dimensions
+// and animation frames. A JPEG's EXIF orientation is applied to the pixels
+// first so the picture still displays upright. Content that is not an image is
+// returned unchanged so the regular attachment validation can judge it; an
+// image that cannot be re-encoded is rejected rather than stored as-is.
+func stripImageMetadata(content []byte) ([]byte, error) {
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return content, nil
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxStrippedImagePixels {
+		return nil, ErrAttachmentImageTooLarge
+	}
+
+	var out bytes.Buffer
+	switch format {
+	case "jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(content))
+		if err != nil {
+			return nil, ErrAttachmentImageInvalid
+		}
+		img = applyOrientation(img, jpegOrientation(content))
+		if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: strippedJPEGQuality}); err != nil {
+			return nil, ErrAttachmentImageInvalid
+		}
+	case "png":
+		img, err := png.Decode(bytes.NewReader(content))
+		if err != nil || png.Encode(&out, img) != nil {
+			return nil, ErrAttachmentImageInvalid
+		}
+	case "gif":
+		animation, err := gif.DecodeAll(bytes.NewReader(content))
+		if err != nil || gif.EncodeAll(&out, animation) != nil {
+			return nil, ErrAttachmentImageInvalid
+		}
+	default:
+		return content, nil
+	}
+	return out.Bytes(), nil
+}
+
+// jpegOrientation reads the EXIF orientation tag (1-8) from a JPEG's APP1
+// segment, returning 1 when there is none or it cannot be parsed.
+func jpegOrientation(content []byte) int {
+	if len(content) < 4 || content[0] != 0xFF || content[1] != 0xD8 {
+		return 1
+	}
+	for pos := 2; pos+4 <= len(content); {
+		if content[pos] != 0xFF {
+			return 1
+		}
+		marker := content[pos+1]
+		// Start of scan: no metadata segments follow.
+		if marker == 0xDA {
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(content[pos+2:]))
+		if length < 2 || pos+2+length > len(content) {
+			return 1
+		}
+		segment := content[pos+4 : pos+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for idx := 0; idx < entries; idx++ {
+		entry := ifd + 2 + idx*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		// Tag 0x0112 is Orientation, a single SHORT stored inline.
+		if order.Uint16(tiff[entry:]) == 0x0112 && order.Uint16(tiff[entry+2:]) == 3 {
+			if orientation := int(order.Uint16(tiff[entry+8:])); orientation >= 1 && orientation <= 8 {
+				return orientation
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// applyOrientation returns img transformed so that EXIF orientation 1 (no
+// transform) describes it.
+func applyOrientation(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	// Orientations 5-8 swap the axes.
+	outWidth, outHeight := width, height
+	if orientation >= 5 {
+		outWidth, outHeight = height, width
+	}
+	out := image.NewNRGBA(image.Rect(0, 0, outWidth, outHeight))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2:
+				dx, dy = width-1-x, y
+			case 3:
+				dx, dy = width-1-x, height-1-y
+			case 4:
+				dx, dy = x, height-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = height-1-y, x
+			case 7:
+				dx, dy = height-1-y, width-1-x
+			case 8:
+				dx, dy = y, width-1-x
+			}
+			out.Set(dx, dy, img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		}
+	}
+	return out
+}
+
+// stripUploadMetadata runs before the service lock is taken, since decoding and
+// re-encoding large images is slow.
+func (s *Service) stripUploadMetadata(uploads []AttachmentUploadInput) ([]AttachmentUploadInput, error) {
+	if !s.stripImageMetadata || len(uploads) == 0 {
+		return uploads, nil
+	}
+	stripped := make([]AttachmentUploadInput, len(uploads))
+	for idx, upload := range uploads {
+		stripped[idx] = upload
+		if len(upload.Data) > 0 && len(upload.Data) <= s.maxAttachmentBytes {
+			content, err := stripImageMetadata(upload.Data)
+			if err != nil {
+				return nil, err
+			}
+			stripped[idx].Data = content
+		}
+	}
+	return stripped, nil
+}
@@ -0,0 +1,189 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultMaxScheduledPerUser is used when Options.MaxScheduledPerUser is unset.
+const DefaultMaxScheduledPerUser = 20
+
+var (
+	ErrSendAtInvalid            = errors.New("scheduled send time must be in the future")
+	ErrScheduleTooFar           = errors.New("scheduled send time is too far in the future")
+	ErrScheduledMessageNotFound = errors.New("scheduled message not found")
+	ErrTooManyScheduled         = errors.New("too many pending scheduled messages")
+)
+
+type ScheduledMessage struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	AuthorUID string `json:"author_uid"`
+	SendAt    string `json:"send_at"`
+}
+
+type pendingMessage struct {
+	scheduled ScheduledMessage
+	sendAt    time.Time
+	input     CreateMessageInput
+	timer     *time.Timer
+}
+
+// ScheduleMessage holds a message until sendAt and then creates it as if it had
+// just been posted. The message is validated as CreateMessage would validate it
+// now; delivery failures caused by later changes (for example a channel that
+// became read-only) drop the pending message.
+func (s *Service) ScheduleMessage(input CreateMessageInput, sendAt time.Time) (ScheduledMessage, error) {
+	format := MessageFormat(strings.ToLower(strings.TrimSpace(string(input.Format))))
+	if _, ok := allowedMessageFormats[format]; format != "" && !ok {
+		return ScheduledMessage{}, ErrMessageFormatInvalid
+	}
+	if strings.TrimSpace(input.Body) == "" && len(input.Uploads) == 0 && input.ForwardFrom == nil {
+		return ScheduledMessage{}, ErrMessageEmpty
+	}
+	uploads, err := s.stripUploadMetadata(input.Uploads)
+	if err != nil {
+		return ScheduledMessage{}, err
+	}
+	input.Uploads = uploads
+	input.uploadsStripped = true
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if !sendAt.After(now) {
+		return ScheduledMessage{}, ErrSendAtInvalid
+	}
+	if sendAt.Sub(now) > s.maxScheduleAhead {
+		return ScheduledMessage{}, fmt.Errorf("%w: at most %s ahead", ErrScheduleTooFar, s.maxScheduleAhead)
+	}
+	channelType, ok := s.channelTypeByID[input.ChannelID]
+	if !ok {
+		return ScheduledMessage{}, fmt.Errorf("%w: %s", ErrChannelNotFound, input.ChannelID)
+	}
+	if channelType != ChannelTypeText {
+		return ScheduledMessage{}, fmt.Errorf("%w: messages can only be sent to text channels", ErrChannelTypeInvalid)
+	}
+	if _, readOnly := s.readOnlyChannelIDs[input.ChannelID]; readOnly && !s.hasRoleLocked(s.channelServerByID[input.ChannelID], input.AuthorUID, RoleAuthor) {
+		return ScheduledMessage{}, ErrChannelReadOnly
+	}
+	if err := s.validateScheduledLocked(input); err != nil {
+		return ScheduledMessage{}, err
+	}
+	pendingForAuthor := 0
+	for _, pending := range s.scheduledByID {
+		if pending.scheduled.AuthorUID == input.AuthorUID {
+			pendingForAuthor++
+		}
+	}
+	if pendingForAuthor >= s.maxScheduledPerUser {
+		return ScheduledMessage{}, fmt.Errorf("%w: at most %d per user", ErrTooManyScheduled, s.maxScheduledPerUser)
+	}
+
+	pending := &pendingMessage{
+		scheduled: ScheduledMessage{
+			ID:        "sched_" + strings.ReplaceAll(uuid.NewString(), "-", "")[:12],
+			ChannelID: input.ChannelID,
+			AuthorUID: input.AuthorUID,
+			SendAt:    sendAt.UTC().Format(time.RFC3339),
+		},
+		sendAt: sendAt,
+		input:  input,
+	}
+	scheduledID := pending.scheduled.ID
+	pending.timer = time.AfterFunc(sendAt.Sub(now), func() {
+		s.DeliverDueMessages()
+		s.rearmScheduled(scheduledID)
+	})
+	s.scheduledByID[scheduledID] = pending
+	return pending.scheduled, nil
+}
+
+// validateScheduledLocked applies CreateMessage's visibility, forward, reply,
+// and attachment checks against the current state.
+func (s *Service) validateScheduledLocked(input CreateMessageInput) error {
+	visibility, _, err := s.normalizeVisibilityLocked(input.ChannelID, input.Visibility, input.VisibleTo)
+	if err != nil {
+		return err
+	}
+	if visibility == MessageVisibilityEphemeral && len(input.Uploads) > 0 {
+		return ErrEphemeralAttachments
+	}
+	forwarded := 0
+	if input.ForwardFrom != nil {
+		sourceChannelID := strings.TrimSpace(input.ForwardFrom.ChannelID)
+		source, found := s.findMessageByIDLocked(sourceChannelID, strings.TrimSpace(input.ForwardFrom.MessageID))
+		if !found || !s.canReadChannelLocked(sourceChannelID, input.AuthorUID) {
+			return ErrForwardSourceNotFound
+		}
+		forwarded = len(source.Attachments)
+	}
+	if visibility == MessageVisibilityEphemeral && forwarded > 0 {
+		return ErrEphemeralAttachments
+	}
+	if forwarded+len(input.Uploads) > s.maxAttachmentsPerMessage {
+		return ErrTooManyAttachments
+	}
+	for _, upload := range input.Uploads {
+		if _, _, err := s.buildAttachmentLocked(input.ChannelID, upload); err != nil {
+			return err
+		}
+	}
+	if replyToMessageID := strings.TrimSpace(input.ReplyToMessageID); replyToMessageID != "" {
+		if _, found := s.findMessageByIDLocked(input.ChannelID, replyToMessageID); !found {
+			return ErrReplyTargetNotFound
+		}
+	}
+	return nil
+}
+
+func (s *Service) CancelScheduledMessage(channelID string, scheduledID string, requesterUID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	pending, ok := s.scheduledByID[scheduledID]
+	if !ok || pending.scheduled.ChannelID != channelID || pending.scheduled.AuthorUID != strings.TrimSpace(requesterUID) {
+		return fmt.Errorf("%w: %s", ErrScheduledMessageNotFound, scheduledID)
+	}
+	pending.timer.Stop()
+	delete(s.scheduledByID, scheduledID)
+	return nil
+}
+
+// DeliverDueMessages creates every scheduled message whose send time has passed
+// and returns how many were delivered.
+func (s *Service) DeliverDueMessages() int {
+	s.mu.Lock()
+	now := s.now()
+	due := make([]*pendingMessage, 0)
+	for scheduledID, pending := range s.scheduledByID {
+		if pending.sendAt.After(now) {
+			continue
+		}
+		pending.timer.Stop()
+		delete(s.scheduledByID, scheduledID)
+		due = append(due, pending)
+	}
+	s.mu.Unlock()
+
+	delivered := 0
+	for _, pending := range due {
+		if _, err := s.CreateMessage(pending.input); err == nil {
+			delivered++
+		}
+	}
+	return delivered
+}
+
+// rearmScheduled restarts the timer of a message that is still pending after its
+// timer fired, which happens when the service clock lags the wall clock.
+func (s *Service) rearmScheduled(scheduledID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pending, ok := s.scheduledByID[scheduledID]; ok {
+		pending.timer.Reset(pending.sendAt.Sub(s.now()))
+	}
+}
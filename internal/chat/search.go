@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const MaxSearchResults = 100
+
+var ErrSearchQueryEmpty = errors.New("search query is required")
+
+// SearchResult is a matching message with how many channel messages sit before
+// and after it, so clients can jump into context.
+type SearchResult struct {
+	Message        Message `json:"message"`
+	MessagesBefore int     `json:"messages_before"`
+	MessagesAfter  int     `json:"messages_after"`
+}
+
+type SearchPage struct {
+	Results      []SearchResult
+	TotalMatches int
+}
+
+// SearchMessages matches every whitespace-separated token of query against
+// message bodies, case-insensitively, newest first. Deleted messages never match.
+func (s *Service) SearchMessages(channelID string, query string, limit int) (SearchPage, error) {
+	tokens := strings.Fields(strings.ToLower(query))
+	if len(tokens) == 0 {
+		return SearchPage{}, ErrSearchQueryEmpty
+	}
+	if limit <= 0 || limit > MaxSearchResults {
+		limit = MaxSearchResults
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.channelTypeByID[channelID]; !ok {
+		return SearchPage{}, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+
+	messages := s.messagesByChannel[channelID]
+	page := SearchPage{Results: make([]SearchResult, 0)}
+	for idx := len(messages) - 1; idx >= 0; idx-- {
+		message := messages[idx]
+		if message.Deleted || !containsAllTokens(strings.ToLower(message.Body), tokens) {
+			continue
+		}
+		page.TotalMatches++
+		if len(page.Results) < limit {
+			page.Results = append(page.Results, SearchResult{
+				Message:        cloneMessage(message),
+				MessagesBefore: idx,
+				MessagesAfter:  len(messages) - idx - 1,
+			})
+		}
+	}
+	return page, nil
+}
+
+func containsAllTokens(body string, tokens []string) bool {
+	for _, token := range tokens {
+		if !strings.Contains(body, token) {
+			return false
+		}
+	}
+	return true
+}
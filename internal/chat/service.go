@@ -2,6 +2,7 @@ package chat
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"image"
@@ -10,10 +11,13 @@ import (
 	_ "image/png"
 	"net/http"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -25,17 +29,29 @@ const (
 	ChannelTypeVoice ChannelType = "voice"
 )
 
+type MessageFormat string
+
+const (
+	MessageFormatPlain    MessageFormat = "plain"
+	MessageFormatMarkdown MessageFormat = "markdown"
+)
+
 type Channel struct {
 	ID          string      `json:"id"`
 	Name        string      `json:"name"`
 	Type        ChannelType `json:"type"`
+	Topic       string      `json:"topic,omitempty"`
 	UnreadCount int         `json:"unread_count,omitempty"`
+	ActiveCall  bool        `json:"active_call,omitempty"`
+	ReadOnly    bool        `json:"read_only,omitempty"`
+	Order       int         `json:"order"`
 }
 
 type ChannelGroup struct {
 	ID       string    `json:"id"`
 	Label    string    `json:"label"`
 	Kind     string    `json:"kind"`
+	Order    int       `json:"order"`
 	Channels []Channel `json:"channels"`
 }
 
@@ -46,13 +62,30 @@ type Member struct {
 }
 
 type Message struct {
-	ID          string                 `json:"id"`
-	ChannelID   string                 `json:"channel_id"`
-	AuthorUID   string                 `json:"author_uid"`
-	Body        string                 `json:"body"`
-	CreatedAt   string                 `json:"created_at"`
-	ReplyTo     *MessageReplyReference `json:"reply_to,omitempty"`
-	Attachments []MessageAttachment    `json:"attachments,omitempty"`
+	ID            string                   `json:"id"`
+	ChannelID     string                   `json:"channel_id"`
+	Seq           int64                    `json:"seq"`
+	AuthorUID     string                   `json:"author_uid"`
+	Body          string                   `json:"body"`
+	Format        MessageFormat            `json:"format"`
+	CreatedAt     string                   `json:"created_at"`
+	EditedAt      string                   `json:"edited_at,omitempty"`
+	EditedBy      string                   `json:"edited_by,omitempty"`
+	Deleted       bool                     `json:"deleted,omitempty"`
+	DeletedAt     string                   `json:"deleted_at,omitempty"`
+	PinnedAt      string                   `json:"pinned_at,omitempty"`
+	PinnedBy      string                   `json:"pinned_by,omitempty"`
+	ReplyTo       *MessageReplyReference   `json:"reply_to,omitempty"`
+	ForwardedFrom *MessageForwardReference `json:"forwarded_from,omitempty"`
+	Attachments   []MessageAttachment      `json:"attachments,omitempty"`
+	Visibility    MessageVisibility        `json:"visibility,omitempty"`
+	VisibleTo     []string                 `json:"visible_to,omitempty"`
+}
+
+type MessageForwardReference struct {
+	ChannelID string `json:"channel_id"`
+	MessageID string `json:"message_id"`
+	AuthorUID string `json:"author_uid"`
 }
 
 type MessageReplyReference struct {
@@ -63,22 +96,63 @@ type MessageReplyReference struct {
 	IsUnavailable     bool   `json:"is_unavailable"`
 }
 
+type AttachmentKind string
+
+const (
+	AttachmentKindImage AttachmentKind = "image"
+	AttachmentKindVideo AttachmentKind = "video"
+	AttachmentKindAudio AttachmentKind = "audio"
+	AttachmentKindFile  AttachmentKind = "file"
+)
+
 type MessageAttachment struct {
-	AttachmentID string `json:"attachment_id"`
-	FileName     string `json:"file_name"`
-	URL          string `json:"url"`
-	Width        int    `json:"width"`
-	Height       int    `json:"height"`
-	ContentType  string `json:"content_type"`
-	Bytes        int    `json:"bytes"`
+	AttachmentID string         `json:"attachment_id"`
+	Kind         AttachmentKind `json:"kind"`
+	FileName     string         `json:"file_name"`
+	URL          string         `json:"url"`
+	Width        int            `json:"width"`
+	Height       int            `json:"height"`
+	ContentType  string         `json:"content_type"`
+	Bytes        int            `json:"bytes"`
+	AltText      string         `json:"alt_text,omitempty"`
+}
+
+type EditMessageInput struct {
+	ChannelID string
+	MessageID string
+	EditorUID string
+	Body      string
+}
+
+type CreateMessageInput struct {
+	ChannelID        string
+	AuthorUID        string
+	Body             string
+	Format           MessageFormat
+	Uploads          []AttachmentUploadInput
+	ReplyToMessageID string
+	ForwardFrom      *ForwardSource
+	Visibility       MessageVisibility
+	VisibleTo        []string
+	// uploadsStripped marks uploads that already went through metadata
+	// stripping when the message was scheduled.
+	uploadsStripped bool
+}
+
+type ForwardSource struct {
+	ChannelID string
+	MessageID string
 }
 
 type AttachmentUploadInput struct {
 	FileName    string
 	ContentType string
 	Data        []byte
+	AltText     string
 }
 
+const MaxAttachmentAltTextRunes = 1000
+
 type ServerDirectoryEntry struct {
 	ServerID                  string `json:"server_id"`
 	DisplayName               string `json:"display_name"`
@@ -86,10 +160,72 @@ type ServerDirectoryEntry struct {
 	TrustState                string `json:"trust_state"`
 	IdentityHandshakeStrategy string `json:"identity_handshake_strategy"`
 	UserIdentifierPolicy      string `json:"user_identifier_policy"`
+	DefaultChannelID          string `json:"default_channel_id,omitempty"`
+}
+
+// Options carries deployment-level settings for the chat service. Zero values
+// fall back to the built-in defaults.
+type Options struct {
+	DefaultMessageFormat MessageFormat
+	Empty                bool
+	EditWindow           time.Duration
+	ReplyPreviewMaxRunes int
+	MaxPinsPerChannel    int
+	// MaxScheduleAhead caps how far in the future a message can be scheduled.
+	MaxScheduleAhead time.Duration
+	// MaxScheduledPerUser caps each user's pending scheduled messages.
+	MaxScheduledPerUser int
+	// ReactionEmojis restricts unicode reactions to this list; empty allows any.
+	ReactionEmojis []string
+	// StripImageMetadata re-encodes uploaded images so EXIF, XMP, and comments
+	// are not stored or served.
+	StripImageMetadata bool
+	// Store persists messages, reactions, attachments, and left-server records.
+	// When it holds no messages the seed data is used. Nil keeps everything in
+	// memory.
+	Store Store
+	Now   func() time.Time
+}
+
+type MessageQuery struct {
+	Limit  int
+	Before string
+	// Descending returns the page newest-first. The page window and NextCursor
+	// are the same in either order: Before always walks toward older messages.
+	Descending bool
+}
+
+type MessagePage struct {
+	Messages   []Message
+	NextCursor string
+	Total      int
+}
+
+type CreateServerInput struct {
+	ServerID    string
+	DisplayName string
+	IconText    string
+}
+
+type CreateChannelInput struct {
+	GroupID  string
+	Name     string
+	Type     ChannelType
+	ReadOnly bool
+	// Order places the channel within its group; nil appends it.
+	Order *int
 }
 
 type MessageBroadcaster interface {
 	BroadcastMessage(message Message)
+	BroadcastMessageUpdated(message Message)
+	BroadcastMessageDeleted(message Message)
+	BroadcastChannelPurged(channelID string, purgedBy string)
+	BroadcastChannelTopicUpdated(channelID string, topic string, updatedBy string)
+}
+
+type CallOccupancy interface {
+	ChannelHasParticipants(channelID string) bool
 }
 
 type Service struct {
@@ -101,54 +237,189 @@ type Service struct {
 	channelGroupsByServer map[string][]ChannelGroup
 	membersByServer       map[string][]Member
 	messagesByChannel     map[string][]Message
-	attachmentsByID       map[string]attachmentBlob
-	channelServerByID     map[string]string
-	channelTypeByID       map[string]ChannelType
-	leftServersByUser     map[string]map[string]time.Time
+	lastSeqByChannel      map[string]int64
+	// messageSignal is closed and replaced whenever a message is stored, waking long-polls.
+	messageSignal      chan struct{}
+	attachmentsByID    map[string]attachmentBlob
+	blobsByDigest      map[string]*contentBlob
+	retiredAttachments map[string]struct{}
+	reactionEmojis     []string
+	reactionEmojiSet   map[string]struct{}
+	customEmojis       map[string]customEmojiAsset
+	channelServerByID  map[string]string
+	channelTypeByID    map[string]ChannelType
+	readOnlyChannelIDs map[string]struct{}
+	leftServersByUser  map[string]map[string]time.Time
+	defaultChannelByID map[string]string
+	reactionsByMessage map[messageKey]map[string]map[string]struct{}
+	scheduledByID      map[string]*pendingMessage
+	revisionsByMessage map[messageKey][]MessageRevision
 
 	maxAttachmentBytes       int
 	maxAttachmentsPerMessage int
 	allowedAttachmentTypes   map[string]struct{}
-
-	broadcaster MessageBroadcaster
+	defaultMessageFormat     MessageFormat
+	editWindow               time.Duration
+	replyPreviewMaxRunes     int
+	maxPinsPerChannel        int
+	maxScheduleAhead         time.Duration
+	maxScheduledPerUser      int
+	stripImageMetadata       bool
+	now                      func() time.Time
+
+	broadcaster   MessageBroadcaster
+	callOccupancy CallOccupancy
+	permissions   PermissionProvider
+	store         Store
+	storeErr      error
+	// orphanedChannelIDs had stored messages but no channel when loaded.
+	orphanedChannelIDs []string
 }
 
 type attachmentBlob struct {
 	metadata  MessageAttachment
 	channelID string
+	messageID string
+	digest    string
 	content   []byte
 }
 
 var (
+	ErrServerNotFound            = errors.New("server not found")
+	ErrChannelNotFound           = errors.New("channel not found")
 	ErrMessageEmpty              = errors.New("message body or attachment is required")
 	ErrAttachmentTooLarge        = errors.New("attachment exceeds max upload size")
 	ErrAttachmentTypeUnsupported = errors.New("attachment mime type is unsupported")
 	ErrAttachmentImageInvalid    = errors.New("attachment image payload is invalid")
+	ErrAttachmentEmpty           = errors.New("attachment upload is empty")
+	ErrAttachmentTypeMismatch    = errors.New("attachment declared type does not match its content")
+	ErrAttachmentAltTooLong      = errors.New("attachment alt text is too long")
 	ErrTooManyAttachments        = errors.New("too many attachments")
 	ErrAttachmentNotFound        = errors.New("attachment not found")
 	ErrReplyTargetNotFound       = errors.New("reply target message not found")
+	ErrForwardSourceNotFound     = errors.New("forwarded message not found")
+	ErrMessageFormatInvalid      = errors.New("message format is unsupported")
+	ErrServerExists              = errors.New("server already exists")
+	ErrServerNameInvalid         = errors.New("server display name is invalid")
+	ErrChannelNameInvalid        = errors.New("channel name is invalid")
+	ErrChannelTypeInvalid        = errors.New("channel type is invalid")
+	ErrCursorInvalid             = errors.New("pagination cursor is invalid")
+	ErrMessageNotFound           = errors.New("message not found")
+	ErrMessageEditForbidden      = errors.New("only the author can edit this message")
+	ErrEditWindowExpired         = errors.New("message edit window has expired")
+	ErrChannelReadOnly           = errors.New("channel is read-only")
+	ErrModeratorRequired         = errors.New("moderator role is required")
 )
 
-func NewService(publicBaseURL string) *Service {
+var allowedMessageFormats = map[MessageFormat]struct{}{
+	MessageFormatPlain:    {},
+	MessageFormatMarkdown: {},
+}
+
+func NewService(publicBaseURL string, opts Options) *Service {
+	defaultFormat := MessageFormat(strings.ToLower(strings.TrimSpace(string(opts.DefaultMessageFormat))))
+	if _, ok := allowedMessageFormats[defaultFormat]; !ok {
+		defaultFormat = MessageFormatPlain
+	}
+	editWindow := opts.EditWindow
+	if editWindow <= 0 {
+		editWindow = 15 * time.Minute
+	}
+	replyPreviewMaxRunes := opts.ReplyPreviewMaxRunes
+	if replyPreviewMaxRunes <= 0 {
+		replyPreviewMaxRunes = 220
+	}
+	maxPinsPerChannel := opts.MaxPinsPerChannel
+	if maxPinsPerChannel <= 0 {
+		maxPinsPerChannel = DefaultMaxPinsPerChannel
+	}
+	maxScheduleAhead := opts.MaxScheduleAhead
+	if maxScheduleAhead <= 0 {
+		maxScheduleAhead = 30 * 24 * time.Hour
+	}
+	maxScheduledPerUser := opts.MaxScheduledPerUser
+	if maxScheduledPerUser <= 0 {
+		maxScheduledPerUser = DefaultMaxScheduledPerUser
+	}
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
+	reactionEmojis := make([]string, 0, len(opts.ReactionEmojis))
+	reactionEmojiSet := make(map[string]struct{}, len(opts.ReactionEmojis))
+	for _, emoji := range opts.ReactionEmojis {
+		emoji = strings.TrimSpace(emoji)
+		if _, seen := reactionEmojiSet[emoji]; emoji == "" || seen {
+			continue
+		}
+		reactionEmojiSet[emoji] = struct{}{}
+		reactionEmojis = append(reactionEmojis, emoji)
+	}
+
 	svc := &Service{
 		publicBaseURL:            strings.TrimSuffix(strings.TrimSpace(publicBaseURL), "/"),
-		servers:                  seedServerDirectory(),
-		channelGroupsByServer:    seedChannelGroups(),
-		membersByServer:          seedMembers(),
-		messagesByChannel:        seedMessages(),
+		servers:                  []ServerDirectoryEntry{},
+		channelGroupsByServer:    make(map[string][]ChannelGroup),
+		membersByServer:          make(map[string][]Member),
+		messagesByChannel:        make(map[string][]Message),
+		lastSeqByChannel:         make(map[string]int64),
+		messageSignal:            make(chan struct{}),
 		attachmentsByID:          make(map[string]attachmentBlob),
+		blobsByDigest:            make(map[string]*contentBlob),
+		retiredAttachments:       make(map[string]struct{}),
+		reactionEmojis:           reactionEmojis,
+		reactionEmojiSet:         reactionEmojiSet,
+		customEmojis:             make(map[string]customEmojiAsset),
 		channelServerByID:        make(map[string]string),
 		channelTypeByID:          make(map[string]ChannelType),
+		readOnlyChannelIDs:       make(map[string]struct{}),
 		leftServersByUser:        make(map[string]map[string]time.Time),
+		defaultChannelByID:       make(map[string]string),
+		reactionsByMessage:       make(map[messageKey]map[string]map[string]struct{}),
+		scheduledByID:            make(map[string]*pendingMessage),
+		revisionsByMessage:       make(map[messageKey][]MessageRevision),
 		maxAttachmentBytes:       50 * 1024 * 1024,
 		maxAttachmentsPerMessage: 4,
 		allowedAttachmentTypes: map[string]struct{}{
-			"image/png":  {},
-			"image/jpeg": {},
-			"image/gif":  {},
+			"image/png":       {},
+			"image/jpeg":      {},
+			"image/gif":       {},
+			"application/pdf": {},
+			"video/mp4":       {},
+			"audio/mpeg":      {},
 		},
+		defaultMessageFormat: defaultFormat,
+		editWindow:           editWindow,
+		replyPreviewMaxRunes: replyPreviewMaxRunes,
+		maxPinsPerChannel:    maxPinsPerChannel,
+		maxScheduleAhead:     maxScheduleAhead,
+		maxScheduledPerUser:  maxScheduledPerUser,
+		stripImageMetadata:   opts.StripImageMetadata,
+		now:                  now,
+	}
+	if !opts.Empty {
+		svc.servers = seedServerDirectory()
+		svc.channelGroupsByServer = seedChannelGroups()
+		for _, groups := range svc.channelGroupsByServer {
+			assignInsertionOrder(groups)
+		}
+		svc.membersByServer = seedMembers()
+		svc.messagesByChannel = seedMessages()
+		for channelID, messages := range svc.messagesByChannel {
+			for idx := range messages {
+				messages[idx].Seq = int64(idx + 1)
+			}
+			svc.lastSeqByChannel[channelID] = int64(len(messages))
+		}
 	}
 	svc.indexChannels()
+	if opts.Store != nil {
+		if err := svc.hydrateLocked(opts.Store); err != nil {
+			svc.storeErr = err
+		} else {
+			svc.store = opts.Store
+		}
+	}
 	return svc
 }
 
@@ -157,6 +428,9 @@ func (s *Service) ListServers() []ServerDirectoryEntry {
 	defer s.mu.RUnlock()
 	servers := make([]ServerDirectoryEntry, len(s.servers))
 	copy(servers, s.servers)
+	for idx := range servers {
+		servers[idx].DefaultChannelID = s.defaultChannelIDLocked(servers[idx].ServerID)
+	}
 	return servers
 }
 
@@ -173,25 +447,203 @@ func (s *Service) ListServersForUser(userUID string) []ServerDirectoryEntry {
 				continue
 			}
 		}
+		server.DefaultChannelID = s.defaultChannelIDLocked(server.ServerID)
 		servers = append(servers, server)
 	}
 	return servers
 }
 
+func (s *Service) DefaultChannelID(serverID string) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.channelGroupsByServer[serverID]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
+	}
+	return s.defaultChannelIDLocked(serverID), nil
+}
+
+func (s *Service) SetDefaultChannel(serverID string, channelID string) error {
+	serverID = strings.TrimSpace(serverID)
+	channelID = strings.TrimSpace(channelID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.channelGroupsByServer[serverID]; !ok {
+		return fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
+	}
+	if s.channelServerByID[channelID] != serverID {
+		return fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	if s.channelTypeByID[channelID] != ChannelTypeText {
+		return ErrChannelTypeInvalid
+	}
+	snap := s.snapshotDirectoryLocked()
+	s.defaultChannelByID[serverID] = channelID
+	return s.commitDirectoryLocked(snap)
+}
+
+func (s *Service) defaultChannelIDLocked(serverID string) string {
+	if channelID, ok := s.defaultChannelByID[serverID]; ok && s.channelServerByID[channelID] == serverID {
+		return channelID
+	}
+	for _, group := range s.channelGroupsByServer[serverID] {
+		for _, channel := range group.Channels {
+			if channel.Type == ChannelTypeText {
+				return channel.ID
+			}
+		}
+	}
+	return ""
+}
+
 func (s *Service) SetBroadcaster(b MessageBroadcaster) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	s.broadcaster = b
 }
 
+func (s *Service) CreateServer(input CreateServerInput) (ServerDirectoryEntry, error) {
+	displayName := strings.TrimSpace(input.DisplayName)
+	if displayName == "" || len([]rune(displayName)) > 64 {
+		return ServerDirectoryEntry{}, ErrServerNameInvalid
+	}
+	serverID := strings.TrimSpace(input.ServerID)
+	if serverID == "" {
+		serverID = "srv_" + strings.ReplaceAll(uuid.NewString()[:8], "-", "")
+	}
+	iconText := strings.TrimSpace(input.IconText)
+	if iconText == "" {
+		iconText = serverIconText(displayName)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.channelGroupsByServer[serverID]; exists {
+		return ServerDirectoryEntry{}, ErrServerExists
+	}
+
+	snap := s.snapshotDirectoryLocked()
+	entry := ServerDirectoryEntry{
+		ServerID:                  serverID,
+		DisplayName:               displayName,
+		IconText:                  iconText,
+		TrustState:                "verified",
+		IdentityHandshakeStrategy: "challenge_signature",
+		UserIdentifierPolicy:      "server_scoped",
+	}
+	s.servers = append(s.servers, entry)
+	s.channelGroupsByServer[serverID] = []ChannelGroup{}
+	s.membersByServer[serverID] = []Member{}
+	if err := s.commitDirectoryLocked(snap); err != nil {
+		return ServerDirectoryEntry{}, err
+	}
+	return entry, nil
+}
+
+func (s *Service) CreateChannel(serverID string, input CreateChannelInput) (Channel, error) {
+	serverID = strings.TrimSpace(serverID)
+	name := strings.TrimSpace(input.Name)
+	if name == "" || len([]rune(name)) > 64 {
+		return Channel{}, ErrChannelNameInvalid
+	}
+	channelType := ChannelType(strings.ToLower(strings.TrimSpace(string(input.Type))))
+	if channelType == "" {
+		channelType = ChannelTypeText
+	}
+	idPrefix := "ch_"
+	switch channelType {
+	case ChannelTypeText:
+	case ChannelTypeVoice:
+		idPrefix = "vc_"
+	default:
+		return Channel{}, ErrChannelTypeInvalid
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups, ok := s.channelGroupsByServer[serverID]
+	if !ok {
+		return Channel{}, fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
+	}
+	snap := s.snapshotDirectoryLocked()
+
+	channel := Channel{
+		ID:       idPrefix + strings.ReplaceAll(uuid.NewString()[:8], "-", ""),
+		Name:     name,
+		Type:     channelType,
+		ReadOnly: input.ReadOnly,
+	}
+
+	groupIdx := -1
+	groupID := strings.TrimSpace(input.GroupID)
+	for idx, group := range groups {
+		if groupID != "" && group.ID == groupID {
+			groupIdx = idx
+			break
+		}
+		if groupID == "" && group.Kind == string(channelType) {
+			groupIdx = idx
+			break
+		}
+	}
+	if groupIdx < 0 {
+		if groupID == "" {
+			groupID = "grp_" + strings.ReplaceAll(uuid.NewString()[:8], "-", "")
+		}
+		label := "Text Channels"
+		if channelType == ChannelTypeVoice {
+			label = "Voice Channels"
+		}
+		groups = append(groups, ChannelGroup{ID: groupID, Label: label, Kind: string(channelType), Order: nextGroupOrder(groups)})
+		groupIdx = len(groups) - 1
+	}
+	if input.Order != nil {
+		channel.Order = *input.Order
+	} else {
+		channel.Order = nextChannelOrder(groups[groupIdx].Channels)
+	}
+	groups[groupIdx].Channels = append(groups[groupIdx].Channels, channel)
+	s.channelGroupsByServer[serverID] = groups
+	s.messagesByChannel[channel.ID] = []Message{}
+	s.channelServerByID[channel.ID] = serverID
+	s.channelTypeByID[channel.ID] = channelType
+	if channel.ReadOnly {
+		s.readOnlyChannelIDs[channel.ID] = struct{}{}
+	}
+	if err := s.commitDirectoryLocked(snap); err != nil {
+		return Channel{}, err
+	}
+	return channel, nil
+}
+
+func (s *Service) SetCallOccupancy(o CallOccupancy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.callOccupancy = o
+}
+
 func (s *Service) ListChannelGroups(serverID string) ([]ChannelGroup, error) {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
 	groups, ok := s.channelGroupsByServer[serverID]
 	if !ok {
-		return nil, fmt.Errorf("unknown server id: %s", serverID)
+		s.mu.RUnlock()
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
+	}
+	cloned := cloneGroups(groups)
+	occupancy := s.callOccupancy
+	s.mu.RUnlock()
+
+	sortChannelGroups(cloned)
+
+	if occupancy != nil {
+		for groupIdx := range cloned {
+			for channelIdx, channel := range cloned[groupIdx].Channels {
+				if channel.Type == ChannelTypeVoice {
+					cloned[groupIdx].Channels[channelIdx].ActiveCall = occupancy.ChannelHasParticipants(channel.ID)
+				}
+			}
+		}
 	}
-	return cloneGroups(groups), nil
+	return cloned, nil
 }
 
 func (s *Service) ListMembers(serverID string) ([]Member, error) {
@@ -199,28 +651,81 @@ func (s *Service) ListMembers(serverID string) ([]Member, error) {
 	defer s.mu.RUnlock()
 	members, ok := s.membersByServer[serverID]
 	if !ok {
-		return nil, fmt.Errorf("unknown server id: %s", serverID)
+		return nil, fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
 	}
 	cloned := make([]Member, len(members))
 	copy(cloned, members)
 	return cloned, nil
 }
 
-func (s *Service) ListMessages(channelID string, limit int) ([]Message, error) {
+func (s *Service) ListMessages(channelID string, query MessageQuery) (MessagePage, error) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if _, ok := s.channelTypeByID[channelID]; !ok {
-		return nil, fmt.Errorf("unknown channel id: %s", channelID)
+		return MessagePage{}, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
 	}
 	messages := s.messagesByChannel[channelID]
-	if limit <= 0 || limit > len(messages) {
-		limit = len(messages)
+	total := len(messages)
+
+	end := len(messages)
+	if before := strings.TrimSpace(query.Before); before != "" {
+		end = -1
+		for idx, message := range messages {
+			if message.ID == before {
+				end = idx
+				break
+			}
+		}
+		if end < 0 {
+			return MessagePage{}, ErrCursorInvalid
+		}
+	}
+
+	limit := query.Limit
+	if limit <= 0 || limit > end {
+		limit = end
+	}
+	start := end - limit
+	page := MessagePage{
+		Messages: cloneMessages(messages[start:end]),
+		Total:    total,
 	}
-	start := len(messages) - limit
-	if start < 0 {
-		start = 0
+	if query.Descending {
+		slices.Reverse(page.Messages)
+	}
+	if start > 0 {
+		page.NextCursor = messages[start].ID
+	}
+	return page, nil
+}
+
+// WaitForMessages returns messages stored after afterSeq, blocking until one
+// arrives or ctx is done. An expired ctx yields an empty result, not an error.
+func (s *Service) WaitForMessages(ctx context.Context, channelID string, afterSeq int64) ([]Message, error) {
+	for {
+		s.mu.RLock()
+		if _, ok := s.channelTypeByID[channelID]; !ok {
+			s.mu.RUnlock()
+			return nil, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+		}
+		out := make([]Message, 0)
+		for _, message := range s.messagesByChannel[channelID] {
+			if message.Seq > afterSeq {
+				out = append(out, cloneMessage(message))
+			}
+		}
+		signal := s.messageSignal
+		s.mu.RUnlock()
+
+		if len(out) > 0 {
+			return out, nil
+		}
+		select {
+		case <-ctx.Done():
+			return out, nil
+		case <-signal:
+		}
 	}
-	return cloneMessages(messages[start:]), nil
 }
 
 func (s *Service) AttachmentUploadRules() (maxBytes int, maxFiles int, mimeTypes []string) {
@@ -235,44 +740,121 @@ func (s *Service) AttachmentUploadRules() (maxBytes int, maxFiles int, mimeTypes
 	return s.maxAttachmentBytes, s.maxAttachmentsPerMessage, mimeTypes
 }
 
-func (s *Service) CreateMessage(
-	channelID string,
-	authorUID string,
-	body string,
-	uploads []AttachmentUploadInput,
-	replyToMessageID string,
-) (Message, error) {
-	body = strings.TrimSpace(body)
-	replyToMessageID = strings.TrimSpace(replyToMessageID)
+func (s *Service) ReplyPreviewMaxRunes() int {
+	return s.replyPreviewMaxRunes
+}
+
+func (s *Service) MaxPinsPerChannel() int {
+	return s.maxPinsPerChannel
+}
+
+func (s *Service) DefaultMessageFormat() MessageFormat {
+	return s.defaultMessageFormat
+}
+
+func (s *Service) CreateMessage(input CreateMessageInput) (Message, error) {
+	channelID := input.ChannelID
+	authorUID := input.AuthorUID
+	body := strings.TrimSpace(input.Body)
+	replyToMessageID := strings.TrimSpace(input.ReplyToMessageID)
+	uploads := input.Uploads
+	if !input.uploadsStripped {
+		var err error
+		if uploads, err = s.stripUploadMetadata(input.Uploads); err != nil {
+			return Message{}, err
+		}
+	}
+
+	format := MessageFormat(strings.ToLower(strings.TrimSpace(string(input.Format))))
+	if format == "" {
+		format = s.defaultMessageFormat
+	}
+	if _, ok := allowedMessageFormats[format]; !ok {
+		return Message{}, ErrMessageFormatInvalid
+	}
 
 	s.mu.Lock()
 	channelType, ok := s.channelTypeByID[channelID]
 	if !ok {
 		s.mu.Unlock()
-		return Message{}, fmt.Errorf("unknown channel id: %s", channelID)
+		return Message{}, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
 	}
 	if channelType != ChannelTypeText {
 		s.mu.Unlock()
-		return Message{}, errors.New("messages can only be sent to text channels")
+		return Message{}, fmt.Errorf("%w: messages can only be sent to text channels", ErrChannelTypeInvalid)
+	}
+	if _, readOnly := s.readOnlyChannelIDs[channelID]; readOnly && !s.hasRoleLocked(s.channelServerByID[channelID], authorUID, RoleAuthor) {
+		s.mu.Unlock()
+		return Message{}, ErrChannelReadOnly
+	}
+	visibility, visibleTo, err := s.normalizeVisibilityLocked(channelID, input.Visibility, input.VisibleTo)
+	if err != nil {
+		s.mu.Unlock()
+		return Message{}, err
+	}
+	if visibility == MessageVisibilityEphemeral && len(uploads) > 0 {
+		s.mu.Unlock()
+		return Message{}, ErrEphemeralAttachments
+	}
+
+	var forwardedFrom *MessageForwardReference
+	var forwardedAttachments []MessageAttachment
+	var forwardedBlobs []attachmentBlob
+	if input.ForwardFrom != nil {
+		sourceChannelID := strings.TrimSpace(input.ForwardFrom.ChannelID)
+		source, found := s.findMessageByIDLocked(sourceChannelID, strings.TrimSpace(input.ForwardFrom.MessageID))
+		if !found || !s.canReadChannelLocked(sourceChannelID, authorUID) {
+			s.mu.Unlock()
+			return Message{}, ErrForwardSourceNotFound
+		}
+		if body == "" {
+			body = source.Body
+			if strings.TrimSpace(string(input.Format)) == "" {
+				format = source.Format
+			}
+		}
+		// Forwarded attachments get their own ids in the target channel that
+		// share the source blobs, so deleting the source leaves them servable.
+		for _, sourceAttachment := range source.Attachments {
+			blob, ok := s.attachmentsByID[sourceAttachment.AttachmentID]
+			if !ok {
+				continue
+			}
+			attachment := blob.metadata
+			attachment.AttachmentID = s.newAttachmentIDLocked()
+			attachment.URL = s.attachmentURL(channelID, attachment.AttachmentID)
+			forwardedAttachments = append(forwardedAttachments, attachment)
+			forwardedBlobs = append(forwardedBlobs, blob)
+		}
+		forwardedFrom = &MessageForwardReference{
+			ChannelID: source.ChannelID,
+			MessageID: source.ID,
+			AuthorUID: source.AuthorUID,
+		}
+	}
+
+	if visibility == MessageVisibilityEphemeral && len(forwardedAttachments) > 0 {
+		s.mu.Unlock()
+		return Message{}, ErrEphemeralAttachments
 	}
-	if len(uploads) > s.maxAttachmentsPerMessage {
+	if len(forwardedAttachments)+len(uploads) > s.maxAttachmentsPerMessage {
 		s.mu.Unlock()
 		return Message{}, ErrTooManyAttachments
 	}
 
-	attachments := make([]MessageAttachment, 0, len(uploads))
+	// Uploads are validated before anything is retained, so a rejected message
+	// leaves no servable attachments or blob references behind.
+	attachments := make([]MessageAttachment, 0, len(forwardedAttachments)+len(uploads))
+	attachments = append(attachments, forwardedAttachments...)
+	contents := make([][]byte, 0, len(uploads))
 	for _, upload := range uploads {
-		attachment, content, err := s.buildAttachment(channelID, upload)
+		attachment, content, err := s.buildAttachmentLocked(channelID, upload)
 		if err != nil {
 			s.mu.Unlock()
 			return Message{}, err
 		}
-		s.attachmentsByID[attachment.AttachmentID] = attachmentBlob{
-			metadata:  attachment,
-			channelID: channelID,
-			content:   content,
-		}
 		attachments = append(attachments, attachment)
+		contents = append(contents, content)
 	}
 
 	if body == "" && len(attachments) == 0 {
@@ -291,21 +873,62 @@ func (s *Service) CreateMessage(
 			MessageID:         replyMessage.ID,
 			AuthorUID:         replyMessage.AuthorUID,
 			AuthorDisplayName: replyMessage.AuthorUID,
-			PreviewText:       buildReplyPreviewText(replyMessage.Body),
+			PreviewText:       buildReplyPreview(replyMessage, s.replyPreviewMaxRunes),
 			IsUnavailable:     false,
 		}
 	}
 
+	messageID := "msg_" + strings.ReplaceAll(uuid.NewString()[:8], "-", "")
+	for idx, source := range forwardedBlobs {
+		attachment := attachments[idx]
+		digest, shared := s.retainBlobLocked(source.content)
+		s.attachmentsByID[attachment.AttachmentID] = attachmentBlob{
+			metadata:  attachment,
+			channelID: channelID,
+			messageID: messageID,
+			digest:    digest,
+			content:   shared,
+		}
+	}
+	for idx, content := range contents {
+		attachment := attachments[len(forwardedAttachments)+idx]
+		digest, shared := s.retainBlobLocked(content)
+		s.attachmentsByID[attachment.AttachmentID] = attachmentBlob{
+			metadata:  attachment,
+			channelID: channelID,
+			messageID: messageID,
+			digest:    digest,
+			content:   shared,
+		}
+	}
+
 	message := Message{
-		ID:          "msg_" + strings.ReplaceAll(uuid.NewString()[:8], "-", ""),
-		ChannelID:   channelID,
-		AuthorUID:   authorUID,
-		Body:        body,
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		ReplyTo:     cloneMessageReplyReference(replyTo),
-		Attachments: attachments,
-	}
-	s.messagesByChannel[channelID] = append(s.messagesByChannel[channelID], cloneMessage(message))
+		ID:            messageID,
+		ChannelID:     channelID,
+		AuthorUID:     authorUID,
+		Body:          body,
+		Format:        format,
+		CreatedAt:     s.now().UTC().Format(time.RFC3339),
+		ReplyTo:       cloneMessageReplyReference(replyTo),
+		ForwardedFrom: forwardedFrom,
+		Attachments:   attachments,
+		Visibility:    visibility,
+		VisibleTo:     visibleTo,
+	}
+	// Ephemeral messages are only broadcast: they get no seq and never reach
+	// history or the store.
+	if !message.IsEphemeral() {
+		// Seq is assigned under the lock so broadcasts can be reordered to match storage.
+		s.lastSeqByChannel[channelID]++
+		message.Seq = s.lastSeqByChannel[channelID]
+		s.messagesByChannel[channelID] = append(s.messagesByChannel[channelID], cloneMessage(message))
+		if err := s.persistCreatedMessageLocked(message); err != nil {
+			s.mu.Unlock()
+			return Message{}, err
+		}
+		close(s.messageSignal)
+		s.messageSignal = make(chan struct{})
+	}
 	broadcaster := s.broadcaster
 	broadcastMessage := cloneMessage(message)
 	s.mu.Unlock()
@@ -316,17 +939,128 @@ func (s *Service) CreateMessage(
 	return cloneMessage(message), nil
 }
 
+func (s *Service) EditMessage(input EditMessageInput) (Message, error) {
+	s.mu.Lock()
+	snap := s.snapshotChannelLocked(input.ChannelID)
+	edited, err := s.editMessageLocked(input)
+	if err == nil {
+		err = s.commitChannelLocked(snap)
+	}
+	broadcaster := s.broadcaster
+	s.mu.Unlock()
+	if err != nil {
+		return Message{}, err
+	}
+
+	if broadcaster != nil {
+		broadcaster.BroadcastMessageUpdated(cloneMessage(edited))
+	}
+	return edited, nil
+}
+
+func (s *Service) editMessageLocked(input EditMessageInput) (Message, error) {
+	body := strings.TrimSpace(input.Body)
+	editorUID := strings.TrimSpace(input.EditorUID)
+	if _, ok := s.channelTypeByID[input.ChannelID]; !ok {
+		return Message{}, fmt.Errorf("%w: %s", ErrChannelNotFound, input.ChannelID)
+	}
+	messages := s.messagesByChannel[input.ChannelID]
+	idx := -1
+	for i := range messages {
+		if messages[i].ID == input.MessageID {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 || messages[idx].Deleted {
+		return Message{}, fmt.Errorf("%w: %s", ErrMessageNotFound, input.MessageID)
+	}
+	message := messages[idx]
+	if message.AuthorUID != editorUID {
+		return Message{}, ErrMessageEditForbidden
+	}
+	if body == "" && len(message.Attachments) == 0 {
+		return Message{}, ErrMessageEmpty
+	}
+
+	now := s.now().UTC()
+	serverID := s.channelServerByID[input.ChannelID]
+	exempt := s.hasRoleLocked(serverID, editorUID, RoleModerator) || s.hasRoleLocked(serverID, editorUID, RoleBot)
+	if !exempt {
+		createdAt, err := time.Parse(time.RFC3339, message.CreatedAt)
+		if err != nil || now.Sub(createdAt) > s.editWindow {
+			return Message{}, ErrEditWindowExpired
+		}
+	}
+
+	editedAt := now.Format(time.RFC3339)
+	s.recordRevisionLocked(message, editedAt, editorUID)
+	message.Body = body
+	message.EditedAt = editedAt
+	message.EditedBy = editorUID
+	messages[idx] = message
+	return cloneMessage(message), nil
+}
+
+func (s *Service) PurgeChannel(channelID string, requesterUID string) (int, error) {
+	s.mu.Lock()
+	if _, ok := s.channelTypeByID[channelID]; !ok {
+		s.mu.Unlock()
+		return 0, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	if !s.hasRoleLocked(s.channelServerByID[channelID], requesterUID, RoleModerator) {
+		s.mu.Unlock()
+		return 0, ErrModeratorRequired
+	}
+	snap := s.snapshotChannelLocked(channelID)
+	purged := len(s.messagesByChannel[channelID])
+	s.messagesByChannel[channelID] = []Message{}
+	for attachmentID, blob := range s.attachmentsByID {
+		if blob.channelID == channelID {
+			s.retireAttachmentLocked(attachmentID)
+		}
+	}
+	for key := range s.reactionsByMessage {
+		if key.channelID == channelID {
+			delete(s.reactionsByMessage, key)
+		}
+	}
+	for key := range s.revisionsByMessage {
+		if key.channelID == channelID {
+			delete(s.revisionsByMessage, key)
+		}
+	}
+	if err := s.commitChannelLocked(snap); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	broadcaster := s.broadcaster
+	s.mu.Unlock()
+
+	if broadcaster != nil {
+		broadcaster.BroadcastChannelPurged(channelID, requesterUID)
+	}
+	return purged, nil
+}
+
 func (s *Service) findMessageByIDLocked(channelID string, messageID string) (Message, bool) {
 	for _, message := range s.messagesByChannel[channelID] {
-		if message.ID == messageID {
+		if message.ID == messageID && !message.Deleted {
 			return cloneMessage(message), true
 		}
 	}
 	return Message{}, false
 }
 
-func buildReplyPreviewText(body string) string {
-	const maxPreviewRunes = 220
+func buildReplyPreview(message Message, maxRunes int) string {
+	preview := buildReplyPreviewText(message.Body, maxRunes)
+	if preview == "" && len(message.Attachments) > 0 {
+		return "📎 " + message.Attachments[0].FileName
+	}
+	return preview
+}
+
+func buildReplyPreviewText(body string, maxRunes int) string {
 	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(body), "\r", ""), "\n")
 	parts := make([]string, 0, len(lines))
 	for _, line := range lines {
@@ -341,10 +1075,10 @@ func buildReplyPreviewText(body string) string {
 		return ""
 	}
 	runes := []rune(preview)
-	if len(runes) <= maxPreviewRunes {
+	if len(runes) <= maxRunes {
 		return preview
 	}
-	return string(runes[:maxPreviewRunes-1]) + "…"
+	return strings.TrimRightFunc(string(runes[:maxRunes-1]), unicode.IsSpace) + "…"
 }
 
 func (s *Service) AttachmentContent(channelID string, attachmentID string) (MessageAttachment, []byte, error) {
@@ -364,34 +1098,69 @@ func (s *Service) AttachmentContent(channelID string, attachmentID string) (Mess
 	return cloneMessageAttachment(blob.metadata), append([]byte(nil), blob.content...), nil
 }
 
-func (s *Service) buildAttachment(channelID string, upload AttachmentUploadInput) (MessageAttachment, []byte, error) {
+// StorageStats counts attachments; Blobs and Bytes cover the deduplicated
+// content actually held in memory.
+type StorageStats struct {
+	Count int   `json:"count"`
+	Blobs int   `json:"blobs"`
+	Bytes int64 `json:"bytes"`
+}
+
+func (s *Service) AttachmentStorageStats() StorageStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := StorageStats{Count: len(s.attachmentsByID), Blobs: len(s.blobsByDigest)}
+	for _, blob := range s.blobsByDigest {
+		stats.Bytes += int64(len(blob.content))
+	}
+	return stats
+}
+
+func (s *Service) buildAttachmentLocked(channelID string, upload AttachmentUploadInput) (MessageAttachment, []byte, error) {
 	content := upload.Data
 	if len(content) == 0 {
-		return MessageAttachment{}, nil, ErrAttachmentImageInvalid
+		return MessageAttachment{}, nil, ErrAttachmentEmpty
 	}
 	if len(content) > s.maxAttachmentBytes {
 		return MessageAttachment{}, nil, ErrAttachmentTooLarge
 	}
 
-	contentType := normalizeAttachmentContentType(upload.ContentType, content)
+	altText := strings.TrimSpace(upload.AltText)
+	if utf8.RuneCountInString(altText) > MaxAttachmentAltTextRunes {
+		return MessageAttachment{}, nil, ErrAttachmentAltTooLong
+	}
+
+	contentType, err := normalizeAttachmentContentType(upload.ContentType, content)
+	if err != nil {
+		return MessageAttachment{}, nil, err
+	}
 	if _, ok := s.allowedAttachmentTypes[contentType]; !ok {
 		return MessageAttachment{}, nil, ErrAttachmentTypeUnsupported
 	}
 
-	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
-	if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
-		return MessageAttachment{}, nil, ErrAttachmentImageInvalid
+	// Only images have dimensions; other kinds report 0x0.
+	kind := attachmentKind(contentType)
+	var width, height int
+	if kind == AttachmentKindImage {
+		cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+		if err != nil || cfg.Width <= 0 || cfg.Height <= 0 {
+			return MessageAttachment{}, nil, ErrAttachmentImageInvalid
+		}
+		width, height = cfg.Width, cfg.Height
 	}
 
-	attachmentID := "att_" + strings.ReplaceAll(uuid.NewString()[:8], "-", "")
+	attachmentID := s.newAttachmentIDLocked()
 	attachment := MessageAttachment{
 		AttachmentID: attachmentID,
+		Kind:         kind,
 		FileName:     normalizeAttachmentFileName(upload.FileName, contentType),
 		URL:          s.attachmentURL(channelID, attachmentID),
-		Width:        cfg.Width,
-		Height:       cfg.Height,
+		Width:        width,
+		Height:       height,
 		ContentType:  contentType,
 		Bytes:        len(content),
+		AltText:      altText,
 	}
 
 	return attachment, append([]byte(nil), content...), nil
@@ -411,12 +1180,30 @@ func (s *Service) ChannelExists(channelID string) bool {
 	return ok
 }
 
+// ChannelServerID returns the server a channel belongs to, or "" when the
+// channel is unknown.
+func (s *Service) ChannelServerID(channelID string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.channelServerByID[channelID]
+}
+
 func (s *Service) IsVoiceChannel(channelID string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return s.channelTypeByID[channelID] == ChannelTypeVoice
 }
 
+func (s *Service) canReadChannelLocked(channelID string, userUID string) bool {
+	if s.channelTypeByID[channelID] != ChannelTypeText {
+		return false
+	}
+	if _, left := s.leftServersByUser[userUID][s.channelServerByID[channelID]]; left {
+		return false
+	}
+	return true
+}
+
 func (s *Service) LeaveServer(serverID string, userUID string) error {
 	serverID = strings.TrimSpace(serverID)
 	userUID = strings.TrimSpace(userUID)
@@ -431,7 +1218,7 @@ func (s *Service) LeaveServer(serverID string, userUID string) error {
 	defer s.mu.Unlock()
 
 	if _, ok := s.channelGroupsByServer[serverID]; !ok {
-		return fmt.Errorf("unknown server id: %s", serverID)
+		return fmt.Errorf("%w: %s", ErrServerNotFound, serverID)
 	}
 
 	leftByServerID := s.leftServersByUser[userUID]
@@ -439,21 +1226,87 @@ func (s *Service) LeaveServer(serverID string, userUID string) error {
 		leftByServerID = make(map[string]time.Time)
 		s.leftServersByUser[userUID] = leftByServerID
 	}
+	_, alreadyLeft := leftByServerID[serverID]
+	previous := leftByServerID[serverID]
 	leftByServerID[serverID] = time.Now().UTC()
+	if err := s.persistLeftServersLocked(); err != nil {
+		if alreadyLeft {
+			leftByServerID[serverID] = previous
+		} else {
+			delete(leftByServerID, serverID)
+		}
+		return err
+	}
 	return nil
 }
 
+// reindexChannelsLocked rebuilds the channel lookups after the directory was
+// replaced wholesale.
+func (s *Service) reindexChannelsLocked() {
+	s.channelServerByID = make(map[string]string)
+	s.channelTypeByID = make(map[string]ChannelType)
+	s.readOnlyChannelIDs = make(map[string]struct{})
+	s.indexChannels()
+}
+
 func (s *Service) indexChannels() {
 	for serverID, groups := range s.channelGroupsByServer {
 		for _, group := range groups {
 			for _, channel := range group.Channels {
 				s.channelServerByID[channel.ID] = serverID
 				s.channelTypeByID[channel.ID] = channel.Type
+				if channel.ReadOnly {
+					s.readOnlyChannelIDs[channel.ID] = struct{}{}
+				}
 			}
 		}
 	}
 }
 
+// assignInsertionOrder numbers groups and their channels in slice order.
+func assignInsertionOrder(groups []ChannelGroup) {
+	for groupIdx := range groups {
+		groups[groupIdx].Order = groupIdx
+		for channelIdx := range groups[groupIdx].Channels {
+			groups[groupIdx].Channels[channelIdx].Order = channelIdx
+		}
+	}
+}
+
+func nextGroupOrder(groups []ChannelGroup) int {
+	next := 0
+	for _, group := range groups {
+		if group.Order >= next {
+			next = group.Order + 1
+		}
+	}
+	return next
+}
+
+func nextChannelOrder(channels []Channel) int {
+	next := 0
+	for _, channel := range channels {
+		if channel.Order >= next {
+			next = channel.Order + 1
+		}
+	}
+	return next
+}
+
+// sortChannelGroups orders groups and their channels by Order, keeping
+// insertion order for ties.
+func sortChannelGroups(groups []ChannelGroup) {
+	sort.SliceStable(groups, func(i, j int) bool {
+		return groups[i].Order < groups[j].Order
+	})
+	for idx := range groups {
+		channels := groups[idx].Channels
+		sort.SliceStable(channels, func(i, j int) bool {
+			return channels[i].Order < channels[j].Order
+		})
+	}
+}
+
 func cloneGroups(groups []ChannelGroup) []ChannelGroup {
 	out := make([]ChannelGroup, len(groups))
 	for idx, group := range groups {
@@ -463,6 +1316,7 @@ func cloneGroups(groups []ChannelGroup) []ChannelGroup {
 			ID:       group.ID,
 			Label:    group.Label,
 			Kind:     group.Kind,
+			Order:    group.Order,
 			Channels: channels,
 		}
 	}
@@ -480,12 +1334,19 @@ func cloneMessages(messages []Message) []Message {
 func cloneMessage(message Message) Message {
 	out := message
 	out.ReplyTo = cloneMessageReplyReference(message.ReplyTo)
+	if message.ForwardedFrom != nil {
+		forwardedFrom := *message.ForwardedFrom
+		out.ForwardedFrom = &forwardedFrom
+	}
 	if len(message.Attachments) > 0 {
 		out.Attachments = make([]MessageAttachment, len(message.Attachments))
 		for idx, attachment := range message.Attachments {
 			out.Attachments[idx] = cloneMessageAttachment(attachment)
 		}
 	}
+	if len(message.VisibleTo) > 0 {
+		out.VisibleTo = append([]string(nil), message.VisibleTo...)
+	}
 	return out
 }
 
@@ -509,20 +1370,44 @@ func (s *Service) attachmentURL(channelID string, attachmentID string) string {
 	return s.publicBaseURL + path
 }
 
-func normalizeAttachmentContentType(contentType string, body []byte) string {
+func serverIconText(displayName string) string {
+	var initials []rune
+	for _, word := range strings.Fields(displayName) {
+		initials = append(initials, []rune(strings.ToUpper(word))[0])
+		if len(initials) == 2 {
+			break
+		}
+	}
+	return string(initials)
+}
+
+func normalizeAttachmentContentType(contentType string, body []byte) (string, error) {
 	contentType = strings.TrimSpace(strings.ToLower(contentType))
 	if contentType != "" {
 		if idx := strings.Index(contentType, ";"); idx >= 0 {
 			contentType = strings.TrimSpace(contentType[:idx])
 		}
 	}
-	if len(body) > 0 {
-		detected := strings.ToLower(http.DetectContentType(body))
-		if contentType == "" || contentType == "application/octet-stream" {
-			contentType = detected
+	if contentType == "image/jpg" {
+		contentType = "image/jpeg"
+	}
+	if len(body) == 0 {
+		return contentType, nil
+	}
+
+	detected := strings.ToLower(http.DetectContentType(body))
+	declaredUnset := contentType == "" || contentType == "application/octet-stream"
+	if strings.HasPrefix(detected, "image/") {
+		// Sniffed image types win so a client cannot relabel one image format as another.
+		if !declaredUnset && contentType != detected {
+			return "", ErrAttachmentTypeMismatch
 		}
+		return detected, nil
+	}
+	if declaredUnset {
+		return detected, nil
 	}
-	return contentType
+	return contentType, nil
 }
 
 func normalizeAttachmentFileName(fileName string, contentType string) string {
@@ -536,11 +1421,30 @@ func normalizeAttachmentFileName(fileName string, contentType string) string {
 		return "image.jpg"
 	case "image/gif":
 		return "image.gif"
+	case "application/pdf":
+		return "document.pdf"
+	case "video/mp4":
+		return "video.mp4"
+	case "audio/mpeg":
+		return "audio.mp3"
 	default:
 		return "image.png"
 	}
 }
 
+func attachmentKind(contentType string) AttachmentKind {
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return AttachmentKindImage
+	case strings.HasPrefix(contentType, "video/"):
+		return AttachmentKindVideo
+	case strings.HasPrefix(contentType, "audio/"):
+		return AttachmentKindAudio
+	default:
+		return AttachmentKindFile
+	}
+}
+
 func seedServerDirectory() []ServerDirectoryEntry {
 	return []ServerDirectoryEntry{
 		{
@@ -572,7 +1476,7 @@ func seedChannelGroups() map[string][]ChannelGroup {
 				Channels: []Channel{
 					{ID: "ch_general", Name: "general", Type: ChannelTypeText},
 					{ID: "ch_design", Name: "design", Type: ChannelTypeText},
-					{ID: "ch_release", Name: "release-notes", Type: ChannelTypeText},
+					{ID: "ch_release", Name: "release-notes", Type: ChannelTypeText, ReadOnly: true},
 				},
 			},
 			{
@@ -636,22 +1540,22 @@ func seedMessages() map[string][]Message {
 	now := time.Now().UTC()
 	return map[string][]Message{
 		"ch_general": {
-			{ID: "msg_seed_01", ChannelID: "ch_general", AuthorUID: "uid_seed_1", Body: "Welcome to OpenChat Harbor.", CreatedAt: now.Add(-30 * time.Minute).Format(time.RFC3339)},
-			{ID: "msg_seed_02", ChannelID: "ch_general", AuthorUID: "uid_seed_2", Body: "Realtime messaging is enabled.", CreatedAt: now.Add(-24 * time.Minute).Format(time.RFC3339)},
+			{ID: "msg_seed_01", ChannelID: "ch_general", AuthorUID: "uid_seed_1", Body: "Welcome to OpenChat Harbor.", Format: MessageFormatPlain, CreatedAt: now.Add(-30 * time.Minute).Format(time.RFC3339)},
+			{ID: "msg_seed_02", ChannelID: "ch_general", AuthorUID: "uid_seed_2", Body: "Realtime messaging is enabled.", Format: MessageFormatPlain, CreatedAt: now.Add(-24 * time.Minute).Format(time.RFC3339)},
 		},
 		"ch_design": {
-			{ID: "msg_seed_11", ChannelID: "ch_design", AuthorUID: "uid_seed_3", Body: "Design channel ready for discussion.", CreatedAt: now.Add(-18 * time.Minute).Format(time.RFC3339)},
+			{ID: "msg_seed_11", ChannelID: "ch_design", AuthorUID: "uid_seed_3", Body: "Design channel ready for discussion.", Format: MessageFormatPlain, CreatedAt: now.Add(-18 * time.Minute).Format(time.RFC3339)},
 		},
 		"ch_release": {},
 		"ch_outage":  {},
 		"vc_general": {},
 		"vc_party":   {},
 		"tl_ch_general": {
-			{ID: "msg_tl_01", ChannelID: "tl_ch_general", AuthorUID: "uid_tl_1", Body: "TestLab server online.", CreatedAt: now.Add(-22 * time.Minute).Format(time.RFC3339)},
-			{ID: "msg_tl_02", ChannelID: "tl_ch_general", AuthorUID: "uid_tl_2", Body: "Use this channel for integration testing.", CreatedAt: now.Add(-15 * time.Minute).Format(time.RFC3339)},
+			{ID: "msg_tl_01", ChannelID: "tl_ch_general", AuthorUID: "uid_tl_1", Body: "TestLab server online.", Format: MessageFormatPlain, CreatedAt: now.Add(-22 * time.Minute).Format(time.RFC3339)},
+			{ID: "msg_tl_02", ChannelID: "tl_ch_general", AuthorUID: "uid_tl_2", Body: "Use this channel for integration testing.", Format: MessageFormatPlain, CreatedAt: now.Add(-15 * time.Minute).Format(time.RFC3339)},
 		},
 		"tl_ch_qa": {
-			{ID: "msg_tl_11", ChannelID: "tl_ch_qa", AuthorUID: "uid_tl_3", Body: "QA board ready for smoke checks.", CreatedAt: now.Add(-9 * time.Minute).Format(time.RFC3339)},
+			{ID: "msg_tl_11", ChannelID: "tl_ch_qa", AuthorUID: "uid_tl_3", Body: "QA board ready for smoke checks.", Format: MessageFormatPlain, CreatedAt: now.Add(-9 * time.Minute).Format(time.RFC3339)},
 		},
 		"tl_vc_huddle":  {},
 		"tl_vc_pairing": {},
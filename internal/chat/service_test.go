@@ -0,0 +1,644 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func TestEditMessageRespectsEditWindow(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	svc := NewService("http://localhost:8080", Options{EditWindow: 15 * time.Minute, Now: clock.Now})
+	svc.SetPermissionProvider(NewStaticPermissionProvider(map[Role][]string{
+		RoleModerator: {"uid_moderator"},
+	}))
+
+	message, err := svc.CreateMessage(CreateMessageInput{ChannelID: "ch_general", AuthorUID: "uid_author", Body: "first draft"})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	clock.now = clock.now.Add(10 * time.Minute)
+	edited, err := svc.EditMessage(EditMessageInput{ChannelID: "ch_general", MessageID: message.ID, EditorUID: "uid_author", Body: "second draft"})
+	if err != nil {
+		t.Fatalf("edit within window: %v", err)
+	}
+	if edited.Body != "second draft" || edited.EditedAt == "" {
+		t.Fatalf("expected edited body and edited_at, got %+v", edited)
+	}
+
+	clock.now = clock.now.Add(10 * time.Minute)
+	_, err = svc.EditMessage(EditMessageInput{ChannelID: "ch_general", MessageID: message.ID, EditorUID: "uid_author", Body: "too late"})
+	if !errors.Is(err, ErrEditWindowExpired) {
+		t.Fatalf("expected ErrEditWindowExpired, got %v", err)
+	}
+
+	_, err = svc.EditMessage(EditMessageInput{ChannelID: "ch_general", MessageID: message.ID, EditorUID: "uid_other", Body: "not mine"})
+	if !errors.Is(err, ErrMessageEditForbidden) {
+		t.Fatalf("expected ErrMessageEditForbidden, got %v", err)
+	}
+
+	modMessage, err := svc.CreateMessage(CreateMessageInput{ChannelID: "ch_general", AuthorUID: "uid_moderator", Body: "pinned notice"})
+	if err != nil {
+		t.Fatalf("create moderator message: %v", err)
+	}
+	clock.now = clock.now.Add(time.Hour)
+	if _, err := svc.EditMessage(EditMessageInput{ChannelID: "ch_general", MessageID: modMessage.ID, EditorUID: "uid_moderator", Body: "updated notice"}); err != nil {
+		t.Fatalf("expected moderator to be exempt from edit window, got %v", err)
+	}
+}
+
+func TestMessageHistoryListsPriorRevisions(t *testing.T) {
+	clock := &testClock{now: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)}
+	svc := NewService("http://localhost:8080", Options{Now: clock.Now})
+	svc.SetPermissionProvider(NewStaticPermissionProvider(map[Role][]string{
+		RoleModerator: {"uid_moderator"},
+	}))
+
+	message, err := svc.CreateMessage(CreateMessageInput{ChannelID: "ch_general", AuthorUID: "uid_author", Body: "first draft"})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	for _, body := range []string{"second draft", "final"} {
+		clock.now = clock.now.Add(time.Minute)
+		if _, err := svc.EditMessage(EditMessageInput{ChannelID: "ch_general", MessageID: message.ID, EditorUID: "uid_author", Body: body}); err != nil {
+			t.Fatalf("edit to %q: %v", body, err)
+		}
+	}
+
+	revisions, err := svc.MessageHistory("ch_general", message.ID, "uid_moderator")
+	if err != nil {
+		t.Fatalf("moderator history: %v", err)
+	}
+	if len(revisions) != 2 || revisions[0].Body != "first draft" || revisions[1].Body != "second draft" {
+		t.Fatalf("expected both prior bodies oldest first, got %+v", revisions)
+	}
+	if revisions[0].WrittenAt != message.CreatedAt || revisions[1].WrittenAt != revisions[0].ReplacedAt || revisions[1].ReplacedBy != "uid_author" {
+		t.Fatalf("unexpected revision timestamps or editor: %+v", revisions)
+	}
+
+	if _, err := svc.MessageHistory("ch_general", message.ID, "uid_other"); !errors.Is(err, ErrMessageHistoryForbidden) {
+		t.Fatalf("expected ErrMessageHistoryForbidden, got %v", err)
+	}
+}
+
+type recordingBroadcaster struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (b *recordingBroadcaster) BroadcastMessage(message Message) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.messages = append(b.messages, message)
+}
+
+func (b *recordingBroadcaster) BroadcastMessageUpdated(Message) {}
+
+func (b *recordingBroadcaster) BroadcastMessageDeleted(Message) {}
+
+func (b *recordingBroadcaster) BroadcastChannelPurged(string, string) {}
+
+func (b *recordingBroadcaster) BroadcastChannelTopicUpdated(string, string, string) {}
+
+func TestConcurrentCreateMessageSequenceMatchesStoredOrder(t *testing.T) {
+	svc := NewService("http://localhost:8080", Options{})
+	broadcaster := &recordingBroadcaster{}
+	svc.SetBroadcaster(broadcaster)
+
+	const creators = 64
+	var wg sync.WaitGroup
+	for idx := 0; idx < creators; idx++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			if _, err := svc.CreateMessage(CreateMessageInput{
+				ChannelID: "ch_general",
+				AuthorUID: "uid_concurrent",
+				Body:      "message " + strconv.Itoa(idx),
+			}); err != nil {
+				t.Errorf("create message: %v", err)
+			}
+		}(idx)
+	}
+	wg.Wait()
+
+	page, err := svc.ListMessages("ch_general", MessageQuery{})
+	if err != nil {
+		t.Fatalf("list messages: %v", err)
+	}
+	for idx := 1; idx < len(page.Messages); idx++ {
+		if page.Messages[idx].Seq != page.Messages[idx-1].Seq+1 {
+			t.Fatalf("expected contiguous seq in stored order, got %d after %d", page.Messages[idx].Seq, page.Messages[idx-1].Seq)
+		}
+	}
+
+	broadcast := append([]Message(nil), broadcaster.messages...)
+	if len(broadcast) != creators {
+		t.Fatalf("expected %d broadcasts, got %d", creators, len(broadcast))
+	}
+	sort.Slice(broadcast, func(i, j int) bool { return broadcast[i].Seq < broadcast[j].Seq })
+	stored := page.Messages[len(page.Messages)-creators:]
+	for idx := range broadcast {
+		if broadcast[idx].ID != stored[idx].ID || broadcast[idx].Seq != stored[idx].Seq {
+			t.Fatalf("broadcast seq order diverges from storage at %d: %s/%d vs %s/%d",
+				idx, broadcast[idx].ID, broadcast[idx].Seq, stored[idx].ID, stored[idx].Seq)
+		}
+	}
+}
+
+func TestListChannelGroupsFollowsConfiguredOrder(t *testing.T) {
+	svc := NewService("http://localhost:8080", Options{})
+
+	groups, err := svc.ListChannelGroups("srv_harbor")
+	if err != nil {
+		t.Fatalf("list channel groups: %v", err)
+	}
+	if got := groupIDs(groups); !slices.Equal(got, []string{"grp_general", "grp_ops", "grp_voice"}) {
+		t.Fatalf("expected insertion order by default, got %v", got)
+	}
+
+	svc.mu.Lock()
+	configured := svc.channelGroupsByServer["srv_harbor"]
+	configured[0].Order, configured[2].Order = 2, 0
+	svc.mu.Unlock()
+
+	first := 0
+	if _, err := svc.CreateChannel("srv_harbor", CreateChannelInput{GroupID: "grp_general", Name: "announcements", Order: &first}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	if _, err := svc.CreateChannel("srv_harbor", CreateChannelInput{GroupID: "grp_general", Name: "random"}); err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+
+	groups, err = svc.ListChannelGroups("srv_harbor")
+	if err != nil {
+		t.Fatalf("list channel groups: %v", err)
+	}
+	if got := groupIDs(groups); !slices.Equal(got, []string{"grp_voice", "grp_ops", "grp_general"}) {
+		t.Fatalf("expected configured group order, got %v", got)
+	}
+	names := make([]string, 0, len(groups[2].Channels))
+	for _, channel := range groups[2].Channels {
+		names = append(names, channel.Name)
+	}
+	if !slices.Equal(names, []string{"general", "announcements", "design", "release-notes", "random"}) {
+		t.Fatalf("expected channels sorted by order, got %v", names)
+	}
+}
+
+func groupIDs(groups []ChannelGroup) []string {
+	ids := make([]string, 0, len(groups))
+	for _, group := range groups {
+		ids = append(ids, group.ID)
+	}
+	return ids
+}
+
+func TestScheduledMessageDeliversAfterDelay(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	var clockMu sync.Mutex
+	svc := NewService("http://localhost:8080", Options{
+		MaxScheduleAhead: time.Hour,
+		Now: func() time.Time {
+			clockMu.Lock()
+			defer clockMu.Unlock()
+			return now
+		},
+	})
+	broadcaster := &recordingBroadcaster{}
+	svc.SetBroadcaster(broadcaster)
+	advance := func(d time.Duration) {
+		clockMu.Lock()
+		defer clockMu.Unlock()
+		now = now.Add(d)
+	}
+
+	input := CreateMessageInput{ChannelID: "ch_general", AuthorUID: "uid_scheduler", Body: "see you soon"}
+	if _, err := svc.ScheduleMessage(input, now.Add(2*time.Hour)); !errors.Is(err, ErrScheduleTooFar) {
+		t.Fatalf("expected ErrScheduleTooFar, got %v", err)
+	}
+	scheduled, err := svc.ScheduleMessage(input, now.Add(5*time.Minute))
+	if err != nil {
+		t.Fatalf("schedule message: %v", err)
+	}
+	if scheduled.ID == "" || scheduled.SendAt != "2026-03-01T12:05:00Z" {
+		t.Fatalf("unexpected scheduled message %+v", scheduled)
+	}
+	canceled, err := svc.ScheduleMessage(CreateMessageInput{ChannelID: "ch_general", AuthorUID: "uid_scheduler", Body: "never mind"}, now.Add(5*time.Minute))
+	if err != nil {
+		t.Fatalf("schedule message: %v", err)
+	}
+	if err := svc.CancelScheduledMessage("ch_general", canceled.ID, "uid_someone_else"); !errors.Is(err, ErrScheduledMessageNotFound) {
+		t.Fatalf("expected other users to be unable to cancel, got %v", err)
+	}
+	if err := svc.CancelScheduledMessage("ch_general", canceled.ID, "uid_scheduler"); err != nil {
+		t.Fatalf("cancel scheduled message: %v", err)
+	}
+
+	if delivered := svc.DeliverDueMessages(); delivered != 0 {
+		t.Fatalf("expected nothing due yet, delivered %d", delivered)
+	}
+	advance(5 * time.Minute)
+	if delivered := svc.DeliverDueMessages(); delivered != 1 {
+		t.Fatalf("expected 1 delivery after the delay, got %d", delivered)
+	}
+
+	page, err := svc.ListMessages("ch_general", MessageQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("list messages: %v", err)
+	}
+	latest := page.Messages[len(page.Messages)-1]
+	if latest.Body != "see you soon" || latest.CreatedAt != "2026-03-01T12:05:00Z" {
+		t.Fatalf("expected delivered message stamped at send time, got %+v", latest)
+	}
+	broadcaster.mu.Lock()
+	defer broadcaster.mu.Unlock()
+	if len(broadcaster.messages) != 1 || broadcaster.messages[0].Body != "see you soon" {
+		t.Fatalf("expected one broadcast for the delivered message, got %d", len(broadcaster.messages))
+	}
+}
+
+func TestRejectedMessageRetainsNoAttachments(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	svc := NewService("http://localhost:8080", Options{})
+	valid := AttachmentUploadInput{FileName: "ok.png", ContentType: "image/png", Data: encoded.Bytes()}
+
+	if _, err := svc.CreateMessage(CreateMessageInput{
+		ChannelID: "ch_general",
+		AuthorUID: "uid_rejected",
+		Uploads:   []AttachmentUploadInput{valid, {FileName: "empty.png", ContentType: "image/png"}},
+	}); !errors.Is(err, ErrAttachmentEmpty) {
+		t.Fatalf("expected ErrAttachmentEmpty for the second upload, got %v", err)
+	}
+	if _, err := svc.CreateMessage(CreateMessageInput{
+		ChannelID:        "ch_general",
+		AuthorUID:        "uid_rejected",
+		ReplyToMessageID: "msg_missing",
+		Uploads:          []AttachmentUploadInput{valid},
+	}); !errors.Is(err, ErrReplyTargetNotFound) {
+		t.Fatalf("expected ErrReplyTargetNotFound, got %v", err)
+	}
+
+	if stats := svc.AttachmentStorageStats(); stats.Count != 0 || stats.Blobs != 0 || stats.Bytes != 0 {
+		t.Fatalf("expected rejected messages to retain nothing, got %+v", stats)
+	}
+}
+
+func TestIdenticalAttachmentsShareOneBlob(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	svc := NewService("http://localhost:8080", Options{})
+	svc.SetPermissionProvider(NewStaticPermissionProvider(map[Role][]string{
+		RoleModerator: {"uid_moderator"},
+	}))
+
+	var attachmentIDs []string
+	for i := 0; i < 2; i++ {
+		message, err := svc.CreateMessage(CreateMessageInput{
+			ChannelID: "ch_general",
+			AuthorUID: "uid_meme",
+			Uploads:   []AttachmentUploadInput{{FileName: "meme.png", ContentType: "image/png", Data: encoded.Bytes()}},
+		})
+		if err != nil {
+			t.Fatalf("create message %d: %v", i, err)
+		}
+		attachmentIDs = append(attachmentIDs, message.Attachments[0].AttachmentID)
+	}
+	if attachmentIDs[0] == attachmentIDs[1] {
+		t.Fatalf("expected distinct attachment ids, got %v", attachmentIDs)
+	}
+
+	if len(svc.blobsByDigest) != 1 {
+		t.Fatalf("expected 1 stored blob, got %d", len(svc.blobsByDigest))
+	}
+	for _, blob := range svc.blobsByDigest {
+		if blob.refs != 2 {
+			t.Fatalf("expected 2 references, got %d", blob.refs)
+		}
+	}
+	if stats := svc.AttachmentStorageStats(); stats.Count != 2 || stats.Blobs != 1 || stats.Bytes != int64(encoded.Len()) {
+		t.Fatalf("unexpected storage stats %+v", stats)
+	}
+
+	if _, err := svc.PurgeChannel("ch_general", "uid_moderator"); err != nil {
+		t.Fatalf("purge channel: %v", err)
+	}
+	if len(svc.blobsByDigest) != 0 {
+		t.Fatalf("expected blob to be released after purge, got %d", len(svc.blobsByDigest))
+	}
+}
+
+func TestFileStoreRestoresStateAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	openService := func() *Service {
+		store, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatalf("open file store: %v", err)
+		}
+		svc := NewService("http://localhost:8080", Options{Store: store})
+		if err := svc.StoreError(); err != nil {
+			t.Fatalf("load file store: %v", err)
+		}
+		return svc
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	first := openService()
+	if page, _ := first.ListMessages("ch_general", MessageQuery{}); page.Total == 0 {
+		t.Fatalf("expected seed messages when the store is empty")
+	}
+	created, err := first.CreateMessage(CreateMessageInput{
+		ChannelID: "ch_general",
+		AuthorUID: "uid_author",
+		Body:      "survives restarts",
+		Uploads:   []AttachmentUploadInput{{FileName: "dot.png", ContentType: "image/png", Data: encoded.Bytes()}},
+	})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	if err := first.LeaveServer("srv_harbor", "uid_author"); err != nil {
+		t.Fatalf("leave server: %v", err)
+	}
+	if _, err := first.EditMessage(EditMessageInput{ChannelID: "ch_general", MessageID: created.ID, EditorUID: "uid_author", Body: "survives restarts, edited"}); err != nil {
+		t.Fatalf("edit message: %v", err)
+	}
+	if _, err := first.PinMessage("ch_general", created.ID, "uid_author"); err != nil {
+		t.Fatalf("pin message: %v", err)
+	}
+	if _, err := first.AddReaction(ReactionInput{ChannelID: "ch_general", MessageID: created.ID, UserUID: "uid_fan", Emoji: "👍"}); err != nil {
+		t.Fatalf("add reaction: %v", err)
+	}
+	doomed, err := first.CreateMessage(CreateMessageInput{
+		ChannelID: "ch_general",
+		AuthorUID: "uid_author",
+		Body:      "deleted before restart",
+		Uploads:   []AttachmentUploadInput{{FileName: "gone.png", ContentType: "image/png", Data: encoded.Bytes()}},
+	})
+	if err != nil {
+		t.Fatalf("create doomed message: %v", err)
+	}
+	if err := first.DeleteMessage("ch_general", doomed.ID, "uid_author"); err != nil {
+		t.Fatalf("delete message: %v", err)
+	}
+
+	second := openService()
+	page, err := second.ListMessages("ch_general", MessageQuery{})
+	if err != nil {
+		t.Fatalf("list messages: %v", err)
+	}
+	restored := page.Messages[len(page.Messages)-2]
+	if restored.ID != created.ID || restored.Body != "survives restarts, edited" || restored.Seq != created.Seq || restored.PinnedAt == "" {
+		t.Fatalf("expected the edited, pinned message to be restored, got %+v", restored)
+	}
+	if tombstone := page.Messages[len(page.Messages)-1]; tombstone.ID != doomed.ID || !tombstone.Deleted {
+		t.Fatalf("expected the deleted message to stay a tombstone, got %+v", tombstone)
+	}
+	if _, _, err := second.AttachmentContent("ch_general", doomed.Attachments[0].AttachmentID); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Fatalf("expected the deleted message's attachment to stay gone, got %v", err)
+	}
+	if summaries, _, _ := second.ReactionSummaries("ch_general", "uid_fan", []string{created.ID}); len(summaries[created.ID]) != 1 || !summaries[created.ID][0].Reacted {
+		t.Fatalf("expected the reaction to be restored, got %+v", summaries[created.ID])
+	}
+	if _, content, err := second.AttachmentContent("ch_general", created.Attachments[0].AttachmentID); err != nil || !bytes.Equal(content, encoded.Bytes()) {
+		t.Fatalf("expected attachment content to be restored, err=%v", err)
+	}
+	if servers := second.ListServersForUser("uid_author"); len(servers) != len(second.ListServers())-1 {
+		t.Fatalf("expected left server to stay hidden after restart, got %d servers", len(servers))
+	}
+	next, err := second.CreateMessage(CreateMessageInput{ChannelID: "ch_general", AuthorUID: "uid_author", Body: "after restart"})
+	if err != nil {
+		t.Fatalf("create message after restart: %v", err)
+	}
+	if next.Seq != doomed.Seq+1 {
+		t.Fatalf("expected seq to continue from %d, got %d", doomed.Seq, next.Seq)
+	}
+}
+
+func TestFileStoreRestoresRuntimeChannelsAcrossRestart(t *testing.T) {
+	dir := t.TempDir()
+	openService := func() *Service {
+		store, err := NewFileStore(dir)
+		if err != nil {
+			t.Fatalf("open file store: %v", err)
+		}
+		svc := NewService("http://localhost:8080", Options{Empty: true, Store: store})
+		if err := svc.StoreError(); err != nil {
+			t.Fatalf("load file store: %v", err)
+		}
+		svc.SetPermissionProvider(NewStaticPermissionProvider(map[Role][]string{
+			RoleModerator: {"uid_moderator"},
+		}))
+		return svc
+	}
+
+	first := openService()
+	if _, err := first.CreateServer(CreateServerInput{ServerID: "srv_runtime", DisplayName: "Runtime"}); err != nil {
+		t.Fatalf("create server: %v", err)
+	}
+	channel, err := first.CreateChannel("srv_runtime", CreateChannelInput{Name: "lobby", Type: ChannelTypeText})
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	if err := first.SetDefaultChannel("srv_runtime", channel.ID); err != nil {
+		t.Fatalf("set default channel: %v", err)
+	}
+	if _, err := first.SetChannelTopic(channel.ID, "welcome aboard", "uid_moderator"); err != nil {
+		t.Fatalf("set topic: %v", err)
+	}
+	created, err := first.CreateMessage(CreateMessageInput{ChannelID: channel.ID, AuthorUID: "uid_author", Body: "first post"})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	second := openService()
+	if orphaned := second.OrphanedChannels(); len(orphaned) != 0 {
+		t.Fatalf("expected no orphaned channels, got %v", orphaned)
+	}
+	servers := second.ListServers()
+	if len(servers) != 1 || servers[0].ServerID != "srv_runtime" || servers[0].DefaultChannelID != channel.ID {
+		t.Fatalf("expected the runtime server and its default channel to be restored, got %+v", servers)
+	}
+	groups, err := second.ListChannelGroups("srv_runtime")
+	if err != nil || len(groups) != 1 || len(groups[0].Channels) != 1 || groups[0].Channels[0].Topic != "welcome aboard" {
+		t.Fatalf("expected the runtime channel and topic to be restored, got %+v (err=%v)", groups, err)
+	}
+	page, err := second.ListMessages(channel.ID, MessageQuery{})
+	if err != nil || page.Total != 1 || page.Messages[0].ID != created.ID {
+		t.Fatalf("expected the runtime channel's message to be restored, got %+v (err=%v)", page, err)
+	}
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("open file store: %v", err)
+	}
+	stored, err := store.LoadMessages()
+	if err != nil {
+		t.Fatalf("load messages: %v", err)
+	}
+	stored["ch_vanished"] = []Message{{ID: "msg_vanished", ChannelID: "ch_vanished", Body: "nobody home", Seq: 1}}
+	if err := store.SaveMessages(stored); err != nil {
+		t.Fatalf("save messages: %v", err)
+	}
+	third := openService()
+	if orphaned := third.OrphanedChannels(); len(orphaned) != 1 || orphaned[0] != "ch_vanished" {
+		t.Fatalf("expected messages for the unknown channel to be dropped, got %v", orphaned)
+	}
+	if page, err := third.ListMessages(channel.ID, MessageQuery{}); err != nil || page.Total != 1 {
+		t.Fatalf("expected known channels to load alongside the orphan, got %+v (err=%v)", page, err)
+	}
+}
+
+type failingStore struct {
+	Store
+	fail bool
+}
+
+func (f *failingStore) SaveMessages(messagesByChannel map[string][]Message) error {
+	if f.fail {
+		return errors.New("disk full")
+	}
+	return f.Store.SaveMessages(messagesByChannel)
+}
+
+func TestStoreFailureRollsBackMutations(t *testing.T) {
+	fileStore, err := NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("open file store: %v", err)
+	}
+	store := &failingStore{Store: fileStore}
+	svc := NewService("http://localhost:8080", Options{Store: store})
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	created, err := svc.CreateMessage(CreateMessageInput{
+		ChannelID: "ch_general",
+		AuthorUID: "uid_author",
+		Body:      "original",
+		Uploads:   []AttachmentUploadInput{{FileName: "dot.png", ContentType: "image/png", Data: encoded.Bytes()}},
+	})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	store.fail = true
+	if _, err := svc.EditMessage(EditMessageInput{ChannelID: "ch_general", MessageID: created.ID, EditorUID: "uid_author", Body: "edited"}); !errors.Is(err, ErrStoreFailed) {
+		t.Fatalf("expected edit to fail with ErrStoreFailed, got %v", err)
+	}
+	if err := svc.DeleteMessage("ch_general", created.ID, "uid_author"); !errors.Is(err, ErrStoreFailed) {
+		t.Fatalf("expected delete to fail with ErrStoreFailed, got %v", err)
+	}
+	page, _ := svc.ListMessages("ch_general", MessageQuery{})
+	if last := page.Messages[len(page.Messages)-1]; last.Body != "original" || last.Deleted {
+		t.Fatalf("expected failed mutations to be rolled back, got %+v", last)
+	}
+	if _, _, err := svc.AttachmentContent("ch_general", created.Attachments[0].AttachmentID); err != nil {
+		t.Fatalf("expected attachment to survive the failed delete, got %v", err)
+	}
+}
+
+func TestStripImageMetadataRemovesEXIF(t *testing.T) {
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 3, 2)), nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	exifPayload := append([]byte("Exif\x00\x00"), []byte("GPSLatitude=51.5072")...)
+	segment := []byte{0xFF, 0xE1, byte((len(exifPayload) + 2) >> 8), byte(len(exifPayload) + 2)}
+	withEXIF := append([]byte{}, encoded.Bytes()[:2]...)
+	withEXIF = append(withEXIF, segment...)
+	withEXIF = append(withEXIF, exifPayload...)
+	withEXIF = append(withEXIF, encoded.Bytes()[2:]...)
+
+	svc := NewService("http://localhost:8080", Options{StripImageMetadata: true})
+	message, err := svc.CreateMessage(CreateMessageInput{
+		ChannelID: "ch_general",
+		AuthorUID: "uid_author",
+		Uploads:   []AttachmentUploadInput{{FileName: "holiday.jpg", ContentType: "image/jpeg", Data: withEXIF}},
+	})
+	if err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+	attachment, content, err := svc.AttachmentContent("ch_general", message.Attachments[0].AttachmentID)
+	if err != nil {
+		t.Fatalf("attachment content: %v", err)
+	}
+	if bytes.Contains(content, []byte("Exif")) || bytes.Contains(content, []byte("GPSLatitude")) {
+		t.Fatalf("expected EXIF block to be stripped from stored bytes")
+	}
+	if attachment.Width != 3 || attachment.Height != 2 || attachment.Bytes != len(content) {
+		t.Fatalf("unexpected attachment metadata after re-encode: %+v", attachment)
+	}
+}
+
+func TestStripImageMetadataRejectsWhatItCannotStrip(t *testing.T) {
+	svc := NewService("http://localhost:8080", Options{StripImageMetadata: true})
+	upload := func(fileName string, contentType string, content []byte) (Message, error) {
+		return svc.CreateMessage(CreateMessageInput{
+			ChannelID: "ch_general",
+			AuthorUID: "uid_author",
+			Uploads:   []AttachmentUploadInput{{FileName: fileName, ContentType: contentType, Data: content}},
+		})
+	}
+
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, image.NewRGBA(image.Rect(0, 0, 3, 2)), nil); err != nil {
+		t.Fatalf("encode jpeg: %v", err)
+	}
+	// EXIF orientation 6: the stored 3x2 pixels display rotated 90 degrees clockwise.
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00")
+	exifPayload := append([]byte("Exif\x00\x00"), tiff...)
+	rotated := append([]byte{}, encoded.Bytes()[:2]...)
+	rotated = append(rotated, 0xFF, 0xE1, byte((len(exifPayload)+2)>>8), byte(len(exifPayload)+2))
+	rotated = append(rotated, exifPayload...)
+	rotated = append(rotated, encoded.Bytes()[2:]...)
+	message, err := upload("phone.jpg", "image/jpeg", rotated)
+	if err != nil {
+		t.Fatalf("create rotated message: %v", err)
+	}
+	if attachment := message.Attachments[0]; attachment.Width != 2 || attachment.Height != 3 {
+		t.Fatalf("expected the orientation to be applied to the pixels, got %dx%d", attachment.Width, attachment.Height)
+	}
+
+	if _, err := upload("broken.jpg", "image/jpeg", encoded.Bytes()[:len(encoded.Bytes())/2]); !errors.Is(err, ErrAttachmentImageInvalid) {
+		t.Fatalf("expected an undecodable image to be rejected, got %v", err)
+	}
+
+	var small bytes.Buffer
+	if err := png.Encode(&small, image.NewRGBA(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatalf("encode png: %v", err)
+	}
+	bomb := append([]byte{}, small.Bytes()...)
+	binary.BigEndian.PutUint32(bomb[16:], 100_000)
+	binary.BigEndian.PutUint32(bomb[20:], 100_000)
+	binary.BigEndian.PutUint32(bomb[29:], crc32.ChecksumIEEE(bomb[12:29]))
+	if _, err := upload("bomb.png", "image/png", bomb); !errors.Is(err, ErrAttachmentImageTooLarge) {
+		t.Fatalf("expected an oversized image to be rejected before decoding, got %v", err)
+	}
+}
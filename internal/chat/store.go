@@ -0,0 +1,443 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+var ErrStoreFailed = errors.New("chat state could not be persisted")
+
+// Store persists chat state across restarts. The server directory, messages,
+// reactions, and left servers are saved as the full current state for their
+// record type;
+// attachments are saved and retired one at a time so an upload never rewrites
+// every other blob. Load returns nil when nothing is stored.
+type Store interface {
+	LoadServers() ([]StoredServer, error)
+	SaveServers(servers []StoredServer) error
+	LoadMessages() (map[string][]Message, error)
+	SaveMessages(messagesByChannel map[string][]Message) error
+	LoadReactions() ([]StoredReaction, error)
+	SaveReactions(reactions []StoredReaction) error
+	LoadAttachments() ([]StoredAttachment, error)
+	SaveAttachment(attachment StoredAttachment) error
+	// RetireAttachment drops an attachment's content and keeps its id reserved.
+	RetireAttachment(attachmentID string) error
+	LoadLeftServers() (map[string]map[string]time.Time, error)
+	SaveLeftServers(leftServersByUser map[string]map[string]time.Time) error
+}
+
+// StoredServer is a directory entry with its channel groups, including
+// channels created at runtime and their topics.
+type StoredServer struct {
+	Server           ServerDirectoryEntry `json:"server"`
+	ChannelGroups    []ChannelGroup       `json:"channel_groups"`
+	DefaultChannelID string               `json:"default_channel_id,omitempty"`
+}
+
+// StoredReaction is every user who reacted to a message with one emoji.
+type StoredReaction struct {
+	ChannelID string   `json:"channel_id"`
+	MessageID string   `json:"message_id"`
+	Emoji     string   `json:"emoji"`
+	UserUIDs  []string `json:"user_uids"`
+}
+
+// StoredAttachment is an uploaded attachment with its content. Retired
+// attachments carry no content; they are kept so their ids are never reissued.
+type StoredAttachment struct {
+	Metadata  MessageAttachment `json:"metadata"`
+	ChannelID string            `json:"channel_id,omitempty"`
+	MessageID string            `json:"message_id,omitempty"`
+	Content   []byte            `json:"content,omitempty"`
+	Retired   bool              `json:"retired,omitempty"`
+}
+
+// StoreError reports why the configured store could not be loaded. When it is
+// non-nil the service runs from seed data and does not write to the store, so
+// the unreadable data is left untouched.
+func (s *Service) StoreError() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.storeErr
+}
+
+// OrphanedChannels lists the channels whose stored messages were dropped at
+// load because the directory no longer has them.
+func (s *Service) OrphanedChannels() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.orphanedChannelIDs...)
+}
+
+func (s *Service) hydrateLocked(store Store) error {
+	servers, err := store.LoadServers()
+	if err != nil {
+		return fmt.Errorf("load servers: %w", err)
+	}
+	messagesByChannel, err := store.LoadMessages()
+	if err != nil {
+		return fmt.Errorf("load messages: %w", err)
+	}
+	attachments, err := store.LoadAttachments()
+	if err != nil {
+		return fmt.Errorf("load attachments: %w", err)
+	}
+	reactions, err := store.LoadReactions()
+	if err != nil {
+		return fmt.Errorf("load reactions: %w", err)
+	}
+	leftServersByUser, err := store.LoadLeftServers()
+	if err != nil {
+		return fmt.Errorf("load left servers: %w", err)
+	}
+
+	// The directory is restored first so messages can be matched to channels.
+	if servers != nil {
+		s.servers = make([]ServerDirectoryEntry, 0, len(servers))
+		channelGroups := make(map[string][]ChannelGroup, len(servers))
+		s.defaultChannelByID = make(map[string]string)
+		for _, stored := range servers {
+			serverID := stored.Server.ServerID
+			s.servers = append(s.servers, stored.Server)
+			channelGroups[serverID] = stored.ChannelGroups
+			if stored.DefaultChannelID != "" {
+				s.defaultChannelByID[serverID] = stored.DefaultChannelID
+			}
+			if _, ok := s.membersByServer[serverID]; !ok {
+				s.membersByServer[serverID] = []Member{}
+			}
+		}
+		s.channelGroupsByServer = channelGroups
+		s.reindexChannelsLocked()
+	}
+	for channelID := range messagesByChannel {
+		if _, known := s.channelTypeByID[channelID]; !known {
+			s.orphanedChannelIDs = append(s.orphanedChannelIDs, channelID)
+			delete(messagesByChannel, channelID)
+		}
+	}
+	sort.Strings(s.orphanedChannelIDs)
+
+	if len(messagesByChannel) > 0 {
+		s.messagesByChannel = messagesByChannel
+		s.lastSeqByChannel = make(map[string]int64, len(messagesByChannel))
+		for channelID, messages := range messagesByChannel {
+			for _, message := range messages {
+				if message.Seq > s.lastSeqByChannel[channelID] {
+					s.lastSeqByChannel[channelID] = message.Seq
+				}
+			}
+		}
+	}
+	// Attachments whose message is gone or deleted are retired here, so a
+	// retirement the store missed can never bring deleted content back.
+	liveMessages := make(map[messageKey]struct{})
+	for channelID, messages := range messagesByChannel {
+		for _, message := range messages {
+			if !message.Deleted {
+				liveMessages[messageKey{channelID: channelID, messageID: message.ID}] = struct{}{}
+			}
+		}
+	}
+	for _, stored := range attachments {
+		attachmentID := stored.Metadata.AttachmentID
+		_, live := liveMessages[messageKey{channelID: stored.ChannelID, messageID: stored.MessageID}]
+		if stored.Retired || !live {
+			s.retiredAttachments[attachmentID] = struct{}{}
+			continue
+		}
+		digest, shared := s.retainBlobLocked(stored.Content)
+		s.attachmentsByID[attachmentID] = attachmentBlob{
+			metadata:  stored.Metadata,
+			channelID: stored.ChannelID,
+			messageID: stored.MessageID,
+			digest:    digest,
+			content:   shared,
+		}
+	}
+	for _, stored := range reactions {
+		key := messageKey{channelID: stored.ChannelID, messageID: stored.MessageID}
+		if _, live := liveMessages[key]; !live || len(stored.UserUIDs) == 0 {
+			continue
+		}
+		byEmoji := s.reactionsByMessage[key]
+		if byEmoji == nil {
+			byEmoji = make(map[string]map[string]struct{})
+			s.reactionsByMessage[key] = byEmoji
+		}
+		users := make(map[string]struct{}, len(stored.UserUIDs))
+		for _, userUID := range stored.UserUIDs {
+			users[userUID] = struct{}{}
+		}
+		byEmoji[stored.Emoji] = users
+	}
+	if leftServersByUser != nil {
+		s.leftServersByUser = leftServersByUser
+	}
+	return nil
+}
+
+// persistCreatedMessageLocked saves a just-appended message and the
+// attachments it uploaded. On failure the message and its uploads are rolled
+// back so memory never runs ahead of the store.
+func (s *Service) persistCreatedMessageLocked(message Message) error {
+	var err error
+	saved := make([]string, 0, len(message.Attachments))
+	for _, attachment := range message.Attachments {
+		blob, ok := s.attachmentsByID[attachment.AttachmentID]
+		if !ok || blob.messageID != message.ID {
+			continue
+		}
+		if err = s.persistAttachmentLocked(attachment.AttachmentID, blob); err != nil {
+			break
+		}
+		saved = append(saved, attachment.AttachmentID)
+	}
+	if err == nil {
+		err = s.persistMessagesLocked()
+	}
+	if err == nil {
+		return nil
+	}
+
+	messages := s.messagesByChannel[message.ChannelID]
+	s.messagesByChannel[message.ChannelID] = messages[:len(messages)-1]
+	s.lastSeqByChannel[message.ChannelID]--
+	for attachmentID, blob := range s.attachmentsByID {
+		if blob.messageID == message.ID {
+			s.releaseBlobLocked(blob.digest)
+			delete(s.attachmentsByID, attachmentID)
+		}
+	}
+	// Best effort: hydrate retires attachments without a stored message anyway.
+	for _, attachmentID := range saved {
+		_ = s.store.RetireAttachment(attachmentID)
+	}
+	return err
+}
+
+// channelSnapshot is the state a channel mutation may touch, kept so the
+// mutation can be undone when the store rejects it.
+type channelSnapshot struct {
+	channelID   string
+	messages    []Message
+	reactions   map[messageKey]map[string]map[string]struct{}
+	revisions   map[messageKey][]MessageRevision
+	attachments map[string]attachmentBlob
+}
+
+func (s *Service) snapshotChannelLocked(channelID string) channelSnapshot {
+	snap := channelSnapshot{
+		channelID:   channelID,
+		messages:    cloneMessages(s.messagesByChannel[channelID]),
+		reactions:   make(map[messageKey]map[string]map[string]struct{}),
+		revisions:   make(map[messageKey][]MessageRevision),
+		attachments: make(map[string]attachmentBlob),
+	}
+	for key, byEmoji := range s.reactionsByMessage {
+		if key.channelID != channelID {
+			continue
+		}
+		copied := make(map[string]map[string]struct{}, len(byEmoji))
+		for emoji, users := range byEmoji {
+			copied[emoji] = make(map[string]struct{}, len(users))
+			for userUID := range users {
+				copied[emoji][userUID] = struct{}{}
+			}
+		}
+		snap.reactions[key] = copied
+	}
+	for key, revisions := range s.revisionsByMessage {
+		if key.channelID == channelID {
+			snap.revisions[key] = append([]MessageRevision(nil), revisions...)
+		}
+	}
+	for attachmentID, blob := range s.attachmentsByID {
+		if blob.channelID == channelID {
+			snap.attachments[attachmentID] = blob
+		}
+	}
+	return snap
+}
+
+func (s *Service) restoreChannelLocked(snap channelSnapshot) {
+	s.messagesByChannel[snap.channelID] = snap.messages
+	for key := range s.reactionsByMessage {
+		if key.channelID == snap.channelID {
+			delete(s.reactionsByMessage, key)
+		}
+	}
+	for key, byEmoji := range snap.reactions {
+		s.reactionsByMessage[key] = byEmoji
+	}
+	for key := range s.revisionsByMessage {
+		if key.channelID == snap.channelID {
+			delete(s.revisionsByMessage, key)
+		}
+	}
+	for key, revisions := range snap.revisions {
+		s.revisionsByMessage[key] = revisions
+	}
+	for attachmentID, blob := range snap.attachments {
+		if _, live := s.attachmentsByID[attachmentID]; live {
+			continue
+		}
+		blob.digest, blob.content = s.retainBlobLocked(blob.content)
+		s.attachmentsByID[attachmentID] = blob
+		delete(s.retiredAttachments, attachmentID)
+	}
+}
+
+// commitChannelLocked persists a mutation of the snapshotted channel, or
+// restores the snapshot when the store rejects it. Attachments the mutation
+// retired are then retired in the store too.
+func (s *Service) commitChannelLocked(snap channelSnapshot) error {
+	err := s.persistMessagesLocked()
+	if err == nil {
+		err = s.persistReactionsLocked()
+	}
+	if err != nil {
+		s.restoreChannelLocked(snap)
+		return err
+	}
+	if s.store == nil {
+		return nil
+	}
+	for attachmentID := range snap.attachments {
+		if _, live := s.attachmentsByID[attachmentID]; !live {
+			// Best effort: hydrate retires attachments of deleted messages anyway.
+			_ = s.store.RetireAttachment(attachmentID)
+		}
+	}
+	return nil
+}
+
+// directorySnapshot is the server directory as it was before a mutation, kept
+// so the mutation can be undone when the store rejects it.
+type directorySnapshot struct {
+	servers         []ServerDirectoryEntry
+	channelGroups   map[string][]ChannelGroup
+	defaultChannels map[string]string
+}
+
+func (s *Service) snapshotDirectoryLocked() directorySnapshot {
+	snap := directorySnapshot{
+		servers:         append([]ServerDirectoryEntry(nil), s.servers...),
+		channelGroups:   make(map[string][]ChannelGroup, len(s.channelGroupsByServer)),
+		defaultChannels: make(map[string]string, len(s.defaultChannelByID)),
+	}
+	for serverID, groups := range s.channelGroupsByServer {
+		snap.channelGroups[serverID] = cloneGroups(groups)
+	}
+	for serverID, channelID := range s.defaultChannelByID {
+		snap.defaultChannels[serverID] = channelID
+	}
+	return snap
+}
+
+// commitDirectoryLocked persists the directory, or restores the snapshot when
+// the store rejects it.
+func (s *Service) commitDirectoryLocked(snap directorySnapshot) error {
+	err := s.persistServersLocked()
+	if err == nil {
+		return nil
+	}
+	for serverID := range s.channelGroupsByServer {
+		if _, kept := snap.channelGroups[serverID]; !kept {
+			delete(s.membersByServer, serverID)
+		}
+	}
+	s.servers = snap.servers
+	s.channelGroupsByServer = snap.channelGroups
+	s.defaultChannelByID = snap.defaultChannels
+	s.reindexChannelsLocked()
+	for channelID, messages := range s.messagesByChannel {
+		if _, known := s.channelTypeByID[channelID]; !known && len(messages) == 0 {
+			delete(s.messagesByChannel, channelID)
+		}
+	}
+	return err
+}
+
+func (s *Service) persistServersLocked() error {
+	if s.store == nil {
+		return nil
+	}
+	servers := make([]StoredServer, 0, len(s.servers))
+	for _, entry := range s.servers {
+		servers = append(servers, StoredServer{
+			Server:           entry,
+			ChannelGroups:    s.channelGroupsByServer[entry.ServerID],
+			DefaultChannelID: s.defaultChannelByID[entry.ServerID],
+		})
+	}
+	if err := s.store.SaveServers(servers); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+	return nil
+}
+
+func (s *Service) persistMessagesLocked() error {
+	if s.store == nil {
+		return nil
+	}
+	if err := s.store.SaveMessages(s.messagesByChannel); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+	return nil
+}
+
+func (s *Service) persistReactionsLocked() error {
+	if s.store == nil {
+		return nil
+	}
+	reactions := make([]StoredReaction, 0, len(s.reactionsByMessage))
+	for key, byEmoji := range s.reactionsByMessage {
+		for emoji, users := range byEmoji {
+			userUIDs := make([]string, 0, len(users))
+			for userUID := range users {
+				userUIDs = append(userUIDs, userUID)
+			}
+			sort.Strings(userUIDs)
+			reactions = append(reactions, StoredReaction{
+				ChannelID: key.channelID,
+				MessageID: key.messageID,
+				Emoji:     emoji,
+				UserUIDs:  userUIDs,
+			})
+		}
+	}
+	if err := s.store.SaveReactions(reactions); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+	return nil
+}
+
+func (s *Service) persistAttachmentLocked(attachmentID string, blob attachmentBlob) error {
+	if s.store == nil {
+		return nil
+	}
+	err := s.store.SaveAttachment(StoredAttachment{
+		Metadata:  blob.metadata,
+		ChannelID: blob.channelID,
+		MessageID: blob.messageID,
+		Content:   blob.content,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: attachment %s: %v", ErrStoreFailed, attachmentID, err)
+	}
+	return nil
+}
+
+func (s *Service) persistLeftServersLocked() error {
+	if s.store == nil {
+		return nil
+	}
+	if err := s.store.SaveLeftServers(s.leftServersByUser); err != nil {
+		return fmt.Errorf("%w: %v", ErrStoreFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const MaxChannelTopicRunes = 256
+
+var ErrChannelTopicTooLong = errors.New("channel topic is too long")
+
+// SetChannelTopic replaces a channel's topic line; an empty topic clears it.
+// Only moderators of the channel's server may change it.
+func (s *Service) SetChannelTopic(channelID string, topic string, requesterUID string) (Channel, error) {
+	topic = strings.TrimSpace(topic)
+	if utf8.RuneCountInString(topic) > MaxChannelTopicRunes {
+		return Channel{}, ErrChannelTopicTooLong
+	}
+
+	s.mu.Lock()
+	serverID, ok := s.channelServerByID[channelID]
+	if !ok {
+		s.mu.Unlock()
+		return Channel{}, fmt.Errorf("%w: %s", ErrChannelNotFound, channelID)
+	}
+	if !s.hasRoleLocked(serverID, requesterUID, RoleModerator) {
+		s.mu.Unlock()
+		return Channel{}, ErrModeratorRequired
+	}
+	snap := s.snapshotDirectoryLocked()
+	var updated Channel
+	groups := s.channelGroupsByServer[serverID]
+	for groupIdx := range groups {
+		for channelIdx := range groups[groupIdx].Channels {
+			if channel := &groups[groupIdx].Channels[channelIdx]; channel.ID == channelID {
+				channel.Topic = topic
+				updated = *channel
+			}
+		}
+	}
+	if err := s.commitDirectoryLocked(snap); err != nil {
+		s.mu.Unlock()
+		return Channel{}, err
+	}
+	broadcaster := s.broadcaster
+	s.mu.Unlock()
+
+	if broadcaster != nil {
+		broadcaster.BroadcastChannelTopicUpdated(channelID, topic, requesterUID)
+	}
+	return updated, nil
+}
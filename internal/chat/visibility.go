@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+)
+
+type MessageVisibility string
+
+const (
+	MessageVisibilityEveryone  MessageVisibility = "everyone"
+	MessageVisibilityEphemeral MessageVisibility = "ephemeral"
+)
+
+const MaxEphemeralRecipients = 25
+
+var (
+	ErrMessageVisibilityInvalid = errors.New("message visibility must be everyone or ephemeral")
+	ErrVisibleToInvalid         = errors.New("visible_to is invalid")
+	// ErrEphemeralAttachments rejects uploads on ephemeral messages, which are
+	// never stored and so could not keep their attachments either.
+	ErrEphemeralAttachments = errors.New("ephemeral messages cannot carry uploads")
+)
+
+// IsEphemeral reports whether the message is only delivered to VisibleTo.
+func (m Message) IsEphemeral() bool {
+	return m.Visibility == MessageVisibilityEphemeral
+}
+
+// VisibleToUser reports whether userUID may see the message. Ephemeral
+// messages are visible to their recipients and to the author.
+func (m Message) VisibleToUser(userUID string) bool {
+	if !m.IsEphemeral() || m.AuthorUID == userUID {
+		return true
+	}
+	for _, uid := range m.VisibleTo {
+		if uid == userUID {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeVisibilityLocked validates the requested visibility and returns the
+// deduplicated recipient list. Every recipient must be able to read channelID.
+func (s *Service) normalizeVisibilityLocked(channelID string, visibility MessageVisibility, visibleTo []string) (MessageVisibility, []string, error) {
+	visibility = MessageVisibility(strings.ToLower(strings.TrimSpace(string(visibility))))
+	switch visibility {
+	case "", MessageVisibilityEveryone:
+		if len(visibleTo) > 0 {
+			return "", nil, ErrVisibleToInvalid
+		}
+		return "", nil, nil
+	case MessageVisibilityEphemeral:
+	default:
+		return "", nil, ErrMessageVisibilityInvalid
+	}
+
+	seen := make(map[string]struct{}, len(visibleTo))
+	recipients := make([]string, 0, len(visibleTo))
+	for _, uid := range visibleTo {
+		uid = strings.TrimSpace(uid)
+		if uid == "" || !s.canReadChannelLocked(channelID, uid) {
+			return "", nil, ErrVisibleToInvalid
+		}
+		if _, dup := seen[uid]; dup {
+			continue
+		}
+		seen[uid] = struct{}{}
+		recipients = append(recipients, uid)
+	}
+	if len(recipients) == 0 || len(recipients) > MaxEphemeralRecipients {
+		return "", nil, ErrVisibleToInvalid
+	}
+	return visibility, recipients, nil
+}
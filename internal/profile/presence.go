@@ -0,0 +1,77 @@
+package profile
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type Presence string
+
+const (
+	PresenceOnline    Presence = "online"
+	PresenceIdle      Presence = "idle"
+	PresenceDND       Presence = "dnd"
+	PresenceOffline   Presence = "offline"
+	PresenceInvisible Presence = "invisible"
+)
+
+const MaxStatusTextRunes = 100
+
+var (
+	ErrPresenceInvalid   = errors.New("presence is invalid")
+	ErrStatusTextTooLong = errors.New("status text is too long")
+)
+
+func (p Presence) valid() bool {
+	switch p {
+	case PresenceOnline, PresenceIdle, PresenceDND, PresenceOffline, PresenceInvisible:
+		return true
+	}
+	return false
+}
+
+// SetPresence replaces the user's presence and status text. Presence is not
+// part of the versioned profile: it leaves profile_version alone so frequent
+// status changes never conflict with If-Match profile edits.
+func (s *Service) SetPresence(userUID string, presence Presence, statusText string) (CanonicalProfile, error) {
+	userUID = normalizeUID(userUID)
+	if userUID == "" {
+		return CanonicalProfile{}, ErrDisplayNameInvalid
+	}
+	presence = Presence(strings.ToLower(strings.TrimSpace(string(presence))))
+	if !presence.valid() {
+		return CanonicalProfile{}, ErrPresenceInvalid
+	}
+	statusText = strings.TrimSpace(statusText)
+	if utf8.RuneCountInString(statusText) > MaxStatusTextRunes {
+		return CanonicalProfile{}, ErrStatusTextTooLong
+	}
+
+	s.mu.Lock()
+	profile := s.getOrCreateLocked(userUID)
+	profile.Presence = presence
+	profile.StatusText = statusText
+	profile.PresenceUpdatedAt = s.now().UTC().Format(time.RFC3339)
+	s.profilesByUID[userUID] = profile
+	broadcaster := s.broadcaster
+	updated := cloneProfile(profile)
+	s.mu.Unlock()
+
+	if broadcaster != nil {
+		broadcaster.BroadcastPresenceUpdated(updated)
+	}
+	return updated, nil
+}
+
+// VisibleTo returns the profile as viewerUID should see it: an invisible
+// user appears offline, without a status, to everyone but themselves.
+func (p CanonicalProfile) VisibleTo(viewerUID string) CanonicalProfile {
+	if p.Presence != PresenceInvisible || strings.TrimSpace(viewerUID) == p.UserUID {
+		return p
+	}
+	p.Presence = PresenceOffline
+	p.StatusText = ""
+	return p
+}
@@ -0,0 +1,145 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const presetAvatarSize = 128
+
+// defaultPresetImageID names the configured image served for presets that
+// have no image of their own.
+const defaultPresetImageID = "default"
+
+type presetImage struct {
+	contentType string
+	content     []byte
+}
+
+type presetPalette struct {
+	from   string
+	to     string
+	accent string
+}
+
+var presetPalettes = map[string]presetPalette{
+	"horizon": {from: "#F59E0B", to: "#EF4444", accent: "#FEF3C7"},
+	"reef":    {from: "#06B6D4", to: "#3B82F6", accent: "#CFFAFE"},
+	"mint":    {from: "#34D399", to: "#059669", accent: "#D1FAE5"},
+	"ember":   {from: "#F97316", to: "#B91C1C", accent: "#FFEDD5"},
+	"violet":  {from: "#A78BFA", to: "#6D28D9", accent: "#EDE9FE"},
+	"slate":   {from: "#94A3B8", to: "#334155", accent: "#F1F5F9"},
+}
+
+// LoadPresetAvatarDir replaces the generated SVG for a preset with the image
+// file named after it (reef.png, mint.webp, ...); default.<ext> covers every
+// preset without its own file. Files that fail validation are skipped and
+// reported in the returned error.
+func (s *Service) LoadPresetAvatarDir(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	loaded := 0
+	var errs []error
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		ext := filepath.Ext(entry.Name())
+		presetID := strings.TrimSuffix(entry.Name(), ext)
+		if err := s.setPresetImage(presetID, ext, content); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", entry.Name(), err))
+			continue
+		}
+		loaded++
+	}
+	return loaded, errors.Join(errs...)
+}
+
+func (s *Service) setPresetImage(presetID string, ext string, content []byte) error {
+	if _, ok := s.allowedAvatarPresets[presetID]; !ok && presetID != defaultPresetImageID {
+		return ErrAvatarPresetInvalid
+	}
+	if len(content) == 0 || len(content) > s.maxUploadBytes {
+		return ErrAvatarTooLarge
+	}
+	contentType := "image/svg+xml"
+	if !strings.EqualFold(ext, ".svg") {
+		contentType = normalizeContentType("", content)
+		if _, ok := s.allowedMimeTypes[contentType]; !ok {
+			return ErrAvatarTypeUnsupported
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.presetImages[presetID] = presetImage{contentType: contentType, content: append([]byte(nil), content...)}
+	return nil
+}
+
+// PresetAvatar returns the image served for a generated-mode preset: the
+// configured image for it, else the configured default, else generated SVG.
+func (s *Service) PresetAvatar(presetID string) (string, []byte, error) {
+	presetID = strings.TrimSpace(presetID)
+	if _, ok := s.allowedAvatarPresets[presetID]; !ok {
+		return "", nil, ErrAvatarPresetInvalid
+	}
+
+	s.mu.RLock()
+	image, ok := s.presetImages[presetID]
+	if !ok {
+		image, ok = s.presetImages[defaultPresetImageID]
+	}
+	s.mu.RUnlock()
+	if ok {
+		return image.contentType, append([]byte(nil), image.content...), nil
+	}
+
+	content, err := s.PresetAvatarSVG(presetID)
+	return "image/svg+xml", content, err
+}
+
+func (s *Service) presetAvatarURL(presetID string) string {
+	if s.publicBaseURL == "" {
+		return fmt.Sprintf("/v1/profile/avatar/preset/%s", presetID)
+	}
+	return fmt.Sprintf("%s/v1/profile/avatar/preset/%s", s.publicBaseURL, presetID)
+}
+
+func (s *Service) PresetAvatarSVG(presetID string) ([]byte, error) {
+	presetID = strings.TrimSpace(presetID)
+	if _, ok := s.allowedAvatarPresets[presetID]; !ok {
+		return nil, ErrAvatarPresetInvalid
+	}
+	palette, ok := presetPalettes[presetID]
+	if !ok {
+		palette = presetPalettes["slate"]
+	}
+
+	hasher := fnv.New32a()
+	_, _ = hasher.Write([]byte(presetID))
+	seed := hasher.Sum32()
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, presetAvatarSize, presetAvatarSize, presetAvatarSize, presetAvatarSize)
+	fmt.Fprintf(&b, `<defs><linearGradient id="bg" x1="0" y1="0" x2="1" y2="1"><stop offset="0" stop-color="%s"/><stop offset="1" stop-color="%s"/></linearGradient></defs>`, palette.from, palette.to)
+	fmt.Fprintf(&b, `<rect width="%d" height="%d" fill="url(#bg)"/>`, presetAvatarSize, presetAvatarSize)
+	for idx := 0; idx < 3; idx++ {
+		cx := 20 + int((seed>>(idx*8))%88)
+		cy := 20 + int((seed>>(idx*8+4))%88)
+		radius := 10 + int((seed>>(idx*5))%18)
+		fmt.Fprintf(&b, `<circle cx="%d" cy="%d" r="%d" fill="%s" fill-opacity="0.35"/>`, cx, cy, radius, palette.accent)
+	}
+	b.WriteString(`</svg>`)
+	return []byte(b.String()), nil
+}
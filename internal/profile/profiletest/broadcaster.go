@@ -0,0 +1,60 @@
+// Package profiletest provides helpers for tests that exercise
+// profile.Service without a realtime hub.
+package profiletest
+
+import (
+	"sync"
+
+	"github.com/openchat/openchat-backend/internal/profile"
+)
+
+type AvatarReady struct {
+	UserUID string
+	Asset   profile.AvatarAsset
+}
+
+// RecordingBroadcaster captures everything profile.Service would have broadcast.
+type RecordingBroadcaster struct {
+	mu           sync.Mutex
+	profiles     []profile.CanonicalProfile
+	avatarsReady []AvatarReady
+	presences    []profile.CanonicalProfile
+}
+
+var _ profile.Broadcaster = (*RecordingBroadcaster)(nil)
+
+func (b *RecordingBroadcaster) BroadcastProfileUpdated(updated profile.CanonicalProfile) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.profiles = append(b.profiles, updated)
+}
+
+func (b *RecordingBroadcaster) BroadcastAvatarReady(userUID string, asset profile.AvatarAsset) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.avatarsReady = append(b.avatarsReady, AvatarReady{UserUID: userUID, Asset: asset})
+}
+
+func (b *RecordingBroadcaster) BroadcastPresenceUpdated(updated profile.CanonicalProfile) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.presences = append(b.presences, updated)
+}
+
+func (b *RecordingBroadcaster) ProfileUpdates() []profile.CanonicalProfile {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]profile.CanonicalProfile(nil), b.profiles...)
+}
+
+func (b *RecordingBroadcaster) AvatarsReady() []AvatarReady {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]AvatarReady(nil), b.avatarsReady...)
+}
+
+func (b *RecordingBroadcaster) PresenceUpdates() []profile.CanonicalProfile {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]profile.CanonicalProfile(nil), b.presences...)
+}
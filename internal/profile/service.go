@@ -9,12 +9,17 @@ import (
 	_ "image/png"
 	"net/http"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	_ "golang.org/x/image/webp"
+
+	"github.com/openchat/openchat-backend/internal/chat"
 )
 
 type AvatarMode string
@@ -26,13 +31,23 @@ const (
 
 var (
 	ErrDisplayNameInvalid    = errors.New("display name is invalid")
+	ErrDisplayNameReserved   = errors.New("display name contains a reserved word")
 	ErrAvatarModeUnsupported = errors.New("avatar mode unsupported")
 	ErrAvatarPresetInvalid   = errors.New("avatar preset invalid")
 	ErrAvatarAssetNotFound   = errors.New("avatar asset not found")
 	ErrAvatarTypeUnsupported = errors.New("avatar type unsupported")
 	ErrAvatarTooLarge        = errors.New("avatar too large")
 	ErrAvatarDimensions      = errors.New("avatar dimensions exceeded")
+	ErrAvatarLimitReached    = errors.New("avatar asset limit reached")
 	ErrProfileConflict       = errors.New("profile conflict")
+	ErrDisplayNameCooldown   = errors.New("display name was changed too recently")
+	ErrBioTooLong            = errors.New("bio is too long")
+	ErrPronounsTooLong       = errors.New("pronouns are too long")
+)
+
+const (
+	MaxBioRunes      = 300
+	MaxPronounsRunes = 40
 )
 
 var displayNamePattern = regexp.MustCompile(`^[\p{L}\p{N} ._\-]+$`)
@@ -44,8 +59,15 @@ type CanonicalProfile struct {
 	AvatarPresetID *string    `json:"avatar_preset_id"`
 	AvatarAssetID  *string    `json:"avatar_asset_id"`
 	AvatarURL      *string    `json:"avatar_url"`
+	Bio            string     `json:"bio,omitempty"`
+	Pronouns       string     `json:"pronouns,omitempty"`
+	Presence       Presence   `json:"presence"`
+	StatusText     string     `json:"status_text,omitempty"`
 	ProfileVersion int        `json:"profile_version"`
+	CreatedAt      string     `json:"created_at"`
 	UpdatedAt      string     `json:"updated_at"`
+	// PresenceUpdatedAt is empty until SetPresence is first called.
+	PresenceUpdatedAt string `json:"presence_updated_at,omitempty"`
 }
 
 type AvatarAsset struct {
@@ -62,10 +84,15 @@ type UpdateInput struct {
 	AvatarMode    AvatarMode
 	AvatarPreset  string
 	AvatarAssetID string
+	// Bio and Pronouns replace the stored values; empty clears them.
+	Bio      string
+	Pronouns string
 }
 
 type Broadcaster interface {
 	BroadcastProfileUpdated(profile CanonicalProfile)
+	BroadcastAvatarReady(userUID string, asset AvatarAsset)
+	BroadcastPresenceUpdated(profile CanonicalProfile)
 }
 
 type Service struct {
@@ -74,17 +101,24 @@ type Service struct {
 	publicBaseURL string
 	serverID      string
 
-	displayNameMin int
-	displayNameMax int
-	maxUploadBytes int
-	maxImageWidth  int
-	maxImageHeight int
+	displayNameMin   int
+	displayNameMax   int
+	maxUploadBytes   int
+	maxImageWidth    int
+	maxImageHeight   int
+	maxAssetsPerUser int
+	reservedWords    []string
+	nameCooldown     time.Duration
+	now              func() time.Time
 
 	allowedAvatarPresets map[string]struct{}
 	allowedMimeTypes     map[string]struct{}
+	presetImages         map[string]presetImage
 
-	profilesByUID map[string]CanonicalProfile
-	avatarsByID   map[string]avatarBlob
+	profilesByUID  map[string]CanonicalProfile
+	avatarsByID    map[string]avatarBlob
+	avatarIDsByUID map[string][]string
+	nameChangedAt  map[string]time.Time
 
 	broadcaster Broadcaster
 }
@@ -94,9 +128,25 @@ type avatarBlob struct {
 	content  []byte
 }
 
+type Options struct {
+	MaxAvatarAssetsPerUser int
+	ReservedNameWords      []string
+	// DisplayNameCooldown is the minimum gap between display-name changes; zero disables it.
+	DisplayNameCooldown time.Duration
+	Now                 func() time.Time
+}
+
 var defaultPresets = []string{"horizon", "reef", "mint", "ember", "violet", "slate"}
 
-func NewService(publicBaseURL string, serverID string) *Service {
+func NewService(publicBaseURL string, serverID string, opts Options) *Service {
+	maxAssetsPerUser := opts.MaxAvatarAssetsPerUser
+	if maxAssetsPerUser <= 0 {
+		maxAssetsPerUser = 10
+	}
+	now := opts.Now
+	if now == nil {
+		now = time.Now
+	}
 	presets := map[string]struct{}{}
 	for _, preset := range defaultPresets {
 		presets[preset] = struct{}{}
@@ -110,10 +160,17 @@ func NewService(publicBaseURL string, serverID string) *Service {
 		maxUploadBytes:       2 * 1024 * 1024,
 		maxImageWidth:        1024,
 		maxImageHeight:       1024,
+		maxAssetsPerUser:     maxAssetsPerUser,
+		reservedWords:        normalizeReservedWords(opts.ReservedNameWords),
+		nameCooldown:         opts.DisplayNameCooldown,
+		now:                  now,
 		allowedAvatarPresets: presets,
-		allowedMimeTypes:     map[string]struct{}{"image/png": {}, "image/jpeg": {}},
+		allowedMimeTypes:     map[string]struct{}{"image/png": {}, "image/jpeg": {}, "image/webp": {}},
+		presetImages:         make(map[string]presetImage),
 		profilesByUID:        make(map[string]CanonicalProfile),
 		avatarsByID:          make(map[string]avatarBlob),
+		avatarIDsByUID:       make(map[string][]string),
+		nameChangedAt:        make(map[string]time.Time),
 		broadcaster:          nil,
 	}
 }
@@ -145,6 +202,18 @@ func (s *Service) AllowedAvatarModes() []string {
 	return []string{string(AvatarModeGenerated), string(AvatarModeUploaded)}
 }
 
+// Get returns the user's stored profile without creating one.
+func (s *Service) Get(userUID string) (CanonicalProfile, bool) {
+	userUID = normalizeUID(userUID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	profile, ok := s.profilesByUID[userUID]
+	if !ok {
+		return CanonicalProfile{}, false
+	}
+	return cloneProfile(profile), true
+}
+
 func (s *Service) GetOrCreate(userUID string) CanonicalProfile {
 	userUID = normalizeUID(userUID)
 	s.mu.Lock()
@@ -153,6 +222,15 @@ func (s *Service) GetOrCreate(userUID string) CanonicalProfile {
 	return cloneProfile(profile)
 }
 
+// Exists reports whether a profile has been stored for the user.
+func (s *Service) Exists(userUID string) bool {
+	userUID = normalizeUID(userUID)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.profilesByUID[userUID]
+	return ok
+}
+
 func (s *Service) BatchGet(userUIDs []string) []CanonicalProfile {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -173,7 +251,8 @@ func (s *Service) BatchGet(userUIDs []string) []CanonicalProfile {
 	return out
 }
 
-func (s *Service) UploadAvatar(contentType string, data []byte) (AvatarAsset, error) {
+func (s *Service) UploadAvatar(userUID string, contentType string, data []byte) (AvatarAsset, error) {
+	userUID = normalizeUID(userUID)
 	contentType = normalizeContentType(contentType, data)
 	if _, ok := s.allowedMimeTypes[contentType]; !ok {
 		return AvatarAsset{}, ErrAvatarTypeUnsupported
@@ -200,14 +279,52 @@ func (s *Service) UploadAvatar(contentType string, data []byte) (AvatarAsset, er
 		ContentType:   contentType,
 		Bytes:         len(data),
 	}
+	if err := s.storeAvatar(userUID, asset, data); err != nil {
+		return AvatarAsset{}, err
+	}
 
+	s.mu.RLock()
+	broadcaster := s.broadcaster
+	s.mu.RUnlock()
+	if broadcaster != nil {
+		broadcaster.BroadcastAvatarReady(userUID, asset)
+	}
+	return asset, nil
+}
+
+func (s *Service) storeAvatar(userUID string, asset AvatarAsset, data []byte) error {
 	s.mu.Lock()
-	s.avatarsByID[assetID] = avatarBlob{
+	defer s.mu.Unlock()
+	owned := s.avatarIDsByUID[userUID]
+	if len(owned) >= s.maxAssetsPerUser {
+		evictIdx := -1
+		for idx, ownedID := range owned {
+			if !s.avatarReferencedLocked(ownedID) {
+				evictIdx = idx
+				break
+			}
+		}
+		if evictIdx < 0 {
+			return ErrAvatarLimitReached
+		}
+		delete(s.avatarsByID, owned[evictIdx])
+		owned = append(owned[:evictIdx:evictIdx], owned[evictIdx+1:]...)
+	}
+	s.avatarIDsByUID[userUID] = append(owned, asset.AvatarAssetID)
+	s.avatarsByID[asset.AvatarAssetID] = avatarBlob{
 		metadata: asset,
 		content:  append([]byte(nil), data...),
 	}
-	s.mu.Unlock()
-	return asset, nil
+	return nil
+}
+
+func (s *Service) avatarReferencedLocked(assetID string) bool {
+	for _, profile := range s.profilesByUID {
+		if profile.AvatarAssetID != nil && *profile.AvatarAssetID == assetID {
+			return true
+		}
+	}
+	return false
 }
 
 func (s *Service) AvatarContent(assetID string) (AvatarAsset, []byte, error) {
@@ -225,6 +342,19 @@ func (s *Service) AvatarContent(assetID string) (AvatarAsset, []byte, error) {
 	return blob.metadata, append([]byte(nil), blob.content...), nil
 }
 
+// AvatarStorageStats reports avatars in the attachment stats shape; avatars
+// are not deduplicated, so each one is its own blob.
+func (s *Service) AvatarStorageStats() chat.StorageStats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := chat.StorageStats{Count: len(s.avatarsByID), Blobs: len(s.avatarsByID)}
+	for _, blob := range s.avatarsByID {
+		stats.Bytes += int64(len(blob.content))
+	}
+	return stats
+}
+
 func (s *Service) Update(userUID string, input UpdateInput, expectedVersion *int) (CanonicalProfile, error) {
 	userUID = normalizeUID(userUID)
 	if userUID == "" {
@@ -235,6 +365,14 @@ func (s *Service) Update(userUID string, input UpdateInput, expectedVersion *int
 	if err := s.validateDisplayName(displayName); err != nil {
 		return CanonicalProfile{}, err
 	}
+	bio := strings.TrimSpace(input.Bio)
+	if utf8.RuneCountInString(bio) > MaxBioRunes {
+		return CanonicalProfile{}, ErrBioTooLong
+	}
+	pronouns := strings.TrimSpace(input.Pronouns)
+	if utf8.RuneCountInString(pronouns) > MaxPronounsRunes {
+		return CanonicalProfile{}, ErrPronounsTooLong
+	}
 
 	s.mu.Lock()
 	profile := s.getOrCreateLocked(userUID)
@@ -244,7 +382,18 @@ func (s *Service) Update(userUID string, input UpdateInput, expectedVersion *int
 		return CanonicalProfile{}, ErrProfileConflict
 	}
 
+	now := s.now().UTC()
+	nameChanged := displayName != profile.DisplayName
+	if nameChanged && s.nameCooldown > 0 {
+		if changedAt, ok := s.nameChangedAt[userUID]; ok && now.Sub(changedAt) < s.nameCooldown {
+			s.mu.Unlock()
+			return CanonicalProfile{}, fmt.Errorf("%w: retry after %s", ErrDisplayNameCooldown, changedAt.Add(s.nameCooldown).Format(time.RFC3339))
+		}
+	}
+
 	profile.DisplayName = displayName
+	profile.Bio = bio
+	profile.Pronouns = pronouns
 	profile.AvatarMode = input.AvatarMode
 	switch input.AvatarMode {
 	case AvatarModeGenerated:
@@ -255,7 +404,7 @@ func (s *Service) Update(userUID string, input UpdateInput, expectedVersion *int
 		}
 		profile.AvatarPresetID = strPtr(preset)
 		profile.AvatarAssetID = nil
-		profile.AvatarURL = nil
+		profile.AvatarURL = strPtr(s.presetAvatarURL(preset))
 	case AvatarModeUploaded:
 		assetID := strings.TrimSpace(input.AvatarAssetID)
 		blob, ok := s.avatarsByID[assetID]
@@ -271,9 +420,44 @@ func (s *Service) Update(userUID string, input UpdateInput, expectedVersion *int
 		return CanonicalProfile{}, ErrAvatarModeUnsupported
 	}
 
+	if nameChanged {
+		s.nameChangedAt[userUID] = now
+	}
+	profile.ProfileVersion++
+	profile.UpdatedAt = now.Format(time.RFC3339)
+	s.profilesByUID[userUID] = profile
+	broadcaster := s.broadcaster
+	updated := cloneProfile(profile)
+	s.mu.Unlock()
+
+	if broadcaster != nil {
+		broadcaster.BroadcastProfileUpdated(updated)
+	}
+	return updated, nil
+}
+
+// ClearAvatar reverts the user to their default generated avatar and drops the
+// previously uploaded asset once nothing references it.
+func (s *Service) ClearAvatar(userUID string) (CanonicalProfile, error) {
+	userUID = normalizeUID(userUID)
+	if userUID == "" {
+		return CanonicalProfile{}, ErrDisplayNameInvalid
+	}
+
+	s.mu.Lock()
+	profile := s.getOrCreateLocked(userUID)
+	previousAssetID := profile.AvatarAssetID
+	presetID := defaultPresetForUID(userUID)
+	profile.AvatarMode = AvatarModeGenerated
+	profile.AvatarPresetID = strPtr(presetID)
+	profile.AvatarAssetID = nil
+	profile.AvatarURL = strPtr(s.presetAvatarURL(presetID))
 	profile.ProfileVersion++
-	profile.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	profile.UpdatedAt = s.now().UTC().Format(time.RFC3339)
 	s.profilesByUID[userUID] = profile
+	if previousAssetID != nil && !s.avatarReferencedLocked(*previousAssetID) {
+		s.deleteAvatarLocked(*previousAssetID)
+	}
 	broadcaster := s.broadcaster
 	updated := cloneProfile(profile)
 	s.mu.Unlock()
@@ -284,6 +468,15 @@ func (s *Service) Update(userUID string, input UpdateInput, expectedVersion *int
 	return updated, nil
 }
 
+func (s *Service) deleteAvatarLocked(assetID string) {
+	delete(s.avatarsByID, assetID)
+	for ownerUID, owned := range s.avatarIDsByUID {
+		if idx := slices.Index(owned, assetID); idx >= 0 {
+			s.avatarIDsByUID[ownerUID] = slices.Delete(owned, idx, idx+1)
+		}
+	}
+}
+
 func (s *Service) getOrCreateLocked(userUID string) CanonicalProfile {
 	profile, exists := s.profilesByUID[userUID]
 	if exists {
@@ -291,15 +484,17 @@ func (s *Service) getOrCreateLocked(userUID string) CanonicalProfile {
 	}
 
 	presetID := defaultPresetForUID(userUID)
-	now := time.Now().UTC().Format(time.RFC3339)
+	now := s.now().UTC().Format(time.RFC3339)
 	profile = CanonicalProfile{
 		UserUID:        userUID,
 		DisplayName:    defaultDisplayName(userUID),
 		AvatarMode:     AvatarModeGenerated,
 		AvatarPresetID: strPtr(presetID),
 		AvatarAssetID:  nil,
-		AvatarURL:      nil,
+		AvatarURL:      strPtr(s.presetAvatarURL(presetID)),
+		Presence:       PresenceOnline,
 		ProfileVersion: 1,
+		CreatedAt:      now,
 		UpdatedAt:      now,
 	}
 	s.profilesByUID[userUID] = profile
@@ -314,9 +509,25 @@ func (s *Service) validateDisplayName(displayName string) error {
 	if !displayNamePattern.MatchString(displayName) {
 		return ErrDisplayNameInvalid
 	}
+	lowered := strings.ToLower(displayName)
+	for _, word := range s.reservedWords {
+		if strings.Contains(lowered, word) {
+			return ErrDisplayNameReserved
+		}
+	}
 	return nil
 }
 
+func normalizeReservedWords(words []string) []string {
+	out := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			out = append(out, word)
+		}
+	}
+	return out
+}
+
 func (s *Service) avatarAssetURL(assetID string) string {
 	if s.publicBaseURL == "" {
 		return fmt.Sprintf("/v1/profile/avatar/%s", assetID)
@@ -0,0 +1,191 @@
+package profile_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openchat/openchat-backend/internal/profile"
+	"github.com/openchat/openchat-backend/internal/profile/profiletest"
+)
+
+func TestUpdateBroadcastsProfile(t *testing.T) {
+	svc := profile.NewService("http://localhost:8080", "srv_harbor", profile.Options{})
+	broadcaster := &profiletest.RecordingBroadcaster{}
+	svc.SetBroadcaster(broadcaster)
+
+	updated, err := svc.Update("uid_broadcast", profile.UpdateInput{
+		DisplayName:  "Harbor Pilot",
+		AvatarMode:   profile.AvatarModeGenerated,
+		AvatarPreset: "reef",
+	}, nil)
+	if err != nil {
+		t.Fatalf("update profile: %v", err)
+	}
+
+	updates := broadcaster.ProfileUpdates()
+	if len(updates) != 1 {
+		t.Fatalf("expected 1 broadcast, got %d", len(updates))
+	}
+	sent := updates[0]
+	if sent.UserUID != "uid_broadcast" || sent.DisplayName != "Harbor Pilot" || sent.ProfileVersion != updated.ProfileVersion {
+		t.Fatalf("unexpected broadcast profile %+v", sent)
+	}
+	if sent.AvatarPresetID == nil || *sent.AvatarPresetID != "reef" {
+		t.Fatalf("expected reef preset in broadcast, got %v", sent.AvatarPresetID)
+	}
+	if len(broadcaster.AvatarsReady()) != 0 {
+		t.Fatalf("expected no avatar ready broadcasts")
+	}
+}
+
+func TestDisplayNameCooldown(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := profile.NewService("http://localhost:8080", "srv_harbor", profile.Options{
+		DisplayNameCooldown: time.Hour,
+		Now:                 func() time.Time { return now },
+	})
+	update := func(displayName string, preset string) error {
+		_, err := svc.Update("uid_cooldown", profile.UpdateInput{
+			DisplayName:  displayName,
+			AvatarMode:   profile.AvatarModeGenerated,
+			AvatarPreset: preset,
+		}, nil)
+		return err
+	}
+
+	if err := update("First Name", "reef"); err != nil {
+		t.Fatalf("first rename: %v", err)
+	}
+	if err := update("Second Name", "reef"); !errors.Is(err, profile.ErrDisplayNameCooldown) {
+		t.Fatalf("expected cooldown error, got %v", err)
+	}
+	if err := update("First Name", "mint"); err != nil {
+		t.Fatalf("expected avatar-only change to bypass cooldown, got %v", err)
+	}
+
+	now = now.Add(time.Hour)
+	updated, err := svc.Update("uid_cooldown", profile.UpdateInput{
+		DisplayName:  "Second Name",
+		AvatarMode:   profile.AvatarModeGenerated,
+		AvatarPreset: "mint",
+	}, nil)
+	if err != nil {
+		t.Fatalf("expected rename after cooldown, got %v", err)
+	}
+	if updated.DisplayName != "Second Name" {
+		t.Fatalf("expected renamed profile, got %q", updated.DisplayName)
+	}
+}
+
+func TestUpdateKeepsCreatedAt(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := profile.NewService("http://localhost:8080", "srv_harbor", profile.Options{
+		Now: func() time.Time { return now },
+	})
+	broadcaster := &profiletest.RecordingBroadcaster{}
+	svc.SetBroadcaster(broadcaster)
+
+	created, err := svc.Update("uid_created", profile.UpdateInput{
+		DisplayName:  "First Name",
+		AvatarMode:   profile.AvatarModeGenerated,
+		AvatarPreset: "reef",
+	}, nil)
+	if err != nil {
+		t.Fatalf("create profile: %v", err)
+	}
+
+	now = now.Add(48 * time.Hour)
+	updated, err := svc.Update("uid_created", profile.UpdateInput{
+		DisplayName:  "First Name",
+		AvatarMode:   profile.AvatarModeGenerated,
+		AvatarPreset: "ember",
+	}, nil)
+	if err != nil {
+		t.Fatalf("update profile: %v", err)
+	}
+	if created.CreatedAt == "" || updated.CreatedAt != created.CreatedAt {
+		t.Fatalf("expected created_at to stay %q, got %q", created.CreatedAt, updated.CreatedAt)
+	}
+	if updated.UpdatedAt == created.UpdatedAt {
+		t.Fatalf("expected updated_at to advance past %q", created.UpdatedAt)
+	}
+	if sent := broadcaster.ProfileUpdates(); sent[len(sent)-1].CreatedAt != created.CreatedAt {
+		t.Fatalf("expected broadcast to carry created_at %q", created.CreatedAt)
+	}
+}
+
+func TestUpdateSetsAndClearsBioAndPronouns(t *testing.T) {
+	svc := profile.NewService("http://localhost:8080", "srv_harbor", profile.Options{})
+	broadcaster := &profiletest.RecordingBroadcaster{}
+	svc.SetBroadcaster(broadcaster)
+	update := func(bio string, pronouns string) (profile.CanonicalProfile, error) {
+		return svc.Update("uid_bio", profile.UpdateInput{
+			DisplayName:  "Harbor Pilot",
+			AvatarMode:   profile.AvatarModeGenerated,
+			AvatarPreset: "reef",
+			Bio:          bio,
+			Pronouns:     pronouns,
+		}, nil)
+	}
+
+	if _, err := update(strings.Repeat("b", profile.MaxBioRunes+1), ""); !errors.Is(err, profile.ErrBioTooLong) {
+		t.Fatalf("expected ErrBioTooLong, got %v", err)
+	}
+	if _, err := update("", strings.Repeat("p", profile.MaxPronounsRunes+1)); !errors.Is(err, profile.ErrPronounsTooLong) {
+		t.Fatalf("expected ErrPronounsTooLong, got %v", err)
+	}
+	if _, err := update("  Sails at dawn.  ", " they/them "); err != nil {
+		t.Fatalf("update bio: %v", err)
+	}
+	batch := svc.BatchGet([]string{"uid_bio"})
+	if len(batch) != 1 || batch[0].Bio != "Sails at dawn." || batch[0].Pronouns != "they/them" {
+		t.Fatalf("expected trimmed bio and pronouns in batch results, got %+v", batch)
+	}
+	if sent := broadcaster.ProfileUpdates(); len(sent) != 1 || sent[0].Pronouns != "they/them" {
+		t.Fatalf("expected broadcast to carry pronouns, got %+v", sent)
+	}
+
+	cleared, err := update("", "")
+	if err != nil {
+		t.Fatalf("clear bio: %v", err)
+	}
+	if cleared.Bio != "" || cleared.Pronouns != "" {
+		t.Fatalf("expected empty strings to clear bio and pronouns, got %+v", cleared)
+	}
+}
+
+func TestSetPresenceDefaultsValidatesAndBroadcasts(t *testing.T) {
+	svc := profile.NewService("http://localhost:8080", "srv_harbor", profile.Options{})
+	broadcaster := &profiletest.RecordingBroadcaster{}
+	svc.SetBroadcaster(broadcaster)
+
+	created := svc.GetOrCreate("uid_presence")
+	if created.Presence != profile.PresenceOnline {
+		t.Fatalf("expected new profiles to start online, got %q", created.Presence)
+	}
+	if _, err := svc.SetPresence("uid_presence", "away", ""); !errors.Is(err, profile.ErrPresenceInvalid) {
+		t.Fatalf("expected ErrPresenceInvalid, got %v", err)
+	}
+	if _, err := svc.SetPresence("uid_presence", profile.PresenceDND, strings.Repeat("s", profile.MaxStatusTextRunes+1)); !errors.Is(err, profile.ErrStatusTextTooLong) {
+		t.Fatalf("expected ErrStatusTextTooLong, got %v", err)
+	}
+
+	updated, err := svc.SetPresence("uid_presence", profile.PresenceDND, " In a meeting ")
+	if err != nil {
+		t.Fatalf("set presence: %v", err)
+	}
+	if updated.Presence != profile.PresenceDND || updated.StatusText != "In a meeting" {
+		t.Fatalf("unexpected presence %+v", updated)
+	}
+	if updated.ProfileVersion != created.ProfileVersion {
+		t.Fatalf("expected presence to leave profile_version at %d, got %d", created.ProfileVersion, updated.ProfileVersion)
+	}
+	if len(broadcaster.ProfileUpdates()) != 0 {
+		t.Fatalf("expected no profile_updated broadcast for a presence change")
+	}
+	if sent := broadcaster.PresenceUpdates(); len(sent) != 1 || sent[0].StatusText != "In a meeting" {
+		t.Fatalf("expected one presence broadcast, got %+v", sent)
+	}
+}
@@ -0,0 +1,82 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/openchat/openchat-backend/internal/chat"
+)
+
+// unacknowledged returns the suffix of a seq-ordered replay buffer above
+// watermark.
+func unacknowledged(buffer []chat.Message, watermark int64) []chat.Message {
+	idx := sort.Search(len(buffer), func(i int) bool { return buffer[i].Seq > watermark })
+	return buffer[idx:]
+}
+
+// acknowledge raises userUID's delivered watermark in channelID to seq,
+// clamped to the channel's newest buffered message; it never moves backwards.
+// Watermarks are kept per user rather than per connection so they survive a
+// reconnect. It returns the watermark and how many buffered messages remain
+// unacknowledged, which is what chat.resume would replay.
+func (h *Hub) acknowledge(userUID string, channelID string, seq int64) (int64, int) {
+	h.replayMu.Lock()
+	defer h.replayMu.Unlock()
+	buffer := h.replayByChannel[channelID]
+	var last int64
+	if len(buffer) > 0 {
+		last = buffer[len(buffer)-1].Seq
+	}
+	if seq > last {
+		seq = last
+	}
+	delivered := h.deliveredByUser[userUID]
+	if seq > delivered[channelID] {
+		if delivered == nil {
+			delivered = make(map[string]int64)
+			h.deliveredByUser[userUID] = delivered
+		}
+		delivered[channelID] = seq
+	}
+	watermark := delivered[channelID]
+	return watermark, len(unacknowledged(buffer, watermark))
+}
+
+// DeliveredSeq is the highest message seq in channelID that any of userUID's
+// connections has acknowledged.
+func (h *Hub) DeliveredSeq(userUID string, channelID string) int64 {
+	h.replayMu.Lock()
+	defer h.replayMu.Unlock()
+	return h.deliveredByUser[userUID][channelID]
+}
+
+func (c *client) handleAck(envelope Envelope) {
+	var payload struct {
+		ChannelID string `json:"channel_id"`
+		Seq       int64  `json:"seq"`
+	}
+	_ = json.Unmarshal(envelope.Payload, &payload)
+	channelID := strings.TrimSpace(payload.ChannelID)
+	if channelID == "" {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_channel_required", "channel_id is required", false))
+		return
+	}
+	if payload.Seq <= 0 {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_ack_invalid", "seq must be positive", false))
+		return
+	}
+	c.hub.mu.RLock()
+	_, subscribed := c.subscriptions[channelID]
+	c.hub.mu.RUnlock()
+	if !subscribed {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_not_subscribed", "channel subscription is required", false))
+		return
+	}
+	watermark, buffered := c.hub.acknowledge(c.userUID, channelID, payload.Seq)
+	c.enqueue(newEnvelope(EventAcked, envelope.RequestID, map[string]any{
+		"channel_id": channelID,
+		"seq":        watermark,
+		"buffered":   buffered,
+	}))
+}
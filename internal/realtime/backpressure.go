@@ -0,0 +1,32 @@
+package realtime
+
+const (
+	// DefaultSendBufferSize is each connection's outbound queue length when
+	// Options.SendBufferSize is unset.
+	DefaultSendBufferSize = 64
+	// DefaultSlowConsumerDrops is how many consecutive envelopes may be dropped
+	// on a full queue before the connection is closed as a slow consumer.
+	DefaultSlowConsumerDrops = 32
+)
+
+// noteDropped counts an envelope lost to a full send queue. Once
+// slowConsumerDrops are dropped in a row the write loop is asked to send a
+// slow_consumer error and close, so the client reconnects and resumes instead
+// of silently missing events.
+func (c *client) noteDropped(envelope Envelope) {
+	c.hub.droppedTotal.Add(1)
+	dropped := c.dropped.Add(1)
+	if c.consecutiveDrops.Add(1) != int64(c.hub.slowConsumerDrops) {
+		return
+	}
+	c.hub.logger.Warn("disconnecting slow realtime consumer",
+		"client_id", c.id,
+		"user_uid", c.userUID,
+		"dropped", dropped,
+		"last_type", envelope.Type,
+	)
+	select {
+	case c.closeNotice <- errorEnvelope("", "slow_consumer", "connection fell too far behind; reconnect and resume", true):
+	default:
+	}
+}
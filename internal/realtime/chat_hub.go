@@ -2,10 +2,13 @@ package realtime
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -15,7 +18,7 @@ import (
 )
 
 type Envelope struct {
-	Type      string          `json:"type"`
+	Type      EventType       `json:"type"`
 	RequestID string          `json:"request_id,omitempty"`
 	Payload   json.RawMessage `json:"payload,omitempty"`
 }
@@ -27,12 +30,95 @@ type Hub struct {
 	mu                sync.RWMutex
 	clientsByID       map[string]*client
 	subscribersByRoom map[string]map[string]*client
+
+	presenceTTL time.Duration
+	heartbeats  map[string]time.Time
+	now         func() time.Time
+
+	presenceGrace    time.Duration
+	pendingLeaves    map[presenceKey]*pendingLeave
+	presenceDisabled bool
+
+	welcomeByChannel map[string]string
+	welcomeTTL       time.Duration
+	welcomeMu        sync.Mutex
+	welcomedAt       map[welcomeKey]time.Time
+	welcomeSweptAt   time.Time
+
+	watchersByProfile   map[string]map[string]*client
+	profileUpdatesToAll bool
+
+	replayMu         sync.Mutex
+	replayByChannel  map[string][]chat.Message
+	replayBufferSize int
+	// deliveredByUser is each user's acknowledged seq per channel, guarded by
+	// replayMu. chat.resume skips messages at or below it.
+	deliveredByUser map[string]map[string]int64
+
+	sendBufferSize    int
+	slowConsumerDrops int
+	droppedTotal      atomic.Int64
+	readLimit         int64
+
+	presenceSource PresenceSource
+	// chosenPresence caches each connected user's chosen presence, guarded by
+	// mu, so presence is resolved without calling the source under the lock.
+	chosenPresence map[string]presenceStatus
+}
+
+type Options struct {
+	PresenceTTL time.Duration
+	// PresenceGrace delays chat.presence.left after a disconnect so a quick
+	// reconnect from the same device does not flicker. Zero broadcasts immediately.
+	PresenceGrace time.Duration
+	// DisablePresence suppresses presence snapshots, joins, and leaves.
+	DisablePresence bool
+	// WelcomeMessages maps channel ids to text sent once, as chat.channel.welcome,
+	// to a user's first subscribe. WelcomeTTL controls how long that first
+	// subscribe is remembered; zero means 30 days.
+	WelcomeMessages map[string]string
+	WelcomeTTL      time.Duration
+	// ProfileUpdatesToAll delivers every profile_updated event to every
+	// connection. By default a connection only receives updates for its own
+	// user and the uids it follows with profile.subscribe.
+	ProfileUpdatesToAll bool
+	// ReplayBufferSize is how many recent messages each channel keeps for
+	// chat.resume; zero means DefaultReplayBufferSize.
+	ReplayBufferSize int
+	// SendBufferSize is each connection's outbound queue length, and
+	// SlowConsumerDrops the consecutive drops on a full queue before the
+	// connection is closed with slow_consumer. Zero means the defaults.
+	SendBufferSize    int
+	SlowConsumerDrops int
+	// MaxFrameBytes caps inbound frames; larger ones close the connection with
+	// 1009 (message too big). Zero means DefaultMaxFrameBytes.
+	MaxFrameBytes int64
+}
+
+// DefaultMaxFrameBytes is the inbound frame limit when Options.MaxFrameBytes
+// is unset. Every inbound event is a small JSON control message.
+const DefaultMaxFrameBytes = 64 << 10
+
+type presenceKey struct {
+	channelID string
+	userUID   string
+	deviceID  string
+}
+
+type pendingLeave struct {
+	member presenceMember
+	// hidden holds the leave back from other users, as the member was invisible.
+	hidden bool
+	timer  *time.Timer
 }
 
 type presenceMember struct {
 	ClientID string `json:"client_id"`
 	UserUID  string `json:"user_uid"`
 	DeviceID string `json:"device_id"`
+	// Presence and StatusText are filled in for snapshots and joins only.
+	Presence   profile.Presence `json:"presence,omitempty"`
+	StatusText string           `json:"status_text,omitempty"`
 }
 
 type channelDeparture struct {
@@ -40,7 +126,31 @@ type channelDeparture struct {
 	peers     []*client
 }
 
-func NewHub(logger *slog.Logger) *Hub {
+func NewHub(logger *slog.Logger, opts Options) *Hub {
+	presenceTTL := opts.PresenceTTL
+	if presenceTTL <= 0 {
+		presenceTTL = 45 * time.Second
+	}
+	welcomeTTL := opts.WelcomeTTL
+	if welcomeTTL <= 0 {
+		welcomeTTL = defaultWelcomeTTL
+	}
+	replayBufferSize := opts.ReplayBufferSize
+	if replayBufferSize <= 0 {
+		replayBufferSize = DefaultReplayBufferSize
+	}
+	sendBufferSize := opts.SendBufferSize
+	if sendBufferSize <= 0 {
+		sendBufferSize = DefaultSendBufferSize
+	}
+	slowConsumerDrops := opts.SlowConsumerDrops
+	if slowConsumerDrops <= 0 {
+		slowConsumerDrops = DefaultSlowConsumerDrops
+	}
+	readLimit := opts.MaxFrameBytes
+	if readLimit <= 0 {
+		readLimit = DefaultMaxFrameBytes
+	}
 	return &Hub{
 		logger: logger,
 		upgrader: websocket.Upgrader{
@@ -50,8 +160,26 @@ func NewHub(logger *slog.Logger) *Hub {
 				return true
 			},
 		},
-		clientsByID:       make(map[string]*client),
-		subscribersByRoom: make(map[string]map[string]*client),
+		clientsByID:         make(map[string]*client),
+		subscribersByRoom:   make(map[string]map[string]*client),
+		presenceTTL:         presenceTTL,
+		heartbeats:          make(map[string]time.Time),
+		now:                 time.Now,
+		presenceGrace:       opts.PresenceGrace,
+		pendingLeaves:       make(map[presenceKey]*pendingLeave),
+		presenceDisabled:    opts.DisablePresence,
+		welcomeByChannel:    opts.WelcomeMessages,
+		welcomeTTL:          welcomeTTL,
+		welcomedAt:          make(map[welcomeKey]time.Time),
+		watchersByProfile:   make(map[string]map[string]*client),
+		profileUpdatesToAll: opts.ProfileUpdatesToAll,
+		replayByChannel:     make(map[string][]chat.Message),
+		chosenPresence:      make(map[string]presenceStatus),
+		replayBufferSize:    replayBufferSize,
+		deliveredByUser:     make(map[string]map[string]int64),
+		sendBufferSize:      sendBufferSize,
+		slowConsumerDrops:   slowConsumerDrops,
+		readLimit:           readLimit,
 	}
 }
 
@@ -78,16 +206,19 @@ func (h *Hub) ServeWS(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := &client{
-		id:            uuid.NewString(),
-		userUID:       userUID,
-		deviceID:      deviceID,
-		conn:          conn,
-		hub:           h,
-		send:          make(chan Envelope, 64),
-		subscriptions: make(map[string]struct{}),
-		closed:        make(chan struct{}),
+		id:             uuid.NewString(),
+		userUID:        userUID,
+		deviceID:       deviceID,
+		conn:           conn,
+		hub:            h,
+		send:           make(chan Envelope, h.sendBufferSize),
+		closeNotice:    make(chan Envelope, 1),
+		subscriptions:  make(map[string]struct{}),
+		profileWatches: make(map[string]struct{}),
+		closed:         make(chan struct{}),
 	}
 
+	h.cacheChosenPresence(userUID)
 	h.register(client)
 	go client.writeLoop()
 	client.readLoop()
@@ -97,27 +228,93 @@ func (h *Hub) BroadcastMessage(message chat.Message) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 	room := h.subscribersByRoom[message.ChannelID]
+	envelope := newEnvelope(EventMessageCreated, "", map[string]any{"message": message})
+	if message.IsEphemeral() {
+		// Ephemeral messages are neither replayed nor resumable.
+		for _, client := range room {
+			if message.VisibleToUser(client.userUID) {
+				client.enqueue(envelope)
+			}
+		}
+		return
+	}
+	h.recordForReplay(message)
+	for _, client := range room {
+		client.enqueue(envelope)
+	}
+}
+
+func (h *Hub) BroadcastMessageUpdated(message chat.Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.replaceForReplay(message)
+	room := h.subscribersByRoom[message.ChannelID]
 	if len(room) == 0 {
 		return
 	}
-	envelope := newEnvelope("chat.message.created", "", map[string]any{"message": message})
+	envelope := newEnvelope(EventMessageUpdated, "", map[string]any{"message": message})
 	for _, client := range room {
 		client.enqueue(envelope)
 	}
 }
 
-func (h *Hub) BroadcastProfileUpdated(updated profile.CanonicalProfile) {
+func (h *Hub) BroadcastMessageDeleted(message chat.Message) {
 	h.mu.RLock()
-	clients := make([]*client, 0, len(h.clientsByID))
-	for _, c := range h.clientsByID {
-		clients = append(clients, c)
+	defer h.mu.RUnlock()
+	h.replaceForReplay(message)
+	room := h.subscribersByRoom[message.ChannelID]
+	if len(room) == 0 {
+		return
+	}
+	envelope := newEnvelope(EventMessageDeleted, "", map[string]any{"message": message})
+	for _, client := range room {
+		client.enqueue(envelope)
+	}
+}
+
+func (h *Hub) BroadcastChannelPurged(channelID string, purgedBy string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	h.clearReplay(channelID)
+	room := h.subscribersByRoom[channelID]
+	if len(room) == 0 {
+		return
 	}
+	envelope := newEnvelope(EventChannelPurged, "", map[string]any{
+		"channel_id": channelID,
+		"purged_by":  purgedBy,
+	})
+	for _, client := range room {
+		client.enqueue(envelope)
+	}
+}
+
+func (h *Hub) BroadcastChannelTopicUpdated(channelID string, topic string, updatedBy string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	room := h.subscribersByRoom[channelID]
+	if len(room) == 0 {
+		return
+	}
+	envelope := newEnvelope(EventChannelTopicUpdated, "", map[string]any{
+		"channel_id": channelID,
+		"topic":      topic,
+		"updated_by": updatedBy,
+	})
+	for _, client := range room {
+		client.enqueue(envelope)
+	}
+}
+
+func (h *Hub) BroadcastProfileUpdated(updated profile.CanonicalProfile) {
+	h.mu.RLock()
+	clients := h.profileWatchersLocked(updated.UserUID)
 	h.mu.RUnlock()
 	if len(clients) == 0 {
 		return
 	}
 
-	envelope := newEnvelope("profile_updated", "", map[string]any{
+	envelope := newEnvelope(EventProfileUpdated, "", map[string]any{
 		"user_uid":         updated.UserUID,
 		"profile_version":  updated.ProfileVersion,
 		"display_name":     updated.DisplayName,
@@ -125,6 +322,9 @@ func (h *Hub) BroadcastProfileUpdated(updated profile.CanonicalProfile) {
 		"avatar_preset_id": updated.AvatarPresetID,
 		"avatar_asset_id":  updated.AvatarAssetID,
 		"avatar_url":       updated.AvatarURL,
+		"bio":              updated.Bio,
+		"pronouns":         updated.Pronouns,
+		"created_at":       updated.CreatedAt,
 		"updated_at":       updated.UpdatedAt,
 	})
 
@@ -133,16 +333,74 @@ func (h *Hub) BroadcastProfileUpdated(updated profile.CanonicalProfile) {
 	}
 }
 
+// BroadcastPresenceUpdated sends presence_updated to the profile's watchers
+// and chat.presence.updated to the rooms the user is subscribed to.
+// Invisible users are reported as offline to watchers other than themselves
+// and are left out of rooms entirely.
+func (h *Hub) BroadcastPresenceUpdated(updated profile.CanonicalProfile) {
+	h.mu.Lock()
+	clients := h.profileWatchersLocked(updated.UserUID)
+	before := h.userPresenceLocked(updated.UserUID)
+	h.chosenPresence[updated.UserUID] = chosenStatus(updated)
+	after := h.userPresenceLocked(updated.UserUID)
+	h.mu.Unlock()
+	h.broadcastUserPresence(updated.UserUID, before, after)
+
+	for _, c := range clients {
+		visible := updated.VisibleTo(c.userUID)
+		c.enqueue(newEnvelope(EventPresenceUpdated, "", map[string]any{
+			"user_uid":            visible.UserUID,
+			"presence":            visible.Presence,
+			"status_text":         visible.StatusText,
+			"presence_updated_at": visible.PresenceUpdatedAt,
+		}))
+	}
+}
+
+func (h *Hub) BroadcastAvatarReady(userUID string, asset profile.AvatarAsset) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	envelope := newEnvelope(EventProfileAvatarReady, "", map[string]any{
+		"user_uid":        userUID,
+		"avatar_asset_id": asset.AvatarAssetID,
+		"avatar_url":      asset.AvatarURL,
+		"width":           asset.Width,
+		"height":          asset.Height,
+		"content_type":    asset.ContentType,
+	})
+	for _, c := range h.clientsByID {
+		if c.userUID == userUID {
+			c.enqueue(envelope)
+		}
+	}
+}
+
 func (h *Hub) register(c *client) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.clientsByID[c.id] = c
+	h.addProfileWatcherLocked(c.userUID, c)
 }
 
 func (h *Hub) unregister(c *client) []channelDeparture {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	delete(h.clientsByID, c.id)
+	connected := false
+	for _, other := range h.clientsByID {
+		if other.userUID == c.userUID {
+			connected = true
+			break
+		}
+	}
+	if !connected {
+		delete(h.chosenPresence, c.userUID)
+	}
+	h.removeProfileWatcherLocked(c.userUID, c)
+	for userUID := range c.profileWatches {
+		h.removeProfileWatcherLocked(userUID, c)
+	}
+	c.profileWatches = make(map[string]struct{})
 	departures := make([]channelDeparture, 0, len(c.subscriptions))
 	for channelID := range c.subscriptions {
 		room := h.subscribersByRoom[channelID]
@@ -178,12 +436,28 @@ func (h *Hub) subscribe(c *client, channelID string) ([]presenceMember, []*clien
 		h.subscribersByRoom[channelID] = room
 	}
 	_, alreadySubscribed := c.subscriptions[channelID]
+	key := presenceKey{channelID: channelID, userUID: c.userUID, deviceID: c.deviceID}
+	if pending, ok := h.pendingLeaves[key]; ok {
+		// The device came back within the grace period; peers never saw it leave.
+		pending.timer.Stop()
+		delete(h.pendingLeaves, key)
+		alreadySubscribed = true
+	}
 	room[c.id] = c
 	c.subscriptions[channelID] = struct{}{}
 	snapshot := make([]presenceMember, 0, len(room))
 	peers := make([]*client, 0, len(room))
+	statuses := make(map[string]presenceStatus, len(room))
 	for _, member := range room {
-		snapshot = append(snapshot, presenceMemberFromClient(member))
+		status, ok := statuses[member.userUID]
+		if !ok {
+			status = h.userPresenceLocked(member.userUID)
+			statuses[member.userUID] = status
+		}
+		// Invisible users are absent from everyone else's snapshot.
+		if !status.hidden() || member.userUID == c.userUID {
+			snapshot = append(snapshot, memberWithStatus(member, status))
+		}
 		if member.id != c.id {
 			peers = append(peers, member)
 		}
@@ -213,6 +487,46 @@ func (h *Hub) unsubscribe(c *client, channelID string) ([]*client, bool) {
 	return peers, true
 }
 
+func (h *Hub) deferLeave(channelID string, member presenceMember, hidden bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	key := presenceKey{channelID: channelID, userUID: member.UserUID, deviceID: member.DeviceID}
+	if previous, ok := h.pendingLeaves[key]; ok {
+		previous.timer.Stop()
+	}
+	pending := &pendingLeave{member: member, hidden: hidden}
+	pending.timer = time.AfterFunc(h.presenceGrace, func() {
+		h.flushLeave(key, pending)
+	})
+	h.pendingLeaves[key] = pending
+}
+
+func (h *Hub) flushLeave(key presenceKey, pending *pendingLeave) {
+	h.mu.Lock()
+	if h.pendingLeaves[key] != pending {
+		h.mu.Unlock()
+		return
+	}
+	delete(h.pendingLeaves, key)
+	room := h.subscribersByRoom[key.channelID]
+	peers := make([]*client, 0, len(room))
+	for _, peer := range room {
+		if pending.hidden && peer.userUID != key.userUID {
+			continue
+		}
+		peers = append(peers, peer)
+	}
+	h.mu.Unlock()
+
+	leftEnvelope := newEnvelope(EventPresenceLeft, "", map[string]any{
+		"channel_id": key.channelID,
+		"member":     pending.member,
+	})
+	for _, peer := range peers {
+		peer.enqueue(leftEnvelope)
+	}
+}
+
 func (h *Hub) typingPeers(c *client, channelID string) ([]*client, bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -240,14 +554,25 @@ type client struct {
 	conn     *websocket.Conn
 	hub      *Hub
 	send     chan Envelope
+	// closeNotice carries a final error written before the connection closes.
+	closeNotice chan Envelope
+
+	dropped          atomic.Int64
+	consecutiveDrops atomic.Int64
+
+	subscriptions  map[string]struct{}
+	profileWatches map[string]struct{}
+	// activity is the connection's reported online or idle state, guarded by
+	// hub.mu; empty means online.
+	activity profile.Presence
 
-	subscriptions map[string]struct{}
-	closeOnce     sync.Once
-	closed        chan struct{}
+	closeOnce sync.Once
+	closed    chan struct{}
 }
 
 func (c *client) readLoop() {
 	defer c.close()
+	c.conn.SetReadLimit(c.hub.readLimit)
 	_ = c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		_ = c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -257,6 +582,9 @@ func (c *client) readLoop() {
 	for {
 		var envelope Envelope
 		if err := c.conn.ReadJSON(&envelope); err != nil {
+			if errors.Is(err, websocket.ErrReadLimit) {
+				c.hub.logger.Warn("closing realtime connection after oversized frame", "client_id", c.id, "user_uid", c.userUID, "limit_bytes", c.hub.readLimit)
+			}
 			return
 		}
 		_ = c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -264,86 +592,114 @@ func (c *client) readLoop() {
 	}
 }
 
+var inboundHandlers = map[EventType]func(*client, Envelope){
+	EventSubscribe:          (*client).handleSubscribe,
+	EventUnsubscribe:        (*client).handleUnsubscribe,
+	EventTypingUpdate:       (*client).handleTypingUpdate,
+	EventAck:                (*client).handleAck,
+	EventPresenceUpdate:     (*client).handlePresenceUpdate,
+	EventResume:             (*client).handleResume,
+	EventProfileSubscribe:   (*client).handleProfileSubscribe,
+	EventProfileUnsubscribe: (*client).handleProfileUnsubscribe,
+	EventPing: func(c *client, envelope Envelope) {
+		c.enqueue(newEnvelope(EventPong, envelope.RequestID, map[string]any{"ts": time.Now().UTC().Format(time.RFC3339Nano)}))
+	},
+}
+
 func (c *client) handleEnvelope(envelope Envelope) {
-	switch envelope.Type {
-	case "chat.subscribe":
-		var payload struct {
-			ChannelID string `json:"channel_id"`
-		}
-		_ = json.Unmarshal(envelope.Payload, &payload)
-		channelID := strings.TrimSpace(payload.ChannelID)
-		if channelID == "" {
-			c.enqueue(errorEnvelope(envelope.RequestID, "chat_channel_required", "channel_id is required", false))
-			return
-		}
-		snapshot, peers, joined := c.hub.subscribe(c, channelID)
-		c.enqueue(newEnvelope("chat.subscribed", envelope.RequestID, map[string]any{"channel_id": channelID}))
-		c.enqueue(newEnvelope("chat.presence.snapshot", "", map[string]any{
+	handler, ok := inboundHandlers[envelope.Type]
+	if !ok {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_unknown_event", "unsupported realtime event", false))
+		return
+	}
+	handler(c, envelope)
+}
+
+func (c *client) handleSubscribe(envelope Envelope) {
+	var payload struct {
+		ChannelID string `json:"channel_id"`
+	}
+	_ = json.Unmarshal(envelope.Payload, &payload)
+	channelID := strings.TrimSpace(payload.ChannelID)
+	if channelID == "" {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_channel_required", "channel_id is required", false))
+		return
+	}
+	snapshot, peers, joined := c.hub.subscribe(c, channelID)
+	c.enqueue(newEnvelope(EventSubscribed, envelope.RequestID, map[string]any{"channel_id": channelID}))
+	if !c.hub.presenceDisabled {
+		c.enqueue(newEnvelope(EventPresenceSnapshot, "", map[string]any{
 			"channel_id": channelID,
 			"members":    snapshot,
 		}))
 		if joined {
-			joinedEnvelope := newEnvelope("chat.presence.joined", "", map[string]any{
-				"channel_id": channelID,
-				"member":     presenceMemberFromClient(c),
-			})
-			for _, peer := range peers {
-				peer.enqueue(joinedEnvelope)
+			status := c.hub.userPresence(c.userUID)
+			for _, peer := range presencePeers(peers, c.userUID, status) {
+				peer.enqueue(newEnvelope(EventPresenceJoined, "", map[string]any{
+					"channel_id": channelID,
+					"member":     memberWithStatus(c, status),
+				}))
 			}
 		}
-	case "chat.unsubscribe":
-		var payload struct {
-			ChannelID string `json:"channel_id"`
-		}
-		_ = json.Unmarshal(envelope.Payload, &payload)
-		channelID := strings.TrimSpace(payload.ChannelID)
-		if channelID == "" {
-			return
-		}
-		peers, removed := c.hub.unsubscribe(c, channelID)
-		c.enqueue(newEnvelope("chat.unsubscribed", envelope.RequestID, map[string]any{"channel_id": channelID}))
-		if removed {
-			leftEnvelope := newEnvelope("chat.presence.left", "", map[string]any{
-				"channel_id": channelID,
-				"member":     presenceMemberFromClient(c),
-			})
-			for _, peer := range peers {
-				peer.enqueue(leftEnvelope)
-			}
-		}
-	case "chat.typing.update":
-		var payload struct {
-			ChannelID string `json:"channel_id"`
-			IsTyping  bool   `json:"is_typing"`
-		}
-		_ = json.Unmarshal(envelope.Payload, &payload)
-		channelID := strings.TrimSpace(payload.ChannelID)
-		if channelID == "" {
-			c.enqueue(errorEnvelope(envelope.RequestID, "chat_channel_required", "channel_id is required", false))
-			return
-		}
-		peers, subscribed := c.hub.typingPeers(c, channelID)
-		if !subscribed {
-			c.enqueue(errorEnvelope(envelope.RequestID, "chat_not_subscribed", "channel subscription is required", false))
-			return
-		}
-		typingEnvelope := newEnvelope("chat.typing.updated", "", map[string]any{
+	}
+	if text, ok := c.hub.claimWelcome(c.userUID, channelID); ok {
+		c.enqueue(newEnvelope(EventChannelWelcome, "", map[string]any{
+			"channel_id": channelID,
+			"body":       text,
+		}))
+	}
+}
+
+func (c *client) handleUnsubscribe(envelope Envelope) {
+	var payload struct {
+		ChannelID string `json:"channel_id"`
+	}
+	_ = json.Unmarshal(envelope.Payload, &payload)
+	channelID := strings.TrimSpace(payload.ChannelID)
+	if channelID == "" {
+		return
+	}
+	peers, removed := c.hub.unsubscribe(c, channelID)
+	c.enqueue(newEnvelope(EventUnsubscribed, envelope.RequestID, map[string]any{"channel_id": channelID}))
+	if removed && !c.hub.presenceDisabled {
+		leftEnvelope := newEnvelope(EventPresenceLeft, "", map[string]any{
 			"channel_id": channelID,
 			"member":     presenceMemberFromClient(c),
-			"is_typing":  payload.IsTyping,
 		})
-		for _, peer := range peers {
-			peer.enqueue(typingEnvelope)
+		for _, peer := range presencePeers(peers, c.userUID, c.hub.userPresence(c.userUID)) {
+			peer.enqueue(leftEnvelope)
 		}
-	case "chat.ping":
-		c.enqueue(newEnvelope("chat.pong", envelope.RequestID, map[string]any{"ts": time.Now().UTC().Format(time.RFC3339Nano)}))
-	default:
-		c.enqueue(errorEnvelope(envelope.RequestID, "chat_unknown_event", "unsupported realtime event", false))
+	}
+}
+
+func (c *client) handleTypingUpdate(envelope Envelope) {
+	var payload struct {
+		ChannelID string `json:"channel_id"`
+		IsTyping  bool   `json:"is_typing"`
+	}
+	_ = json.Unmarshal(envelope.Payload, &payload)
+	channelID := strings.TrimSpace(payload.ChannelID)
+	if channelID == "" {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_channel_required", "channel_id is required", false))
+		return
+	}
+	peers, subscribed := c.hub.typingPeers(c, channelID)
+	if !subscribed {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_not_subscribed", "channel subscription is required", false))
+		return
+	}
+	typingEnvelope := newEnvelope(EventTypingUpdated, "", map[string]any{
+		"channel_id": channelID,
+		"member":     presenceMemberFromClient(c),
+		"is_typing":  payload.IsTyping,
+	})
+	for _, peer := range peers {
+		peer.enqueue(typingEnvelope)
 	}
 }
 
 func (c *client) writeLoop() {
-	ticker := time.NewTicker(25 * time.Second)
+	ticker := time.NewTicker(jitteredPingInterval())
 	defer ticker.Stop()
 	for {
 		select {
@@ -355,6 +711,12 @@ func (c *client) writeLoop() {
 			if err := c.conn.WriteJSON(envelope); err != nil {
 				return
 			}
+		case notice := <-c.closeNotice:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			_ = c.conn.WriteJSON(notice)
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "slow_consumer"), time.Now().Add(time.Second))
+			c.close()
+			return
 		case <-ticker.C:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(10*time.Second)); err != nil {
@@ -366,29 +728,57 @@ func (c *client) writeLoop() {
 	}
 }
 
+const (
+	pingInterval = 25 * time.Second
+	pingJitter   = 3 * time.Second
+)
+
+// jitteredPingInterval spreads keepalives across connections while staying well
+// inside the 60s read deadline.
+func jitteredPingInterval() time.Duration {
+	return pingInterval - pingJitter + rand.N(2*pingJitter+1)
+}
+
 func (c *client) enqueue(envelope Envelope) {
 	defer func() {
 		_ = recover()
 	}()
 	select {
 	case c.send <- envelope:
+		c.consecutiveDrops.Store(0)
 	default:
+		c.noteDropped(envelope)
 	}
 }
 
 func (c *client) close() {
 	c.closeOnce.Do(func() {
+		before := c.hub.userPresence(c.userUID)
 		departures := c.hub.unregister(c)
 		member := presenceMemberFromClient(c)
+		if c.hub.presenceDisabled {
+			departures = nil
+		}
 		for _, departure := range departures {
-			leftEnvelope := newEnvelope("chat.presence.left", "", map[string]any{
+			if c.hub.presenceGrace > 0 {
+				c.hub.deferLeave(departure.channelID, member, before.hidden())
+				continue
+			}
+			leftEnvelope := newEnvelope(EventPresenceLeft, "", map[string]any{
 				"channel_id": departure.channelID,
 				"member":     member,
 			})
-			for _, peer := range departure.peers {
+			for _, peer := range presencePeers(departure.peers, c.userUID, before) {
 				peer.enqueue(leftEnvelope)
 			}
 		}
+		if after := c.hub.userPresence(c.userUID); after != before {
+			// An active device left while the user's others stay idle.
+			c.hub.broadcastUserPresence(c.userUID, before, after)
+		}
+		if dropped := c.dropped.Load(); dropped > 0 {
+			c.hub.logger.Info("realtime connection closed with dropped events", "client_id", c.id, "user_uid", c.userUID, "dropped", dropped)
+		}
 		close(c.closed)
 		close(c.send)
 		_ = c.conn.Close()
@@ -403,7 +793,7 @@ func presenceMemberFromClient(c *client) presenceMember {
 	}
 }
 
-func newEnvelope(eventType string, requestID string, payload any) Envelope {
+func newEnvelope(eventType EventType, requestID string, payload any) Envelope {
 	rawPayload := json.RawMessage("{}")
 	if payload != nil {
 		encoded, err := json.Marshal(payload)
@@ -419,7 +809,7 @@ func newEnvelope(eventType string, requestID string, payload any) Envelope {
 }
 
 func errorEnvelope(requestID string, code string, message string, retryable bool) Envelope {
-	return newEnvelope("chat.error", requestID, map[string]any{
+	return newEnvelope(EventError, requestID, map[string]any{
 		"code":      code,
 		"message":   message,
 		"retryable": retryable,
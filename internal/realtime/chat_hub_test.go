@@ -0,0 +1,218 @@
+package realtime
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/openchat/openchat-backend/internal/chat"
+)
+
+func TestJitteredPingIntervalStaysWithinBounds(t *testing.T) {
+	seen := make(map[time.Duration]struct{})
+	for i := 0; i < 200; i++ {
+		interval := jitteredPingInterval()
+		if interval < pingInterval-pingJitter || interval > pingInterval+pingJitter {
+			t.Fatalf("interval %s outside [%s, %s]", interval, pingInterval-pingJitter, pingInterval+pingJitter)
+		}
+		seen[interval] = struct{}{}
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected jitter to vary the ping interval")
+	}
+}
+
+func TestAckTrimsResumeBacklogAcrossReconnects(t *testing.T) {
+	hub := NewHub(slog.Default(), Options{DisablePresence: true})
+	connect := func(id string) *client {
+		c := &client{
+			id:             id,
+			userUID:        "uid_ack",
+			deviceID:       "dev_ack",
+			hub:            hub,
+			send:           make(chan Envelope, 64),
+			subscriptions:  make(map[string]struct{}),
+			profileWatches: make(map[string]struct{}),
+			closed:         make(chan struct{}),
+		}
+		hub.register(c)
+		return c
+	}
+	drain := func(c *client) []Envelope {
+		var out []Envelope
+		for len(c.send) > 0 {
+			out = append(out, <-c.send)
+		}
+		return out
+	}
+	ack := func(c *client, channelID string, seq int64) Envelope {
+		t.Helper()
+		drain(c)
+		payload, _ := json.Marshal(map[string]any{"channel_id": channelID, "seq": seq})
+		c.handleEnvelope(Envelope{Type: EventAck, Payload: payload})
+		replies := drain(c)
+		if len(replies) != 1 {
+			t.Fatalf("expected one reply to chat.ack, got %d", len(replies))
+		}
+		return replies[0]
+	}
+	acked := func(envelope Envelope) (int64, int) {
+		t.Helper()
+		if envelope.Type != EventAcked {
+			t.Fatalf("expected %s, got %s: %s", EventAcked, envelope.Type, envelope.Payload)
+		}
+		var payload struct {
+			Seq      int64 `json:"seq"`
+			Buffered int   `json:"buffered"`
+		}
+		_ = json.Unmarshal(envelope.Payload, &payload)
+		return payload.Seq, payload.Buffered
+	}
+
+	first := connect("client_ack_first")
+	if reply := ack(first, "ch_general", 1); reply.Type != EventError {
+		t.Fatalf("expected acks for unsubscribed channels to be rejected, got %s", reply.Type)
+	}
+	hub.subscribe(first, "ch_general")
+	for seq := int64(1); seq <= 3; seq++ {
+		hub.BroadcastMessage(chat.Message{ID: fmt.Sprintf("msg_ack_%d", seq), ChannelID: "ch_general", Seq: seq})
+	}
+
+	if seq, buffered := acked(ack(first, "ch_general", 2)); seq != 2 || buffered != 1 {
+		t.Fatalf("expected watermark 2 with seq 3 still buffered, got %d/%d", seq, buffered)
+	}
+	if seq, buffered := acked(ack(first, "ch_general", 1)); seq != 2 || buffered != 1 {
+		t.Fatalf("expected a stale ack to leave the watermark at 2, got %d/%d", seq, buffered)
+	}
+
+	// A new connection for the same user resumes from the acked watermark.
+	hub.unregister(first)
+	second := connect("client_ack_second")
+	hub.subscribe(second, "ch_general")
+	drain(second)
+	payload, _ := json.Marshal(map[string]any{"channel_id": "ch_general"})
+	second.handleEnvelope(Envelope{Type: EventResume, Payload: payload})
+	replayed := drain(second)
+	if len(replayed) != 1 || replayed[0].Type != EventMessageCreated || !strings.Contains(string(replayed[0].Payload), "msg_ack_3") {
+		t.Fatalf("expected only msg_ack_3 to be replayed after reconnecting, got %+v", replayed)
+	}
+
+	if seq, buffered := acked(ack(second, "ch_general", 99)); seq != 3 || buffered != 0 {
+		t.Fatalf("expected an ack past the newest message to clamp to 3 and empty the backlog, got %d/%d", seq, buffered)
+	}
+	if watermark := hub.DeliveredSeq("uid_ack", "ch_general"); watermark != 3 {
+		t.Fatalf("expected delivered watermark 3, got %d", watermark)
+	}
+	second.handleEnvelope(Envelope{Type: EventResume, Payload: payload})
+	if replayed := drain(second); len(replayed) != 0 {
+		t.Fatalf("expected nothing to replay once everything is acked, got %+v", replayed)
+	}
+}
+
+func TestResumeReplaysMissedMessagesAndFlagsTruncation(t *testing.T) {
+	hub := NewHub(slog.Default(), Options{DisablePresence: true, ReplayBufferSize: 80})
+	for i := 1; i <= 90; i++ {
+		hub.BroadcastMessage(chat.Message{ID: fmt.Sprintf("msg_%02d", i), ChannelID: "ch_general", Seq: int64(i)})
+	}
+	c := &client{
+		id:             "client_resume",
+		userUID:        "uid_resume",
+		deviceID:       "dev_resume",
+		hub:            hub,
+		send:           make(chan Envelope, 64),
+		subscriptions:  make(map[string]struct{}),
+		profileWatches: make(map[string]struct{}),
+		closed:         make(chan struct{}),
+	}
+	hub.register(c)
+
+	resume := func(lastSeen string) []Envelope {
+		t.Helper()
+		payload, _ := json.Marshal(map[string]any{"channel_id": "ch_general", "last_seen_message_id": lastSeen})
+		c.handleEnvelope(Envelope{Type: EventResume, RequestID: "resume", Payload: payload})
+		var out []Envelope
+		for len(c.send) > 0 {
+			out = append(out, <-c.send)
+		}
+		return out
+	}
+	messageIDs := func(envelopes []Envelope) []string {
+		ids := make([]string, 0, len(envelopes))
+		for _, envelope := range envelopes {
+			if envelope.Type != EventMessageCreated {
+				t.Fatalf("expected %s, got %s", EventMessageCreated, envelope.Type)
+			}
+			var payload struct {
+				Message chat.Message `json:"message"`
+			}
+			_ = json.Unmarshal(envelope.Payload, &payload)
+			ids = append(ids, payload.Message.ID)
+		}
+		return ids
+	}
+
+	if got := resume("msg_87"); len(got) != 1 || got[0].Type != EventError {
+		t.Fatalf("expected chat_not_subscribed before subscribing, got %+v", got)
+	}
+	hub.subscribe(c, "ch_general")
+
+	if ids := messageIDs(resume("msg_87")); strings.Join(ids, ",") != "msg_88,msg_89,msg_90" {
+		t.Fatalf("expected the three missed messages in order, got %v", ids)
+	}
+
+	got := resume("msg_05")
+	if len(got) != ResumeReplayLimit+1 || got[0].Type != EventResumeTruncated {
+		t.Fatalf("expected a truncation marker and %d messages, got %d envelopes", ResumeReplayLimit, len(got))
+	}
+	if ids := messageIDs(got[1:]); ids[0] != "msg_41" || ids[len(ids)-1] != "msg_90" {
+		t.Fatalf("expected the newest %d messages, got %s..%s", ResumeReplayLimit, ids[0], ids[len(ids)-1])
+	}
+
+	hub.BroadcastChannelPurged("ch_general", "uid_mod")
+	<-c.send
+	if got := resume("msg_89"); len(got) != 1 || got[0].Type != EventResumeTruncated {
+		t.Fatalf("expected only a truncation marker after a purge, got %+v", got)
+	}
+}
+
+func TestSlowConsumerIsClosedAfterConsecutiveDrops(t *testing.T) {
+	hub := NewHub(slog.Default(), Options{DisablePresence: true, SlowConsumerDrops: 3})
+	c := &client{
+		id:          "client_slow",
+		userUID:     "uid_slow",
+		hub:         hub,
+		send:        make(chan Envelope, 2),
+		closeNotice: make(chan Envelope, 1),
+		closed:      make(chan struct{}),
+	}
+	ping := newEnvelope(EventPong, "", nil)
+
+	c.enqueue(ping)
+	c.enqueue(ping)
+	c.enqueue(ping)
+	c.enqueue(ping)
+	<-c.send
+	c.enqueue(ping)
+	c.enqueue(ping)
+	c.enqueue(ping)
+	if len(c.closeNotice) != 0 {
+		t.Fatalf("expected a successful send to reset the consecutive drop count")
+	}
+	c.enqueue(ping)
+	select {
+	case notice := <-c.closeNotice:
+		var payload map[string]any
+		_ = json.Unmarshal(notice.Payload, &payload)
+		if notice.Type != EventError || payload["code"] != "slow_consumer" {
+			t.Fatalf("expected a slow_consumer error, got %s %s", notice.Type, notice.Payload)
+		}
+	default:
+		t.Fatalf("expected the connection to be closed as a slow consumer")
+	}
+	if dropped := hub.Health().DroppedMessages; dropped != 5 {
+		t.Fatalf("expected 5 dropped messages, got %d", dropped)
+	}
+}
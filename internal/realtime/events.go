@@ -0,0 +1,80 @@
+package realtime
+
+type EventType string
+
+const (
+	EventSubscribe             EventType = "chat.subscribe"
+	EventUnsubscribe           EventType = "chat.unsubscribe"
+	EventTypingUpdate          EventType = "chat.typing.update"
+	EventPing                  EventType = "chat.ping"
+	EventAck                   EventType = "chat.ack"
+	EventPresenceUpdate        EventType = "chat.presence.update"
+	EventResume                EventType = "chat.resume"
+	EventProfileSubscribe      EventType = "profile.subscribe"
+	EventProfileUnsubscribe    EventType = "profile.unsubscribe"
+	EventSubscribed            EventType = "chat.subscribed"
+	EventUnsubscribed          EventType = "chat.unsubscribed"
+	EventPresenceSnapshot      EventType = "chat.presence.snapshot"
+	EventPresenceJoined        EventType = "chat.presence.joined"
+	EventPresenceLeft          EventType = "chat.presence.left"
+	EventPresenceStatusUpdated EventType = "chat.presence.updated"
+	EventTypingUpdated         EventType = "chat.typing.updated"
+	EventPong                  EventType = "chat.pong"
+	EventAcked                 EventType = "chat.acked"
+	EventResumeTruncated       EventType = "chat.resume.truncated"
+	EventError                 EventType = "chat.error"
+	EventMessageCreated        EventType = "chat.message.created"
+	EventMessageUpdated        EventType = "chat.message.updated"
+	EventMessageDeleted        EventType = "chat.message.deleted"
+	EventChannelPurged         EventType = "chat.channel.purged"
+	EventChannelWelcome        EventType = "chat.channel.welcome"
+	EventChannelTopicUpdated   EventType = "chat.channel.topic.updated"
+	EventProfileSubscribed     EventType = "profile.subscribed"
+	EventProfileUpdated        EventType = "profile_updated"
+	EventProfileAvatarReady    EventType = "profile.avatar.ready"
+	EventPresenceUpdated       EventType = "presence_updated"
+)
+
+var InboundEvents = map[EventType]struct{}{
+	EventSubscribe:          {},
+	EventUnsubscribe:        {},
+	EventTypingUpdate:       {},
+	EventPing:               {},
+	EventAck:                {},
+	EventPresenceUpdate:     {},
+	EventResume:             {},
+	EventProfileSubscribe:   {},
+	EventProfileUnsubscribe: {},
+}
+
+var OutboundEvents = map[EventType]struct{}{
+	EventSubscribed:            {},
+	EventUnsubscribed:          {},
+	EventPresenceSnapshot:      {},
+	EventPresenceJoined:        {},
+	EventPresenceLeft:          {},
+	EventPresenceStatusUpdated: {},
+	EventTypingUpdated:         {},
+	EventPong:                  {},
+	EventAcked:                 {},
+	EventResumeTruncated:       {},
+	EventError:                 {},
+	EventMessageCreated:        {},
+	EventMessageUpdated:        {},
+	EventMessageDeleted:        {},
+	EventChannelPurged:         {},
+	EventChannelWelcome:        {},
+	EventChannelTopicUpdated:   {},
+	EventProfileSubscribed:     {},
+	EventProfileUpdated:        {},
+	EventProfileAvatarReady:    {},
+	EventPresenceUpdated:       {},
+}
+
+func (t EventType) Known() bool {
+	if _, ok := InboundEvents[t]; ok {
+		return true
+	}
+	_, ok := OutboundEvents[t]
+	return ok
+}
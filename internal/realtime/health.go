@@ -0,0 +1,37 @@
+package realtime
+
+// Health is a point-in-time view of the chat hub for monitoring.
+type Health struct {
+	Connections    int `json:"connections"`
+	Users          int `json:"users"`
+	Channels       int `json:"channels"`
+	Subscriptions  int `json:"subscriptions"`
+	ProfileWatches int `json:"profile_watches"`
+	// QueuedMessages counts envelopes waiting in connection send buffers.
+	QueuedMessages int `json:"queued_messages"`
+	// DroppedMessages counts envelopes lost to full send buffers since start.
+	DroppedMessages int64 `json:"dropped_messages"`
+}
+
+func (h *Hub) Health() Health {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	users := make(map[string]struct{}, len(h.clientsByID))
+	health := Health{
+		Connections:     len(h.clientsByID),
+		Channels:        len(h.subscribersByRoom),
+		DroppedMessages: h.droppedTotal.Load(),
+	}
+	for _, c := range h.clientsByID {
+		users[c.userUID] = struct{}{}
+		health.QueuedMessages += len(c.send)
+	}
+	for _, room := range h.subscribersByRoom {
+		health.Subscriptions += len(room)
+	}
+	for _, watchers := range h.watchersByProfile {
+		health.ProfileWatches += len(watchers)
+	}
+	health.Users = len(users)
+	return health
+}
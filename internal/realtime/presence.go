@@ -0,0 +1,54 @@
+package realtime
+
+import (
+	"strings"
+	"time"
+)
+
+type PresenceStatus struct {
+	UserUID   string     `json:"user_uid"`
+	Status    string     `json:"status"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (h *Hub) Heartbeat(userUID string) PresenceStatus {
+	userUID = strings.TrimSpace(userUID)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.now().UTC()
+	for uid, expiresAt := range h.heartbeats {
+		if !expiresAt.After(now) {
+			delete(h.heartbeats, uid)
+		}
+	}
+	expiresAt := now.Add(h.presenceTTL)
+	h.heartbeats[userUID] = expiresAt
+	return PresenceStatus{UserUID: userUID, Status: "online", ExpiresAt: &expiresAt}
+}
+
+func (h *Hub) Presence(userUIDs []string) []PresenceStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	connected := make(map[string]struct{}, len(h.clientsByID))
+	for _, c := range h.clientsByID {
+		connected[c.userUID] = struct{}{}
+	}
+
+	now := h.now().UTC()
+	out := make([]PresenceStatus, 0, len(userUIDs))
+	for _, userUID := range userUIDs {
+		userUID = strings.TrimSpace(userUID)
+		if userUID == "" {
+			continue
+		}
+		status := PresenceStatus{UserUID: userUID, Status: "offline"}
+		if _, ok := connected[userUID]; ok {
+			status.Status = "online"
+		} else if expiresAt, ok := h.heartbeats[userUID]; ok && expiresAt.After(now) {
+			status.Status = "online"
+			status.ExpiresAt = &expiresAt
+		}
+		out = append(out, status)
+	}
+	return out
+}
@@ -0,0 +1,189 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/openchat/openchat-backend/internal/profile"
+)
+
+// PresenceSource looks up the presence and status text a user has chosen
+// without creating a profile. *profile.Service satisfies it.
+type PresenceSource interface {
+	Get(userUID string) (profile.CanonicalProfile, bool)
+}
+
+func (h *Hub) SetPresenceSource(source PresenceSource) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.presenceSource = source
+}
+
+type presenceStatus struct {
+	Presence   profile.Presence
+	StatusText string
+}
+
+// hidden reports that other users must not see the user at all.
+func (s presenceStatus) hidden() bool {
+	return s.Presence == profile.PresenceInvisible
+}
+
+func chosenStatus(chosen profile.CanonicalProfile) presenceStatus {
+	status := presenceStatus{Presence: profile.PresenceOnline, StatusText: chosen.StatusText}
+	if chosen.Presence != "" {
+		status.Presence = chosen.Presence
+	}
+	return status
+}
+
+// cacheChosenPresence looks up the user's chosen presence before their
+// connection registers, outside the hub lock. An entry already written by
+// BroadcastPresenceUpdated is at least as new and is kept.
+func (h *Hub) cacheChosenPresence(userUID string) {
+	h.mu.RLock()
+	source := h.presenceSource
+	h.mu.RUnlock()
+	status := presenceStatus{Presence: profile.PresenceOnline}
+	if source != nil {
+		if chosen, ok := source.Get(userUID); ok {
+			status = chosenStatus(chosen)
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, cached := h.chosenPresence[userUID]; !cached {
+		h.chosenPresence[userUID] = status
+	}
+}
+
+// userPresenceLocked is the user's chosen presence, with online and idle
+// coalesced across their connections: any active device makes them online.
+// Explicit choices (dnd, offline, invisible) are never overridden.
+func (h *Hub) userPresenceLocked(userUID string) presenceStatus {
+	status, ok := h.chosenPresence[userUID]
+	if !ok {
+		status = presenceStatus{Presence: profile.PresenceOnline}
+	}
+	if status.Presence != profile.PresenceOnline && status.Presence != profile.PresenceIdle {
+		return status
+	}
+	connected := false
+	for _, c := range h.clientsByID {
+		if c.userUID != userUID {
+			continue
+		}
+		if c.activity != profile.PresenceIdle {
+			status.Presence = profile.PresenceOnline
+			return status
+		}
+		connected = true
+	}
+	if connected {
+		status.Presence = profile.PresenceIdle
+	}
+	return status
+}
+
+func (h *Hub) userPresence(userUID string) presenceStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.userPresenceLocked(userUID)
+}
+
+func memberWithStatus(c *client, status presenceStatus) presenceMember {
+	member := presenceMemberFromClient(c)
+	member.Presence = status.Presence
+	member.StatusText = status.StatusText
+	return member
+}
+
+// presencePeers narrows peers to the user's own connections while the user
+// is hidden, so their joins and leaves reach nobody else.
+func presencePeers(peers []*client, userUID string, status presenceStatus) []*client {
+	if !status.hidden() {
+		return peers
+	}
+	own := make([]*client, 0, len(peers))
+	for _, peer := range peers {
+		if peer.userUID == userUID {
+			own = append(own, peer)
+		}
+	}
+	return own
+}
+
+// broadcastUserPresence tells every room the user is subscribed to about a
+// change from before to after, once per room. Other users never see an
+// invisible user: going invisible reaches them as the user's connections
+// leaving the room, and coming back as those connections joining.
+func (h *Hub) broadcastUserPresence(userUID string, before presenceStatus, after presenceStatus) {
+	if h.presenceDisabled {
+		return
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for channelID, room := range h.subscribersByRoom {
+		var own []*client
+		for _, member := range room {
+			if member.userUID == userUID {
+				own = append(own, member)
+			}
+		}
+		if len(own) == 0 {
+			continue
+		}
+		updated := newEnvelope(EventPresenceStatusUpdated, "", map[string]any{
+			"channel_id":  channelID,
+			"user_uid":    userUID,
+			"presence":    after.Presence,
+			"status_text": after.StatusText,
+		})
+		for _, member := range room {
+			switch {
+			case member.userUID == userUID:
+				member.enqueue(updated)
+			case after.hidden() && before.hidden():
+			case after.hidden():
+				for _, c := range own {
+					member.enqueue(newEnvelope(EventPresenceLeft, "", map[string]any{
+						"channel_id": channelID,
+						"member":     presenceMemberFromClient(c),
+					}))
+				}
+			case before.hidden():
+				for _, c := range own {
+					member.enqueue(newEnvelope(EventPresenceJoined, "", map[string]any{
+						"channel_id": channelID,
+						"member":     memberWithStatus(c, after),
+					}))
+				}
+			default:
+				member.enqueue(updated)
+			}
+		}
+	}
+}
+
+// handlePresenceUpdate records whether this connection is active or idle.
+// Rooms hear about it only when the user's coalesced presence changes.
+func (c *client) handlePresenceUpdate(envelope Envelope) {
+	var payload struct {
+		Presence string `json:"presence"`
+	}
+	_ = json.Unmarshal(envelope.Payload, &payload)
+	activity := profile.Presence(strings.ToLower(strings.TrimSpace(payload.Presence)))
+	if activity != profile.PresenceOnline && activity != profile.PresenceIdle {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_presence_invalid", "presence must be online or idle", false))
+		return
+	}
+
+	c.hub.mu.Lock()
+	before := c.hub.userPresenceLocked(c.userUID)
+	c.activity = activity
+	after := c.hub.userPresenceLocked(c.userUID)
+	c.hub.mu.Unlock()
+	if after != before {
+		c.hub.broadcastUserPresence(c.userUID, before, after)
+	}
+}
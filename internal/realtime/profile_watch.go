@@ -0,0 +1,124 @@
+package realtime
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// MaxProfileWatchesPerClient caps how many uids a single connection may follow
+// for profile_updated events.
+const MaxProfileWatchesPerClient = 500
+
+// watchProfiles adds userUIDs to the set of profiles c receives profile_updated
+// events for and returns the resulting set.
+func (h *Hub) watchProfiles(c *client, userUIDs []string) ([]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userUID := range userUIDs {
+		if _, watching := c.profileWatches[userUID]; watching {
+			continue
+		}
+		if len(c.profileWatches) >= MaxProfileWatchesPerClient {
+			return sortedProfileWatches(c), false
+		}
+		c.profileWatches[userUID] = struct{}{}
+		h.addProfileWatcherLocked(userUID, c)
+	}
+	return sortedProfileWatches(c), true
+}
+
+func (h *Hub) unwatchProfiles(c *client, userUIDs []string) []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, userUID := range userUIDs {
+		if _, watching := c.profileWatches[userUID]; !watching {
+			continue
+		}
+		delete(c.profileWatches, userUID)
+		if userUID != c.userUID {
+			h.removeProfileWatcherLocked(userUID, c)
+		}
+	}
+	return sortedProfileWatches(c)
+}
+
+// profileWatchersLocked returns the clients that should see userUID's profile
+// updates: its own connections, plus every client watching it.
+func (h *Hub) profileWatchersLocked(userUID string) []*client {
+	if h.profileUpdatesToAll {
+		clients := make([]*client, 0, len(h.clientsByID))
+		for _, c := range h.clientsByID {
+			clients = append(clients, c)
+		}
+		return clients
+	}
+	watchers := h.watchersByProfile[userUID]
+	clients := make([]*client, 0, len(watchers))
+	for _, c := range watchers {
+		clients = append(clients, c)
+	}
+	return clients
+}
+
+func (h *Hub) addProfileWatcherLocked(userUID string, c *client) {
+	watchers := h.watchersByProfile[userUID]
+	if watchers == nil {
+		watchers = make(map[string]*client)
+		h.watchersByProfile[userUID] = watchers
+	}
+	watchers[c.id] = c
+}
+
+func (h *Hub) removeProfileWatcherLocked(userUID string, c *client) {
+	watchers := h.watchersByProfile[userUID]
+	if watchers == nil {
+		return
+	}
+	delete(watchers, c.id)
+	if len(watchers) == 0 {
+		delete(h.watchersByProfile, userUID)
+	}
+}
+
+func sortedProfileWatches(c *client) []string {
+	userUIDs := make([]string, 0, len(c.profileWatches))
+	for userUID := range c.profileWatches {
+		userUIDs = append(userUIDs, userUID)
+	}
+	sort.Strings(userUIDs)
+	return userUIDs
+}
+
+func decodeProfileWatchUIDs(envelope Envelope) []string {
+	var payload struct {
+		UserUIDs []string `json:"user_uids"`
+	}
+	_ = json.Unmarshal(envelope.Payload, &payload)
+	userUIDs := make([]string, 0, len(payload.UserUIDs))
+	for _, userUID := range payload.UserUIDs {
+		if userUID = strings.TrimSpace(userUID); userUID != "" {
+			userUIDs = append(userUIDs, userUID)
+		}
+	}
+	return userUIDs
+}
+
+func (c *client) handleProfileSubscribe(envelope Envelope) {
+	userUIDs := decodeProfileWatchUIDs(envelope)
+	if len(userUIDs) == 0 {
+		c.enqueue(errorEnvelope(envelope.RequestID, "profile_uids_required", "user_uids is required", false))
+		return
+	}
+	watching, ok := c.hub.watchProfiles(c, userUIDs)
+	if !ok {
+		c.enqueue(errorEnvelope(envelope.RequestID, "profile_watch_limit", "too many profile subscriptions on this connection", false))
+		return
+	}
+	c.enqueue(newEnvelope(EventProfileSubscribed, envelope.RequestID, map[string]any{"user_uids": watching}))
+}
+
+func (c *client) handleProfileUnsubscribe(envelope Envelope) {
+	watching := c.hub.unwatchProfiles(c, decodeProfileWatchUIDs(envelope))
+	c.enqueue(newEnvelope(EventProfileSubscribed, envelope.RequestID, map[string]any{"user_uids": watching}))
+}
@@ -0,0 +1,121 @@
+package realtime
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/openchat/openchat-backend/internal/chat"
+)
+
+const (
+	// DefaultReplayBufferSize is the per-channel history kept for chat.resume
+	// when Options.ReplayBufferSize is unset.
+	DefaultReplayBufferSize = 100
+	// ResumeReplayLimit caps the messages replayed by one chat.resume so the
+	// backlog fits in the connection's send buffer.
+	ResumeReplayLimit = 50
+)
+
+// recordForReplay appends message to its channel's ring buffer. Callers hold
+// at least h.mu.RLock; replayMu serializes concurrent broadcasters.
+func (h *Hub) recordForReplay(message chat.Message) {
+	h.replayMu.Lock()
+	defer h.replayMu.Unlock()
+	buffer := h.replayByChannel[message.ChannelID]
+	if len(buffer) >= h.replayBufferSize {
+		buffer = append(buffer[:0:0], buffer[len(buffer)-h.replayBufferSize+1:]...)
+	}
+	h.replayByChannel[message.ChannelID] = append(buffer, message)
+}
+
+// replaceForReplay swaps in the latest state of an edited or deleted message
+// so a resume replays what the channel shows now.
+func (h *Hub) replaceForReplay(message chat.Message) {
+	h.replayMu.Lock()
+	defer h.replayMu.Unlock()
+	buffer := h.replayByChannel[message.ChannelID]
+	for i := range buffer {
+		if buffer[i].ID == message.ID {
+			buffer[i] = message
+			return
+		}
+	}
+}
+
+func (h *Hub) clearReplay(channelID string) {
+	h.replayMu.Lock()
+	defer h.replayMu.Unlock()
+	delete(h.replayByChannel, channelID)
+}
+
+// missedSince returns the buffered messages after lastSeenID that userUID has
+// not acknowledged, newest ResumeReplayLimit at most. The user's delivered
+// watermark also locates the resume point when lastSeenID is unknown or older.
+// truncated reports that older missed messages could not be replayed, either
+// because neither has a place in the buffer or because more than the limit
+// were missed.
+func (h *Hub) missedSince(userUID string, channelID string, lastSeenID string) ([]chat.Message, bool) {
+	h.replayMu.Lock()
+	defer h.replayMu.Unlock()
+	buffer := h.replayByChannel[channelID]
+	start := -1
+	for i := range buffer {
+		if buffer[i].ID == lastSeenID {
+			start = i + 1
+			break
+		}
+	}
+	watermark := h.deliveredByUser[userUID][channelID]
+	if watermark > 0 && len(buffer) > 0 && watermark >= buffer[0].Seq-1 {
+		if acked := len(buffer) - len(unacknowledged(buffer, watermark)); acked > start {
+			start = acked
+		}
+	}
+	truncated := start < 0
+	if truncated {
+		start = 0
+	}
+	if len(buffer)-start > ResumeReplayLimit {
+		start = len(buffer) - ResumeReplayLimit
+		truncated = true
+	}
+	return append([]chat.Message(nil), buffer[start:]...), truncated
+}
+
+// handleResume replays the channel's messages after last_seen_message_id, or
+// after the user's acknowledged seq, as chat.message.created. It holds the hub write lock so no live broadcast can
+// interleave with the backlog.
+func (c *client) handleResume(envelope Envelope) {
+	var payload struct {
+		ChannelID         string `json:"channel_id"`
+		LastSeenMessageID string `json:"last_seen_message_id"`
+	}
+	_ = json.Unmarshal(envelope.Payload, &payload)
+	channelID := strings.TrimSpace(payload.ChannelID)
+	if channelID == "" {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_channel_required", "channel_id is required", false))
+		return
+	}
+
+	c.hub.mu.Lock()
+	defer c.hub.mu.Unlock()
+	if _, subscribed := c.subscriptions[channelID]; !subscribed {
+		c.enqueue(errorEnvelope(envelope.RequestID, "chat_not_subscribed", "channel subscription is required", false))
+		return
+	}
+	missed, truncated := c.hub.missedSince(c.userUID, channelID, strings.TrimSpace(payload.LastSeenMessageID))
+	if truncated {
+		marker := map[string]any{
+			"channel_id":           channelID,
+			"last_seen_message_id": strings.TrimSpace(payload.LastSeenMessageID),
+			"replayed":             len(missed),
+		}
+		if len(missed) > 0 {
+			marker["oldest_replayed_message_id"] = missed[0].ID
+		}
+		c.enqueue(newEnvelope(EventResumeTruncated, envelope.RequestID, marker))
+	}
+	for _, message := range missed {
+		c.enqueue(newEnvelope(EventMessageCreated, "", map[string]any{"message": message}))
+	}
+}
@@ -0,0 +1,44 @@
+package realtime
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	defaultWelcomeTTL  = 30 * 24 * time.Hour
+	welcomeSweepPeriod = time.Minute
+)
+
+type welcomeKey struct {
+	userUID   string
+	channelID string
+}
+
+// claimWelcome returns the channel's welcome text the first time userUID
+// subscribes to it within the welcome TTL. The text is delivered, never stored.
+func (h *Hub) claimWelcome(userUID string, channelID string) (string, bool) {
+	text := strings.TrimSpace(h.welcomeByChannel[channelID])
+	if text == "" {
+		return "", false
+	}
+
+	h.welcomeMu.Lock()
+	defer h.welcomeMu.Unlock()
+	now := h.now()
+	if now.Sub(h.welcomeSweptAt) >= welcomeSweepPeriod {
+		for key, at := range h.welcomedAt {
+			if now.Sub(at) >= h.welcomeTTL {
+				delete(h.welcomedAt, key)
+			}
+		}
+		h.welcomeSweptAt = now
+	}
+
+	key := welcomeKey{userUID: userUID, channelID: channelID}
+	if at, ok := h.welcomedAt[key]; ok && now.Sub(at) < h.welcomeTTL {
+		return "", false
+	}
+	h.welcomedAt[key] = now
+	return text, true
+}
@@ -0,0 +1,38 @@
+package rtc
+
+import "github.com/gorilla/websocket"
+
+const (
+	// DefaultSendBufferSize is each participant's outbound queue length when
+	// SignalingOptions.SendBufferSize is unset.
+	DefaultSendBufferSize = 64
+	// DefaultSlowConsumerDrops is how many consecutive envelopes may be dropped
+	// on a full queue before the participant is disconnected.
+	DefaultSlowConsumerDrops = 32
+)
+
+// noteDropped counts an envelope lost to a full send queue. Once
+// slowConsumerDrops are dropped in a row the participant is sent a
+// slow_consumer error and disconnected rather than left silently desynced.
+func (c *wsClient) noteDropped(envelope Envelope) {
+	c.service.droppedTotal.Add(1)
+	dropped := c.dropped.Add(1)
+	if c.consecutiveDrops.Add(1) != int64(c.service.slowConsumerDrops) {
+		return
+	}
+	c.service.logger.Warn("disconnecting slow signaling consumer",
+		"participant_id", c.participant.ParticipantID,
+		"user_uid", c.participant.UserUID,
+		"dropped", dropped,
+		"last_type", envelope.Type,
+	)
+	c.closeWith(closeNotice{
+		envelope: NewEnvelope(EventError, c.channelID(), "", map[string]any{
+			"code":      "slow_consumer",
+			"message":   "connection fell too far behind; rejoin with a new ticket",
+			"retryable": true,
+		}),
+		code:   websocket.CloseTryAgainLater,
+		reason: "slow_consumer",
+	})
+}
@@ -0,0 +1,17 @@
+package rtc
+
+// Media-state chunks carry their bytes in chunk_b64. chunk_encoding says how
+// those bytes were packed; the server validates the flag and relays the chunk
+// untouched, so compression costs it nothing.
+const (
+	ChunkEncodingBase64     = "base64"
+	ChunkEncodingGzipBase64 = "gzip+base64"
+)
+
+func knownChunkEncoding(encoding string) bool {
+	switch encoding {
+	case "", ChunkEncodingBase64, ChunkEncodingGzipBase64:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package rtc
+
+type EventType string
+
+const (
+	EventJoin                EventType = "rtc.join"
+	EventLeave               EventType = "rtc.leave"
+	EventPing                EventType = "rtc.ping"
+	EventMediaState          EventType = "rtc.media.state"
+	EventMediaSpeaking       EventType = "rtc.media.speaking"
+	EventSubscribeRequest    EventType = "rtc.subscribe.request"
+	EventPermissionsQuery    EventType = "rtc.permissions.query"
+	EventOfferPublish        EventType = "rtc.offer.publish"
+	EventOfferSubscribe      EventType = "rtc.offer.subscribe"
+	EventAnswerPublish       EventType = "rtc.answer.publish"
+	EventAnswerSubscribe     EventType = "rtc.answer.subscribe"
+	EventICECandidate        EventType = "rtc.ice.candidate"
+	EventModerationMute      EventType = "rtc.moderation.mute"
+	EventModerationUnmute    EventType = "rtc.moderation.unmute"
+	EventModerationKick      EventType = "rtc.moderation.kick"
+	EventJoined              EventType = "rtc.joined"
+	EventPong                EventType = "rtc.pong"
+	EventError               EventType = "rtc.error"
+	EventPermissions         EventType = "rtc.permissions"
+	EventSubscribeAvailable  EventType = "rtc.subscribe.available"
+	EventParticipantJoined   EventType = "rtc.participant.joined"
+	EventParticipantLeft     EventType = "rtc.participant.left"
+	EventParticipantUpdated  EventType = "rtc.participant.updated"
+	EventChannelMigrated     EventType = "rtc.channel.migrated"
+	EventParticipantMuted    EventType = "rtc.participant.muted"
+	EventParticipantUnmuted  EventType = "rtc.participant.unmuted"
+	EventKicked              EventType = "rtc.kicked"
+	EventParticipantSpeaking EventType = "rtc.participant.speaking"
+)
+
+// InboundEvents are the event types clients may send; media state and
+// offer/answer/candidate events are also relayed back out to peers.
+var InboundEvents = map[EventType]struct{}{
+	EventJoin:             {},
+	EventLeave:            {},
+	EventPing:             {},
+	EventMediaState:       {},
+	EventMediaSpeaking:    {},
+	EventSubscribeRequest: {},
+	EventPermissionsQuery: {},
+	EventOfferPublish:     {},
+	EventOfferSubscribe:   {},
+	EventAnswerPublish:    {},
+	EventAnswerSubscribe:  {},
+	EventICECandidate:     {},
+	EventModerationMute:   {},
+	EventModerationUnmute: {},
+	EventModerationKick:   {},
+}
+
+var OutboundEvents = map[EventType]struct{}{
+	EventJoined:              {},
+	EventPong:                {},
+	EventError:               {},
+	EventPermissions:         {},
+	EventSubscribeAvailable:  {},
+	EventParticipantJoined:   {},
+	EventParticipantLeft:     {},
+	EventParticipantUpdated:  {},
+	EventChannelMigrated:     {},
+	EventParticipantMuted:    {},
+	EventParticipantUnmuted:  {},
+	EventKicked:              {},
+	EventParticipantSpeaking: {},
+	EventMediaState:          {},
+	EventOfferPublish:        {},
+	EventOfferSubscribe:      {},
+	EventAnswerPublish:       {},
+	EventAnswerSubscribe:     {},
+	EventICECandidate:        {},
+}
+
+func (t EventType) Known() bool {
+	if _, ok := InboundEvents[t]; ok {
+		return true
+	}
+	_, ok := OutboundEvents[t]
+	return ok
+}
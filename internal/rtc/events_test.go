@@ -0,0 +1,19 @@
+package rtc
+
+import "testing"
+
+func TestInboundHandlersMatchKnownEvents(t *testing.T) {
+	for eventType := range inboundHandlers {
+		if _, ok := InboundEvents[eventType]; !ok {
+			t.Fatalf("handled event %s is missing from InboundEvents", eventType)
+		}
+	}
+	for eventType := range InboundEvents {
+		if _, ok := inboundHandlers[eventType]; !ok {
+			t.Fatalf("inbound event %s has no handler", eventType)
+		}
+	}
+	if EventType("rtc.unknown").Known() {
+		t.Fatalf("expected unregistered event type to be unknown")
+	}
+}
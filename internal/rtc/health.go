@@ -0,0 +1,36 @@
+package rtc
+
+// Health is a point-in-time view of the signaling rooms for monitoring.
+type Health struct {
+	Rooms            int `json:"rooms"`
+	Participants     int `json:"participants"`
+	PublishedStreams int `json:"published_streams"`
+	// QueuedMessages counts envelopes waiting in participant send buffers.
+	QueuedMessages int `json:"queued_messages"`
+	// DroppedMessages counts envelopes lost to full send buffers since start.
+	DroppedMessages int64 `json:"dropped_messages"`
+}
+
+func (s *SignalingService) Health() Health {
+	health := s.rooms.health()
+	health.DroppedMessages = s.droppedTotal.Load()
+	return health
+}
+
+func (h *roomHub) health() Health {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	health := Health{Rooms: len(h.rooms)}
+	for _, room := range h.rooms {
+		health.Participants += len(room)
+		for _, client := range room {
+			health.QueuedMessages += len(client.send)
+		}
+	}
+	for _, byParticipant := range h.streams {
+		for _, streams := range byParticipant {
+			health.PublishedStreams += len(streams)
+		}
+	}
+	return health
+}
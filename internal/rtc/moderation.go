@@ -0,0 +1,136 @@
+package rtc
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// handleModerationKick sends the target rtc.kicked and closes its connection,
+// which broadcasts rtc.participant.left as for any other departure.
+func (c *wsClient) handleModerationKick(envelope Envelope) {
+	target, ok := c.moderationTarget(envelope, "only moderators can kick participants")
+	if !ok {
+		return
+	}
+	target.closeWith(closeNotice{
+		envelope: NewEnvelope(EventKicked, c.channelID(), "", map[string]any{
+			"participant_id": target.participant.ParticipantID,
+			"moderator_id":   c.participant.ParticipantID,
+		}),
+		code:   websocket.ClosePolicyViolation,
+		reason: "rtc_kicked",
+	})
+}
+
+// handleModerationMute force-mutes or releases another participant's audio.
+// The mute applies to the target's user in this channel, so it survives a
+// reconnect; while muted, audio media state is rejected with rtc_media_denied.
+func (c *wsClient) handleModerationMute(envelope Envelope) {
+	target, ok := c.moderationTarget(envelope, "only moderators can mute participants")
+	if !ok {
+		return
+	}
+	targetID := target.participant.ParticipantID
+	targetUID := target.snapshot().UserUID
+
+	muted := envelope.Type == EventModerationMute
+	c.service.setUserMuted(c.channelID(), targetUID, muted)
+	eventType := EventParticipantUnmuted
+	if muted {
+		eventType = EventParticipantMuted
+		c.service.rooms.unpublishAudio(c.channelID(), targetID)
+	}
+	c.service.rooms.broadcast(c.channelID(), NewEnvelope(eventType, c.channelID(), envelope.RequestID, map[string]any{
+		"participant_id": targetID,
+		"user_uid":       targetUID,
+		"moderator_id":   c.participant.ParticipantID,
+	}), "")
+}
+
+// moderationTarget checks that c may moderate and resolves the envelope's
+// target_participant_id, replying with an error when either fails.
+func (c *wsClient) moderationTarget(envelope Envelope, forbiddenMessage string) (*wsClient, bool) {
+	if !c.permissions().Moderator {
+		c.sendError(envelope.RequestID, "rtc_forbidden", forbiddenMessage, false)
+		return nil, false
+	}
+	var payload struct {
+		TargetParticipantID string `json:"target_participant_id"`
+	}
+	if len(envelope.Payload) > 0 {
+		_ = json.Unmarshal(envelope.Payload, &payload)
+	}
+	target := c.service.rooms.client(c.channelID(), strings.TrimSpace(payload.TargetParticipantID))
+	if target == nil {
+		c.sendError(envelope.RequestID, "rtc_target_not_found", "target participant is not available", true)
+		return nil, false
+	}
+	return target, true
+}
+
+func (c *wsClient) forceMuted() bool {
+	participant := c.snapshot()
+	return c.service.userMuted(participant.ChannelID, participant.UserUID)
+}
+
+func (s *SignalingService) userMuted(channelID string, userUID string) bool {
+	s.mutesMu.RLock()
+	defer s.mutesMu.RUnlock()
+	_, muted := s.mutedUsers[channelID][userUID]
+	return muted
+}
+
+func (s *SignalingService) setUserMuted(channelID string, userUID string, muted bool) {
+	s.mutesMu.Lock()
+	defer s.mutesMu.Unlock()
+	if !muted {
+		delete(s.mutedUsers[channelID], userUID)
+		if len(s.mutedUsers[channelID]) == 0 {
+			delete(s.mutedUsers, channelID)
+		}
+		return
+	}
+	if s.mutedUsers == nil {
+		s.mutedUsers = make(map[string]map[string]struct{})
+	}
+	if s.mutedUsers[channelID] == nil {
+		s.mutedUsers[channelID] = make(map[string]struct{})
+	}
+	s.mutedUsers[channelID][userUID] = struct{}{}
+}
+
+// migrateMutes carries fromChannelID's mutes into toChannelID along with its
+// participants.
+func (s *SignalingService) migrateMutes(fromChannelID string, toChannelID string) {
+	s.mutesMu.Lock()
+	defer s.mutesMu.Unlock()
+	muted := s.mutedUsers[fromChannelID]
+	if len(muted) == 0 {
+		return
+	}
+	if s.mutedUsers[toChannelID] == nil {
+		s.mutedUsers[toChannelID] = make(map[string]struct{}, len(muted))
+	}
+	for userUID := range muted {
+		s.mutedUsers[toChannelID][userUID] = struct{}{}
+	}
+	delete(s.mutedUsers, fromChannelID)
+}
+
+func (h *roomHub) client(channelID string, participantID string) *wsClient {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.rooms[channelID][participantID]
+}
+
+// unpublishAudio drops a participant's published audio streams so peers stop
+// being offered them.
+func (h *roomHub) unpublishAudio(channelID string, participantID string) {
+	for _, stream := range h.publishedStreams(channelID) {
+		if stream.ParticipantID == participantID && strings.HasPrefix(stream.StreamKind, "audio") {
+			h.unpublish(channelID, stream)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package rtc
+
+import "time"
+
+// participantStaleAfter is how long a participant may go without a read or
+// pong before the room sweep reclaims it. It comfortably exceeds the read
+// deadline, so the sweep only catches sockets whose read loop never noticed.
+const participantStaleAfter = 60 * time.Second
+
+func (c *wsClient) touch(now time.Time) {
+	c.lastSeen.Store(now.UnixNano())
+}
+
+func (c *wsClient) stale(staleBefore time.Time) bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+	}
+	return c.lastSeen.Load() < staleBefore.UnixNano()
+}
+
+func (s *SignalingService) runRoomSweep(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if reclaimed := s.sweepRooms(now); reclaimed > 0 {
+			s.logger.Info("reclaimed stale rtc participants", "count", reclaimed)
+		}
+	}
+}
+
+// sweepRooms drops participants that went stale at now, closing their
+// connections so peers see them leave, and deletes rooms left empty.
+func (s *SignalingService) sweepRooms(now time.Time) int {
+	stragglers := s.rooms.sweep(now.Add(-participantStaleAfter))
+	for _, client := range stragglers {
+		if client.conn != nil {
+			client.closeConnection()
+		}
+	}
+	return len(stragglers)
+}
+
+func (h *roomHub) sweep(staleBefore time.Time) []*wsClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var stragglers []*wsClient
+	for channelID, room := range h.rooms {
+		for participantID, client := range room {
+			if !client.stale(staleBefore) {
+				continue
+			}
+			stragglers = append(stragglers, client)
+			delete(room, participantID)
+			if published := h.streams[channelID]; published != nil {
+				delete(published, participantID)
+				if len(published) == 0 {
+					delete(h.streams, channelID)
+				}
+			}
+		}
+		if stats := h.stats[channelID]; stats != nil {
+			stats.Participants = len(room)
+		}
+		if len(room) == 0 {
+			delete(h.rooms, channelID)
+		}
+	}
+	return stragglers
+}
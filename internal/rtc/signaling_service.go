@@ -1,28 +1,109 @@
 package rtc
 
 import (
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"log/slog"
+	"math/rand/v2"
 	"net/http"
+	"slices"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
+var (
+	ErrChannelDisabled  = errors.New("rtc is disabled for this channel")
+	ErrMigrationInvalid = errors.New("rtc channel migration requires distinct source and target channels")
+	ErrCapacityReached  = errors.New("rtc room capacity reached")
+	ErrChannelFull      = errors.New("rtc channel is full")
+)
+
 type SignalingService struct {
-	logger    *slog.Logger
-	tokens    *TokenService
-	upgrader  websocket.Upgrader
-	rooms     *roomHub
-	readLimit int64
+	logger          *slog.Logger
+	tokens          *TokenService
+	upgrader        websocket.Upgrader
+	rooms           *roomHub
+	readLimit       int64
+	enabledChannels map[string]struct{}
+	enabledEvents   map[EventType]struct{}
+	bindDevice      bool
+
+	sendBufferSize    int
+	slowConsumerDrops int
+	droppedTotal      atomic.Int64
+
+	// mutedUsers holds moderator mutes by channel and user uid rather than by
+	// connection, so a muted user stays muted after reconnecting.
+	mutesMu    sync.RWMutex
+	mutedUsers map[string]map[string]struct{}
 }
 
-func NewSignalingService(logger *slog.Logger, tokens *TokenService) *SignalingService {
-	return &SignalingService{
+type SignalingOptions struct {
+	EnabledChannels []string
+	// BindTicketDevice requires rtc.join to come from the device the ticket was issued to.
+	BindTicketDevice bool
+	// MaxRooms caps concurrently active rooms; joins that would open a new room
+	// beyond it are rejected with rtc_capacity_reached. Zero means unlimited.
+	MaxRooms int
+	// MaxParticipants caps participants per room; further joins are rejected
+	// with rtc_channel_full. Zero means unlimited.
+	MaxParticipants int
+	// RoomSweepInterval is how often rooms are checked for participants whose
+	// sockets went quiet without closing. Zero disables the sweep.
+	RoomSweepInterval time.Duration
+	// EnabledEvents allowlists inbound event types; others are rejected with
+	// rtc_event_disabled. rtc.join, rtc.leave, and rtc.ping are always
+	// accepted. Empty enables every inbound event.
+	EnabledEvents []string
+	// SendBufferSize is each participant's outbound queue length, and
+	// SlowConsumerDrops the consecutive drops on a full queue before the
+	// participant is disconnected with slow_consumer. Zero means the defaults.
+	SendBufferSize    int
+	SlowConsumerDrops int
+}
+
+func NewSignalingService(logger *slog.Logger, tokens *TokenService, opts SignalingOptions) *SignalingService {
+	var enabledChannels map[string]struct{}
+	for _, channelID := range opts.EnabledChannels {
+		if channelID = strings.TrimSpace(channelID); channelID == "" {
+			continue
+		}
+		if enabledChannels == nil {
+			enabledChannels = make(map[string]struct{})
+		}
+		enabledChannels[channelID] = struct{}{}
+	}
+	var enabledEvents map[EventType]struct{}
+	for _, name := range opts.EnabledEvents {
+		eventType := EventType(strings.TrimSpace(name))
+		if eventType == "" {
+			continue
+		}
+		if _, ok := InboundEvents[eventType]; !ok {
+			logger.Warn("ignoring unknown signaling event in allowlist", "event", eventType)
+			continue
+		}
+		if enabledEvents == nil {
+			enabledEvents = map[EventType]struct{}{EventJoin: {}, EventLeave: {}, EventPing: {}}
+		}
+		enabledEvents[eventType] = struct{}{}
+	}
+	sendBufferSize := opts.SendBufferSize
+	if sendBufferSize <= 0 {
+		sendBufferSize = DefaultSendBufferSize
+	}
+	slowConsumerDrops := opts.SlowConsumerDrops
+	if slowConsumerDrops <= 0 {
+		slowConsumerDrops = DefaultSlowConsumerDrops
+	}
+	service := &SignalingService{
 		logger: logger,
 		tokens: tokens,
 		upgrader: websocket.Upgrader{
@@ -32,9 +113,34 @@ func NewSignalingService(logger *slog.Logger, tokens *TokenService) *SignalingSe
 				return true
 			},
 		},
-		rooms:     newRoomHub(),
-		readLimit: 1 << 20,
+		rooms:             newRoomHub(opts.MaxRooms, opts.MaxParticipants),
+		readLimit:         1 << 20,
+		enabledChannels:   enabledChannels,
+		enabledEvents:     enabledEvents,
+		bindDevice:        opts.BindTicketDevice,
+		sendBufferSize:    sendBufferSize,
+		slowConsumerDrops: slowConsumerDrops,
+	}
+	if opts.RoomSweepInterval > 0 {
+		go service.runRoomSweep(opts.RoomSweepInterval)
+	}
+	return service
+}
+
+func (s *SignalingService) EventEnabled(eventType EventType) bool {
+	if s.enabledEvents == nil {
+		return true
 	}
+	_, ok := s.enabledEvents[eventType]
+	return ok
+}
+
+func (s *SignalingService) ChannelEnabled(channelID string) bool {
+	if s.enabledChannels == nil {
+		return true
+	}
+	_, ok := s.enabledChannels[channelID]
+	return ok
 }
 
 func (s *SignalingService) ServeWS(w http.ResponseWriter, r *http.Request) {
@@ -43,12 +149,18 @@ func (s *SignalingService) ServeWS(w http.ResponseWriter, r *http.Request) {
 		s.logger.Warn("rtc websocket upgrade failed", "error", err)
 		return
 	}
+	deviceID := strings.TrimSpace(r.Header.Get("X-OpenChat-Device-ID"))
+	if deviceID == "" {
+		deviceID = strings.TrimSpace(r.URL.Query().Get("device_id"))
+	}
 	client := &wsClient{
-		id:      uuid.NewString(),
-		conn:    conn,
-		service: s,
-		send:    make(chan Envelope, 64),
-		closed:  make(chan struct{}),
+		id:              uuid.NewString(),
+		conn:            conn,
+		service:         s,
+		claimedDeviceID: deviceID,
+		send:            make(chan Envelope, s.sendBufferSize),
+		closeNotice:     make(chan closeNotice, 1),
+		closed:          make(chan struct{}),
 	}
 	go client.writePump()
 	client.readPump()
@@ -59,7 +171,21 @@ type wsClient struct {
 	conn        *websocket.Conn
 	service     *SignalingService
 	participant Participant
-	send        chan Envelope
+	serverID    string
+	// claimedDeviceID is the device the connection identified as during the upgrade.
+	claimedDeviceID string
+	stateMu         sync.RWMutex
+	iceTypes        map[string]int
+	// lastSeen is the UnixNano of the latest read or pong.
+	lastSeen atomic.Int64
+	// dropped and consecutiveDrops count envelopes lost to a full send queue.
+	dropped          atomic.Int64
+	consecutiveDrops atomic.Int64
+	speaking         speakingState
+	send             chan Envelope
+	// closeNotice carries the final envelope written before a drain or kick
+	// closes the connection.
+	closeNotice chan closeNotice
 	closed      chan struct{}
 	closeOnce   sync.Once
 }
@@ -69,12 +195,33 @@ func (c *wsClient) readPump() {
 	c.conn.SetReadLimit(c.service.readLimit)
 	_ = c.conn.SetReadDeadline(time.Now().Add(40 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
+		c.touch(time.Now())
 		_ = c.conn.SetReadDeadline(time.Now().Add(40 * time.Second))
 		return nil
 	})
 
 	if err := c.waitForJoin(); err != nil {
-		c.sendError("", "rtc_join_denied", err.Error(), false)
+		code := "rtc_join_denied"
+		retryable := false
+		switch {
+		case errors.Is(err, ErrCapacityReached):
+			code = "rtc_capacity_reached"
+			retryable = true
+		case errors.Is(err, ErrChannelFull):
+			code = "rtc_channel_full"
+			retryable = true
+		case errors.Is(err, ErrChannelDisabled):
+			code = "rtc_channel_disabled"
+		case errors.Is(err, ErrTicketBinding):
+			code = "rtc_ticket_binding_failed"
+		}
+		// Write directly: closing the connection would otherwise race the write pump.
+		_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+		_ = c.conn.WriteJSON(NewEnvelope(EventError, "", "", map[string]any{
+			"code":      code,
+			"message":   err.Error(),
+			"retryable": retryable,
+		}))
 		return
 	}
 
@@ -89,6 +236,7 @@ func (c *wsClient) readPump() {
 			}
 			return
 		}
+		c.touch(time.Now())
 		_ = c.conn.SetReadDeadline(time.Now().Add(40 * time.Second))
 		c.handleEnvelope(envelope)
 	}
@@ -100,12 +248,13 @@ func (c *wsClient) waitForJoin() error {
 	if err := c.conn.ReadJSON(&envelope); err != nil {
 		return err
 	}
-	if envelope.Type != "rtc.join" {
+	if envelope.Type != EventJoin {
 		return errors.New("first signaling message must be rtc.join")
 	}
 
 	var payload struct {
 		Ticket string `json:"ticket"`
+		Nonce  string `json:"nonce"`
 	}
 	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
 		return errors.New("invalid rtc.join payload")
@@ -115,6 +264,17 @@ func (c *wsClient) waitForJoin() error {
 	if err != nil {
 		return err
 	}
+	if claims.Nonce != "" && subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(strings.TrimSpace(payload.Nonce))) != 1 {
+		return ErrTicketBinding
+	}
+	// The device is the one claimed at upgrade; a device_id in the join payload
+	// is ignored so a leaked ticket cannot be replayed by naming its device.
+	if c.service.bindDevice && c.claimedDeviceID != claims.DeviceID {
+		return ErrTicketBinding
+	}
+	if !c.service.ChannelEnabled(claims.ChannelID) {
+		return ErrChannelDisabled
+	}
 	participant := Participant{
 		ParticipantID: c.id,
 		ChannelID:     claims.ChannelID,
@@ -124,8 +284,12 @@ func (c *wsClient) waitForJoin() error {
 		JoinedAt:      time.Now().UTC(),
 	}
 	c.participant = participant
+	c.serverID = claims.ServerID
 
-	existing := c.service.rooms.register(c)
+	existing, err := c.service.rooms.register(c)
+	if err != nil {
+		return err
+	}
 
 	joinPayload := map[string]any{
 		"participant_id": participant.ParticipantID,
@@ -133,12 +297,12 @@ func (c *wsClient) waitForJoin() error {
 		"participants":   participantsToSummaries(existing),
 		"joined_at":      participant.JoinedAt.Format(time.RFC3339),
 	}
-	c.enqueue(NewEnvelope("rtc.joined", participant.ChannelID, envelope.RequestID, joinPayload))
+	c.enqueue(NewEnvelope(EventJoined, participant.ChannelID, envelope.RequestID, joinPayload))
 
 	c.service.rooms.broadcast(
 		participant.ChannelID,
 		NewEnvelope(
-			"rtc.participant.joined",
+			EventParticipantJoined,
 			participant.ChannelID,
 			"",
 			map[string]any{"participant": participantSummaryFromParticipant(participant)},
@@ -150,19 +314,46 @@ func (c *wsClient) waitForJoin() error {
 	return nil
 }
 
-func (c *wsClient) handleEnvelope(envelope Envelope) {
-	switch envelope.Type {
-	case "rtc.ping":
-		c.enqueue(NewEnvelope("rtc.pong", c.participant.ChannelID, envelope.RequestID, map[string]any{"ts": time.Now().UTC().Format(time.RFC3339Nano)}))
-	case "rtc.leave":
+var inboundHandlers = map[EventType]func(*wsClient, Envelope){
+	EventJoin: func(c *wsClient, envelope Envelope) {
+		c.sendError(envelope.RequestID, "rtc_already_joined", "connection has already joined a channel", false)
+	},
+	EventLeave: func(c *wsClient, _ Envelope) {
 		c.closeConnection()
-	case "rtc.media.state":
-		c.relayMediaState(envelope)
-	case "rtc.offer.publish", "rtc.offer.subscribe", "rtc.answer.publish", "rtc.answer.subscribe", "rtc.ice.candidate":
-		c.forwardSignal(envelope)
-	default:
+	},
+	EventPing: func(c *wsClient, envelope Envelope) {
+		c.enqueue(NewEnvelope(EventPong, c.channelID(), envelope.RequestID, map[string]any{"ts": time.Now().UTC().Format(time.RFC3339Nano)}))
+	},
+	EventMediaState:       (*wsClient).relayMediaState,
+	EventMediaSpeaking:    (*wsClient).handleMediaSpeaking,
+	EventSubscribeRequest: (*wsClient).listAvailableStreams,
+	EventPermissionsQuery: func(c *wsClient, envelope Envelope) {
+		c.enqueue(NewEnvelope(EventPermissions, c.channelID(), envelope.RequestID, map[string]any{
+			"participant_id": c.participant.ParticipantID,
+			"permissions":    c.permissions(),
+		}))
+	},
+	EventOfferPublish:     (*wsClient).forwardSignal,
+	EventOfferSubscribe:   (*wsClient).forwardSignal,
+	EventAnswerPublish:    (*wsClient).forwardSignal,
+	EventAnswerSubscribe:  (*wsClient).forwardSignal,
+	EventICECandidate:     (*wsClient).forwardSignal,
+	EventModerationMute:   (*wsClient).handleModerationMute,
+	EventModerationUnmute: (*wsClient).handleModerationMute,
+	EventModerationKick:   (*wsClient).handleModerationKick,
+}
+
+func (c *wsClient) handleEnvelope(envelope Envelope) {
+	handler, ok := inboundHandlers[envelope.Type]
+	if !ok {
 		c.sendError(envelope.RequestID, "rtc_unknown_event", "unsupported signaling event type", false)
+		return
 	}
+	if !c.service.EventEnabled(envelope.Type) {
+		c.sendError(envelope.RequestID, "rtc_event_disabled", "signaling event type is disabled on this server", false)
+		return
+	}
+	handler(c, envelope)
 }
 
 func (c *wsClient) relayMediaState(envelope Envelope) {
@@ -174,31 +365,90 @@ func (c *wsClient) relayMediaState(envelope Envelope) {
 		payload = make(map[string]any)
 	}
 
+	if encoding, _ := payload["chunk_encoding"].(string); !knownChunkEncoding(encoding) {
+		c.sendError(envelope.RequestID, "rtc_invalid_payload", "unsupported chunk_encoding", false)
+		return
+	}
+
 	streamKind, _ := payload["stream_kind"].(string)
 	streamKind = strings.TrimSpace(streamKind)
+	permissions := c.permissions()
 	switch streamKind {
 	case "":
 		// Presence-only media state updates are allowed without stream checks.
 	case "video_camera":
-		if !c.participant.Permissions.Video {
+		if !permissions.Video {
 			c.sendError(envelope.RequestID, "rtc_media_denied", "participant is not allowed to publish camera video", false)
 			return
 		}
 	case "video_screen":
-		if !c.participant.Permissions.Screenshare {
+		if !permissions.Screenshare {
 			c.sendError(envelope.RequestID, "rtc_media_denied", "participant is not allowed to publish screen share", false)
 			return
 		}
 	default:
-		if strings.HasPrefix(streamKind, "audio") && !c.participant.Permissions.Speak {
+		if strings.HasPrefix(streamKind, "audio") && !permissions.Speak {
 			c.sendError(envelope.RequestID, "rtc_media_denied", "participant is not allowed to publish audio", false)
 			return
 		}
+		if strings.HasPrefix(streamKind, "audio") && c.forceMuted() {
+			c.sendError(envelope.RequestID, "rtc_media_denied", "participant was muted by a moderator", false)
+			return
+		}
+	}
+
+	if streamID, _ := payload["stream_id"].(string); strings.TrimSpace(streamID) != "" && streamKind != "" {
+		active, hasActive := payload["active"].(bool)
+		stream := PublishedStream{
+			ParticipantID: c.participant.ParticipantID,
+			UserUID:       c.participant.UserUID,
+			StreamID:      strings.TrimSpace(streamID),
+			StreamKind:    streamKind,
+		}
+		eof, _ := payload["eof"].(bool)
+		var kinds []string
+		var changed bool
+		if (hasActive && !active) || eof {
+			kinds, changed = c.service.rooms.unpublish(c.channelID(), stream)
+		} else {
+			kinds, changed = c.service.rooms.publish(c.channelID(), stream)
+		}
+		if changed {
+			summary := participantSummaryFromParticipant(c.snapshot())
+			summary["active_stream_kinds"] = kinds
+			c.service.rooms.broadcast(c.channelID(), NewEnvelope(EventParticipantUpdated, c.channelID(), "", map[string]any{
+				"participant": summary,
+			}), "")
+		}
 	}
 
 	payload["participant_id"] = c.participant.ParticipantID
 	payload["user_uid"] = c.participant.UserUID
-	c.service.rooms.broadcast(c.participant.ChannelID, NewEnvelope("rtc.media.state", c.participant.ChannelID, envelope.RequestID, payload), "")
+	c.service.rooms.broadcast(c.channelID(), NewEnvelope(EventMediaState, c.channelID(), envelope.RequestID, payload), "")
+}
+
+func (c *wsClient) listAvailableStreams(envelope Envelope) {
+	var payload struct {
+		ParticipantID string `json:"participant_id"`
+	}
+	if len(envelope.Payload) > 0 {
+		_ = json.Unmarshal(envelope.Payload, &payload)
+	}
+	targetID := strings.TrimSpace(payload.ParticipantID)
+
+	streams := make([]PublishedStream, 0)
+	for _, stream := range c.service.rooms.publishedStreams(c.channelID()) {
+		if stream.ParticipantID == c.participant.ParticipantID {
+			continue
+		}
+		if targetID != "" && stream.ParticipantID != targetID {
+			continue
+		}
+		streams = append(streams, stream)
+	}
+	c.enqueue(NewEnvelope(EventSubscribeAvailable, c.channelID(), envelope.RequestID, map[string]any{
+		"streams": streams,
+	}))
 }
 
 func (c *wsClient) forwardSignal(envelope Envelope) {
@@ -210,22 +460,25 @@ func (c *wsClient) forwardSignal(envelope Envelope) {
 		payload = make(map[string]any)
 	}
 	payload["from_participant_id"] = c.participant.ParticipantID
+	if envelope.Type == EventICECandidate {
+		c.tallyCandidate(payload["candidate"])
+	}
 
 	targetID, _ := payload["target_participant_id"].(string)
 	targetID = strings.TrimSpace(targetID)
-	forward := NewEnvelope(envelope.Type, c.participant.ChannelID, envelope.RequestID, payload)
+	forward := NewEnvelope(envelope.Type, c.channelID(), envelope.RequestID, payload)
 
 	if targetID != "" {
-		if ok := c.service.rooms.sendToParticipant(c.participant.ChannelID, targetID, forward); !ok {
+		if ok := c.service.rooms.sendToParticipant(c.channelID(), targetID, forward); !ok {
 			c.sendError(envelope.RequestID, "rtc_target_not_found", "target participant is not available", true)
 		}
 		return
 	}
 
-	c.service.rooms.broadcast(c.participant.ChannelID, forward, c.participant.ParticipantID)
+	c.service.rooms.broadcast(c.channelID(), forward, c.participant.ParticipantID)
 }
 
-func (c *wsClient) relayToRoom(eventType string, envelope Envelope) {
+func (c *wsClient) relayToRoom(eventType EventType, envelope Envelope) {
 	var payload map[string]any
 	if len(envelope.Payload) > 0 {
 		_ = json.Unmarshal(envelope.Payload, &payload)
@@ -236,11 +489,76 @@ func (c *wsClient) relayToRoom(eventType string, envelope Envelope) {
 	payload["participant_id"] = c.participant.ParticipantID
 	payload["user_uid"] = c.participant.UserUID
 
-	c.service.rooms.broadcast(c.participant.ChannelID, NewEnvelope(eventType, c.participant.ChannelID, envelope.RequestID, payload), "")
+	c.service.rooms.broadcast(c.channelID(), NewEnvelope(eventType, c.channelID(), envelope.RequestID, payload), "")
+}
+
+func (c *wsClient) permissions() Permissions {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.participant.Permissions
+}
+
+func (c *wsClient) setPermissions(permissions Permissions) Participant {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	c.participant.Permissions = permissions
+	return c.participant
+}
+
+func (c *wsClient) tallyCandidate(raw any) {
+	candidate, _ := raw.(string)
+	if nested, ok := raw.(map[string]any); ok {
+		candidate, _ = nested["candidate"].(string)
+	}
+	candidateType := iceCandidateType(candidate)
+	if candidateType == "" {
+		return
+	}
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+	if c.iceTypes == nil {
+		c.iceTypes = make(map[string]int)
+	}
+	c.iceTypes[candidateType]++
+}
+
+func (c *wsClient) rosterEntry() RosterEntry {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	counts := make(map[string]int, len(c.iceTypes))
+	for candidateType, count := range c.iceTypes {
+		counts[candidateType] = count
+	}
+	return RosterEntry{Participant: c.participant, ICECandidateTypes: counts}
+}
+
+// iceCandidateType reads the "typ" attribute of an SDP candidate line (RFC 8839).
+func iceCandidateType(candidate string) string {
+	fields := strings.Fields(candidate)
+	for idx := 0; idx+1 < len(fields); idx++ {
+		if fields[idx] == "typ" {
+			return strings.ToLower(fields[idx+1])
+		}
+	}
+	return ""
+}
+
+// channelID is read under stateMu because a migration can move the client to
+// another room while its pumps are running.
+func (c *wsClient) channelID() string {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.participant.ChannelID
+}
+
+func (c *wsClient) snapshot() Participant {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.participant
 }
 
 func (c *wsClient) sendError(requestID string, code string, message string, retryable bool) {
-	c.enqueue(NewEnvelope("rtc.error", c.participant.ChannelID, requestID, map[string]any{
+	c.enqueue(NewEnvelope(EventError, c.channelID(), requestID, map[string]any{
 		"code":      code,
 		"message":   message,
 		"retryable": retryable,
@@ -250,13 +568,15 @@ func (c *wsClient) sendError(requestID string, code string, message string, retr
 func (c *wsClient) enqueue(envelope Envelope) {
 	select {
 	case c.send <- envelope:
+		c.consecutiveDrops.Store(0)
 	default:
-		c.service.logger.Warn("dropping signaling message due to full send queue", "participant_id", c.participant.ParticipantID, "type", envelope.Type)
+		c.service.logger.Warn("dropping signaling message due to full send queue", "participant_id", c.participant.ParticipantID, "type", envelope.Type, "dropped", c.dropped.Load()+1)
+		c.noteDropped(envelope)
 	}
 }
 
 func (c *wsClient) writePump() {
-	ticker := time.NewTicker(20 * time.Second)
+	ticker := time.NewTicker(jitteredPingInterval())
 	defer ticker.Stop()
 	for {
 		select {
@@ -269,6 +589,12 @@ func (c *wsClient) writePump() {
 			if err := c.conn.WriteJSON(envelope); err != nil {
 				return
 			}
+		case notice := <-c.closeNotice:
+			_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+			_ = c.conn.WriteJSON(notice.envelope)
+			_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(notice.code, notice.reason), time.Now().Add(time.Second))
+			c.closeConnection()
+			return
 		case <-ticker.C:
 			_ = c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.conn.WriteControl(websocket.PingMessage, []byte("ping"), time.Now().Add(10*time.Second)); err != nil {
@@ -280,15 +606,73 @@ func (c *wsClient) writePump() {
 	}
 }
 
+const (
+	pingInterval = 20 * time.Second
+	pingJitter   = 2 * time.Second
+	// drainReconnectAfter is the rejoin delay suggested to drained clients.
+	drainReconnectAfter = time.Second
+)
+
+// jitteredPingInterval spreads keepalives so connections opened together do not
+// ping in lockstep; the upper bound stays well inside the 40s read deadline.
+func jitteredPingInterval() time.Duration {
+	return pingInterval - pingJitter + rand.N(2*pingJitter+1)
+}
+
+// drain asks the write pump to send an rtc_server_draining error with a fresh
+// join ticket and then close the connection.
+func (c *wsClient) drain(reconnectAfter time.Duration) {
+	participant := c.snapshot()
+	payload := map[string]any{
+		"code":               "rtc_server_draining",
+		"message":            "rtc room is draining; rejoin with the attached ticket",
+		"retryable":          true,
+		"reconnect_after_ms": reconnectAfter.Milliseconds(),
+	}
+	ticket, claims, err := c.service.tokens.Issue(IssueTicketInput{
+		ServerID:    c.serverID,
+		ChannelID:   participant.ChannelID,
+		UserUID:     participant.UserUID,
+		DeviceID:    participant.DeviceID,
+		Permissions: participant.Permissions,
+	})
+	if err != nil {
+		c.service.logger.Warn("rtc drain ticket issue failed", "participant_id", participant.ParticipantID, "error", err)
+	} else {
+		payload["ticket"] = ticket
+		payload["ticket_expires_at"] = time.Unix(claims.ExpiresAt, 0).UTC().Format(time.RFC3339)
+	}
+	c.closeWith(closeNotice{
+		envelope: NewEnvelope(EventError, participant.ChannelID, "", payload),
+		code:     websocket.CloseTryAgainLater,
+		reason:   "rtc_server_draining",
+	})
+}
+
+type closeNotice struct {
+	envelope Envelope
+	code     int
+	reason   string
+}
+
+// closeWith hands the write pump a final envelope to send before it closes the
+// connection. Only the first notice is kept.
+func (c *wsClient) closeWith(notice closeNotice) {
+	select {
+	case c.closeNotice <- notice:
+	default:
+	}
+}
+
 func (c *wsClient) closeConnection() {
 	c.closeOnce.Do(func() {
-		if c.participant.ChannelID != "" {
-			c.service.rooms.unregister(c.participant.ChannelID, c.participant.ParticipantID)
+		if c.channelID() != "" {
+			c.service.rooms.unregister(c.channelID(), c.participant.ParticipantID)
 			c.service.rooms.broadcast(
-				c.participant.ChannelID,
+				c.channelID(),
 				NewEnvelope(
-					"rtc.participant.left",
-					c.participant.ChannelID,
+					EventParticipantLeft,
+					c.channelID(),
 					"",
 					map[string]any{
 						"participant": map[string]any{
@@ -300,35 +684,218 @@ func (c *wsClient) closeConnection() {
 				"",
 			)
 		}
+		if dropped := c.dropped.Load(); dropped > 0 {
+			c.service.logger.Info("signaling connection closed with dropped events", "participant_id", c.participant.ParticipantID, "dropped", dropped)
+		}
 		close(c.closed)
 		close(c.send)
 		_ = c.conn.Close()
 	})
 }
 
+func (s *SignalingService) RoomStats() []RoomStats {
+	return s.rooms.snapshotStats()
+}
+
+func (s *SignalingService) Roster(channelID string) []RosterEntry {
+	return s.rooms.roster(channelID)
+}
+
+// Participation lists every room userUID currently appears in, across all of
+// the user's devices, oldest join first.
+func (s *SignalingService) Participation(userUID string) []Participant {
+	return s.rooms.participation(userUID)
+}
+
+// MigrateChannel moves every participant in fromChannelID's room to
+// toChannelID, keeping participant ids, and notifies them of the new channel.
+// When the target room is occupied, both sides get rtc.participant.joined for
+// each other. A merge that would overfill the target fails with ErrChannelFull.
+func (s *SignalingService) MigrateChannel(fromChannelID string, toChannelID string) (int, error) {
+	fromChannelID = strings.TrimSpace(fromChannelID)
+	toChannelID = strings.TrimSpace(toChannelID)
+	if fromChannelID == "" || toChannelID == "" || fromChannelID == toChannelID {
+		return 0, ErrMigrationInvalid
+	}
+	if !s.ChannelEnabled(toChannelID) {
+		return 0, ErrChannelDisabled
+	}
+	moved, existing, err := s.rooms.migrate(fromChannelID, toChannelID)
+	if err != nil {
+		return 0, err
+	}
+	s.migrateMutes(fromChannelID, toChannelID)
+	for _, participant := range moved {
+		s.rooms.sendToParticipant(toChannelID, participant.ParticipantID, NewEnvelope(EventChannelMigrated, toChannelID, "", map[string]any{
+			"from_channel_id": fromChannelID,
+			"channel_id":      toChannelID,
+			"participant":     participantSummaryFromParticipant(participant),
+		}))
+	}
+	for _, participant := range moved {
+		for _, peer := range existing {
+			s.rooms.sendToParticipant(toChannelID, participant.ParticipantID, NewEnvelope(EventParticipantJoined, toChannelID, "", map[string]any{
+				"participant": participantSummaryFromParticipant(peer),
+			}))
+			s.rooms.sendToParticipant(toChannelID, peer.ParticipantID, NewEnvelope(EventParticipantJoined, toChannelID, "", map[string]any{
+				"participant": participantSummaryFromParticipant(participant),
+			}))
+		}
+	}
+	return len(moved), nil
+}
+
+// DrainChannel disconnects every participant in channelID's room, leaving other
+// rooms untouched, and returns how many were drained.
+func (s *SignalingService) DrainChannel(channelID string) int {
+	clients := s.rooms.clients(channelID)
+	for _, client := range clients {
+		client.drain(drainReconnectAfter)
+	}
+	return len(clients)
+}
+
+func (s *SignalingService) ChannelHasParticipants(channelID string) bool {
+	return s.rooms.participantCount(channelID) > 0
+}
+
+func (s *SignalingService) UpdateParticipantPermissions(channelID string, userUID string, permissions Permissions) int {
+	updated := s.rooms.updatePermissions(channelID, userUID, permissions)
+	for _, participant := range updated {
+		summary := participantSummaryFromParticipant(participant)
+		summary["active_stream_kinds"] = s.rooms.activeStreamKinds(channelID, participant.ParticipantID)
+		s.rooms.broadcast(
+			channelID,
+			NewEnvelope(
+				EventParticipantUpdated,
+				channelID,
+				"",
+				map[string]any{"participant": summary},
+			),
+			"",
+		)
+	}
+	return len(updated)
+}
+
 type roomHub struct {
-	mu    sync.RWMutex
-	rooms map[string]map[string]*wsClient
+	mu       sync.RWMutex
+	rooms    map[string]map[string]*wsClient
+	stats    map[string]*RoomStats
+	streams  map[string]map[string]map[string]PublishedStream
+	maxRooms int
+	// maxParticipants bounds each room on register and migrate.
+	maxParticipants int
 }
 
-func newRoomHub() *roomHub {
-	return &roomHub{rooms: make(map[string]map[string]*wsClient)}
+func newRoomHub(maxRooms int, maxParticipants int) *roomHub {
+	return &roomHub{
+		rooms:           make(map[string]map[string]*wsClient),
+		stats:           make(map[string]*RoomStats),
+		streams:         make(map[string]map[string]map[string]PublishedStream),
+		maxRooms:        maxRooms,
+		maxParticipants: maxParticipants,
+	}
 }
 
-func (h *roomHub) register(client *wsClient) []Participant {
+func (h *roomHub) register(client *wsClient) ([]Participant, error) {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	room := h.rooms[client.participant.ChannelID]
 	if room == nil {
+		if h.maxRooms > 0 && len(h.rooms) >= h.maxRooms {
+			return nil, ErrCapacityReached
+		}
 		room = make(map[string]*wsClient)
 		h.rooms[client.participant.ChannelID] = room
 	}
+	if h.maxParticipants > 0 && len(room) >= h.maxParticipants {
+		return nil, ErrChannelFull
+	}
+	client.touch(time.Now())
 	existing := make([]Participant, 0, len(room))
 	for _, peer := range room {
-		existing = append(existing, peer.participant)
+		existing = append(existing, peer.snapshot())
 	}
 	room[client.participant.ParticipantID] = client
-	return existing
+
+	stats := h.stats[client.participant.ChannelID]
+	if stats == nil {
+		stats = &RoomStats{ChannelID: client.participant.ChannelID}
+		h.stats[client.participant.ChannelID] = stats
+	}
+	stats.TotalJoins++
+	stats.Participants = len(room)
+	if stats.Participants > stats.PeakParticipants {
+		stats.PeakParticipants = stats.Participants
+	}
+	return existing, nil
+}
+
+// migrate moves fromChannelID's clients into toChannelID and returns them along
+// with the target's prior occupants. The source room is removed, so a merge
+// never raises the room count past maxRooms.
+func (h *roomHub) migrate(fromChannelID string, toChannelID string) ([]Participant, []Participant, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	room := h.rooms[fromChannelID]
+	if len(room) == 0 {
+		return nil, nil, nil
+	}
+	target := h.rooms[toChannelID]
+	if h.maxParticipants > 0 && len(target)+len(room) > h.maxParticipants {
+		return nil, nil, ErrChannelFull
+	}
+	existing := make([]Participant, 0, len(target))
+	for _, peer := range target {
+		existing = append(existing, peer.snapshot())
+	}
+	if target == nil {
+		target = make(map[string]*wsClient, len(room))
+		h.rooms[toChannelID] = target
+	}
+	moved := make([]Participant, 0, len(room))
+	for participantID, client := range room {
+		client.stateMu.Lock()
+		client.participant.ChannelID = toChannelID
+		participant := client.participant
+		client.stateMu.Unlock()
+		target[participantID] = client
+		moved = append(moved, participant)
+	}
+	delete(h.rooms, fromChannelID)
+
+	if published := h.streams[fromChannelID]; published != nil {
+		targetStreams := h.streams[toChannelID]
+		if targetStreams == nil {
+			targetStreams = make(map[string]map[string]PublishedStream, len(published))
+			h.streams[toChannelID] = targetStreams
+		}
+		for participantID, byStreamID := range published {
+			targetStreams[participantID] = byStreamID
+		}
+		delete(h.streams, fromChannelID)
+	}
+
+	if stats := h.stats[fromChannelID]; stats != nil {
+		stats.Participants = 0
+	}
+	stats := h.stats[toChannelID]
+	if stats == nil {
+		stats = &RoomStats{ChannelID: toChannelID}
+		h.stats[toChannelID] = stats
+	}
+	stats.Participants = len(target)
+	if stats.Participants > stats.PeakParticipants {
+		stats.PeakParticipants = stats.Participants
+	}
+	sort.Slice(moved, func(i, j int) bool {
+		return moved[i].JoinedAt.Before(moved[j].JoinedAt)
+	})
+	sort.Slice(existing, func(i, j int) bool {
+		return existing[i].JoinedAt.Before(existing[j].JoinedAt)
+	})
+	return moved, existing, nil
 }
 
 func (h *roomHub) unregister(channelID string, participantID string) {
@@ -339,11 +906,175 @@ func (h *roomHub) unregister(channelID string, participantID string) {
 		return
 	}
 	delete(room, participantID)
+	if published := h.streams[channelID]; published != nil {
+		delete(published, participantID)
+		if len(published) == 0 {
+			delete(h.streams, channelID)
+		}
+	}
+	if stats := h.stats[channelID]; stats != nil {
+		stats.Participants = len(room)
+	}
 	if len(room) == 0 {
 		delete(h.rooms, channelID)
 	}
 }
 
+func (h *roomHub) updatePermissions(channelID string, userUID string, permissions Permissions) []Participant {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	updated := make([]Participant, 0, 1)
+	for _, client := range h.rooms[channelID] {
+		if client.participant.UserUID != userUID {
+			continue
+		}
+		if client.permissions() == permissions {
+			continue
+		}
+		updated = append(updated, client.setPermissions(permissions))
+	}
+	return updated
+}
+
+// publish records a live stream and reports the participant's active stream
+// kinds, along with whether that set changed.
+func (h *roomHub) publish(channelID string, stream PublishedStream) ([]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, joined := h.rooms[channelID][stream.ParticipantID]; !joined {
+		return nil, false
+	}
+	before := h.activeStreamKindsLocked(channelID, stream.ParticipantID)
+	published := h.streams[channelID]
+	if published == nil {
+		published = make(map[string]map[string]PublishedStream)
+		h.streams[channelID] = published
+	}
+	byStreamID := published[stream.ParticipantID]
+	if byStreamID == nil {
+		byStreamID = make(map[string]PublishedStream)
+		published[stream.ParticipantID] = byStreamID
+	}
+	byStreamID[stream.StreamID] = stream
+	after := h.activeStreamKindsLocked(channelID, stream.ParticipantID)
+	return after, !slices.Equal(before, after)
+}
+
+func (h *roomHub) unpublish(channelID string, stream PublishedStream) ([]string, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	published := h.streams[channelID]
+	if published == nil {
+		return []string{}, false
+	}
+	before := h.activeStreamKindsLocked(channelID, stream.ParticipantID)
+	delete(published[stream.ParticipantID], stream.StreamID)
+	if len(published[stream.ParticipantID]) == 0 {
+		delete(published, stream.ParticipantID)
+	}
+	if len(published) == 0 {
+		delete(h.streams, channelID)
+	}
+	after := h.activeStreamKindsLocked(channelID, stream.ParticipantID)
+	return after, !slices.Equal(before, after)
+}
+
+func (h *roomHub) activeStreamKinds(channelID string, participantID string) []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.activeStreamKindsLocked(channelID, participantID)
+}
+
+func (h *roomHub) activeStreamKindsLocked(channelID string, participantID string) []string {
+	kinds := make([]string, 0)
+	for _, stream := range h.streams[channelID][participantID] {
+		if !slices.Contains(kinds, stream.StreamKind) {
+			kinds = append(kinds, stream.StreamKind)
+		}
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+func (h *roomHub) publishedStreams(channelID string) []PublishedStream {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]PublishedStream, 0)
+	for _, byStreamID := range h.streams[channelID] {
+		for _, stream := range byStreamID {
+			out = append(out, stream)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].ParticipantID != out[j].ParticipantID {
+			return out[i].ParticipantID < out[j].ParticipantID
+		}
+		return out[i].StreamID < out[j].StreamID
+	})
+	return out
+}
+
+func (h *roomHub) roster(channelID string) []RosterEntry {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]RosterEntry, 0, len(h.rooms[channelID]))
+	for _, client := range h.rooms[channelID] {
+		entry := client.rosterEntry()
+		entry.ActiveStreamKinds = h.activeStreamKindsLocked(channelID, entry.ParticipantID)
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].JoinedAt.Before(out[j].JoinedAt)
+	})
+	return out
+}
+
+func (h *roomHub) participation(userUID string) []Participant {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]Participant, 0)
+	for _, room := range h.rooms {
+		for _, client := range room {
+			if participant := client.snapshot(); participant.UserUID == userUID {
+				out = append(out, participant)
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].JoinedAt.Before(out[j].JoinedAt)
+	})
+	return out
+}
+
+func (h *roomHub) clients(channelID string) []*wsClient {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]*wsClient, 0, len(h.rooms[channelID]))
+	for _, client := range h.rooms[channelID] {
+		out = append(out, client)
+	}
+	return out
+}
+
+func (h *roomHub) participantCount(channelID string) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.rooms[channelID])
+}
+
+func (h *roomHub) snapshotStats() []RoomStats {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make([]RoomStats, 0, len(h.stats))
+	for _, stats := range h.stats {
+		out = append(out, *stats)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].ChannelID < out[j].ChannelID
+	})
+	return out
+}
+
 func (h *roomHub) broadcast(channelID string, envelope Envelope, exceptParticipantID string) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
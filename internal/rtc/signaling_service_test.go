@@ -0,0 +1,534 @@
+package rtc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func testRoomClient(channelID string, participantID string) *wsClient {
+	return &wsClient{
+		id: participantID,
+		participant: Participant{
+			ParticipantID: participantID,
+			ChannelID:     channelID,
+			UserUID:       "uid_" + participantID,
+		},
+		send:   make(chan Envelope, 64),
+		closed: make(chan struct{}),
+	}
+}
+
+func TestRoomHubTracksPeakConcurrencyAndJoins(t *testing.T) {
+	hub := newRoomHub(0, 0)
+
+	a := testRoomClient("vc_general", "p_a")
+	b := testRoomClient("vc_general", "p_b")
+	c := testRoomClient("vc_general", "p_c")
+	hub.register(a)
+	hub.register(b)
+	hub.register(c)
+	hub.unregister("vc_general", "p_a")
+	hub.unregister("vc_general", "p_b")
+	hub.register(testRoomClient("vc_general", "p_d"))
+	hub.register(testRoomClient("vc_party", "p_e"))
+
+	stats := hub.snapshotStats()
+	if len(stats) != 2 {
+		t.Fatalf("expected stats for 2 channels, got %d", len(stats))
+	}
+	general := stats[0]
+	if general.ChannelID != "vc_general" {
+		t.Fatalf("expected vc_general first, got %s", general.ChannelID)
+	}
+	if general.PeakParticipants != 3 {
+		t.Fatalf("expected peak of 3, got %d", general.PeakParticipants)
+	}
+	if general.TotalJoins != 4 {
+		t.Fatalf("expected 4 total joins, got %d", general.TotalJoins)
+	}
+	if general.Participants != 2 {
+		t.Fatalf("expected 2 current participants, got %d", general.Participants)
+	}
+
+	hub.unregister("vc_party", "p_e")
+	stats = hub.snapshotStats()
+	if stats[1].Participants != 0 || stats[1].PeakParticipants != 1 || stats[1].TotalJoins != 1 {
+		t.Fatalf("expected emptied room to keep cumulative counters, got %+v", stats[1])
+	}
+}
+
+func TestRoomHubRejectsNewRoomsBeyondCap(t *testing.T) {
+	hub := newRoomHub(2, 0)
+
+	if _, err := hub.register(testRoomClient("vc_one", "p_a")); err != nil {
+		t.Fatalf("register first room: %v", err)
+	}
+	if _, err := hub.register(testRoomClient("vc_two", "p_b")); err != nil {
+		t.Fatalf("register second room: %v", err)
+	}
+	if _, err := hub.register(testRoomClient("vc_three", "p_c")); !errors.Is(err, ErrCapacityReached) {
+		t.Fatalf("expected ErrCapacityReached for a third room, got %v", err)
+	}
+	if _, err := hub.register(testRoomClient("vc_one", "p_d")); err != nil {
+		t.Fatalf("expected join to an existing room to succeed, got %v", err)
+	}
+
+	hub.unregister("vc_two", "p_b")
+	if _, err := hub.register(testRoomClient("vc_three", "p_c")); err != nil {
+		t.Fatalf("expected join after a room freed up to succeed, got %v", err)
+	}
+}
+
+func TestRoomHubRejectsJoinsBeyondParticipantLimit(t *testing.T) {
+	hub := newRoomHub(0, 2)
+
+	if _, err := hub.register(testRoomClient("vc_general", "p_a")); err != nil {
+		t.Fatalf("register first participant: %v", err)
+	}
+	if _, err := hub.register(testRoomClient("vc_general", "p_b")); err != nil {
+		t.Fatalf("expected the join that reaches the limit to succeed, got %v", err)
+	}
+	if _, err := hub.register(testRoomClient("vc_general", "p_c")); !errors.Is(err, ErrChannelFull) {
+		t.Fatalf("expected ErrChannelFull past the limit, got %v", err)
+	}
+	if count := hub.participantCount("vc_general"); count != 2 {
+		t.Fatalf("expected rejected join to leave 2 participants, got %d", count)
+	}
+	if _, err := hub.register(testRoomClient("vc_other", "p_c")); err != nil {
+		t.Fatalf("expected the limit to apply per room, got %v", err)
+	}
+
+	hub.unregister("vc_general", "p_a")
+	if _, err := hub.register(testRoomClient("vc_general", "p_c")); err != nil {
+		t.Fatalf("expected join after a participant left to succeed, got %v", err)
+	}
+	if _, _, err := hub.migrate("vc_other", "vc_general"); !errors.Is(err, ErrChannelFull) {
+		t.Fatalf("expected a migration past the limit to fail with ErrChannelFull, got %v", err)
+	}
+	if count := hub.participantCount("vc_other"); count != 1 {
+		t.Fatalf("expected a rejected migration to leave its source room intact, got %d", count)
+	}
+}
+
+func TestRoomSweepReclaimsStaleParticipants(t *testing.T) {
+	service := &SignalingService{rooms: newRoomHub(0, 0)}
+	now := time.Now()
+
+	quietA := testRoomClient("vc_stale", "p_quiet_a")
+	quietB := testRoomClient("vc_stale", "p_quiet_b")
+	live := testRoomClient("vc_live", "p_live")
+	closed := testRoomClient("vc_live", "p_closed")
+	for _, client := range []*wsClient{quietA, quietB, live, closed} {
+		service.rooms.register(client)
+	}
+	quietA.touch(now.Add(-2 * participantStaleAfter))
+	quietB.touch(now.Add(-participantStaleAfter - time.Second))
+	close(closed.closed)
+
+	if reclaimed := service.sweepRooms(now); reclaimed != 3 {
+		t.Fatalf("expected 3 stale participants reclaimed, got %d", reclaimed)
+	}
+	if count := service.rooms.participantCount("vc_stale"); count != 0 {
+		t.Fatalf("expected stale room to be emptied, got %d participants", count)
+	}
+	service.rooms.mu.RLock()
+	_, staleRoomKept := service.rooms.rooms["vc_stale"]
+	service.rooms.mu.RUnlock()
+	if staleRoomKept {
+		t.Fatalf("expected the sweep to delete the empty room")
+	}
+	if count := service.rooms.participantCount("vc_live"); count != 1 {
+		t.Fatalf("expected the live participant to remain, got %d", count)
+	}
+	if reclaimed := service.sweepRooms(now); reclaimed != 0 {
+		t.Fatalf("expected a second sweep to find nothing, got %d", reclaimed)
+	}
+}
+
+func TestUpdateParticipantPermissionsBroadcastsUpdate(t *testing.T) {
+	service := &SignalingService{rooms: newRoomHub(0, 0)}
+
+	target := testRoomClient("vc_general", "p_target")
+	target.participant.Permissions = Permissions{Speak: true, Video: true, Screenshare: true}
+	peer := testRoomClient("vc_general", "p_peer")
+	service.rooms.register(target)
+	service.rooms.register(peer)
+
+	muted := Permissions{Speak: false, Video: true, Screenshare: true}
+	if updated := service.UpdateParticipantPermissions("vc_general", "uid_p_target", muted); updated != 1 {
+		t.Fatalf("expected 1 participant updated, got %d", updated)
+	}
+	if target.permissions() != muted {
+		t.Fatalf("expected target permissions %+v, got %+v", muted, target.permissions())
+	}
+
+	select {
+	case envelope := <-peer.send:
+		if envelope.Type != "rtc.participant.updated" {
+			t.Fatalf("expected rtc.participant.updated, got %s", envelope.Type)
+		}
+	default:
+		t.Fatalf("expected peer to receive participant update")
+	}
+
+	if updated := service.UpdateParticipantPermissions("vc_general", "uid_p_target", muted); updated != 0 {
+		t.Fatalf("expected unchanged permissions to skip broadcast, got %d updates", updated)
+	}
+}
+
+func TestSubscribeRequestListsPublishedStreams(t *testing.T) {
+	service := &SignalingService{rooms: newRoomHub(0, 0)}
+
+	publisher := testRoomClient("vc_general", "p_publisher")
+	publisher.service = service
+	publisher.participant.Permissions = Permissions{Speak: true}
+	subscriber := testRoomClient("vc_general", "p_subscriber")
+	subscriber.service = service
+	service.rooms.register(publisher)
+	service.rooms.register(subscriber)
+
+	publisher.handleEnvelope(NewEnvelope("rtc.media.state", "vc_general", "media_1", map[string]any{
+		"stream_id":   "stream_mic",
+		"stream_kind": "audio_pcm_s16le_48k_mono",
+	}))
+	if envelope := <-subscriber.send; envelope.Type != EventParticipantUpdated {
+		t.Fatalf("expected rtc.participant.updated, got %s", envelope.Type)
+	}
+	<-subscriber.send
+
+	subscriber.handleEnvelope(NewEnvelope("rtc.subscribe.request", "vc_general", "sub_1", nil))
+	envelope := <-subscriber.send
+	if envelope.Type != "rtc.subscribe.available" {
+		t.Fatalf("expected rtc.subscribe.available, got %s", envelope.Type)
+	}
+	var payload struct {
+		Streams []PublishedStream `json:"streams"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		t.Fatalf("decode available streams: %v", err)
+	}
+	if len(payload.Streams) != 1 {
+		t.Fatalf("expected 1 available stream, got %d", len(payload.Streams))
+	}
+	stream := payload.Streams[0]
+	if stream.ParticipantID != "p_publisher" || stream.StreamID != "stream_mic" || stream.StreamKind != "audio_pcm_s16le_48k_mono" {
+		t.Fatalf("unexpected stream %+v", stream)
+	}
+
+	service.rooms.unregister("vc_general", "p_publisher")
+	subscriber.handleEnvelope(NewEnvelope("rtc.subscribe.request", "vc_general", "sub_2", nil))
+	envelope = <-subscriber.send
+	payload.Streams = nil
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		t.Fatalf("decode available streams: %v", err)
+	}
+	if len(payload.Streams) != 0 {
+		t.Fatalf("expected streams to be dropped when publisher leaves, got %d", len(payload.Streams))
+	}
+}
+
+func TestModeratorMuteBlocksTargetAudio(t *testing.T) {
+	service := &SignalingService{rooms: newRoomHub(0, 0)}
+
+	moderator := testRoomClient("vc_general", "p_moderator")
+	moderator.service = service
+	moderator.participant.Permissions = Permissions{Speak: true, Moderator: true}
+	target := testRoomClient("vc_general", "p_target")
+	target.service = service
+	target.participant.Permissions = Permissions{Speak: true}
+	service.rooms.register(moderator)
+	service.rooms.register(target)
+
+	expectEvent := func(client *wsClient, eventType EventType) Envelope {
+		t.Helper()
+		select {
+		case envelope := <-client.send:
+			if envelope.Type != eventType {
+				t.Fatalf("expected %s, got %s: %s", eventType, envelope.Type, envelope.Payload)
+			}
+			return envelope
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", eventType)
+		}
+		return Envelope{}
+	}
+	sendAudio := func() {
+		target.handleEnvelope(NewEnvelope(EventMediaState, "vc_general", "audio", map[string]any{
+			"stream_id":   "stream_mic",
+			"stream_kind": "audio_pcm_s16le_48k_mono",
+		}))
+	}
+	muteRequest := func(eventType EventType) Envelope {
+		return NewEnvelope(eventType, "vc_general", "mod", map[string]any{"target_participant_id": "p_target"})
+	}
+
+	target.handleEnvelope(NewEnvelope(EventModerationMute, "vc_general", "mod", map[string]any{"target_participant_id": "p_moderator"}))
+	if envelope := expectEvent(target, EventError); !containsCode(envelope, "rtc_forbidden") {
+		t.Fatalf("expected rtc_forbidden for a non-moderator, got %s", envelope.Payload)
+	}
+
+	moderator.handleEnvelope(muteRequest(EventModerationMute))
+	muted := expectEvent(target, EventParticipantMuted)
+	expectEvent(moderator, EventParticipantMuted)
+	if !containsField(muted, "participant_id", "p_target") {
+		t.Fatalf("unexpected mute payload %s", muted.Payload)
+	}
+
+	sendAudio()
+	if envelope := expectEvent(target, EventError); !containsCode(envelope, "rtc_media_denied") {
+		t.Fatalf("expected rtc_media_denied while muted, got %s", envelope.Payload)
+	}
+
+	// Reconnecting under a new participant id keeps the user muted.
+	service.rooms.unregister("vc_general", "p_target")
+	target = testRoomClient("vc_general", "p_target_rejoined")
+	target.service = service
+	target.participant.UserUID = "uid_p_target"
+	target.participant.Permissions = Permissions{Speak: true}
+	service.rooms.register(target)
+	sendAudio()
+	if envelope := expectEvent(target, EventError); !containsCode(envelope, "rtc_media_denied") {
+		t.Fatalf("expected rtc_media_denied after reconnecting, got %s", envelope.Payload)
+	}
+
+	muteRequest = func(eventType EventType) Envelope {
+		return NewEnvelope(eventType, "vc_general", "mod", map[string]any{"target_participant_id": "p_target_rejoined"})
+	}
+	moderator.handleEnvelope(muteRequest(EventModerationUnmute))
+	expectEvent(target, EventParticipantUnmuted)
+	expectEvent(moderator, EventParticipantUnmuted)
+	sendAudio()
+	expectEvent(target, EventParticipantUpdated)
+}
+
+func containsCode(envelope Envelope, code string) bool {
+	return containsField(envelope, "code", code)
+}
+
+func containsField(envelope Envelope, field string, value string) bool {
+	var payload map[string]any
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil {
+		return false
+	}
+	got, _ := payload[field].(string)
+	return got == value
+}
+
+func TestJitteredPingIntervalStaysWithinBounds(t *testing.T) {
+	seen := make(map[time.Duration]struct{})
+	for i := 0; i < 200; i++ {
+		interval := jitteredPingInterval()
+		if interval < pingInterval-pingJitter || interval > pingInterval+pingJitter {
+			t.Fatalf("interval %s outside [%s, %s]", interval, pingInterval-pingJitter, pingInterval+pingJitter)
+		}
+		seen[interval] = struct{}{}
+	}
+	if len(seen) < 2 {
+		t.Fatalf("expected jitter to vary the ping interval")
+	}
+}
+
+func TestSpeakingReportsAreDebouncedPerParticipant(t *testing.T) {
+	service := &SignalingService{rooms: newRoomHub(0, 0)}
+	speaker := testRoomClient("vc_general", "p_speaker")
+	speaker.service = service
+	speaker.participant.Permissions = Permissions{Speak: true}
+	listener := testRoomClient("vc_general", "p_listener")
+	listener.service = service
+	service.rooms.register(speaker)
+	service.rooms.register(listener)
+
+	speak := func(client *wsClient, speaking bool) {
+		client.handleEnvelope(NewEnvelope(EventMediaSpeaking, "vc_general", "", map[string]any{"speaking": speaking, "level": 140}))
+	}
+	nextSpeaking := func() Envelope {
+		t.Helper()
+		select {
+		case envelope := <-listener.send:
+			if envelope.Type != EventParticipantSpeaking {
+				t.Fatalf("expected %s, got %s", EventParticipantSpeaking, envelope.Type)
+			}
+			return envelope
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", EventParticipantSpeaking)
+		}
+		return Envelope{}
+	}
+	decode := func(envelope Envelope) (bool, float64) {
+		var payload map[string]any
+		_ = json.Unmarshal(envelope.Payload, &payload)
+		speaking, _ := payload["speaking"].(bool)
+		level, _ := payload["level"].(float64)
+		return speaking, level
+	}
+
+	speak(speaker, true)
+	if first := nextSpeaking(); !containsField(first, "participant_id", "p_speaker") {
+		t.Fatalf("unexpected speaking payload %s", first.Payload)
+	} else if speaking, level := decode(first); !speaking || level != 100 {
+		t.Fatalf("expected speaking at clamped level 100, got %v %v", speaking, level)
+	}
+
+	speak(speaker, false)
+	speak(speaker, true)
+	speak(speaker, false)
+	if speaking, _ := decode(nextSpeaking()); speaking {
+		t.Fatalf("expected rapid flips to collapse to the last state")
+	}
+	select {
+	case envelope := <-listener.send:
+		t.Fatalf("expected a single collapsed broadcast, got %s %s", envelope.Type, envelope.Payload)
+	case <-time.After(2 * speakingDebounce):
+	}
+
+	speak(listener, true)
+	select {
+	case envelope := <-listener.send:
+		if !containsCode(envelope, "rtc_media_denied") {
+			t.Fatalf("expected rtc_media_denied without speak permission, got %s", envelope.Payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("timed out waiting for rtc_media_denied")
+	}
+}
+
+func TestCompressedMediaChunkIsRelayedIntact(t *testing.T) {
+	service := &SignalingService{rooms: newRoomHub(0, 0)}
+	sender := testRoomClient("vc_general", "p_sender")
+	sender.service = service
+	sender.participant.Permissions = Permissions{Speak: true}
+	peer := testRoomClient("vc_general", "p_peer")
+	peer.service = service
+	service.rooms.register(sender)
+	service.rooms.register(peer)
+
+	original := bytes.Repeat([]byte{0x00, 0x01, 0x02, 0x03}, 512)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write(original)
+	_ = zw.Close()
+	chunkB64 := base64.StdEncoding.EncodeToString(compressed.Bytes())
+
+	nextEnvelope := func(client *wsClient) Envelope {
+		t.Helper()
+		for {
+			select {
+			case envelope := <-client.send:
+				if envelope.Type == EventParticipantUpdated {
+					continue
+				}
+				return envelope
+			case <-time.After(time.Second):
+				t.Fatalf("timed out waiting for an envelope")
+			}
+		}
+	}
+
+	sender.handleEnvelope(NewEnvelope(EventMediaState, "vc_general", "chunk_0", map[string]any{
+		"stream_id":      "stream_file",
+		"stream_kind":    "audio_file_chunks",
+		"seq":            0,
+		"chunk_b64":      chunkB64,
+		"chunk_encoding": ChunkEncodingGzipBase64,
+	}))
+	relayed := nextEnvelope(peer)
+	if relayed.Type != EventMediaState || !containsField(relayed, "chunk_encoding", ChunkEncodingGzipBase64) || !containsField(relayed, "chunk_b64", chunkB64) {
+		t.Fatalf("expected the compressed chunk relayed as sent, got %s %s", relayed.Type, relayed.Payload)
+	}
+	var payload struct {
+		ChunkB64 string `json:"chunk_b64"`
+	}
+	_ = json.Unmarshal(relayed.Payload, &payload)
+	raw, _ := base64.StdEncoding.DecodeString(payload.ChunkB64)
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("open relayed gzip chunk: %v", err)
+	}
+	if decoded, err := io.ReadAll(zr); err != nil || !bytes.Equal(decoded, original) {
+		t.Fatalf("relayed chunk did not decompress to the original bytes: %v", err)
+	}
+	if echoed := nextEnvelope(sender); echoed.Type != EventMediaState {
+		t.Fatalf("expected the sender's own media state echo, got %s", echoed.Type)
+	}
+
+	sender.handleEnvelope(NewEnvelope(EventMediaState, "vc_general", "chunk_1", map[string]any{
+		"stream_id":      "stream_file",
+		"stream_kind":    "audio_file_chunks",
+		"chunk_b64":      chunkB64,
+		"chunk_encoding": "brotli",
+	}))
+	if envelope := nextEnvelope(sender); envelope.Type != EventError || !containsCode(envelope, "rtc_invalid_payload") {
+		t.Fatalf("expected rtc_invalid_payload for an unknown encoding, got %s %s", envelope.Type, envelope.Payload)
+	}
+}
+
+func TestEventAllowlistRejectsDisabledEvents(t *testing.T) {
+	service := NewSignalingService(slog.Default(), nil, SignalingOptions{
+		EnabledEvents: []string{"rtc.media.state", "rtc.not_an_event"},
+	})
+	client := testRoomClient("vc_general", "p_client")
+	client.service = service
+	client.participant.Permissions = Permissions{Speak: true, Screenshare: true}
+	service.rooms.register(client)
+
+	next := func() Envelope {
+		t.Helper()
+		select {
+		case envelope := <-client.send:
+			return envelope
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for an envelope")
+		}
+		return Envelope{}
+	}
+
+	client.handleEnvelope(NewEnvelope(EventMediaSpeaking, "vc_general", "speak", map[string]any{"speaking": true}))
+	if envelope := next(); envelope.Type != EventError || !containsCode(envelope, "rtc_event_disabled") {
+		t.Fatalf("expected rtc_event_disabled, got %s %s", envelope.Type, envelope.Payload)
+	}
+	client.handleEnvelope(NewEnvelope(EventMediaState, "vc_general", "state", map[string]any{"muted": true}))
+	if envelope := next(); envelope.Type != EventMediaState {
+		t.Fatalf("expected allowlisted media state to relay, got %s %s", envelope.Type, envelope.Payload)
+	}
+	client.handleEnvelope(NewEnvelope(EventPing, "vc_general", "ping", nil))
+	if envelope := next(); envelope.Type != EventPong {
+		t.Fatalf("expected ping to stay enabled, got %s %s", envelope.Type, envelope.Payload)
+	}
+	if !NewSignalingService(slog.Default(), nil, SignalingOptions{}).EventEnabled(EventMediaSpeaking) {
+		t.Fatalf("expected every event enabled without an allowlist")
+	}
+}
+
+func TestSlowConsumerIsDisconnectedAfterConsecutiveDrops(t *testing.T) {
+	service := NewSignalingService(slog.Default(), nil, SignalingOptions{SlowConsumerDrops: 2})
+	client := testRoomClient("vc_general", "p_slow")
+	client.service = service
+	client.send = make(chan Envelope, 1)
+	client.closeNotice = make(chan closeNotice, 1)
+
+	pong := NewEnvelope(EventPong, "vc_general", "", nil)
+	client.enqueue(pong)
+	client.enqueue(pong)
+	if len(client.closeNotice) != 0 {
+		t.Fatalf("expected one drop to stay under the threshold")
+	}
+	client.enqueue(pong)
+	select {
+	case notice := <-client.closeNotice:
+		if notice.reason != "slow_consumer" || !containsCode(notice.envelope, "slow_consumer") {
+			t.Fatalf("expected a slow_consumer close, got %+v", notice)
+		}
+	default:
+		t.Fatalf("expected the participant to be disconnected as a slow consumer")
+	}
+	if dropped := service.Health().DroppedMessages; dropped != 2 {
+		t.Fatalf("expected 2 dropped messages, got %d", dropped)
+	}
+}
@@ -0,0 +1,89 @@
+package rtc
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// speakingDebounce is the minimum gap between rtc.participant.speaking
+// broadcasts for one participant; reports inside it collapse to the latest.
+const speakingDebounce = 300 * time.Millisecond
+
+type speakingReport struct {
+	Speaking bool
+	Level    int
+}
+
+type speakingState struct {
+	mu      sync.Mutex
+	pending speakingReport
+	sent    speakingReport
+	hasSent bool
+	sentAt  time.Time
+	timer   *time.Timer
+}
+
+// handleMediaSpeaking relays a client's voice activity to the room as
+// rtc.participant.speaking, debounced per participant.
+func (c *wsClient) handleMediaSpeaking(envelope Envelope) {
+	if !c.permissions().Speak {
+		c.sendError(envelope.RequestID, "rtc_media_denied", "participant is not allowed to speak", false)
+		return
+	}
+	if c.forceMuted() {
+		c.sendError(envelope.RequestID, "rtc_media_denied", "participant was muted by a moderator", false)
+		return
+	}
+	var payload struct {
+		Speaking *bool `json:"speaking"`
+		Level    int   `json:"level"`
+	}
+	if err := json.Unmarshal(envelope.Payload, &payload); err != nil || payload.Speaking == nil {
+		c.sendError(envelope.RequestID, "rtc_invalid_payload", "speaking is required", false)
+		return
+	}
+	c.reportSpeaking(speakingReport{Speaking: *payload.Speaking, Level: min(max(payload.Level, 0), 100)})
+}
+
+func (c *wsClient) reportSpeaking(report speakingReport) {
+	state := &c.speaking
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.pending = report
+	if state.timer != nil {
+		return
+	}
+	wait := speakingDebounce - time.Since(state.sentAt)
+	if wait <= 0 {
+		c.flushSpeakingLocked()
+		return
+	}
+	state.timer = time.AfterFunc(wait, func() {
+		state.mu.Lock()
+		defer state.mu.Unlock()
+		state.timer = nil
+		c.flushSpeakingLocked()
+	})
+}
+
+func (c *wsClient) flushSpeakingLocked() {
+	state := &c.speaking
+	if state.hasSent && state.sent == state.pending {
+		return
+	}
+	select {
+	case <-c.closed:
+		return
+	default:
+	}
+	state.sent = state.pending
+	state.hasSent = true
+	state.sentAt = time.Now()
+	c.service.rooms.broadcast(c.channelID(), NewEnvelope(EventParticipantSpeaking, c.channelID(), "", map[string]any{
+		"participant_id": c.participant.ParticipantID,
+		"user_uid":       c.participant.UserUID,
+		"speaking":       state.sent.Speaking,
+		"level":          state.sent.Level,
+	}), "")
+}
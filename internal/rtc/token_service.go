@@ -18,14 +18,22 @@ var (
 	ErrInvalidTicket = errors.New("invalid join ticket")
 	ErrExpiredTicket = errors.New("join ticket expired")
 	ErrReplayTicket  = errors.New("join ticket replayed")
+	ErrTicketBinding = errors.New("join ticket is bound to a different device or nonce")
+	// ErrTicketRefreshExpired is returned by Refresh for tickets that expired
+	// more than TicketRefreshGrace ago.
+	ErrTicketRefreshExpired = errors.New("join ticket expired beyond the refresh grace window")
 )
 
+// TicketRefreshGrace is how long after expiry a ticket can still be refreshed.
+const TicketRefreshGrace = 5 * time.Minute
+
 type IssueTicketInput struct {
 	ServerID    string
 	ChannelID   string
 	UserUID     string
 	DeviceID    string
 	Permissions Permissions
+	Nonce       string
 }
 
 type TokenService struct {
@@ -47,29 +55,71 @@ func (s *TokenService) Issue(input IssueTicketInput) (string, TicketClaims, erro
 	if strings.TrimSpace(input.ServerID) == "" || strings.TrimSpace(input.ChannelID) == "" {
 		return "", TicketClaims{}, fmt.Errorf("server and channel ids are required")
 	}
-	now := time.Now().UTC()
-	claims := TicketClaims{
+	return s.sign(TicketClaims{
 		ServerID:    input.ServerID,
 		ChannelID:   input.ChannelID,
 		UserUID:     input.UserUID,
 		DeviceID:    input.DeviceID,
 		Permissions: input.Permissions,
-		IssuedAt:    now.Unix(),
-		ExpiresAt:   now.Add(s.ttl).Unix(),
-		JTI:         uuid.NewString(),
+		Nonce:       strings.TrimSpace(input.Nonce),
+	})
+}
+
+// Refresh reissues a still-valid or recently expired ticket with the same
+// claims, a new JTI, and a new expiry. The old ticket's replay slot is left
+// untouched, so it can still be used to join until it expires.
+func (s *TokenService) Refresh(ticket string) (string, TicketClaims, error) {
+	claims, err := s.parse(ticket)
+	if err != nil {
+		return "", TicketClaims{}, err
+	}
+	if claims.ExpiresAt+int64(TicketRefreshGrace/time.Second) <= time.Now().UTC().Unix() {
+		return "", TicketClaims{}, ErrTicketRefreshExpired
 	}
+	return s.sign(claims)
+}
+
+// sign stamps claims with a fresh JTI and validity window and encodes them.
+func (s *TokenService) sign(claims TicketClaims) (string, TicketClaims, error) {
+	now := time.Now().UTC()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(s.ttl).Unix()
+	claims.JTI = uuid.NewString()
 
 	payloadBytes, err := json.Marshal(claims)
 	if err != nil {
 		return "", TicketClaims{}, fmt.Errorf("marshal claims: %w", err)
 	}
 	payloadEncoded := base64.RawURLEncoding.EncodeToString(payloadBytes)
-	signatureEncoded := base64.RawURLEncoding.EncodeToString(s.sign(payloadEncoded))
+	signatureEncoded := base64.RawURLEncoding.EncodeToString(s.mac(payloadEncoded))
 
 	return payloadEncoded + "." + signatureEncoded, claims, nil
 }
 
 func (s *TokenService) ParseAndConsume(ticket string) (TicketClaims, error) {
+	claims, err := s.parse(ticket)
+	if err != nil {
+		return TicketClaims{}, err
+	}
+
+	now := time.Now().UTC().Unix()
+	if claims.ExpiresAt <= now {
+		return TicketClaims{}, ErrExpiredTicket
+	}
+
+	s.usedMutex.Lock()
+	defer s.usedMutex.Unlock()
+	s.gcUsedJTIs(now)
+	if _, exists := s.usedJTIs[claims.JTI]; exists {
+		return TicketClaims{}, ErrReplayTicket
+	}
+	s.usedJTIs[claims.JTI] = claims.ExpiresAt
+
+	return claims, nil
+}
+
+// parse verifies the signature and decodes the claims without checking expiry.
+func (s *TokenService) parse(ticket string) (TicketClaims, error) {
 	parts := strings.Split(ticket, ".")
 	if len(parts) != 2 {
 		return TicketClaims{}, ErrInvalidTicket
@@ -82,7 +132,7 @@ func (s *TokenService) ParseAndConsume(ticket string) (TicketClaims, error) {
 		return TicketClaims{}, ErrInvalidTicket
 	}
 
-	expected := s.sign(payloadEncoded)
+	expected := s.mac(payloadEncoded)
 	if !hmac.Equal(signature, expected) {
 		return TicketClaims{}, ErrInvalidTicket
 	}
@@ -96,24 +146,10 @@ func (s *TokenService) ParseAndConsume(ticket string) (TicketClaims, error) {
 	if err := json.Unmarshal(payloadBytes, &claims); err != nil {
 		return TicketClaims{}, ErrInvalidTicket
 	}
-
-	now := time.Now().UTC().Unix()
-	if claims.ExpiresAt <= now {
-		return TicketClaims{}, ErrExpiredTicket
-	}
-
-	s.usedMutex.Lock()
-	defer s.usedMutex.Unlock()
-	s.gcUsedJTIs(now)
-	if _, exists := s.usedJTIs[claims.JTI]; exists {
-		return TicketClaims{}, ErrReplayTicket
-	}
-	s.usedJTIs[claims.JTI] = claims.ExpiresAt
-
 	return claims, nil
 }
 
-func (s *TokenService) sign(payloadEncoded string) []byte {
+func (s *TokenService) mac(payloadEncoded string) []byte {
 	mac := hmac.New(sha256.New, s.secret)
 	_, _ = mac.Write([]byte(payloadEncoded))
 	return mac.Sum(nil)
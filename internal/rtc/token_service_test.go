@@ -35,3 +35,46 @@ func TestIssueParseAndConsumeTicket(t *testing.T) {
 		t.Fatalf("expected replay error, got: %v", err)
 	}
 }
+
+func TestRefreshPreservesClaimsWithinGraceWindow(t *testing.T) {
+	input := IssueTicketInput{
+		ServerID:    "srv_local",
+		ChannelID:   "vc_general",
+		UserUID:     "uid_a",
+		DeviceID:    "dev_a",
+		Permissions: Permissions{Speak: true, Moderator: true},
+		Nonce:       "nonce_a",
+	}
+	recentlyExpired := NewTokenService("unit-test-secret", -time.Minute)
+	ticket, original, err := recentlyExpired.Issue(input)
+	if err != nil {
+		t.Fatalf("issue ticket failed: %v", err)
+	}
+
+	svc := NewTokenService("unit-test-secret", time.Minute)
+	refreshed, claims, err := svc.Refresh(ticket)
+	if err != nil {
+		t.Fatalf("refresh within grace failed: %v", err)
+	}
+	if claims.JTI == original.JTI || claims.ExpiresAt <= time.Now().Unix() {
+		t.Fatalf("expected a new jti and a future expiry, got %+v", claims)
+	}
+	if claims.UserUID != input.UserUID || claims.DeviceID != input.DeviceID || claims.Nonce != input.Nonce || claims.Permissions != input.Permissions {
+		t.Fatalf("refresh changed claims: %+v", claims)
+	}
+	if _, err := svc.ParseAndConsume(refreshed); err != nil {
+		t.Fatalf("refreshed ticket should be usable: %v", err)
+	}
+
+	longExpired := NewTokenService("unit-test-secret", -TicketRefreshGrace-time.Minute)
+	stale, _, err := longExpired.Issue(input)
+	if err != nil {
+		t.Fatalf("issue ticket failed: %v", err)
+	}
+	if _, _, err := svc.Refresh(stale); err != ErrTicketRefreshExpired {
+		t.Fatalf("expected ErrTicketRefreshExpired, got %v", err)
+	}
+	if _, _, err := svc.Refresh(ticket + "x"); err != ErrInvalidTicket {
+		t.Fatalf("expected ErrInvalidTicket for a tampered ticket, got %v", err)
+	}
+}
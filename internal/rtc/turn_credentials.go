@@ -0,0 +1,53 @@
+package rtc
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type TurnCredential struct {
+	Username   string
+	Credential string
+	ExpiresAt  time.Time
+}
+
+// TurnCredentialService mints time-limited TURN credentials using the coturn
+// REST API convention (use-auth-secret): the username is "<expiry>:<userUID>"
+// and the credential is the base64 HMAC-SHA1 of the username under the
+// secret shared with the TURN server.
+type TurnCredentialService struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func NewTurnCredentialService(secret string, ttl time.Duration) *TurnCredentialService {
+	if ttl <= 0 {
+		ttl = time.Hour
+	}
+	return &TurnCredentialService{
+		secret: []byte(strings.TrimSpace(secret)),
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Issue reports false when no secret is configured.
+func (s *TurnCredentialService) Issue(userUID string) (TurnCredential, bool) {
+	if len(s.secret) == 0 {
+		return TurnCredential{}, false
+	}
+	expiresAt := s.now().Add(s.ttl).UTC().Truncate(time.Second)
+	username := strconv.FormatInt(expiresAt.Unix(), 10) + ":" + strings.TrimSpace(userUID)
+	mac := hmac.New(sha1.New, s.secret)
+	_, _ = mac.Write([]byte(username))
+	return TurnCredential{
+		Username:   username,
+		Credential: base64.StdEncoding.EncodeToString(mac.Sum(nil)),
+		ExpiresAt:  expiresAt,
+	}, true
+}
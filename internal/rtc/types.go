@@ -9,6 +9,8 @@ type Permissions struct {
 	Speak       bool `json:"speak"`
 	Video       bool `json:"video"`
 	Screenshare bool `json:"screenshare"`
+	// Moderator allows rtc.moderation.mute and rtc.moderation.unmute.
+	Moderator bool `json:"moderator"`
 }
 
 type TicketClaims struct {
@@ -17,6 +19,7 @@ type TicketClaims struct {
 	UserUID     string      `json:"user_uid"`
 	DeviceID    string      `json:"device_id"`
 	Permissions Permissions `json:"permissions"`
+	Nonce       string      `json:"nonce,omitempty"`
 	ExpiresAt   int64       `json:"exp"`
 	IssuedAt    int64       `json:"iat"`
 	JTI         string      `json:"jti"`
@@ -31,14 +34,34 @@ type Participant struct {
 	JoinedAt      time.Time   `json:"joined_at"`
 }
 
+type RosterEntry struct {
+	Participant
+	ICECandidateTypes map[string]int `json:"ice_candidate_types"`
+	ActiveStreamKinds []string       `json:"active_stream_kinds"`
+}
+
+type PublishedStream struct {
+	ParticipantID string `json:"participant_id"`
+	UserUID       string `json:"user_uid"`
+	StreamID      string `json:"stream_id"`
+	StreamKind    string `json:"stream_kind"`
+}
+
+type RoomStats struct {
+	ChannelID        string `json:"channel_id"`
+	Participants     int    `json:"participants"`
+	PeakParticipants int    `json:"peak_participants"`
+	TotalJoins       int64  `json:"total_joins"`
+}
+
 type Envelope struct {
-	Type      string          `json:"type"`
+	Type      EventType       `json:"type"`
 	RequestID string          `json:"request_id,omitempty"`
 	ChannelID string          `json:"channel_id,omitempty"`
 	Payload   json.RawMessage `json:"payload,omitempty"`
 }
 
-func NewEnvelope(eventType string, channelID string, requestID string, payload any) Envelope {
+func NewEnvelope(eventType EventType, channelID string, requestID string, payload any) Envelope {
 	rawPayload := json.RawMessage("{}")
 	if payload != nil {
 		encoded, err := json.Marshal(payload)